@@ -4,8 +4,10 @@ go 1.14
 
 require (
 	github.com/facebookgo/symwalk v0.0.0-20150726040526-42004b9f3222
+	github.com/hashicorp/go-getter v1.4.2-0.20200106182914-9813cbd4eb02
 	github.com/hashicorp/go-hclog v0.9.2
 	github.com/hashicorp/go-plugin v1.3.0
+	github.com/hashicorp/go-tfe v0.8.1
 	github.com/hashicorp/go-version v1.2.0
 	github.com/hashicorp/hcl/v2 v2.6.0
 	github.com/hashicorp/terraform v0.13.2
@@ -13,7 +15,9 @@ require (
 	github.com/mitchellh/cli v1.0.0
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db
 	github.com/mitchellh/go-homedir v1.1.0
+	github.com/open-policy-agent/opa v0.24.0
 	github.com/zclconf/go-cty v1.5.1
+	github.com/zclconf/go-cty-yaml v1.0.2
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 )
 
@@ -21,7 +21,7 @@ import (
 )
 
 // GetTerraspec computes the path of the terraspec executable.
-// If it cannot be found it is build.
+// It is built from the sources of rootDir every time.
 func GetTerraspec(t *testing.T, rootDir string) string {
 	terraspecFileName := "terraspec"
 	if runtime.GOOS == "windows" {
@@ -29,15 +29,10 @@ func GetTerraspec(t *testing.T, rootDir string) string {
 	}
 	terraspecPath := rootDir + "/" + terraspecFileName
 
-	_, err := os.Stat(terraspecPath)
-	if os.IsNotExist(err) {
-		changeBack := Chdir(t, rootDir)
-		defer changeBack()
-
-		buildTerraspec(t, terraspecFileName)
-	} else if err != nil {
-		t.Fatalf("Could not stat file %s: %v", terraspecPath, err)
-	}
+	// the executable is always built again, so the tests never run one left by a previous build
+	changeBack := Chdir(t, rootDir)
+	defer changeBack()
+	buildTerraspec(t, terraspecFileName)
 
 	return terraspecPath
 }
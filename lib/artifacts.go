@@ -0,0 +1,84 @@
+package terraspec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// Retentions of the temporary folders created for the test cases, see Options.KeepArtifacts
+const (
+	// KeepArtifactsNever removes the temporary folders of every test case once it completed
+	KeepArtifactsNever = "never"
+	// KeepArtifactsOnFailure keeps the temporary folders of the failing test cases, to debug them
+	KeepArtifactsOnFailure = "on-failure"
+	// KeepArtifactsAlways keeps the temporary folders of every test case
+	KeepArtifactsAlways = "always"
+)
+
+var artifactRetentions = map[string]bool{
+	"":                     true,
+	KeepArtifactsNever:     true,
+	KeepArtifactsOnFailure: true,
+	KeepArtifactsAlways:    true,
+}
+
+// caseArtifacts owns the temporary folders created for a test case, eg its harness or its workdir,
+// which are removed or kept once the test case completed
+type caseArtifacts struct {
+	// parent is the folder the temporary folders are created in. Empty means the temporary folder of the system
+	parent string
+	// name is the name of the test case, in the name of the temporary folders so kept ones can be told apart
+	name string
+	dirs []string
+}
+
+// tempDir creates a new temporary folder for the given purpose, eg harness
+func (a *caseArtifacts) tempDir(purpose string) (string, error) {
+	if a.parent != "" {
+		if err := os.MkdirAll(a.parent, 0755); err != nil {
+			return "", err
+		}
+	}
+	name := strings.NewReplacer("/", "_", "\\", "_", " ", "_").Replace(a.name)
+	dir, err := ioutil.TempDir(a.parent, fmt.Sprintf("terraspec-%s-%s-", name, purpose))
+	if err != nil {
+		return "", err
+	}
+	a.dirs = append(a.dirs, dir)
+	return dir, nil
+}
+
+// harness generates in a new temporary folder the root configuration calling the module found in moduleDir
+func (a *caseArtifacts) harness(moduleDir string) (*Harness, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	dir, err := a.tempDir("harness")
+	if err != nil {
+		return nil, diags.Append(err)
+	}
+	harness := &Harness{Dir: dir}
+	return harness, harness.generate(moduleDir)
+}
+
+// workdir copies the config found in dir in a new temporary folder
+func (a *caseArtifacts) workdir(dir string) (*Workdir, error) {
+	tmp, err := a.tempDir("workdir")
+	if err != nil {
+		return nil, err
+	}
+	return newWorkdirIn(dir, tmp)
+}
+
+// release removes the temporary folders, unless retention keeps them. It returns the folders kept
+func (a *caseArtifacts) release(retention string, failed bool) []string {
+	if retention == KeepArtifactsAlways || (retention == KeepArtifactsOnFailure && failed) {
+		return a.dirs
+	}
+	for _, dir := range a.dirs {
+		os.RemoveAll(dir)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package terraspec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCaseArtifactsRelease(t *testing.T) {
+	parent, err := ioutil.TempDir("", "terraspec-artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+
+	for name, tc := range map[string]struct {
+		retention string
+		failed    bool
+		kept      bool
+	}{
+		"default":             {"", true, false},
+		"never":               {KeepArtifactsNever, true, false},
+		"on failure, failed":  {KeepArtifactsOnFailure, true, true},
+		"on failure, passed":  {KeepArtifactsOnFailure, false, false},
+		"always":              {KeepArtifactsAlways, false, true},
+		"always, with a fail": {KeepArtifactsAlways, true, true},
+	} {
+		artifacts := &caseArtifacts{parent: filepath.Join(parent, "nested"), name: "nested/case"}
+		dir, err := artifacts.tempDir("harness")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Dir(dir) != filepath.Join(parent, "nested") || !strings.HasPrefix(filepath.Base(dir), "terraspec-nested_case-harness-") {
+			t.Errorf("%s : temporary folder should be named after the test case in the parent folder, got %s", name, dir)
+		}
+		kept := artifacts.release(tc.retention, tc.failed)
+		if _, err := os.Stat(dir); os.IsNotExist(err) == tc.kept {
+			t.Errorf("%s : expected folder kept to be %t, got %v", name, tc.kept, err)
+		}
+		if (len(kept) == 1 && kept[0] == dir) != tc.kept {
+			t.Errorf("%s : expected folder reported as kept to be %t, got %v", name, tc.kept, kept)
+		}
+	}
+}
+
+func TestRunSuiteKeepArtifacts(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-keep-artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"module/main.tf":               `output "size" { value = "size-1" }`,
+		"module/spec/pass/case.tfspec": `reject "output" "missing" {}`,
+		"module/spec/fail/case.tfspec": `assert "output" "missing" {}`,
+	})
+	artifactsDir := filepath.Join(root, "artifacts")
+
+	results, err := RunSuite(context.Background(), Options{Dir: filepath.Join(root, "module"), ModuleMode: true, KeepArtifacts: KeepArtifactsOnFailure, ArtifactsDir: artifactsDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results.Cases {
+		if r.Failed() != (r.Name == "fail") {
+			t.Errorf("Test case %s should fail only when named fail, got %v", r.Name, r.Diagnostics.Err())
+		}
+		if r.Failed() != (len(r.Artifacts) == 1) {
+			t.Errorf("Test case %s should keep its harness only when it fails, got %v", r.Name, r.Artifacts)
+		}
+		for _, dir := range r.Artifacts {
+			if _, err := os.Stat(filepath.Join(dir, "main.tf")); err != nil {
+				t.Errorf("Harness of test case %s should be kept, got %v", r.Name, err)
+			}
+		}
+	}
+	if entries, err := ioutil.ReadDir(artifactsDir); err != nil || len(entries) != 1 {
+		t.Errorf("Only the harness of the failing test case should be left, got %d folders, %v", len(entries), err)
+	}
+
+	if _, err := RunSuite(context.Background(), Options{Dir: filepath.Join(root, "module"), KeepArtifacts: "sometimes"}); err == nil {
+		t.Error("An unknown retention should be rejected")
+	}
+}
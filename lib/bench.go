@@ -0,0 +1,158 @@
+package terraspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"time"
+)
+
+// BenchPhases are the durations measured by a benchmark : the whole test case, then every phase of its Timings
+var BenchPhases = []string{"total", "config", "schemas", "refresh", "plan", "validate"}
+
+// benchNoise is the slowdown under which a phase is never reported as a regression, as short phases vary a lot between runs
+const benchNoise = 10 * time.Millisecond
+
+// Bench holds the durations of the test cases of a suite run several times, as stored in a baseline file
+type Bench struct {
+	Runs int `json:"runs"`
+	// Cases are sorted by name
+	Cases []*CaseBench `json:"cases"`
+}
+
+// CaseBench holds the durations of a test case over all the runs of a benchmark
+type CaseBench struct {
+	Name string `json:"name"`
+	// Phases holds the statistics of every phase of BenchPhases
+	Phases map[string]*DurationStats `json:"phases"`
+}
+
+// DurationStats summarizes the durations of a phase over several runs
+type DurationStats struct {
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+}
+
+// NewBench computes the statistics of the test cases run by every given run of the suite.
+// Cached results are left out, as their durations come from an older run, and so are skipped test cases
+func NewBench(runs []*Results) *Bench {
+	durations := make(map[string]map[string][]time.Duration)
+	for _, results := range runs {
+		for _, c := range results.Cases {
+			if c.Cached || c.SkipReason != "" {
+				continue
+			}
+			if durations[c.Name] == nil {
+				durations[c.Name] = make(map[string][]time.Duration)
+			}
+			timings := c.Timings
+			if timings == nil {
+				timings = &Timings{}
+			}
+			for i, d := range []time.Duration{c.Duration, timings.ConfigLoad, timings.SchemaFetch, timings.Refresh, timings.Plan, timings.Validate} {
+				durations[c.Name][BenchPhases[i]] = append(durations[c.Name][BenchPhases[i]], d)
+			}
+		}
+	}
+
+	bench := &Bench{Runs: len(runs)}
+	for name, phases := range durations {
+		cb := &CaseBench{Name: name, Phases: make(map[string]*DurationStats)}
+		for phase, values := range phases {
+			cb.Phases[phase] = newDurationStats(values)
+		}
+		bench.Cases = append(bench.Cases, cb)
+	}
+	sort.Slice(bench.Cases, func(i, j int) bool { return bench.Cases[i].Name < bench.Cases[j].Name })
+	return bench
+}
+
+func newDurationStats(values []time.Duration) *DurationStats {
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, v := range sorted {
+		total += v
+	}
+	return &DurationStats{Mean: total / time.Duration(len(sorted)), P50: percentile(sorted, 0.5), P90: percentile(sorted, 0.9)}
+}
+
+// percentile returns the nearest-rank percentile p of the sorted values
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// Regression is a phase of a test case slower than in the baseline
+type Regression struct {
+	Case  string
+	Phase string
+	// Baseline and Current are the mean durations of the phase
+	Baseline time.Duration
+	Current  time.Duration
+}
+
+// Ratio returns how much slower the phase is, eg 0.5 when it takes 50% more time than in the baseline
+func (r *Regression) Ratio() float64 {
+	if r.Baseline == 0 {
+		return math.Inf(1)
+	}
+	return float64(r.Current-r.Baseline) / float64(r.Baseline)
+}
+
+// Compare returns the phases of the test cases whose mean duration grew by more than threshold, eg 0.2 for 20%, compared to baseline.
+// Slowdowns shorter than 10ms are ignored. Test cases missing from the baseline are not compared
+func (b *Bench) Compare(baseline *Bench, threshold float64) []*Regression {
+	previous := make(map[string]*CaseBench)
+	for _, c := range baseline.Cases {
+		previous[c.Name] = c
+	}
+	var regressions []*Regression
+	for _, c := range b.Cases {
+		base, ok := previous[c.Name]
+		if !ok {
+			continue
+		}
+		for _, phase := range BenchPhases {
+			current, before := c.Phases[phase], base.Phases[phase]
+			if current == nil || before == nil {
+				continue
+			}
+			if current.Mean-before.Mean > benchNoise && float64(current.Mean) > float64(before.Mean)*(1+threshold) {
+				regressions = append(regressions, &Regression{Case: c.Name, Phase: phase, Baseline: before.Mean, Current: current.Mean})
+			}
+		}
+	}
+	return regressions
+}
+
+// WriteBench stores bench in the baseline file found at path
+func WriteBench(path string, bench *Bench) error {
+	data, err := json.MarshalIndent(bench, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("Could not write baseline file %s : %v", path, err)
+	}
+	return nil
+}
+
+// ReadBench reads the baseline file found at path
+func ReadBench(path string) (*Bench, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read baseline file %s : %v", path, err)
+	}
+	bench := &Bench{}
+	if err := json.Unmarshal(data, bench); err != nil {
+		return nil, fmt.Errorf("Invalid baseline file %s : %v", path, err)
+	}
+	return bench, nil
+}
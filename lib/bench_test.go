@@ -0,0 +1,83 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func benchRun(prodPlan, devPlan time.Duration) *Results {
+	return &Results{Cases: []*CaseResult{
+		{Name: "prod", Duration: prodPlan + time.Second, Timings: &Timings{SchemaFetch: time.Second, Plan: prodPlan}},
+		{Name: "dev", Duration: devPlan, Timings: &Timings{Plan: devPlan}},
+		{Name: "cached", Duration: time.Hour, Cached: true},
+	}}
+}
+
+func TestNewBench(t *testing.T) {
+	var runs []*Results
+	for i := 1; i <= 10; i++ {
+		runs = append(runs, benchRun(time.Duration(i)*100*time.Millisecond, 50*time.Millisecond))
+	}
+	bench := NewBench(runs)
+	if bench.Runs != 10 || len(bench.Cases) != 2 {
+		t.Fatalf("Expected 2 test cases over 10 runs, got %d over %d runs", len(bench.Cases), bench.Runs)
+	}
+	if bench.Cases[0].Name != "dev" || bench.Cases[1].Name != "prod" {
+		t.Errorf("Expected test cases sorted by name, got %s and %s", bench.Cases[0].Name, bench.Cases[1].Name)
+	}
+	plan := bench.Cases[1].Phases["plan"]
+	if plan.Mean != 550*time.Millisecond || plan.P50 != 500*time.Millisecond || plan.P90 != 900*time.Millisecond {
+		t.Errorf("Unexpected plan statistics %+v", plan)
+	}
+	if schemas := bench.Cases[1].Phases["schemas"]; schemas.Mean != time.Second {
+		t.Errorf("Expected schemas to take 1s, got %+v", schemas)
+	}
+}
+
+func TestBenchCompare(t *testing.T) {
+	baseline := NewBench([]*Results{benchRun(time.Second, 5*time.Millisecond)})
+	current := NewBench([]*Results{benchRun(1500*time.Millisecond, 8*time.Millisecond)})
+	regressions := current.Compare(baseline, 0.2)
+	// dev is 60% slower, but by less than 10ms
+	if len(regressions) != 2 {
+		t.Fatalf("Expected the total and plan of prod to regress, got %d regressions", len(regressions))
+	}
+	for i, phase := range []string{"total", "plan"} {
+		if r := regressions[i]; r.Case != "prod" || r.Phase != phase {
+			t.Errorf("Expected regression of prod %s, got %s %s", phase, r.Case, r.Phase)
+		}
+	}
+	if ratio := regressions[1].Ratio(); ratio != 0.5 {
+		t.Errorf("Expected plan to be 50%% slower, got %v", ratio)
+	}
+	if regressions := current.Compare(baseline, 0.6); len(regressions) != 0 {
+		t.Errorf("Expected no regression above a 60%% threshold, got %d", len(regressions))
+	}
+}
+
+func TestBenchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-bench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "baseline.json")
+
+	bench := NewBench([]*Results{benchRun(time.Second, time.Second)})
+	if err := WriteBench(path, bench); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadBench(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Cases) != 2 || read.Cases[1].Phases["plan"].Mean != time.Second {
+		t.Errorf("Unexpected baseline read %+v", read)
+	}
+	if _, err := ReadBench(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error reading a missing baseline")
+	}
+}
@@ -0,0 +1,265 @@
+package terraspec
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/lang/blocktoattr"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// specBody returns body decoding the elements of schema the way they're written in the spec : like terraform does,
+// attributes holding a list or a set of objects can be written as blocks, and nested blocks can be written as attributes,
+// with an object, eg inner = { inner_prop = "x" }, or a list of objects for a block repeated several times.
+// Both syntaxes decode to the same value, so assertions are compared whatever the syntax the spec or the provider uses
+func specBody(body hcl.Body, schema *configschema.Block) hcl.Body {
+	return blocktoattr.FixUpBlockAttrs(&blockAttrsBody{Body: body}, schema)
+}
+
+// blockAttrsBody turns the nested blocks of body written as attributes into blocks
+type blockAttrsBody struct {
+	hcl.Body
+}
+
+func (b *blockAttrsBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	content, _, diags := b.content(schema, false)
+	return content, diags
+}
+
+func (b *blockAttrsBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	return b.content(schema, true)
+}
+
+func (b *blockAttrsBody) content(schema *hcl.BodySchema, partial bool) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	// the block types written as attributes are read as attributes from the original body, then turned into blocks
+	effective := &hcl.BodySchema{Attributes: schema.Attributes}
+	var asAttributes []string
+	for _, block := range schema.Blocks {
+		probe, _, _ := b.Body.PartialContent(&hcl.BodySchema{Attributes: []hcl.AttributeSchema{{Name: block.Type}}})
+		if _, ok := probe.Attributes[block.Type]; ok && len(block.LabelNames) == 0 {
+			asAttributes = append(asAttributes, block.Type)
+			effective.Attributes = append(effective.Attributes, hcl.AttributeSchema{Name: block.Type})
+		} else {
+			effective.Blocks = append(effective.Blocks, block)
+		}
+	}
+
+	var content *hcl.BodyContent
+	var remain hcl.Body
+	var diags hcl.Diagnostics
+	if partial {
+		content, remain, diags = b.Body.PartialContent(effective)
+		remain = &blockAttrsBody{Body: remain}
+	} else {
+		content, diags = b.Body.Content(effective)
+	}
+	if content == nil {
+		return content, remain, diags
+	}
+
+	for i, block := range content.Blocks {
+		nested := *block
+		nested.Body = &blockAttrsBody{Body: block.Body}
+		content.Blocks[i] = &nested
+	}
+	for _, name := range asAttributes {
+		attr, ok := content.Attributes[name]
+		if !ok {
+			continue
+		}
+		delete(content.Attributes, name)
+		blocks, blockDiags := attrBlocks(attr)
+		diags = append(diags, blockDiags...)
+		content.Blocks = append(content.Blocks, blocks...)
+	}
+	return content, remain, diags
+}
+
+// attrBlocks returns the blocks written with the attribute syntax by attr : an object is a single block,
+// and a list of objects is a block repeated for every object
+func attrBlocks(attr *hcl.Attribute) (hcl.Blocks, hcl.Diagnostics) {
+	exprs := []hcl.Expression{attr.Expr}
+	if list, diags := hcl.ExprList(attr.Expr); !diags.HasErrors() {
+		exprs = list
+	}
+	var blocks hcl.Blocks
+	var diags hcl.Diagnostics
+	for _, expr := range exprs {
+		pairs, mapDiags := hcl.ExprMap(expr)
+		if mapDiags.HasErrors() {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported block value",
+				Detail:   fmt.Sprintf("%s is a block : write it as a block, as an object or as a list of objects", attr.Name),
+				Subject:  expr.Range().Ptr(),
+			})
+			continue
+		}
+		body := &objectBody{attrs: make(hcl.Attributes, len(pairs)), rng: expr.Range()}
+		for _, pair := range pairs {
+			key, keyDiags := pair.Key.Value(nil)
+			if keyDiags.HasErrors() || !key.IsWhollyKnown() || key.IsNull() || key.Type() != cty.String {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid attribute name",
+					Detail:   fmt.Sprintf("The attribute names of a %s block written as an object must be static", attr.Name),
+					Subject:  pair.Key.Range().Ptr(),
+				})
+				continue
+			}
+			name := key.AsString()
+			body.attrs[name] = &hcl.Attribute{Name: name, Expr: pair.Value, Range: hcl.RangeBetween(pair.Key.Range(), pair.Value.Range()), NameRange: pair.Key.Range()}
+		}
+		blocks = append(blocks, &hcl.Block{Type: attr.Name, Body: body, DefRange: expr.Range(), TypeRange: attr.NameRange})
+	}
+	return blocks, diags
+}
+
+// objectBody is the body of a block written as an object. Its own nested blocks are objects as well
+type objectBody struct {
+	attrs hcl.Attributes
+	rng   hcl.Range
+}
+
+func (b *objectBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	content, remain, diags := b.PartialContent(schema)
+	var expected []string
+	for _, s := range schema.Attributes {
+		expected = append(expected, s.Name)
+	}
+	for _, s := range schema.Blocks {
+		expected = append(expected, s.Type)
+	}
+	var unsupported []string
+	for name := range remain.(*objectBody).attrs {
+		unsupported = append(unsupported, name)
+	}
+	sort.Strings(unsupported)
+	for _, name := range unsupported {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported argument",
+			Detail:   fmt.Sprintf("An argument named %q is not expected here.%s", name, didYouMean(name, expected)),
+			Subject:  b.attrs[name].NameRange.Ptr(),
+		})
+	}
+	return content, diags
+}
+
+func (b *objectBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	left := make(hcl.Attributes, len(b.attrs))
+	for name, attr := range b.attrs {
+		left[name] = attr
+	}
+	content := &hcl.BodyContent{Attributes: make(hcl.Attributes), MissingItemRange: b.rng}
+	for _, s := range schema.Attributes {
+		if attr, ok := left[s.Name]; ok {
+			content.Attributes[s.Name] = attr
+			delete(left, s.Name)
+		} else if s.Required {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing required argument",
+				Detail:   fmt.Sprintf("The argument %q is required, but no definition was found.", s.Name),
+				Subject:  b.rng.Ptr(),
+			})
+		}
+	}
+	for _, s := range schema.Blocks {
+		attr, ok := left[s.Type]
+		if !ok || len(s.LabelNames) > 0 {
+			continue
+		}
+		delete(left, s.Type)
+		blocks, blockDiags := attrBlocks(attr)
+		diags = append(diags, blockDiags...)
+		content.Blocks = append(content.Blocks, blocks...)
+	}
+	return content, &objectBody{attrs: left, rng: b.rng}, diags
+}
+
+func (b *objectBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	return b.attrs, nil
+}
+
+func (b *objectBody) MissingItemRange() hcl.Range {
+	return b.rng
+}
+
+// checkAttributeKeys reports the keys of the objects written in the attributes of body that the type of the attribute doesn't have,
+// in the attributes of body and of its nested blocks. Terraform would only report them as required attributes missing from the object
+func checkAttributeKeys(body hcl.Body, schema *configschema.Block) hcl.Diagnostics {
+	content, _, _ := body.PartialContent(hcldec.ImpliedSchema(schema.DecoderSpec()))
+	var diags hcl.Diagnostics
+	var names []string
+	for name := range content.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if attr, ok := schema.Attributes[name]; ok {
+			diags = append(diags, checkObjectKeys(content.Attributes[name].Expr, attr.Type)...)
+		}
+	}
+	for _, block := range content.Blocks {
+		if nested, ok := schema.BlockTypes[block.Type]; ok {
+			diags = append(diags, checkAttributeKeys(block.Body, &nested.Block)...)
+		}
+	}
+	return diags
+}
+
+// checkObjectKeys reports the keys of the objects written in expr that ty doesn't have. Only the objects, lists and maps
+// written literally are checked, other expressions are left to the type conversion of their value
+func checkObjectKeys(expr hcl.Expression, ty cty.Type) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	switch {
+	case ty.IsObjectType():
+		pairs, mapDiags := hcl.ExprMap(expr)
+		if mapDiags.HasErrors() {
+			return nil
+		}
+		var known []string
+		for name := range ty.AttributeTypes() {
+			known = append(known, name)
+		}
+		for _, pair := range pairs {
+			key, keyDiags := pair.Key.Value(nil)
+			if keyDiags.HasErrors() || !key.IsWhollyKnown() || key.IsNull() || key.Type() != cty.String {
+				continue
+			}
+			name := key.AsString()
+			if !ty.HasAttribute(name) {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Unsupported attribute",
+					Detail:   fmt.Sprintf("This object has no attribute named %q.%s", name, didYouMean(name, known)),
+					Subject:  pair.Key.Range().Ptr(),
+				})
+				continue
+			}
+			diags = append(diags, checkObjectKeys(pair.Value, ty.AttributeType(name))...)
+		}
+	case ty.IsListType() || ty.IsSetType():
+		elements, listDiags := hcl.ExprList(expr)
+		if listDiags.HasErrors() {
+			return nil
+		}
+		for _, element := range elements {
+			diags = append(diags, checkObjectKeys(element, ty.ElementType())...)
+		}
+	case ty.IsMapType():
+		pairs, mapDiags := hcl.ExprMap(expr)
+		if mapDiags.HasErrors() {
+			return nil
+		}
+		for _, pair := range pairs {
+			diags = append(diags, checkObjectKeys(pair.Value, ty.ElementType())...)
+		}
+	}
+	return diags
+}
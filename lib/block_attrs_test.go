@@ -0,0 +1,145 @@
+package terraspec
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSpecBody(t *testing.T) {
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"name":  {Type: cty.String, Optional: true},
+			"rules": {Type: cty.List(cty.Object(map[string]cty.Type{"port": cty.Number})), Optional: true},
+		},
+		BlockTypes: map[string]*configschema.NestedBlock{
+			"inner": {
+				Block:   configschema.Block{Attributes: map[string]*configschema.Attribute{"prop": {Type: cty.String, Optional: true}}},
+				Nesting: configschema.NestingSingle,
+			},
+			"disk": {
+				Block: configschema.Block{
+					Attributes: map[string]*configschema.Attribute{"size": {Type: cty.Number, Optional: true}},
+					BlockTypes: map[string]*configschema.NestedBlock{
+						"sub": {
+							Block:   configschema.Block{Attributes: map[string]*configschema.Attribute{"flag": {Type: cty.Bool, Optional: true}}},
+							Nesting: configschema.NestingSingle,
+						},
+					},
+				},
+				Nesting: configschema.NestingList,
+			},
+		},
+	}
+	decode := func(src string) (cty.Value, hcl.Diagnostics) {
+		file, diags := hclsyntax.ParseConfig([]byte(src), "spec.tfspec", hcl.InitialPos)
+		if diags.HasErrors() {
+			t.Fatal(diags)
+		}
+		return hcldec.Decode(specBody(file.Body, schema), schema.DecoderSpec(), nil)
+	}
+
+	blocks, diags := decode(`
+name = "a"
+rules {
+  port = 80
+}
+rules {
+  port = 443
+}
+inner {
+  prop = "x"
+}
+disk {
+  size = 1
+  sub {
+    flag = true
+  }
+}
+disk {
+  size = 2
+}
+`)
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	attributes, diags := decode(`
+name  = "a"
+rules = [{ port = 80 }, { port = 443 }]
+inner = { prop = "x" }
+disk  = [{ size = 1, sub = { flag = true } }, { size = 2 }]
+`)
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	if !blocks.RawEquals(attributes) {
+		t.Errorf("Both syntaxes should decode to the same value. Got %#v and %#v", blocks, attributes)
+	}
+
+	errors := map[string]struct {
+		src     string
+		summary string
+	}{
+		"Block written as a string":           {src: `inner = "x"`, summary: "Unsupported block value"},
+		"Unknown attribute of a block":        {src: `inner = { unknown = 1 }`, summary: "Unsupported argument"},
+		"Unknown attribute of a nested block": {src: `disk = [{ sub = { unknown = true } }]`, summary: "Unsupported argument"},
+	}
+	for name, tc := range errors {
+		t.Run(name, func(t *testing.T) {
+			_, diags := decode(tc.src)
+			if !diags.HasErrors() || diags[0].Summary != tc.summary {
+				t.Errorf("Expected a %q error, got %v", tc.summary, diags)
+			}
+		})
+	}
+}
+
+func TestCheckAttributeKeys(t *testing.T) {
+	port := cty.Object(map[string]cty.Type{"port": cty.Number, "host": cty.String})
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"endpoint":  {Type: port, Optional: true},
+			"endpoints": {Type: cty.List(port), Optional: true},
+			"by_name":   {Type: cty.Map(port), Optional: true},
+			"tags":      {Type: cty.Map(cty.String), Optional: true},
+		},
+		BlockTypes: map[string]*configschema.NestedBlock{
+			"inner": {
+				Block:   configschema.Block{Attributes: map[string]*configschema.Attribute{"backend": {Type: port, Optional: true}}},
+				Nesting: configschema.NestingSingle,
+			},
+		},
+	}
+	tests := map[string]struct {
+		src      string
+		expected []string
+	}{
+		"Known keys":           {src: `endpoint = { port = 80, host = "a" }`},
+		"Map keys not checked": {src: `tags = { anything = "a" }`},
+		"Object":               {src: `endpoint = { prot = 80 }`, expected: []string{`spec.tfspec:1,14-18: Unsupported attribute; This object has no attribute named "prot". Did you mean "port"?`}},
+		"List of objects":      {src: `endpoints = [{ port = 80 }, { hots = "a" }]`, expected: []string{`spec.tfspec:1,31-35: Unsupported attribute; This object has no attribute named "hots". Did you mean "host"?`}},
+		"Map of objects":       {src: `by_name = { a = { prot = 80 } }`, expected: []string{`spec.tfspec:1,19-23: Unsupported attribute; This object has no attribute named "prot". Did you mean "port"?`}},
+		"Nested block":         {src: "inner {\n  backend = { url = \"a\" }\n}\n", expected: []string{`spec.tfspec:2,15-18: Unsupported attribute; This object has no attribute named "url".`}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			file, diags := hclsyntax.ParseConfig([]byte(tt.src), "spec.tfspec", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+			diags = checkAttributeKeys(specBody(file.Body, schema), schema)
+			if len(diags) != len(tt.expected) {
+				t.Fatalf("Expected %d errors, got %v", len(tt.expected), diags)
+			}
+			for i, expected := range tt.expected {
+				if got := diags[i].Error(); got != expected {
+					t.Errorf("Expected error %s, got %s", expected, got)
+				}
+			}
+		})
+	}
+}
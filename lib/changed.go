@@ -0,0 +1,143 @@
+package terraspec
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform/configs"
+)
+
+// configExtensions are the extensions of the files of a terraform module that change its plan
+var configExtensions = []string{".tf", ".tf.json", ".tfvars", ".tfvars.json"}
+
+// ChangedFiles returns the absolute paths of the files of the git repository holding dir that changed since the git ref ref,
+// including the uncommitted changes and the untracked files
+func ChangedFiles(dir, ref string) ([]string, error) {
+	top, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	root := strings.TrimSpace(top)
+	diff, err := git(dir, "diff", "--name-only", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(dir, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+
+	return repoFiles(root, diff+untracked), nil
+}
+
+// StagedFiles returns the absolute paths of the files of the git repository holding dir whose changes are staged for the next commit,
+// as a pre-commit hook sees them
+func StagedFiles(dir string) ([]string, error) {
+	top, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	staged, err := git(dir, "diff", "--cached", "--name-only", "--")
+	if err != nil {
+		return nil, err
+	}
+	return repoFiles(strings.TrimSpace(top), staged), nil
+}
+
+// repoFiles returns the absolute paths of the files listed by a git command, one per line relative to the root of the repository
+func repoFiles(root, output string) []string {
+	var files []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			files = append(files, filepath.Join(root, filepath.FromSlash(line)))
+		}
+	}
+	return files
+}
+
+// git runs a git command in dir and returns its output
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed : %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return string(output), nil
+}
+
+// AffectedTestCases returns the test cases whose result may change because of the changed files.
+// All the test cases plan the config, so they're all affected when a .tf or .tfvars file of the config, or of a module it calls, changed.
+// Otherwise, only the test cases with a changed file in their folder, or a changed spec or variable file, are affected.
+// Other files read by the config, eg templates, are not tracked
+func AffectedTestCases(cfg *configs.Config, testCases []*TestCase, changed []string) []*TestCase {
+	moduleDirs := make(map[string]bool)
+	cfg.DeepEach(func(c *configs.Config) {
+		if dir, err := filepath.Abs(c.Module.SourceDir); err == nil {
+			moduleDirs[dir] = true
+		}
+	})
+
+	changedDirs := make(map[string]bool)
+	changedFiles := make(map[string]bool)
+	for _, file := range changed {
+		if moduleDirs[filepath.Dir(file)] && isConfigFile(file) {
+			return testCases
+		}
+		changedDirs[filepath.Dir(file)] = true
+		changedFiles[file] = true
+	}
+
+	var affected []*TestCase
+	for _, tc := range testCases {
+		if changedDirs[absPath(tc.Dir)] || changedFiles[absPath(tc.SpecFile)] || (tc.VariableFile != "" && changedFiles[absPath(tc.VariableFile)]) {
+			affected = append(affected, tc)
+		}
+	}
+	return affected
+}
+
+func isConfigFile(file string) bool {
+	for _, ext := range configExtensions {
+		if strings.HasSuffix(file, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// absPath returns the absolute path of file, or file itself when it can't be found
+func absPath(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return file
+}
+
+// changedFilter returns a filter keeping the test cases affected by the changes made since opts.ChangedSince, or by the staged changes
+// when opts.ChangedOnly is set. All the test cases are kept when the config can't be loaded, so its errors are reported by the test cases
+func changedFilter(opts Options) (func(*TestCase) bool, error) {
+	var changed []string
+	var err error
+	if opts.ChangedOnly {
+		if changed, err = StagedFiles(opts.Dir); err != nil {
+			return nil, fmt.Errorf("Could not list the staged files : %v", err)
+		}
+	} else if changed, err = ChangedFiles(opts.Dir, opts.ChangedSince); err != nil {
+		return nil, fmt.Errorf("Could not list the files changed since %s : %v", opts.ChangedSince, err)
+	}
+	cfg, diags := LoadConfig(opts.Dir)
+	if diags.HasErrors() {
+		return func(*TestCase) bool { return true }, nil
+	}
+	return func(tc *TestCase) bool {
+		return len(AffectedTestCases(cfg, []*TestCase{tc}, changed)) > 0
+	}, nil
+}
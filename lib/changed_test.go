@@ -0,0 +1,134 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/configs"
+)
+
+func TestAffectedTestCases(t *testing.T) {
+	root := &configs.Config{Module: &configs.Module{SourceDir: "/repo/infra"}, Children: make(map[string]*configs.Config)}
+	root.Root = root
+	root.Children["network"] = &configs.Config{Root: root, Parent: root, Module: &configs.Module{SourceDir: "/repo/modules/network"}}
+	prod := &TestCase{Dir: "/repo/infra/spec/prod", SpecFile: "/repo/infra/spec/prod/prod.tfspec", VariableFile: "/repo/infra/spec/prod/prod.tfvars"}
+	dev := &TestCase{Dir: "/repo/infra/spec/dev", SpecFile: "/repo/infra/spec/dev/dev.tfspec"}
+	testCases := []*TestCase{prod, dev}
+
+	for name, tc := range map[string]struct {
+		changed  []string
+		expected []*TestCase
+	}{
+		"root config":      {changed: []string{"/repo/README.md", "/repo/infra/main.tf"}, expected: []*TestCase{prod, dev}},
+		"called module":    {changed: []string{"/repo/modules/network/vpc.tf.json"}, expected: []*TestCase{prod, dev}},
+		"uncalled module":  {changed: []string{"/repo/modules/dns/main.tf"}, expected: nil},
+		"spec file":        {changed: []string{"/repo/infra/spec/dev/dev.tfspec"}, expected: []*TestCase{dev}},
+		"variable file":    {changed: []string{"/repo/infra/spec/prod/prod.tfvars"}, expected: []*TestCase{prod}},
+		"non config file":  {changed: []string{"/repo/infra/README.md"}, expected: nil},
+		"test case folder": {changed: []string{"/repo/infra/spec/prod/state.json"}, expected: []*TestCase{prod}},
+		"nothing changed":  {changed: nil, expected: nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			affected := AffectedTestCases(root, testCases, tc.changed)
+			if len(affected) != len(tc.expected) {
+				t.Fatalf("Expected %d affected test cases, got %d", len(tc.expected), len(affected))
+			}
+			for i := range affected {
+				if affected[i] != tc.expected[i] {
+					t.Errorf("Expected test case %s, got %s", tc.expected[i].Dir, affected[i].Dir)
+				}
+			}
+		})
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "terraspec-changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the git repository path is resolved by git
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(file, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(args ...string) {
+		if _, err := git(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.tf", "")
+	write("unchanged.tf", "")
+	run("init", "-q")
+	run("add", ".")
+	run("-c", "user.name=terraspec", "-c", "user.email=terraspec@example.com", "commit", "-q", "-m", "init")
+	write("main.tf", "locals {}\n")
+	write("new.tf", "")
+
+	changed, err := ChangedFiles(dir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(dir, "main.tf"), filepath.Join(dir, "new.tf")}
+	if len(changed) != len(expected) {
+		t.Fatalf("Expected changed files %v, got %v", expected, changed)
+	}
+	for i := range expected {
+		if changed[i] != expected[i] {
+			t.Errorf("Expected changed file %s, got %s", expected[i], changed[i])
+		}
+	}
+}
+
+func TestStagedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "terraspec-staged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(file, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(args ...string) {
+		if _, err := git(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.tf", "")
+	run("init", "-q")
+	run("add", ".")
+	run("-c", "user.name=terraspec", "-c", "user.email=terraspec@example.com", "commit", "-q", "-m", "init")
+	write("main.tf", "locals {}\n")
+	write("staged.tf", "")
+	write("untracked.tf", "")
+	run("add", "staged.tf")
+
+	staged, err := StagedFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(dir, "staged.tf"); len(staged) != 1 || staged[0] != expected {
+		t.Errorf("Only %s should be staged, got %v", expected, staged)
+	}
+}
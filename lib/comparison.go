@@ -0,0 +1,170 @@
+package terraspec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	ctyyaml "github.com/zclconf/go-cty-yaml"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// encodings are the encodings of the strings decoded before they're compared, as a set of flags
+type encodings uint8
+
+const (
+	encodingBase64 encodings = 1 << iota
+	encodingJSON
+	encodingYAML
+)
+
+// encodingNames are the names of the encodings in spec files
+var encodingNames = map[string]encodings{"base64": encodingBase64, "json": encodingJSON, "yaml": encodingYAML}
+
+// comparison tells how asserted primitive values are compared with the planned ones.
+// The zero comparison requires equal values
+type comparison struct {
+	// tolerance is the difference allowed between an asserted number and the planned one
+	tolerance float64
+	// round compares numbers rounded to the nearest whole number
+	round bool
+	// normalize are the encodings of the strings decoded before they're compared
+	normalize encodings
+}
+
+// comparison returns how the values of assert are compared : the options of the assert block override the ones of the terraspec block
+func (s *Spec) comparison(assert *Assert) comparison {
+	var c comparison
+	normalize := assert.Normalize
+	if s.Terraspec != nil {
+		c = comparison{tolerance: s.Terraspec.Tolerance, round: s.Terraspec.RoundNumbers}
+		if normalize == nil {
+			normalize = s.Terraspec.Normalize
+		}
+	}
+	if assert.Tolerance != nil {
+		c.tolerance = *assert.Tolerance
+	}
+	if assert.RoundNumbers != nil {
+		c.round = *assert.RoundNumbers
+	}
+	for _, name := range normalize {
+		c.normalize |= encodingNames[name]
+	}
+	return c
+}
+
+// equal tells whether the planned primitive value got is the expected one. Numbers are compared with the tolerance
+// and the rounding of c, and strings once decoded from the encodings of c. Other values must be equal
+func (c comparison) equal(expected, got cty.Value) bool {
+	if !got.IsKnown() {
+		return false
+	}
+	if expected.IsNull() || got.IsNull() || expected.Type() != got.Type() {
+		return expected.Equals(got).True()
+	}
+	switch {
+	case expected.Type() == cty.Number && (c.tolerance != 0 || c.round):
+		e, g := expected.AsBigFloat(), got.AsBigFloat()
+		if c.round {
+			e, g = roundFloat(e), roundFloat(g)
+		}
+		diff := new(big.Float).Sub(e, g)
+		return diff.Abs(diff).Cmp(big.NewFloat(c.tolerance)) <= 0
+	case expected.Type() == cty.String && c.normalize != 0:
+		e, g := c.decode(expected.AsString()), c.decode(got.AsString())
+		return e.Type().Equals(g.Type()) && e.Equals(g).True()
+	}
+	return expected.Equals(got).True()
+}
+
+// roundFloat returns f rounded to the nearest whole number, halves away from zero
+func roundFloat(f *big.Float) *big.Float {
+	half := big.NewFloat(0.5)
+	if f.Sign() < 0 {
+		half.Neg(half)
+	}
+	i, _ := new(big.Float).Add(f, half).Int(nil)
+	return new(big.Float).SetInt(i)
+}
+
+// decode returns the content of s, decoded from base64 first, then parsed as JSON or YAML, so documents that only differ
+// by their key order or formatting are equal. s is kept as is when it's not encoded with any of the encodings of c
+func (c comparison) decode(s string) cty.Value {
+	if c.normalize&encodingBase64 != 0 {
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s)); err == nil && utf8.Valid(decoded) {
+			s = string(decoded)
+		}
+	}
+	if c.normalize&encodingJSON != 0 {
+		if ty, err := ctyjson.ImpliedType([]byte(s)); err == nil {
+			if val, err := ctyjson.Unmarshal([]byte(s), ty); err == nil {
+				return val
+			}
+		}
+	}
+	if c.normalize&encodingYAML != 0 {
+		if val, err := ctyyaml.Standard.Unmarshal([]byte(s), cty.DynamicPseudoType); err == nil && val.IsWhollyKnown() {
+			return val
+		}
+	}
+	return cty.StringVal(s)
+}
+
+// decodeComparison sets how the values of assert are compared from its tolerance, round_numbers and normalize arguments,
+// when they're set
+func decodeComparison(assert *Assert, tolerance, round, normalize hcl.Expression, ctx *hcl.EvalContext) hcl.Diagnostics {
+	if val, diags := tolerance.Value(ctx); diags.HasErrors() || !val.IsNull() {
+		var t float64
+		if diags := gohcl.DecodeExpression(tolerance, ctx, &t); diags.HasErrors() {
+			return diags
+		}
+		if t < 0 {
+			return hcl.Diagnostics{invalidTolerance(tolerance.Range().Ptr())}
+		}
+		assert.Tolerance = &t
+	}
+	if val, diags := round.Value(ctx); diags.HasErrors() || !val.IsNull() {
+		var r bool
+		if diags := gohcl.DecodeExpression(round, ctx, &r); diags.HasErrors() {
+			return diags
+		}
+		assert.RoundNumbers = &r
+	}
+	if val, diags := normalize.Value(ctx); diags.HasErrors() || !val.IsNull() {
+		n := []string{}
+		if diags := gohcl.DecodeExpression(normalize, ctx, &n); diags.HasErrors() {
+			return diags
+		}
+		if diags := checkEncodings(n, normalize.Range().Ptr()); diags.HasErrors() {
+			return diags
+		}
+		assert.Normalize = n
+	}
+	return nil
+}
+
+func invalidTolerance(subject *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Invalid tolerance", Detail: "The tolerance must be a positive number", Subject: subject}
+}
+
+// checkEncodings reports the names that are not encodings strings can be normalized from
+func checkEncodings(names []string, subject *hcl.Range) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, name := range names {
+		if _, ok := encodingNames[name]; !ok {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid normalize",
+				Detail:   fmt.Sprintf("%q is not an encoding strings can be normalized from : use json, yaml or base64.%s", name, didYouMean(name, []string{"base64", "json", "yaml"})),
+				Subject:  subject,
+			})
+		}
+	}
+	return diags
+}
@@ -0,0 +1,89 @@
+package terraspec
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestComparisonEqual(t *testing.T) {
+	tests := map[string]struct {
+		comparison comparison
+		expected   cty.Value
+		got        cty.Value
+		equal      bool
+	}{
+		"Exact":                    {expected: cty.NumberIntVal(3), got: cty.NumberFloatVal(3.0001), equal: false},
+		"Within tolerance":         {comparison: comparison{tolerance: 0.001}, expected: cty.NumberIntVal(3), got: cty.NumberFloatVal(3.0001), equal: true},
+		"Beyond tolerance":         {comparison: comparison{tolerance: 0.001}, expected: cty.NumberIntVal(3), got: cty.NumberFloatVal(3.002), equal: false},
+		"Rounded":                  {comparison: comparison{round: true}, expected: cty.NumberIntVal(4), got: cty.NumberFloatVal(3.5), equal: true},
+		"Rounded negative":         {comparison: comparison{round: true}, expected: cty.NumberIntVal(-4), got: cty.NumberFloatVal(-3.5), equal: true},
+		"Rounded differently":      {comparison: comparison{round: true}, expected: cty.NumberIntVal(3), got: cty.NumberFloatVal(3.5), equal: false},
+		"Rounded within tolerance": {comparison: comparison{round: true, tolerance: 1}, expected: cty.NumberIntVal(3), got: cty.NumberFloatVal(3.5), equal: true},
+		"Strings not affected":     {comparison: comparison{tolerance: 1, round: true}, expected: cty.StringVal("1"), got: cty.StringVal("2"), equal: false},
+		"Unknown":                  {comparison: comparison{tolerance: 1}, expected: cty.NumberIntVal(1), got: cty.UnknownVal(cty.Number), equal: false},
+		"Null":                     {comparison: comparison{tolerance: 1}, expected: cty.NumberIntVal(1), got: cty.NullVal(cty.Number), equal: false},
+		"JSON not normalized":      {expected: cty.StringVal(`{"b":1,"a":[1,2]}`), got: cty.StringVal("{\n  \"a\": [1, 2],\n  \"b\": 1\n}"), equal: false},
+		"JSON":                     {comparison: comparison{normalize: encodingJSON}, expected: cty.StringVal(`{"b":1,"a":[1,2]}`), got: cty.StringVal("{\n  \"a\": [1, 2],\n  \"b\": 1\n}"), equal: true},
+		"Different JSON":           {comparison: comparison{normalize: encodingJSON}, expected: cty.StringVal(`{"b":1,"a":[1,2]}`), got: cty.StringVal(`{"a":[2,1],"b":1}`), equal: false},
+		"YAML":                     {comparison: comparison{normalize: encodingYAML}, expected: cty.StringVal("a: 1\nb: x\n"), got: cty.StringVal("b: x\na:   1"), equal: true},
+		"Base64":                   {comparison: comparison{normalize: encodingBase64}, expected: cty.StringVal("hello world"), got: cty.StringVal("aGVsbG8gd29ybGQ="), equal: true},
+		"Base64 JSON":              {comparison: comparison{normalize: encodingBase64 | encodingJSON}, expected: cty.StringVal(`{"b":1,"a":2}`), got: cty.StringVal("eyJhIjogMiwgImIiOiAxfQ=="), equal: true},
+		"Plain strings":            {comparison: comparison{normalize: encodingBase64 | encodingJSON | encodingYAML}, expected: cty.StringVal("value"), got: cty.StringVal("other"), equal: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if equal := tt.comparison.equal(tt.expected, tt.got); equal != tt.equal {
+				t.Errorf("Expected equal to be %v, got %v", tt.equal, equal)
+			}
+		})
+	}
+}
+
+func TestSpecComparison(t *testing.T) {
+	spec, diags := ParseSpec([]byte(`
+terraspec {
+  tolerance     = 0.01
+  round_numbers = true
+  normalize     = ["json"]
+}
+
+assert "ressource_type" "global" {
+  property = "value"
+}
+
+assert "ressource_type" "overridden" {
+  tolerance     = 0
+  round_numbers = false
+  normalize     = []
+  property      = "value"
+}
+`), "comparison.tfspec", testSchemas())
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	if c := spec.comparison(spec.Asserts[0]); c != (comparison{tolerance: 0.01, round: true, normalize: encodingJSON}) {
+		t.Errorf("The assert should use the comparison of the terraspec block, got %+v", c)
+	}
+	if c := spec.comparison(spec.Asserts[1]); c != (comparison{}) {
+		t.Errorf("The assert should override the comparison of the terraspec block, got %+v", c)
+	}
+
+	_, diags = ParseSpec([]byte(`
+assert "ressource_type" "name" {
+  tolerance = -1
+}
+`), "comparison.tfspec", testSchemas())
+	if !diags.HasErrors() || diags[0].Summary != "Invalid tolerance" {
+		t.Errorf("Expected an invalid tolerance error, got %v", diags)
+	}
+
+	_, diags = ParseSpec([]byte(`
+assert "ressource_type" "name" {
+  normalize = ["jsn"]
+}
+`), "comparison.tfspec", testSchemas())
+	if expected := `comparison.tfspec:3,15-22: Invalid normalize; "jsn" is not an encoding strings can be normalized from : use json, yaml or base64. Did you mean "json"?`; !diags.HasErrors() || diags[0].Error() != expected {
+		t.Errorf("Expected error %s, got %v", expected, diags)
+	}
+}
@@ -0,0 +1,103 @@
+package terraspec
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// assertedLeaf is a primitive value asserted by an assert block
+type assertedLeaf struct {
+	value  cty.Value
+	assert *Assert
+}
+
+// checkConflictingAsserts reports the attributes asserted by several assert blocks of the same resource or output.
+// Different expected values can't all pass, so they're errors, while the same value asserted again is a warning.
+// Only known primitive values are compared : matchers, values read from the plan and elements of sets are left out
+func checkConflictingAsserts(asserts []*Assert) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	byKey := make(map[string][]*Assert)
+	var keys []string
+	for _, assert := range asserts {
+		if _, ok := byKey[assert.Key()]; !ok {
+			keys = append(keys, assert.Key())
+		}
+		byKey[assert.Key()] = append(byKey[assert.Key()], assert)
+	}
+
+	for _, key := range keys {
+		if len(byKey[key]) < 2 {
+			continue
+		}
+		asserted := make(map[string]assertedLeaf)
+		for _, assert := range byKey[key] {
+			assert := assert
+			eachAssertedLeaf(cty.GetAttrPath(key), assert.Value, func(path cty.Path, value cty.Value) {
+				name := FormatPath(path)
+				previous, ok := asserted[name]
+				if !ok {
+					asserted[name] = assertedLeaf{value: value, assert: assert}
+					return
+				}
+				if previous.value.RawEquals(value) {
+					diags = diags.Append(&hcl.Diagnostic{
+						Severity: hcl.DiagWarning,
+						Summary:  "Duplicate assertion",
+						Detail:   fmt.Sprintf("%s is already asserted to be %s by the assert block at line %d.", name, formatLeaf(value), previous.assert.DeclRange.Start.Line),
+						Subject:  assert.DeclRange.Ptr(),
+					})
+					return
+				}
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Conflicting assertions",
+					Detail: fmt.Sprintf("%s is asserted to be %s here while the assert block at line %d asserts it's %s : both can't pass.",
+						name, formatLeaf(value), previous.assert.DeclRange.Start.Line, formatLeaf(previous.value)),
+					Subject: assert.DeclRange.Ptr(),
+				})
+			})
+		}
+	}
+	return diags
+}
+
+// eachAssertedLeaf calls found with every known primitive value of val, and its path
+func eachAssertedLeaf(path cty.Path, val cty.Value, found func(cty.Path, cty.Value)) {
+	if matcherCallOf(val) != nil || !val.IsKnown() || val.IsNull() {
+		return
+	}
+	ty := val.Type()
+	switch {
+	case ty.IsPrimitiveType():
+		found(path, val)
+	case ty.IsObjectType() || ty.IsMapType():
+		for it := val.ElementIterator(); it.Next(); {
+			key, value := it.Element()
+			if ty.IsObjectType() && key.AsString() == "reject" {
+				continue
+			}
+			eachAssertedLeaf(path.GetAttr(key.AsString()), value, found)
+		}
+	case ty.IsListType() || ty.IsTupleType():
+		for it := val.ElementIterator(); it.Next(); {
+			key, value := it.Element()
+			eachAssertedLeaf(path.Index(key), value, found)
+		}
+	}
+}
+
+// formatLeaf formats a primitive asserted value the way it's written in a spec
+func formatLeaf(val cty.Value) string {
+	switch val.Type() {
+	case cty.String:
+		return strconv.Quote(val.AsString())
+	case cty.Number:
+		return val.AsBigFloat().Text('f', -1)
+	case cty.Bool:
+		return strconv.FormatBool(val.True())
+	}
+	return val.GoString()
+}
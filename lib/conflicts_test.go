@@ -0,0 +1,78 @@
+package terraspec
+
+import (
+	"testing"
+)
+
+func TestCheckConflictingAsserts(t *testing.T) {
+	tests := map[string]struct {
+		spec     string
+		expected []string
+	}{
+		"Different attributes": {
+			spec: `
+assert "ressource_type" "name" {
+  property = "value"
+}
+assert "ressource_type" "name" {
+  inner {
+    inner_prop = "value"
+  }
+}
+`,
+		},
+		"Different resources": {
+			spec: `
+assert "ressource_type" "name" {
+  property = "value"
+}
+assert "ressource_type" "other" {
+  property = "other"
+}
+`,
+		},
+		"Duplicate": {
+			spec: `
+assert "ressource_type" "name" {
+  property = "value"
+}
+assert "ressource_type" "name" {
+  property = "value"
+}
+`,
+			expected: []string{`conflicts.tfspec:5,1-31: Duplicate assertion; ressource_type.name.property is already asserted to be "value" by the assert block at line 2.`},
+		},
+		"Conflict": {
+			spec: `
+assert "ressource_type" "name" {
+  inner {
+    inner_prop = "value"
+  }
+}
+assert "ressource_type" "name" {
+  inner {
+    inner_prop = "other"
+  }
+}
+`,
+			expected: []string{`conflicts.tfspec:7,1-31: Conflicting assertions; ressource_type.name.inner.inner_prop is asserted to be "other" here while the assert block at line 2 asserts it's "value" : both can't pass.`},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			spec, diags := ParseSpec([]byte(tt.spec), "conflicts.tfspec", testSchemas())
+			if len(diags) != len(tt.expected) {
+				t.Fatalf("Expected %d diagnostics, got %v", len(tt.expected), diags)
+			}
+			for i, expected := range tt.expected {
+				if got := diags[i].Error(); got != expected {
+					t.Errorf("Expected diagnostic %s, got %s", expected, got)
+				}
+			}
+			if (spec == nil) != diags.HasErrors() {
+				t.Errorf("The spec should only be parsed when no assertions conflict")
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package terraspec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Coverage tells which resources of a plan, and which of their attributes, are checked by at least one assertion
+type Coverage struct {
+	// Resources are the managed resources of the plan, sorted by address
+	Resources []*ResourceCoverage
+}
+
+// ResourceCoverage tells whether a planned resource and its attributes are checked by an assertion
+type ResourceCoverage struct {
+	Address string
+	// Covered is true when an assert or a reject block checks the resource
+	Covered bool
+	// Attributes maps the top level attributes planned with a known value to whether an assertion checks them.
+	// The attributes of a resource to destroy are the ones of its prior state
+	Attributes map[string]bool
+}
+
+// ResourceRatio returns the fraction of the resources checked by an assertion, or 1 when the plan has no resource
+func (c *Coverage) ResourceRatio() float64 {
+	var covered int
+	for _, r := range c.Resources {
+		if r.Covered {
+			covered++
+		}
+	}
+	return ratio(covered, len(c.Resources))
+}
+
+// AttributeRatio returns the fraction of the planned attributes of all resources checked by an assertion,
+// or 1 when no attribute is planned
+func (c *Coverage) AttributeRatio() float64 {
+	var covered, total int
+	for _, r := range c.Resources {
+		for _, ok := range r.Attributes {
+			if ok {
+				covered++
+			}
+			total++
+		}
+	}
+	return ratio(covered, total)
+}
+
+// Uncovered returns the addresses of the resources no assertion checks, sorted
+func (c *Coverage) Uncovered() []string {
+	var uncovered []string
+	for _, r := range c.Resources {
+		if !r.Covered {
+			uncovered = append(uncovered, r.Address)
+		}
+	}
+	return uncovered
+}
+
+// CoverageShortfall is a part of the planned resources whose coverage is below the minimum required by Options.MinCoverage
+type CoverageShortfall struct {
+	// Module is the path of the module of the resources, eg module.db, or root for the root module. It's empty for all the resources
+	Module         string
+	ResourceRatio  float64
+	AttributeRatio float64
+}
+
+// rootModuleName names the root module in a CoverageShortfall
+const rootModuleName = "root"
+
+// mergeCoverage merges the coverage of several plans : a resource, or one of its attributes, is covered when a plan checks it
+func mergeCoverage(coverages []*Coverage) *Coverage {
+	merged := make(map[string]*ResourceCoverage)
+	for _, c := range coverages {
+		for _, r := range c.Resources {
+			m, ok := merged[r.Address]
+			if !ok {
+				m = &ResourceCoverage{Address: r.Address, Attributes: make(map[string]bool, len(r.Attributes))}
+				merged[r.Address] = m
+			}
+			m.Covered = m.Covered || r.Covered
+			for name, covered := range r.Attributes {
+				m.Attributes[name] = m.Attributes[name] || covered
+			}
+		}
+	}
+	coverage := &Coverage{}
+	for _, r := range merged {
+		coverage.Resources = append(coverage.Resources, r)
+	}
+	sort.Slice(coverage.Resources, func(i, j int) bool { return coverage.Resources[i].Address < coverage.Resources[j].Address })
+	return coverage
+}
+
+// byModule splits the coverage by module path, so the instances of a module called with count or for_each are counted together
+func (c *Coverage) byModule() map[string]*Coverage {
+	modules := make(map[string]*Coverage)
+	for _, r := range c.Resources {
+		module := rootModuleName
+		if addr, diags := addrs.ParseAbsResourceInstanceStr(r.Address); !diags.HasErrors() && !addr.Module.IsRoot() {
+			module = addr.Module.Module().String()
+		}
+		if modules[module] == nil {
+			modules[module] = &Coverage{}
+		}
+		modules[module].Resources = append(modules[module].Resources, r)
+	}
+	return modules
+}
+
+// shortfalls returns the coverage of all the resources, then of every module sorted by path, when its ratio of resources
+// or of attributes checked by an assertion is below min
+func (c *Coverage) shortfalls(min float64) []*CoverageShortfall {
+	var shortfalls []*CoverageShortfall
+	below := func(module string, c *Coverage) {
+		if c.ResourceRatio() < min || c.AttributeRatio() < min {
+			shortfalls = append(shortfalls, &CoverageShortfall{Module: module, ResourceRatio: c.ResourceRatio(), AttributeRatio: c.AttributeRatio()})
+		}
+	}
+	below("", c)
+	modules := c.byModule()
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		below(name, modules[name])
+	}
+	return shortfalls
+}
+
+func ratio(covered, total int) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(covered) / float64(total)
+}
+
+// PlanCoverage computes the coverage of a plan, in the JSON format of terraform show -json, by the assertion results found in diags
+func PlanCoverage(planJSON []byte, diags tfdiags.Diagnostics) (*Coverage, error) {
+	// checked maps the addresses of the resources checked by an assertion to their checked attributes
+	checked := make(map[string]map[string]bool)
+	for _, diag := range diags {
+		d, ok := diag.(*TerraspecDiagnostic)
+		if !ok {
+			continue
+		}
+		path := tfdiags.GetAttribute(d.Diagnostic)
+		if len(path) == 0 {
+			continue
+		}
+		addr, ok := path[0].(cty.GetAttrStep)
+		if !ok {
+			continue
+		}
+		if checked[addr.Name] == nil {
+			checked[addr.Name] = make(map[string]bool)
+		}
+		if len(path) > 1 {
+			if attr, ok := path[1].(cty.GetAttrStep); ok {
+				checked[addr.Name][attr.Name] = true
+			}
+		}
+	}
+
+	coverage := &Coverage{}
+	err := eachResourceChange(planJSON, func(rc *jsonResourceChange) error {
+		if rc.Mode != "managed" {
+			return nil
+		}
+		planned, unknown := rc.Change.After, rc.Change.AfterUnknown
+		if rc.Change.deleted() {
+			planned, unknown = rc.Change.Before, nil
+		}
+		names, err := knownAttributes(planned, unknown)
+		if err != nil {
+			return fmt.Errorf("Could not read planned values of %s : %v", rc.Address, err)
+		}
+
+		attrs, covered := checked[rc.Address]
+		rcov := &ResourceCoverage{Address: rc.Address, Covered: covered, Attributes: make(map[string]bool, len(names))}
+		for _, name := range names {
+			rcov.Attributes[name] = attrs[name]
+		}
+		coverage.Resources = append(coverage.Resources, rcov)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not read plan : %v", err)
+	}
+	sort.Slice(coverage.Resources, func(i, j int) bool { return coverage.Resources[i].Address < coverage.Resources[j].Address })
+	return coverage, nil
+}
+
+// knownAttributes returns the names of the top level attributes of a planned value, in the JSON plan format,
+// that are neither null nor flagged as unknown. Nested values are not decoded
+func knownAttributes(raw, unknown json.RawMessage) ([]string, error) {
+	var unknowns interface{}
+	if len(unknown) > 0 {
+		if err := json.Unmarshal(unknown, &unknowns); err != nil {
+			return nil, err
+		}
+	}
+	raw = bytes.TrimSpace(raw)
+	if unknowns == true || len(raw) == 0 || raw[0] != '{' {
+		return nil, nil
+	}
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &attrs); err != nil {
+		return nil, err
+	}
+	unknownAttrs, _ := unknowns.(map[string]interface{})
+	var names []string
+	for name, attr := range attrs {
+		if string(attr) != "null" && unknownAttrs[name] != true {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,110 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestPlanCoverage(t *testing.T) {
+	planJSON, err := ioutil.ReadFile("testdata/generate/plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := cty.GetAttrPath("module.db.ressource_type.name[0]")
+	var diags tfdiags.Diagnostics
+	diags = diags.Append(SuccessDiags(name.GetAttr("property"), "value"))
+	diags = diags.Append(AssertErrorDiags(name.GetAttr("tags").GetAttr("owner"), "ops", "team"))
+	diags = diags.Append(SuccessDiags(cty.GetAttrPath("output").GetAttr("output.size"), "3"))
+
+	coverage, err := PlanCoverage(planJSON, diags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nb := len(coverage.Resources); nb != 2 {
+		t.Fatalf("expected the 2 managed resources, got %d", nb)
+	}
+
+	covered := coverage.Resources[0]
+	expected := map[string]bool{"property": true, "tags": true, "count": false, "zones": false, "empty": false, "inner": false}
+	if covered.Address != "module.db.ressource_type.name[0]" || !covered.Covered || !reflect.DeepEqual(covered.Attributes, expected) {
+		t.Errorf("coverage of the asserted resource not as expected, got %+v", covered)
+	}
+	removed := coverage.Resources[1]
+	if removed.Address != "ressource_type.removed" || removed.Covered || !reflect.DeepEqual(removed.Attributes, map[string]bool{"property": false}) {
+		t.Errorf("resource to destroy should not be covered, got %+v", removed)
+	}
+
+	if got := coverage.Uncovered(); !reflect.DeepEqual(got, []string{"ressource_type.removed"}) {
+		t.Errorf("Only the resource to destroy should be uncovered, got %v", got)
+	}
+
+	if got := coverage.ResourceRatio(); got != 0.5 {
+		t.Errorf("half of the resources should be covered, got %v", got)
+	}
+	if got := coverage.AttributeRatio(); got != 2.0/7 {
+		t.Errorf("2 attributes out of 7 should be covered, got %v", got)
+	}
+}
+
+func TestUncoveredResources(t *testing.T) {
+	results := &Results{Cases: []*CaseResult{
+		{Coverage: &Coverage{Resources: []*ResourceCoverage{{Address: "aws_instance.web", Covered: true}, {Address: "aws_s3_bucket.logs"}, {Address: "aws_vpc.main"}}}},
+		{},
+		{Coverage: &Coverage{Resources: []*ResourceCoverage{{Address: "aws_instance.web"}, {Address: "aws_s3_bucket.logs", Covered: true}, {Address: "aws_iam_role.app"}}}},
+	}}
+	expected := []string{"aws_iam_role.app", "aws_vpc.main"}
+	if got := results.UncoveredResources(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the resources no test case covers %v, got %v", expected, got)
+	}
+}
+
+func TestCoverageShortfalls(t *testing.T) {
+	results := &Results{Cases: []*CaseResult{
+		{Coverage: &Coverage{Resources: []*ResourceCoverage{
+			{Address: "aws_vpc.main", Covered: true, Attributes: map[string]bool{"cidr_block": true}},
+			{Address: `module.db["eu"].aws_db_instance.main`, Covered: true, Attributes: map[string]bool{"engine": true, "size": false}},
+			{Address: "module.app.aws_instance.web", Attributes: map[string]bool{"ami": false}},
+		}}},
+		{},
+		{Coverage: &Coverage{Resources: []*ResourceCoverage{
+			{Address: `module.db["us"].aws_db_instance.main`, Covered: true, Attributes: map[string]bool{"engine": true, "size": true}},
+			{Address: "module.app.aws_instance.web", Attributes: map[string]bool{"ami": false}},
+		}}},
+	}}
+
+	merged := results.Coverage()
+	if nb := len(merged.Resources); nb != 4 {
+		t.Fatalf("Expected the 4 resources planned by the test cases, got %d", nb)
+	}
+	if got := merged.ResourceRatio(); got != 0.75 {
+		t.Errorf("3 resources out of 4 should be covered, got %v", got)
+	}
+
+	testCases := map[string]struct {
+		min      float64
+		expected []*CoverageShortfall
+	}{
+		"No minimum": {min: 0},
+		"Overall and module below the minimum": {min: 0.7, expected: []*CoverageShortfall{
+			{Module: "", ResourceRatio: 0.75, AttributeRatio: 4.0 / 6},
+			{Module: "module.app", ResourceRatio: 0, AttributeRatio: 0},
+		}},
+		"Instances of a module counted together": {min: 0.8, expected: []*CoverageShortfall{
+			{Module: "", ResourceRatio: 0.75, AttributeRatio: 4.0 / 6},
+			{Module: "module.app", ResourceRatio: 0, AttributeRatio: 0},
+			{Module: "module.db", ResourceRatio: 1, AttributeRatio: 0.75},
+		}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := merged.shortfalls(tc.min)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected shortfalls %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
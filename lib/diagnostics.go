@@ -2,7 +2,10 @@ package terraspec
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/terraform/tfdiags"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -13,38 +16,106 @@ const Info tfdiags.Severity = 'I'
 // TerraspecDiagnostic is an assertion diagnostic, either a success or error
 type TerraspecDiagnostic struct {
 	tfdiags.Diagnostic
+	// Mismatch describes why the assertion failed. It's nil for successes and for errors that are not about a planned value
+	Mismatch *Mismatch
+	// Subject is the range of the header of the spec block the assertion comes from, when known
+	Subject *hcl.Range
+	// FailureMessage explains the rule a failed assertion checks, from the message attribute of its assert block
+	FailureMessage string
 }
 
 var _ tfdiags.Diagnostic = &TerraspecDiagnostic{}
 
+// Source returns the range of the spec block the assertion comes from, when known
+func (d *TerraspecDiagnostic) Source() tfdiags.Source {
+	if d.Subject == nil {
+		return d.Diagnostic.Source()
+	}
+	subject := tfdiags.SourceRangeFromHCL(*d.Subject)
+	return tfdiags.Source{Subject: &subject}
+}
+
+// locate sets the range of the spec block the assertions of diags come from, unless they already have one
+func locate(diags tfdiags.Diagnostics, rng hcl.Range) tfdiags.Diagnostics {
+	if rng.Filename == "" {
+		return diags
+	}
+	for _, diag := range diags {
+		if d, ok := diag.(*TerraspecDiagnostic); ok && d.Subject == nil {
+			d.Subject = rng.Ptr()
+		}
+	}
+	return diags
+}
+
+// explain sets the message of the failed assertions of diags
+func explain(diags tfdiags.Diagnostics, message string) tfdiags.Diagnostics {
+	if message == "" {
+		return diags
+	}
+	for _, diag := range diags {
+		if d, ok := diag.(*TerraspecDiagnostic); ok && d.Severity() == tfdiags.Error {
+			d.FailureMessage = message
+		}
+	}
+	return diags
+}
+
+// strictDiagnostic is a warning reported as an error by a strict run
+type strictDiagnostic struct {
+	tfdiags.Diagnostic
+}
+
+func (d strictDiagnostic) Severity() tfdiags.Severity {
+	return tfdiags.Error
+}
+
+func (d strictDiagnostic) Description() tfdiags.Description {
+	desc := d.Diagnostic.Description()
+	desc.Summary = fmt.Sprintf("%s (warning treated as an error by strict mode)", desc.Summary)
+	return desc
+}
+
+// strictDiags returns diags with its warnings turned into errors
+func strictDiags(diags tfdiags.Diagnostics) tfdiags.Diagnostics {
+	strict := make(tfdiags.Diagnostics, len(diags))
+	for i, diag := range diags {
+		if diag.Severity() == tfdiags.Warning {
+			diag = strictDiagnostic{Diagnostic: diag}
+		}
+		strict[i] = diag
+	}
+	return strict
+}
+
 // SuccessDiags creates a diagnostic at Info level to indicate the user a given assertion matches
 func SuccessDiags(path cty.Path, value interface{}) *TerraspecDiagnostic {
-	return &TerraspecDiagnostic{tfdiags.AttributeValue(Info, "", fmt.Sprintf("%v", value), path)}
+	return &TerraspecDiagnostic{Diagnostic: tfdiags.AttributeValue(Info, "", fmt.Sprintf("%v", value), path)}
 }
 
 // AssertErrorDiags returns a diagnostic at Error level to indicate the user a given assertion failed
 func AssertErrorDiags(path cty.Path, expected, got interface{}) *TerraspecDiagnostic {
-	return &TerraspecDiagnostic{tfdiags.AttributeValue(tfdiags.Error, "", fmt.Sprintf("%v != %v", got, expected), path)}
+	return &TerraspecDiagnostic{Diagnostic: tfdiags.AttributeValue(tfdiags.Error, "", fmt.Sprintf("%v != %v", got, expected), path)}
 }
 
 // ErrorDiags returns a diagnostic at Error level with given error message
 func ErrorDiags(path cty.Path, detail string) *TerraspecDiagnostic {
-	return &TerraspecDiagnostic{tfdiags.AttributeValue(tfdiags.Error, "", detail, path)}
+	return &TerraspecDiagnostic{Diagnostic: tfdiags.AttributeValue(tfdiags.Error, "", detail, path)}
 }
 
 // RejectErrorDiags returns a diagnostic at Error level to indicate the user a given reject assertion failed
 func RejectErrorDiags(path cty.Path, rejected, got interface{}) *TerraspecDiagnostic {
-	return &TerraspecDiagnostic{tfdiags.AttributeValue(tfdiags.Error, "", fmt.Sprintf("%v matches %v", got, rejected), path)}
+	return &TerraspecDiagnostic{Diagnostic: tfdiags.AttributeValue(tfdiags.Error, "", fmt.Sprintf("%v matches %v", got, rejected), path)}
 }
 func RejectValueErrorDiags(path cty.Path, key, rejected, got cty.Value) *TerraspecDiagnostic {
 	errorElement := cty.ObjectVal(map[string]cty.Value{key.AsString(): got})
 	errorReject := cty.ObjectVal(map[string]cty.Value{key.AsString(): rejected})
-	return RejectErrorDiags(path.GetAttr(key.AsString()), string(MarshalValue(errorReject)), string(MarshalValue(errorElement)))
+	return RejectErrorDiags(path.GetAttr(key.AsString()), string(MarshalValue(errorReject)), string(MarshalValue(errorElement))).withMismatch(MismatchRejected, rejected, got)
 }
 
 // RejectSuccessDiags returns a diagnostic at Info level to indicate the user a given reject assertion succeeded
 func RejectSuccessDiags(path cty.Path, message string, rejected interface{}) *TerraspecDiagnostic {
-	return &TerraspecDiagnostic{tfdiags.AttributeValue(Info, "", message, path)}
+	return &TerraspecDiagnostic{Diagnostic: tfdiags.AttributeValue(Info, "", message, path)}
 }
 
 // Compare returns the difference in error numbers between one and other
@@ -65,3 +136,23 @@ func Compare(one, other tfdiags.Diagnostics) int {
 	}
 	return oneErrors - otherErrors
 }
+
+// FormatPath returns the path to an attribute as it is written in terraform config, eg aws_instance.name.tags[0]
+func FormatPath(path cty.Path) string {
+	sb := strings.Builder{}
+	for i, pa := range path {
+		switch p := pa.(type) {
+		case cty.GetAttrStep:
+			if i > 0 {
+				sb.WriteRune('.')
+			}
+			sb.WriteString(p.Name)
+		case cty.IndexStep:
+			sb.WriteRune('[')
+			val, _ := p.Key.AsBigFloat().Int64()
+			sb.WriteString(strconv.Itoa(int(val)))
+			sb.WriteRune(']')
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,123 @@
+package terraspec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// Discovery finds the test cases of a test suite. Options.Discovery selects the one used by a run,
+// so configs with an unusual layout can supply their own
+type Discovery interface {
+	// Discover returns the test cases of the spec folder specDir
+	Discover(specDir string) ([]*TestCase, error)
+}
+
+// StreamingDiscovery is a Discovery able to report every test case as soon as it's found,
+// so the test cases of large suites start running before all of them are found
+type StreamingDiscovery interface {
+	Discovery
+	// DiscoverEach calls found with every test case of the spec folder specDir. It stops at the first error returned by found
+	DiscoverEach(specDir string, found func(*TestCase) error) error
+}
+
+// discoverEach calls found with every test case found by d, as soon as it's found when d is a StreamingDiscovery
+func discoverEach(d Discovery, specDir string, found func(*TestCase) error) error {
+	if streaming, ok := d.(StreamingDiscovery); ok {
+		return streaming.DiscoverEach(specDir, found)
+	}
+	testCases, err := d.Discover(specDir)
+	if err != nil {
+		return err
+	}
+	for _, tc := range testCases {
+		if err := found(tc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DirectoryDiscovery is the default Discovery : every direct subfolder of the spec folder holding a .tfspec file is a test case,
+// except the ones whose name starts with an underscore, as well as the spec folder itself. See FindTestCases
+type DirectoryDiscovery struct{}
+
+// Discover returns the test cases found in specDir and its direct subfolders
+func (DirectoryDiscovery) Discover(specDir string) ([]*TestCase, error) {
+	return FindTestCases(specDir), nil
+}
+
+// DiscoverEach calls found with every test case of specDir and its direct subfolders, as soon as it's found
+func (DirectoryDiscovery) DiscoverEach(specDir string, found func(*TestCase) error) error {
+	err := eachTestCase(specDir, found)
+	if os.IsNotExist(err) {
+		// like FindTestCases, a missing spec folder holds no test case
+		return nil
+	}
+	return err
+}
+
+// DefaultManifestFile is the name of the manifest read by ManifestDiscovery in the spec folder
+const DefaultManifestFile = "testcases.hcl"
+
+// ManifestDiscovery reads the test cases listed in a manifest file, for spec files that are not laid out in folders.
+// Every test_case block of the manifest names a test case and gives the path of its spec file and optional variable file,
+// relative to the manifest :
+//
+//	test_case "prod" {
+//	  spec      = "../envs/prod/prod.tfspec"
+//	  variables = "../envs/prod/prod.tfvars"
+//	}
+type ManifestDiscovery struct {
+	// File is the path of the manifest. Defaults to DefaultManifestFile in the spec folder
+	File string
+}
+
+// Discover returns the test cases listed in the manifest
+func (d ManifestDiscovery) Discover(specDir string) ([]*TestCase, error) {
+	file := d.File
+	if file == "" {
+		file = filepath.Join(specDir, DefaultManifestFile)
+	}
+	f, diags := hclparse.NewParser().ParseHCLFile(file)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	var manifest struct {
+		TestCases []struct {
+			Name      string `hcl:"name,label"`
+			Spec      string `hcl:"spec"`
+			Variables string `hcl:"variables,optional"`
+		} `hcl:"test_case,block"`
+	}
+	if diags := gohcl.DecodeBody(f.Body, nil, &manifest); diags.HasErrors() {
+		return nil, diags
+	}
+
+	dir := filepath.Dir(file)
+	ranges := blockRanges(f.Body, "test_case", "name")
+	seen := make(map[string]bool)
+	testCases := make([]*TestCase, 0, len(manifest.TestCases))
+	for i, entry := range manifest.TestCases {
+		if seen[entry.Name] {
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate test case",
+				Detail:   fmt.Sprintf("A test case named %s is already listed in the manifest", entry.Name),
+				Subject:  &ranges[i],
+			}}
+		}
+		seen[entry.Name] = true
+		tc := &TestCase{Label: entry.Name, SpecFile: filepath.Join(dir, entry.Spec)}
+		tc.Dir = filepath.Dir(tc.SpecFile)
+		if entry.Variables != "" {
+			tc.VariableFile = filepath.Join(dir, entry.Variables)
+		}
+		testCases = append(testCases, tc)
+	}
+	return testCases, nil
+}
@@ -0,0 +1,106 @@
+package terraspec
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifestDiscovery(t *testing.T) {
+	cases, err := ListTestCases(Options{Dir: "testdata", SpecDir: "discovery", Discovery: ManifestDiscovery{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*TestCase{
+		{Label: "prod", Dir: filepath.Join("testdata", "envs", "prod"), SpecFile: filepath.Join("testdata", "envs", "prod", "prod.tfspec"), VariableFile: filepath.Join("testdata", "envs", "prod", "prod.tfvars")},
+		{Label: "staging", Dir: filepath.Join("testdata", "envs"), SpecFile: filepath.Join("testdata", "envs", "staging.tfspec")},
+	}
+	if nb := len(cases); nb != len(expected) {
+		t.Fatalf("expected %d test cases, got %d", len(expected), nb)
+	}
+	for i, tc := range cases {
+		if *tc != *expected[i] {
+			t.Errorf("test case %d should be %+v, got %+v", i, expected[i], tc)
+		}
+	}
+	if name := cases[1].Name(); name != "staging" {
+		t.Errorf("test case should be named after its label, got %s", name)
+	}
+}
+
+func TestManifestDiscoveryDuplicate(t *testing.T) {
+	_, err := ManifestDiscovery{File: "testdata/discovery/duplicate.hcl"}.Discover("spec")
+	if err == nil || !strings.Contains(err.Error(), "duplicate.hcl:5,1-17: Duplicate test case") {
+		t.Errorf("duplicate test cases should be rejected, got %v", err)
+	}
+}
+
+type staticDiscovery []*TestCase
+
+func (d staticDiscovery) Discover(specDir string) ([]*TestCase, error) {
+	return d, nil
+}
+
+func TestCustomDiscovery(t *testing.T) {
+	tc := &TestCase{Dir: "anywhere", SpecFile: "anywhere/case.tfspec"}
+	cases, err := ListTestCases(Options{Discovery: staticDiscovery{tc}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 1 || cases[0] != tc {
+		t.Errorf("test cases of the custom discovery expected, got %v", cases)
+	}
+}
+
+func TestDiscoverEach(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-discover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"root.tfspec":      ``,
+		"a/a.tfspec":       ``,
+		"b/b.tfspec":       ``,
+		"b/b.tfvars":       ``,
+		"notacase/main.tf": ``,
+	})
+
+	var names []string
+	err = discoverEach(DirectoryDiscovery{}, root, func(tc *TestCase) error {
+		names = append(names, tc.Name())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"a", "b", filepath.Base(root)}; strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected test cases %v, got %v", expected, names)
+	}
+
+	stop := errors.New("stop")
+	names = nil
+	err = discoverEach(DirectoryDiscovery{}, root, func(tc *TestCase) error {
+		names = append(names, tc.Name())
+		return stop
+	})
+	if err != stop || len(names) != 1 {
+		t.Errorf("Discovery should stop at the first error, got %v after %v", err, names)
+	}
+
+	if err := discoverEach(DirectoryDiscovery{}, filepath.Join(root, "missing"), func(*TestCase) error { return stop }); err != nil {
+		t.Errorf("A missing spec folder should hold no test case, got %v", err)
+	}
+
+	tc := &TestCase{Dir: "anywhere", SpecFile: "anywhere/case.tfspec"}
+	var found []*TestCase
+	if err := discoverEach(staticDiscovery{tc}, "spec", func(tc *TestCase) error {
+		found = append(found, tc)
+		return nil
+	}); err != nil || len(found) != 1 || found[0] != tc {
+		t.Errorf("Test cases of a discovery that doesn't stream should be found, got %v, %v", found, err)
+	}
+}
@@ -0,0 +1,206 @@
+package terraspec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/rpc/jsonrpc"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// DefaultDockerBin is the docker binary running the containers of the test cases when Options.DockerBin is not set
+const DefaultDockerBin = "docker"
+
+// containerDir is the folder the config is mounted at in the container of a test case
+const containerDir = "/workspace"
+
+// containerReply is the reply of the Terraspec.Run method of the terraspec server running in the container, see package server
+type containerReply struct {
+	Cases []*containerCase
+}
+
+// containerCase is the outcome of a test case reported by the terraspec server running in the container
+type containerCase struct {
+	Name            string
+	Plan            string
+	Assertions      []*Assertion
+	Skipped         int
+	Diagnostics     []*containerDiagnostic
+	Timings         *Timings
+	SkipReason      string
+	ExpectedFailure string
+	PlanJSON        json.RawMessage
+}
+
+type containerDiagnostic struct {
+	Severity string
+	Summary  string
+	Detail   string
+	Range    *hcl.Range
+}
+
+// containerPaths maps the paths of the container of a test case to the paths of the host
+type containerPaths struct {
+	// hostDir is the folder of the config as given by the run, mounted at containerDir
+	hostDir string
+}
+
+// host returns the path of the host for p, a path of the container, absolute or relative to containerDir
+func (c containerPaths) host(p string) string {
+	if p == "" {
+		return p
+	}
+	rel := p
+	if path.IsAbs(p) {
+		if p != containerDir && !strings.HasPrefix(p, containerDir+"/") {
+			return p
+		}
+		rel = strings.TrimPrefix(strings.TrimPrefix(p, containerDir), "/")
+	}
+	return filepath.Join(c.hostDir, filepath.FromSlash(rel))
+}
+
+// message replaces the paths of the container found in a message by the paths of the host
+func (c containerPaths) message(m string) string {
+	return strings.Replace(m, containerDir+"/", filepath.Clean(c.hostDir)+string(filepath.Separator), -1)
+}
+
+// container returns the path of the container for p, a path of the host inside hostDir
+func (c containerPaths) container(p string) (string, error) {
+	rel, err := filepath.Rel(absPath(c.hostDir), absPath(p))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the config folder %s mounted in the container", p, c.hostDir)
+	}
+	return path.Join(containerDir, filepath.ToSlash(rel)), nil
+}
+
+// runInContainer runs the test case with the terraspec binary of a docker image, so the terraform and provider versions
+// pinned in the image are used whatever the host has. The config folder is mounted in the container, where terraspec serve
+// runs the test case, and the paths of its diagnostics are mapped back to the host
+func runInContainer(ctx context.Context, dir string, tc *TestCase, tsCtx *Context, display planDisplay) (caseOutput, tfdiags.Diagnostics) {
+	var out caseOutput
+	var diags tfdiags.Diagnostics
+	paths := containerPaths{hostDir: dir}
+
+	specDir, err := paths.container(tc.Dir)
+	if err != nil {
+		return out, diags.Append(err)
+	}
+	opts := Options{Dir: containerDir, SpecDir: specDir, DisplayPlan: display == displayAll, DisplayPlanOnFailure: display == displayFailed,
+		ModuleMode: tsCtx.ModuleMode, Isolate: tsCtx.Isolate, ShowSensitive: tsCtx.ShowSensitive, PlanFile: tsCtx.PlanFile}
+	if tsCtx.UserVersion != nil {
+		opts.ClaimVersion = tsCtx.UserVersion.String()
+	}
+	if tsCtx.BaseVariableFile != "" {
+		if opts.BaseVariableFile, err = paths.container(tsCtx.BaseVariableFile); err != nil {
+			return out, diags.Append(err)
+		}
+	}
+
+	bin := tsCtx.DockerBin
+	if bin == "" {
+		bin = DefaultDockerBin
+	}
+	args := []string{"run", "--rm", "-i", "-v", absPath(dir) + ":" + containerDir, "-w", containerDir, "--entrypoint", "terraspec", tsCtx.DockerImage, "serve"}
+	reply, err := callContainer(ctx, bin, args, opts)
+	if err != nil {
+		return out, diags.Append(fmt.Errorf("Could not run the test case in %s : %v", tsCtx.DockerImage, err))
+	}
+
+	var result *containerCase
+	for _, c := range reply.Cases {
+		if c.Name == tc.Name() || len(reply.Cases) == 1 {
+			result = c
+		}
+	}
+	if result == nil {
+		return out, diags.Append(fmt.Errorf("Test case %s was not run in %s", tc.Name(), tsCtx.DockerImage))
+	}
+	if result.SkipReason != "" {
+		return out, diags.Append(tfdiags.Sourceless(tfdiags.Error, "Test case skipped in the container", result.SkipReason))
+	}
+
+	out.rendered = result.Plan
+	out.json = result.PlanJSON
+	out.skipped = result.Skipped
+	out.expectedFailure = result.ExpectedFailure
+	if result.Timings != nil {
+		out.timings = *result.Timings
+	}
+	for _, d := range result.Diagnostics {
+		diag := &hcl.Diagnostic{Severity: hcl.DiagError, Summary: paths.message(d.Summary), Detail: paths.message(d.Detail)}
+		if d.Severity == "warning" {
+			diag.Severity = hcl.DiagWarning
+		}
+		if d.Range != nil {
+			rng := *d.Range
+			rng.Filename = paths.host(rng.Filename)
+			diag.Subject = &rng
+		}
+		diags = diags.Append(diag)
+	}
+	for _, a := range result.Assertions {
+		severity := tfdiags.Error
+		if a.Passed {
+			severity = Info
+		}
+		diag := &TerraspecDiagnostic{Diagnostic: tfdiags.AttributeValue(severity, "", paths.message(a.Message), parsePath(a.Path)), Mismatch: a.Mismatch, FailureMessage: a.FailureMessage}
+		if a.Range != nil {
+			rng := *a.Range
+			rng.Filename = paths.host(rng.Filename)
+			diag.Subject = &rng
+		}
+		diags = diags.Append(diag)
+	}
+	return out, diags
+}
+
+// callContainer starts the terraspec server with bin and args, and asks it to run the test cases described by opts
+func callContainer(ctx context.Context, bin string, args []string, opts Options) (*containerReply, error) {
+	cmd := exec.CommandContext(ctx, bin, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	// closing the client closes stdin, which stops the server
+	client := jsonrpc.NewClient(containerConn{ReadCloser: stdout, WriteCloser: stdin})
+	reply := &containerReply{}
+	callErr := client.Call("Terraspec.Run", opts, reply)
+	client.Close()
+	waitErr := cmd.Wait()
+	if callErr != nil {
+		if waitErr != nil {
+			callErr = waitErr
+		}
+		return nil, fmt.Errorf("%s %s : %v\n%s", bin, strings.Join(args, " "), callErr, stderr.String())
+	}
+	return reply, nil
+}
+
+// containerConn joins the output and the input of the container in a single connection
+type containerConn struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (c containerConn) Close() error {
+	return c.WriteCloser.Close()
+}
@@ -0,0 +1,70 @@
+package terraspec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+func TestRunSuiteInDocker(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "spec", "web"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "spec", "web", "web.tfspec"), []byte(`assert "aws_instance" "web" {}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fake docker records its arguments and the request it's given, and replies as the terraspec server of the container
+	bin := filepath.Join(root, "docker")
+	script := `#!/bin/sh
+echo "$@" > ` + filepath.Join(root, "args") + `
+read request
+echo "$request" > ` + filepath.Join(root, "request") + `
+echo '{"id":0,"error":null,"result":{"Cases":[{"Name":"web","Failed":true,"Skipped":1,
+"Assertions":[{"Path":"aws_instance.web.ami","Passed":false,"Message":"ami-1 != ami-2","Range":{"Filename":"/workspace/spec/web/web.tfspec","Start":{"Line":1,"Column":1,"Byte":0},"End":{"Line":1,"Column":28,"Byte":27}}}],
+"Diagnostics":[{"Severity":"warning","Summary":"Deprecated attribute","Detail":"Declared in /workspace/main.tf","Range":{"Filename":"main.tf","Start":{"Line":3,"Column":1,"Byte":20},"End":{"Line":3,"Column":5,"Byte":24}}}]}]}}' | tr -d '\n'
+echo
+`
+	if err := ioutil.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := RunSuite(context.Background(), Options{Dir: root, DockerImage: "toolchain:1.2", DockerBin: bin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args, err := ioutil.ReadFile(filepath.Join(root, "args")); err != nil || strings.TrimSpace(string(args)) != "run --rm -i -v "+root+":/workspace -w /workspace --entrypoint terraspec toolchain:1.2 serve" {
+		t.Errorf("Unexpected arguments of docker %q, %v", args, err)
+	}
+	if request, err := ioutil.ReadFile(filepath.Join(root, "request")); err != nil || !strings.Contains(string(request), `"SpecDir":"/workspace/spec/web"`) {
+		t.Errorf("Expected the test case folder of the container in the request, got %s, %v", request, err)
+	}
+
+	if len(results.Cases) != 1 {
+		t.Fatalf("Expected 1 test case, got %d", len(results.Cases))
+	}
+	r := results.Cases[0]
+	if !r.Failed() || r.Skipped != 1 || len(r.Assertions) != 1 || len(r.Diagnostics) != 2 {
+		t.Fatalf("Unexpected result %+v", r)
+	}
+	if a := r.Assertions[0]; a.Path != "aws_instance.web.ami" || a.Range == nil || a.Range.Filename != filepath.Join(root, "spec", "web", "web.tfspec") {
+		t.Errorf("Expected the assertion to be located on the host, got %+v", a)
+	}
+	warning := r.Diagnostics[0]
+	if warning.Severity() != tfdiags.Warning || warning.Description().Detail != "Declared in "+filepath.Join(root, "main.tf") {
+		t.Errorf("Expected the paths of the warning to be mapped to the host, got %q", warning.Description().Detail)
+	}
+	if subject := warning.Source().Subject; subject == nil || subject.Filename != filepath.Join(root, "main.tf") {
+		t.Errorf("Expected the warning to be located on the host, got %+v", subject)
+	}
+}
@@ -0,0 +1,117 @@
+package terraspec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/lang"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// unknownExpansionDetails are the beginnings of the details of the diagnostics terraform returns
+// when the count or for_each argument of a resource is unknown at plan time
+var unknownExpansionDetails = map[string]string{
+	"Invalid count argument":    `The "count" value depends on resource attributes that cannot be determined until apply`,
+	"Invalid for_each argument": `The "for_each" value depends on resource attributes that cannot be determined until apply`,
+}
+
+// ExplainUnknownExpansion replaces the diagnostics terraform returns when a count or for_each argument is unknown
+// with a diagnostic telling which values must be mocked in the spec
+func ExplainUnknownExpansion(diags tfdiags.Diagnostics, cfg *configs.Config) tfdiags.Diagnostics {
+	var explained tfdiags.Diagnostics
+	for _, diag := range diags {
+		desc := diag.Description()
+		prefix, ok := unknownExpansionDetails[desc.Summary]
+		subject := diag.Source().Subject
+		if !ok || !strings.HasPrefix(desc.Detail, prefix) || subject == nil {
+			explained = explained.Append(diag)
+			continue
+		}
+		resource, argument, expr := findExpansion(cfg, subject.ToHCL())
+		if resource == "" {
+			explained = explained.Append(diag)
+			continue
+		}
+
+		var unknowns []string
+		refs, _ := lang.ReferencesInExpr(expr)
+		for _, ref := range refs {
+			unknowns = append(unknowns, ref.Subject.String())
+		}
+		detail := fmt.Sprintf("The %s of %s depends on %s, which can't be known by terraspec until apply.\n"+
+			"Mock the data sources it depends on with a mock block, or mock the count of the resource with the mock_counts attribute of the terraspec block in your spec file :\n\n"+
+			"terraspec {\n  mock_counts = {\n    %q = 1\n  }\n}",
+			argument, resource, strings.Join(unknowns, ", "), resource)
+		subjectRange := subject.ToHCL()
+		explained = explained.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Unknown %s value", argument),
+			Detail:   detail,
+			Subject:  &subjectRange,
+		})
+	}
+	return explained
+}
+
+// findExpansion finds the resource whose count or for_each expression is defined at the given range.
+// It returns the address of the resource, the argument name and its expression
+func findExpansion(cfg *configs.Config, rng hcl.Range) (string, string, hcl.Expression) {
+	var resource, argument string
+	var expr hcl.Expression
+	if cfg == nil {
+		return resource, argument, expr
+	}
+	cfg.DeepEach(func(c *configs.Config) {
+		for _, resources := range []map[string]*configs.Resource{c.Module.ManagedResources, c.Module.DataResources} {
+			for _, r := range resources {
+				if r.Count != nil && r.Count.Range() == rng {
+					resource, argument, expr = r.Addr().InModule(c.Path).String(), "count", r.Count
+				}
+				if r.ForEach != nil && r.ForEach.Range() == rng {
+					resource, argument, expr = r.Addr().InModule(c.Path).String(), "for_each", r.ForEach
+				}
+			}
+		}
+	})
+	return resource, argument, expr
+}
+
+// OverrideCounts replaces the count argument of the resources of cfg with the given values.
+// Keys of counts are resource addresses, eg module.db.aws_instance.replica
+func OverrideCounts(cfg *configs.Config, counts map[string]int) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	found := make(map[string]bool, len(counts))
+	cfg.DeepEach(func(c *configs.Config) {
+		for _, resources := range []map[string]*configs.Resource{c.Module.ManagedResources, c.Module.DataResources} {
+			for _, r := range resources {
+				addr := r.Addr().InModule(c.Path).String()
+				count, ok := counts[addr]
+				if !ok {
+					continue
+				}
+				found[addr] = true
+				rng := r.DeclRange
+				if r.Count != nil {
+					rng = r.Count.Range()
+				}
+				r.Count = hcl.StaticExpr(cty.NumberIntVal(int64(count)), rng)
+				r.ForEach = nil
+			}
+		}
+	})
+	missing := make([]string, 0, len(counts))
+	for addr := range counts {
+		if !found[addr] {
+			missing = append(missing, addr)
+		}
+	}
+	sort.Strings(missing)
+	for _, addr := range missing {
+		diags = diags.Append(fmt.Errorf("Mocked count of %s matches no resource of the config", addr))
+	}
+	return diags
+}
@@ -0,0 +1,73 @@
+package terraspec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func loadExpansionConfig(t *testing.T) *configs.Config {
+	module, diags := configs.NewParser(nil).LoadConfigDir("testdata/expansion")
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	return &configs.Config{Module: module}
+}
+
+func TestExplainUnknownExpansion(t *testing.T) {
+	cfg := loadExpansionConfig(t)
+	countRange := cfg.Module.ManagedResources["ressource_type.replica"].Count.Range()
+
+	var diags tfdiags.Diagnostics
+	diags = diags.Append(&hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid count argument",
+		Detail:   `The "count" value depends on resource attributes that cannot be determined until apply, so Terraform cannot predict how many instances will be created.`,
+		Subject:  &countRange,
+	})
+	diags = diags.Append(&hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid count argument",
+		Detail:   `The given "count" argument value is null. An integer is required.`,
+		Subject:  &countRange,
+	})
+
+	explained := ExplainUnknownExpansion(diags, cfg)
+	if nb := len(explained); nb != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d", nb)
+	}
+	if got := explained[0].Description().Summary; got != "Unknown count value" {
+		t.Errorf("unknown count should be explained, got %s", got)
+	}
+	detail := explained[0].Description().Detail
+	for _, expected := range []string{"ressource_type.replica", "data.data_type.selected", `"ressource_type.replica" = 1`} {
+		if !strings.Contains(detail, expected) {
+			t.Errorf("explanation should mention %s, got %s", expected, detail)
+		}
+	}
+	if got := explained[1].Description().Detail; got != diags[1].Description().Detail {
+		t.Errorf("other diagnostics should be left unchanged, got %s", got)
+	}
+}
+
+func TestOverrideCounts(t *testing.T) {
+	cfg := loadExpansionConfig(t)
+
+	diags := OverrideCounts(cfg, map[string]int{"ressource_type.replica": 3})
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	count, _ := cfg.Module.ManagedResources["ressource_type.replica"].Count.Value(nil)
+	if !count.RawEquals(cty.NumberIntVal(3)) {
+		t.Errorf("count should be overridden with 3, got %#v", count)
+	}
+
+	diags = OverrideCounts(cfg, map[string]int{"ressource_type.missing": 1})
+	if !diags.HasErrors() {
+		t.Errorf("overriding the count of a missing resource should fail")
+	}
+}
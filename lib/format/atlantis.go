@@ -0,0 +1,84 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	terraspec "github.com/nhurel/terraspec/lib"
+)
+
+// maxAtlantisErrors is the number of errors listed for a failing test case, so the comment of a pull request stays readable
+const maxAtlantisErrors = 10
+
+// Atlantis writes the compact summary of a run posted by Atlantis in the comments of a pull request, when terraspec runs as a step
+// of a custom workflow : a line telling if the run passed with the number of test cases and assertions, then every failing
+// test case with its errors, one line each. Passing test cases are left out, and the output has no color nor emoji
+func Atlantis(w io.Writer, results *terraspec.Results) error {
+	passed, failed := results.Count()
+	status := "PASSED"
+	if results.Failed() {
+		status = "FAILED"
+	}
+	evaluated, _ := results.AssertionCount()
+	summary := fmt.Sprintf("terraspec %s : %d of %d test cases failed, %d assertions evaluated in %s", status, failed, passed+failed, evaluated, results.Duration.Round(100*time.Millisecond))
+	if skipped := results.SkippedCount(); skipped > 0 {
+		summary += fmt.Sprintf(", %d test cases skipped", skipped)
+	}
+	if _, err := fmt.Fprintln(w, summary); err != nil {
+		return err
+	}
+
+	for _, r := range sortedCases(results) {
+		if r.SkipReason != "" || !r.Failed() {
+			continue
+		}
+		fmt.Fprintf(w, "\nFAIL %s\n", r.Name)
+		var errors []string
+		for _, diag := range r.Diagnostics {
+			if diag.Severity() != tfdiags.Error || r.ExpectedFailure != "" && isAssertion(diag) {
+				continue
+			}
+			errors = append(errors, compactDiagnostic(diag))
+		}
+		for i, e := range errors {
+			if i == maxAtlantisErrors {
+				fmt.Fprintf(w, "  ... and %d more errors\n", len(errors)-maxAtlantisErrors)
+				break
+			}
+			fmt.Fprintf(w, "  %s\n", e)
+		}
+	}
+	for _, s := range results.CoverageShortfalls {
+		scope := "all modules"
+		if s.Module != "" {
+			scope = "module " + s.Module
+		}
+		fmt.Fprintf(w, "\nFAIL coverage of %s : %.0f%% of resources and %.0f%% of attributes asserted, below the minimum\n", scope, s.ResourceRatio*100, s.AttributeRatio*100)
+	}
+	return nil
+}
+
+// compactDiagnostic renders an error on a single line : the asserted path and message of a failed assertion, or the location,
+// summary and detail of another error
+func compactDiagnostic(diag tfdiags.Diagnostic) string {
+	desc := diag.Description()
+	message := desc.Summary
+	if desc.Detail != "" {
+		message = fmt.Sprintf("%s : %s", desc.Summary, desc.Detail)
+	}
+	if d, ok := diag.(*terraspec.TerraspecDiagnostic); ok {
+		message = desc.Detail
+		if d.FailureMessage != "" {
+			message = fmt.Sprintf("%s : %s", d.FailureMessage, message)
+		}
+		if path := tfdiags.GetAttribute(d.Diagnostic); path != nil {
+			message = fmt.Sprintf("%s : %s", terraspec.FormatPath(path), message)
+		}
+	} else if subject := diag.Source().Subject; subject != nil {
+		message = fmt.Sprintf("%s#%d,%d : %s", subject.Filename, subject.Start.Line, subject.Start.Column, message)
+	}
+	return strings.Join(strings.Fields(message), " ")
+}
@@ -0,0 +1,43 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	terraspec "github.com/nhurel/terraspec/lib"
+)
+
+func TestAtlantis(t *testing.T) {
+	tests := map[string]struct {
+		results  *terraspec.Results
+		expected string
+	}{
+		"Failing": {
+			results: gitlabResults(),
+			expected: `terraspec FAILED : 2 of 3 test cases failed, 0 assertions evaluated in 3s, 1 test cases skipped
+
+FAIL broken
+  Could not compute the plan
+
+FAIL web
+  aws_instance.web.ami : ami-1 != ami-2
+`,
+		},
+		"Passing": {
+			results:  &terraspec.Results{Duration: 1234 * time.Millisecond, Cases: []*terraspec.CaseResult{{Name: "web"}}},
+			expected: "terraspec PASSED : 0 of 1 test cases failed, 0 assertions evaluated in 1.2s\n",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Atlantis(&out, tt.results); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("Expected\n%s\ngot\n%s", tt.expected, out.String())
+			}
+		})
+	}
+}
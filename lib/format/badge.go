@@ -0,0 +1,33 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	terraspec "github.com/nhurel/terraspec/lib"
+)
+
+// badge is the JSON read by the endpoint badges of shields.io
+type badge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// Badge writes the outcome of the run as the JSON of a shields.io endpoint badge : green with the number of test cases passed,
+// red with the number of test cases failed as well when the run failed, and grey when no test case ran
+func Badge(w io.Writer, results *terraspec.Results) error {
+	passed, failed := results.Count()
+	b := badge{SchemaVersion: 1, Label: "terraspec", Message: fmt.Sprintf("%d passed", passed), Color: "brightgreen"}
+	switch {
+	case results.Failed():
+		b.Message, b.Color = fmt.Sprintf("%d failed, %d passed", failed, passed), "red"
+	case passed == 0:
+		b.Message, b.Color = "no test case", "lightgrey"
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b)
+}
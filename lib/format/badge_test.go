@@ -0,0 +1,38 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	terraspec "github.com/nhurel/terraspec/lib"
+)
+
+func TestBadge(t *testing.T) {
+	failed := &terraspec.CaseResult{Name: "web", Diagnostics: tfdiags.Diagnostics{}.Append(errors.New("Could not compute the plan"))}
+	tests := map[string]struct {
+		cases    []*terraspec.CaseResult
+		expected badge
+	}{
+		"Passing":      {cases: []*terraspec.CaseResult{{Name: "db"}, {Name: "web"}}, expected: badge{SchemaVersion: 1, Label: "terraspec", Message: "2 passed", Color: "brightgreen"}},
+		"Failing":      {cases: []*terraspec.CaseResult{{Name: "db"}, failed}, expected: badge{SchemaVersion: 1, Label: "terraspec", Message: "1 failed, 1 passed", Color: "red"}},
+		"No test case": {cases: []*terraspec.CaseResult{{Name: "parked", SkipReason: "waiting for a fix"}}, expected: badge{SchemaVersion: 1, Label: "terraspec", Message: "no test case", Color: "lightgrey"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Badge(&out, &terraspec.Results{Cases: tt.cases}); err != nil {
+				t.Fatal(err)
+			}
+			var got badge
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected badge %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
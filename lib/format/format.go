@@ -0,0 +1,367 @@
+// Package format renders test results as the terraspec command prints them,
+// so other frontends, like the JSON-RPC server or go tests, show identical output
+package format
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/mitchellh/colorstring"
+	terraspec "github.com/nhurel/terraspec/lib"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Options configures how results are rendered
+type Options struct {
+	// Color highlights paths, successes and failures with ANSI escape codes
+	Color bool
+	// Emoji marks test cases and assertions with emoji rather than plain text markers
+	Emoji bool
+	// Width wraps the messages longer than Width columns. Messages are not wrapped when Width is 0
+	Width int
+}
+
+// CLI holds the options used by the terraspec command
+var CLI = Options{Color: true, Emoji: true}
+
+// markers of test cases, passed and failed assertions
+type markers struct {
+	testCase, passed, failed, cached, skipped, xfail, timings, memory, coverage, count string
+}
+
+var (
+	emojiMarkers = markers{testCase: "🏷  ", passed: " ✔  ", failed: " ❌  ", cached: " ♻️  ", skipped: " ⏭  ", xfail: " 🐛 ", timings: " ⏱  ", memory: " 📈 ", coverage: " 📊 ", count: " 🔢 "}
+	plainMarkers = markers{testCase: "=== ", passed: " PASS ", failed: " FAIL ", cached: " CACHED ", skipped: " SKIP ", xfail: " XFAIL ", timings: " TIME ", memory: " MEM ", coverage: " COVER ", count: " COUNT "}
+)
+
+func (o Options) markers() markers {
+	if o.Emoji {
+		return emojiMarkers
+	}
+	return plainMarkers
+}
+
+func (o Options) colorize(s string) string {
+	return (&colorstring.Colorize{Colors: colorstring.DefaultColors, Disable: !o.Color, Reset: true}).Color(s)
+}
+
+// CaseResult writes the name of a test case, its plan when it was rendered, its diagnostics, the number of assertions evaluated
+// and the temporary folders kept. The count is highlighted when no assertion was evaluated or when blocks of the spec were skipped.
+// A cached result is reported as a cached pass with the number of its assertions, as its diagnostics are not cached,
+// and a skipped test case with the reason it was skipped. A test case that failed as expected is reported with the reason it's expected to fail
+func CaseResult(w io.Writer, r *terraspec.CaseResult, opts Options) {
+	fmt.Fprintf(w, "%s%s\n", opts.markers().testCase, r.Name)
+	if r.Plan != "" {
+		fmt.Fprintln(w, r.Plan)
+	}
+	if r.Cached {
+		fmt.Fprintln(w, opts.colorize(fmt.Sprintf("%s[green]cached pass : %d assertions", opts.markers().cached, len(r.Assertions))))
+		return
+	}
+	if r.SkipReason != "" {
+		fmt.Fprintln(w, opts.colorize(fmt.Sprintf("%s[yellow]skipped : %s", opts.markers().skipped, r.SkipReason)))
+		return
+	}
+	Diagnostics(w, r.Diagnostics, opts)
+	AssertionCount(w, r, opts)
+	if r.FailedAsExpected() {
+		fmt.Fprintln(w, opts.colorize(fmt.Sprintf("%s[green]failed as expected : %s", opts.markers().xfail, r.ExpectedFailure)))
+	}
+	for _, dir := range r.Artifacts {
+		fmt.Fprintln(w, opts.colorize(fmt.Sprintf("[dim]Temporary files kept in %s", dir)))
+	}
+}
+
+// AssertionCount writes the number of assertions evaluated by a test case, and of the assert and reject blocks skipped, on a single line
+func AssertionCount(w io.Writer, r *terraspec.CaseResult, opts Options) {
+	count := fmt.Sprintf("%d assertions evaluated", len(r.Assertions))
+	if r.Skipped > 0 {
+		count += fmt.Sprintf(", %d assert and reject blocks skipped", r.Skipped)
+	}
+	color := "[dim]"
+	if len(r.Assertions) == 0 || r.Skipped > 0 {
+		color = "[yellow]"
+	}
+	fmt.Fprintln(w, opts.colorize(opts.markers().count+color+count))
+}
+
+// Timings writes the time spent in every phase on a single line
+func Timings(w io.Writer, t *terraspec.Timings, opts Options) {
+	fmt.Fprintln(w, opts.colorize(fmt.Sprintf("%s[dim]config %s, schemas %s, refresh %s, plan %s, validate %s", opts.markers().timings,
+		t.ConfigLoad.Round(time.Millisecond), t.SchemaFetch.Round(time.Millisecond), t.Refresh.Round(time.Millisecond),
+		t.Plan.Round(time.Millisecond), t.Validate.Round(time.Millisecond))))
+}
+
+// Coverage writes the number of planned resources and attributes checked by an assertion on a single line,
+// followed by the resources no assertion checks
+func Coverage(w io.Writer, c *terraspec.Coverage, opts Options) {
+	var resources, attributes, totalAttributes int
+	for _, r := range c.Resources {
+		if r.Covered {
+			resources++
+		}
+		for _, ok := range r.Attributes {
+			if ok {
+				attributes++
+			}
+			totalAttributes++
+		}
+	}
+	fmt.Fprintln(w, opts.colorize(fmt.Sprintf("%s[dim]%d/%d resources and %d/%d attributes asserted", opts.markers().coverage, resources, len(c.Resources), attributes, totalAttributes)))
+	for _, addr := range c.Uncovered() {
+		fmt.Fprintln(w, opts.colorize(fmt.Sprintf("[yellow]    not asserted : %s", addr)))
+	}
+}
+
+// MemStats writes the memory used on a single line, followed by the provider plugins left unclosed if any
+func MemStats(w io.Writer, m *terraspec.MemStats, opts Options) {
+	rss := "unknown"
+	if m.PeakRSS > 0 {
+		rss = mebibytes(m.PeakRSS)
+	}
+	fmt.Fprintln(w, opts.colorize(fmt.Sprintf("%s[dim]peak RSS %s, heap %s", opts.markers().memory, rss, mebibytes(m.Heap))))
+	if len(m.UnclosedPlugins) > 0 {
+		fmt.Fprintln(w, opts.colorize(fmt.Sprintf("[yellow]Provider plugins not closed : %s", strings.Join(m.UnclosedPlugins, ", "))))
+	}
+}
+
+func mebibytes(n uint64) string {
+	return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+}
+
+// Diagnostics writes every diagnostic on its own line
+func Diagnostics(w io.Writer, diags tfdiags.Diagnostics, opts Options) {
+	for _, diag := range diags {
+		fmt.Fprintln(w, Diagnostic(diag, opts))
+	}
+}
+
+// Diagnostic renders a diagnostic. Assertion results are marked as passed or failed and show the asserted path,
+// other diagnostics show the range of the config or spec they come from when it's known.
+// Failed assertions are preceded by the message of their assert block and end with the range of their spec block, when known. The ones about a collection or a value missing from the plan
+// are followed by the expected and actual values side by side
+func Diagnostic(diag tfdiags.Diagnostic, opts Options) string {
+	var prefix, message, location, values string
+	color := "[red]"
+	switch d := diag.(type) {
+	case *terraspec.TerraspecDiagnostic:
+		passed := diag.Severity() == terraspec.Info
+		prefix = opts.markers().failed
+		if passed {
+			prefix = opts.markers().passed
+		}
+		if path := tfdiags.GetAttribute(d.Diagnostic); path != nil {
+			prefix += fmt.Sprintf("[bold]%s[reset] ", terraspec.FormatPath(path))
+		}
+		message = diag.Description().Detail
+		if passed {
+			prefix += "= "
+			color = "[green]"
+		} else {
+			prefix += ": "
+			if d.FailureMessage != "" {
+				message = fmt.Sprintf("%s : %s", d.FailureMessage, message)
+			}
+			if d.Subject != nil {
+				location = fmt.Sprintf("[reset][dim] (%s#%d,%d)", d.Subject.Filename, d.Subject.Start.Line, d.Subject.Start.Column)
+			}
+			values = sideBySide(d.Mismatch, opts)
+		}
+
+	default:
+		if subj := diag.Source().Subject; subj != nil {
+			prefix = fmt.Sprintf("[bold]%s#%d,%d[reset] : ", subj.Filename, subj.Start.Line, subj.Start.Column)
+		}
+		desc := diag.Description()
+		message = desc.Detail
+		if desc.Summary != "" && desc.Detail != "" {
+			message = fmt.Sprintf("%s : %s", desc.Summary, desc.Detail)
+		} else if desc.Summary != "" {
+			message = desc.Summary
+		}
+	}
+	indent := utf8.RuneCountInString(strings.NewReplacer("[bold]", "", "[reset]", "").Replace(prefix))
+	return opts.colorize(prefix+color+wrap(message, opts.Width, indent)+location) + values
+}
+
+// maxSideBySideRows is the number of values shown side by side for a failed assertion, so a large object doesn't flood the output
+const maxSideBySideRows = 30
+
+// sideBySide renders the expected and actual values of a failed assertion in aligned columns, one row per primitive value
+// they hold, with the rows that differ highlighted. It's empty when both values are primitive, as the detail of the diagnostic
+// already tells them, and for the assertions that have no expected value, eg matchers
+func sideBySide(m *terraspec.Mismatch, opts Options) string {
+	if m == nil || m.Expected == cty.NilVal || primitive(m.Expected) && primitive(m.Actual) {
+		return ""
+	}
+	expected, actual := flatten(m.Expected), flatten(m.Actual)
+	paths := make([]string, 0, len(expected.paths)+len(actual.paths))
+	paths = append(paths, expected.paths...)
+	for _, p := range actual.paths {
+		if _, ok := expected.values[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+
+	type row struct{ path, expected, actual string }
+	rows := []row{{"", "expected", "actual"}}
+	for _, p := range paths {
+		rows = append(rows, row{p, cell(expected, p), cell(actual, p)})
+	}
+	var hidden int
+	if len(rows) > maxSideBySideRows+1 {
+		hidden = len(rows) - maxSideBySideRows - 1
+		rows = rows[:maxSideBySideRows+1]
+	}
+	pathWidth, expectedWidth := 0, 0
+	for _, r := range rows {
+		if n := utf8.RuneCountInString(r.path); n > pathWidth {
+			pathWidth = n
+		}
+		if n := utf8.RuneCountInString(r.expected); n > expectedWidth {
+			expectedWidth = n
+		}
+	}
+
+	indent := strings.Repeat(" ", utf8.RuneCountInString(opts.markers().failed))
+	var sb strings.Builder
+	for i, r := range rows {
+		line := fmt.Sprintf("%-*s  %s", expectedWidth, r.expected, r.actual)
+		if pathWidth > 0 {
+			line = fmt.Sprintf("%-*s  %s", pathWidth, r.path, line)
+		}
+		switch {
+		case i == 0:
+			line = "[dim]  " + line
+		case r.expected != r.actual:
+			line = "[yellow]~ " + line
+		default:
+			line = "  " + line
+		}
+		sb.WriteString("\n" + opts.colorize(indent+strings.TrimRight(line, " ")))
+	}
+	if hidden > 0 {
+		sb.WriteString("\n" + opts.colorize(fmt.Sprintf("%s[dim]  (%d more values)", indent, hidden)))
+	}
+	return sb.String()
+}
+
+func primitive(val cty.Value) bool {
+	return val != cty.NilVal && val.IsKnown() && !val.IsNull() && val.Type().IsPrimitiveType()
+}
+
+// flatValues are the primitive values held by a value, by path relative to it, in the order of the value
+type flatValues struct {
+	paths  []string
+	values map[string]cty.Value
+}
+
+// cell renders the value found at path, or that there's none
+func cell(f flatValues, path string) string {
+	val, ok := f.values[path]
+	if !ok {
+		val = cty.NilVal
+	}
+	return value(val)
+}
+
+// flatten returns the primitive values of val, and its empty, null or unknown collections, by path.
+// A primitive val has the single path ""
+func flatten(val cty.Value) flatValues {
+	f := flatValues{values: make(map[string]cty.Value)}
+	var walk func(path string, v cty.Value)
+	walk = func(path string, v cty.Value) {
+		if v == cty.NilVal || !v.IsKnown() || v.IsNull() || !v.CanIterateElements() || v.LengthInt() == 0 {
+			f.paths = append(f.paths, path)
+			f.values[path] = v
+			return
+		}
+		ty := v.Type()
+		for i, it := 0, v.ElementIterator(); it.Next(); i++ {
+			key, elem := it.Element()
+			switch {
+			case ty.IsObjectType() || ty.IsMapType():
+				name := key.AsString()
+				if path != "" {
+					name = path + "." + name
+				}
+				walk(name, elem)
+			default:
+				walk(fmt.Sprintf("%s[%d]", path, i), elem)
+			}
+		}
+	}
+	walk("", val)
+	return f
+}
+
+// wrap breaks the lines of message longer than width columns at spaces.
+// The first line is expected to start at column indent, and the next ones are indented to start at the same column
+func wrap(message string, width, indent int) string {
+	if width <= 0 || indent >= width {
+		return message
+	}
+	padding := strings.Repeat(" ", indent)
+	var sb strings.Builder
+	for i, line := range strings.Split(message, "\n") {
+		if i > 0 {
+			sb.WriteString("\n" + padding)
+		}
+		col := indent
+		for j, word := range strings.Split(line, " ") {
+			n := utf8.RuneCountInString(word)
+			if j > 0 {
+				if col+1+n > width {
+					sb.WriteString("\n" + padding)
+					col = indent
+				} else {
+					sb.WriteByte(' ')
+					col++
+				}
+			}
+			sb.WriteString(word)
+			col += n
+		}
+	}
+	return sb.String()
+}
+
+// PlanDiff writes the resources added to, removed from and changed between two plans, with their changed attributes
+func PlanDiff(w io.Writer, diff *terraspec.PlanDiff, opts Options) {
+	for _, addr := range diff.Added {
+		fmt.Fprintln(w, opts.colorize(fmt.Sprintf("[green]+ [bold]%s", addr)))
+	}
+	for _, addr := range diff.Removed {
+		fmt.Fprintln(w, opts.colorize(fmt.Sprintf("[red]- [bold]%s", addr)))
+	}
+	for _, rd := range diff.Changed {
+		line := fmt.Sprintf("[yellow]~ [bold]%s", rd.Address)
+		if rd.ActionA != rd.ActionB {
+			line += fmt.Sprintf("[reset] : %s => %s", rd.ActionA, rd.ActionB)
+		}
+		fmt.Fprintln(w, opts.colorize(line))
+		for _, attr := range rd.Attributes {
+			fmt.Fprintln(w, opts.colorize(fmt.Sprintf("    [bold]%s[reset] : %s => %s", terraspec.FormatPath(attr.Path), value(attr.A), value(attr.B))))
+		}
+	}
+}
+
+// value renders a planned value as JSON
+func value(val cty.Value) string {
+	switch {
+	case val == cty.NilVal:
+		return "(not set)"
+	case !val.IsWhollyKnown():
+		return "(known after apply)"
+	}
+	data, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return val.GoString()
+	}
+	return string(data)
+}
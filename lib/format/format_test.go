@@ -0,0 +1,236 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/tfdiags"
+	terraspec "github.com/nhurel/terraspec/lib"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDiagnostic(t *testing.T) {
+	path := cty.GetAttrPath("aws_instance.web").GetAttr("tags").Index(cty.NumberIntVal(0))
+	var hclDiags hcl.Diagnostics
+	hclDiags = hclDiags.Append(&hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Unsupported argument",
+		Detail:   "An argument named \"foo\" is not expected here.",
+		Subject:  &hcl.Range{Filename: "spec/case.tfspec", Start: hcl.Pos{Line: 3, Column: 5}},
+	})
+	located := tfdiags.Diagnostics{}.Append(hclDiags)[0]
+	tags := cty.GetAttrPath("aws_instance.web").GetAttr("tags")
+	locatedAssert := terraspec.AssertErrorDiags(path, "b", "a")
+	locatedAssert.Subject = &hcl.Range{Filename: "spec/case.tfspec", Start: hcl.Pos{Line: 7, Column: 1}}
+	locatedSuccess := terraspec.SuccessDiags(path, "a")
+	locatedSuccess.Subject = locatedAssert.Subject
+	explained := terraspec.AssertErrorDiags(path, "b", "a")
+	explained.Subject = locatedAssert.Subject
+	explained.FailureMessage = "tags must be sorted"
+	mismatch := func(diag *terraspec.TerraspecDiagnostic, expected, actual cty.Value) *terraspec.TerraspecDiagnostic {
+		diag.Mismatch = &terraspec.Mismatch{Path: tfdiags.GetAttribute(diag.Diagnostic), Reason: terraspec.MismatchType, Expected: expected, Actual: actual}
+		return diag
+	}
+
+	tests := map[string]struct {
+		diag     tfdiags.Diagnostic
+		opts     Options
+		expected string
+	}{
+		"success": {
+			diag:     terraspec.SuccessDiags(path, "a"),
+			opts:     CLI,
+			expected: " ✔  \x1b[1maws_instance.web.tags[0]\x1b[0m = \x1b[32ma\x1b[0m",
+		},
+		"plainFailure": {
+			diag:     terraspec.AssertErrorDiags(path, "b", "a"),
+			opts:     Options{},
+			expected: " FAIL aws_instance.web.tags[0] : a != b",
+		},
+		"locatedFailure": {
+			diag:     locatedAssert,
+			opts:     Options{},
+			expected: " FAIL aws_instance.web.tags[0] : a != b (spec/case.tfspec#7,1)",
+		},
+		"locatedSuccess": {
+			diag:     locatedSuccess,
+			opts:     Options{},
+			expected: " PASS aws_instance.web.tags[0] = a",
+		},
+		"explainedFailure": {
+			diag:     explained,
+			opts:     Options{},
+			expected: " FAIL aws_instance.web.tags[0] : tags must be sorted : a != b (spec/case.tfspec#7,1)",
+		},
+		"primitiveMismatch": {
+			diag:     mismatch(terraspec.AssertErrorDiags(path, "b", "a"), cty.StringVal("b"), cty.StringVal("a")),
+			opts:     Options{},
+			expected: " FAIL aws_instance.web.tags[0] : a != b",
+		},
+		"sideBySide": {
+			diag: mismatch(terraspec.ErrorDiags(tags, "Element don't have multiple properties"),
+				cty.ObjectVal(map[string]cty.Value{"env": cty.StringVal("prod"), "team": cty.StringVal("ops"), "zones": cty.ListVal([]cty.Value{cty.StringVal("a")})}),
+				cty.MapVal(map[string]cty.Value{"env": cty.StringVal("dev"), "extra": cty.StringVal("x"), "team": cty.StringVal("ops")})),
+			opts: Options{},
+			expected: " FAIL aws_instance.web.tags : Element don't have multiple properties\n" +
+				"                  expected   actual\n" +
+				"      ~ env       \"prod\"     \"dev\"\n" +
+				"        team      \"ops\"      \"ops\"\n" +
+				"      ~ zones[0]  \"a\"        (not set)\n" +
+				"      ~ extra     (not set)  \"x\"",
+		},
+		"sideBySideMissing": {
+			diag:     mismatch(terraspec.ErrorDiags(tags, "Missing value"), cty.StringVal("prod"), cty.NilVal),
+			opts:     Options{Color: true},
+			expected: " FAIL \x1b[1maws_instance.web.tags\x1b[0m : \x1b[31mMissing value\x1b[0m\n      \x1b[2m  expected  actual\x1b[0m\n      \x1b[33m~ \"prod\"    (not set)\x1b[0m",
+		},
+		"located": {
+			diag:     located,
+			opts:     Options{},
+			expected: "spec/case.tfspec#3,5 : Unsupported argument : An argument named \"foo\" is not expected here.",
+		},
+		"wrapped": {
+			diag:     located,
+			opts:     Options{Width: 50},
+			expected: "spec/case.tfspec#3,5 : Unsupported argument : An\n                       argument named \"foo\" is not\n                       expected here.",
+		},
+		"error": {
+			diag:     tfdiags.Diagnostics{}.Append(errors.New("plan has no changes"))[0],
+			opts:     Options{Emoji: true},
+			expected: "plan has no changes",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := Diagnostic(tt.diag, tt.opts); got != tt.expected {
+				t.Errorf("Unexpected rendering\nwant: %q\ngot:  %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSideBySideRows(t *testing.T) {
+	var elems []cty.Value
+	for i := 0; i < maxSideBySideRows+5; i++ {
+		elems = append(elems, cty.NumberIntVal(int64(i)))
+	}
+	m := &terraspec.Mismatch{Expected: cty.ListVal(elems), Actual: cty.ListValEmpty(cty.Number)}
+	lines := strings.Split(sideBySide(m, Options{}), "\n")
+	// the values are preceded by an empty line and the header, and followed by the number of hidden values,
+	// which include the empty actual list
+	if len(lines) != maxSideBySideRows+3 {
+		t.Fatalf("Expected %d values, got %d lines", maxSideBySideRows, len(lines))
+	}
+	if expected := "        (6 more values)"; lines[len(lines)-1] != expected {
+		t.Errorf("Unexpected last line\nwant: %q\ngot:  %q", expected, lines[len(lines)-1])
+	}
+}
+
+func TestCaseResult(t *testing.T) {
+	var diags tfdiags.Diagnostics
+	diags = diags.Append(terraspec.SuccessDiags(cty.GetAttrPath("output").GetAttr("size"), "3"))
+	var out bytes.Buffer
+	CaseResult(&out, &terraspec.CaseResult{Name: "case", Diagnostics: diags, Assertions: []*terraspec.Assertion{{Passed: true}}}, Options{})
+	if expected := "=== case\n PASS output.size = 3\n COUNT 1 assertions evaluated\n"; out.String() != expected {
+		t.Errorf("Unexpected rendering\nwant: %q\ngot:  %q", expected, out.String())
+	}
+}
+
+func TestAssertionCount(t *testing.T) {
+	var out bytes.Buffer
+	AssertionCount(&out, &terraspec.CaseResult{Name: "case", Skipped: 2}, Options{Color: true})
+	if expected := " COUNT \x1b[33m0 assertions evaluated, 2 assert and reject blocks skipped\x1b[0m\n"; out.String() != expected {
+		t.Errorf("Unexpected rendering\nwant: %q\ngot:  %q", expected, out.String())
+	}
+}
+
+func TestCachedCaseResult(t *testing.T) {
+	var out bytes.Buffer
+	CaseResult(&out, &terraspec.CaseResult{Name: "case", Cached: true, Assertions: []*terraspec.Assertion{{Passed: true}, {Passed: true}}}, Options{})
+	if expected := "=== case\n CACHED cached pass : 2 assertions\n"; out.String() != expected {
+		t.Errorf("Unexpected rendering\nwant: %q\ngot:  %q", expected, out.String())
+	}
+}
+
+func TestSkippedCaseResult(t *testing.T) {
+	var out bytes.Buffer
+	CaseResult(&out, &terraspec.CaseResult{Name: "case", SkipReason: "waiting for a provider fix"}, Options{})
+	if expected := "=== case\n SKIP skipped : waiting for a provider fix\n"; out.String() != expected {
+		t.Errorf("Unexpected rendering\nwant: %q\ngot:  %q", expected, out.String())
+	}
+}
+
+func TestExpectedFailureCaseResult(t *testing.T) {
+	var diags tfdiags.Diagnostics
+	diags = diags.Append(terraspec.AssertErrorDiags(cty.GetAttrPath("output").GetAttr("size"), "3", "2"))
+	var out bytes.Buffer
+	CaseResult(&out, &terraspec.CaseResult{Name: "case", Diagnostics: diags, Assertions: []*terraspec.Assertion{{}}, ExpectedFailure: "known bug"}, Options{})
+	if expected := "=== case\n FAIL output.size : 2 != 3\n COUNT 1 assertions evaluated\n XFAIL failed as expected : known bug\n"; out.String() != expected {
+		t.Errorf("Unexpected rendering\nwant: %q\ngot:  %q", expected, out.String())
+	}
+}
+
+func TestTimings(t *testing.T) {
+	var out bytes.Buffer
+	Timings(&out, &terraspec.Timings{ConfigLoad: 12 * time.Millisecond, SchemaFetch: 2 * time.Second, Plan: 1500 * time.Microsecond}, Options{})
+	if expected := " TIME config 12ms, schemas 2s, refresh 0s, plan 2ms, validate 0s\n"; out.String() != expected {
+		t.Errorf("Unexpected rendering\nwant: %q\ngot:  %q", expected, out.String())
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	var out bytes.Buffer
+	Coverage(&out, &terraspec.Coverage{Resources: []*terraspec.ResourceCoverage{
+		{Address: "aws_instance.web", Covered: true, Attributes: map[string]bool{"ami": true, "tags": false}},
+		{Address: "aws_s3_bucket.logs", Attributes: map[string]bool{"bucket": false}},
+	}}, Options{})
+	if expected := " COVER 1/2 resources and 1/3 attributes asserted\n    not asserted : aws_s3_bucket.logs\n"; out.String() != expected {
+		t.Errorf("Unexpected rendering\nwant: %q\ngot:  %q", expected, out.String())
+	}
+}
+
+func TestMemStats(t *testing.T) {
+	var out bytes.Buffer
+	MemStats(&out, &terraspec.MemStats{PeakRSS: 300 << 20, Heap: 1536 << 10}, Options{})
+	if expected := " MEM peak RSS 300.0MiB, heap 1.5MiB\n"; out.String() != expected {
+		t.Errorf("Unexpected rendering\nwant: %q\ngot:  %q", expected, out.String())
+	}
+
+	out.Reset()
+	MemStats(&out, &terraspec.MemStats{Heap: 1 << 20, UnclosedPlugins: []string{"aws", "google"}}, Options{})
+	if expected := " MEM peak RSS unknown, heap 1.0MiB\nProvider plugins not closed : aws, google\n"; out.String() != expected {
+		t.Errorf("Unexpected rendering\nwant: %q\ngot:  %q", expected, out.String())
+	}
+}
+
+func TestPlanDiff(t *testing.T) {
+	diff := &terraspec.PlanDiff{
+		Added:   []string{"aws_instance.replica[0]"},
+		Removed: []string{"aws_instance.debug"},
+		Changed: []*terraspec.ResourceDiff{
+			{Address: "aws_instance.legacy", ActionA: "NoOp", ActionB: "Delete"},
+			{Address: "aws_instance.web", ActionA: "Create", ActionB: "Create", Attributes: []*terraspec.AttributeDiff{
+				{Path: cty.GetAttrPath("instance_type"), A: cty.StringVal("t2.micro"), B: cty.StringVal("t2.large")},
+				{Path: cty.GetAttrPath("id"), A: cty.UnknownVal(cty.String), B: cty.NilVal},
+			}},
+		},
+	}
+
+	var out bytes.Buffer
+	PlanDiff(&out, diff, Options{})
+	expected := `+ aws_instance.replica[0]
+- aws_instance.debug
+~ aws_instance.legacy : NoOp => Delete
+~ aws_instance.web
+    instance_type : "t2.micro" => "t2.large"
+    id : (known after apply) => (not set)
+`
+	if got := out.String(); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
@@ -0,0 +1,180 @@
+package format
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	terraspec "github.com/nhurel/terraspec/lib"
+)
+
+// junitSuites is the root element of a JUnit XML report
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Suites   []junitSuite `xml:"testsuite"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     float64      `xml:"time,attr"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure"`
+	Error     *junitProblem `xml:"error"`
+	Skipped   *junitSkipped `xml:"skipped"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// JUnit writes the results as a JUnit XML report, with a test per test case. Failed assertions are reported as a failure of their
+// test case, and other errors, eg an invalid config, as an error. Passed assertions are listed in the output of their test case
+func JUnit(w io.Writer, results *terraspec.Results) error {
+	suite := junitSuite{Name: "terraspec", Time: results.Duration.Seconds()}
+	for _, r := range sortedCases(results) {
+		c := junitCase{Name: r.Name, ClassName: "terraspec", File: r.Dir, Time: r.Duration.Seconds()}
+		var failures, errors, passes []string
+		for _, diag := range r.Diagnostics {
+			switch {
+			case diag.Severity() == terraspec.Info:
+				passes = append(passes, Diagnostic(diag, Options{}))
+			case diag.Severity() != tfdiags.Error:
+			case isAssertion(diag):
+				failures = append(failures, Diagnostic(diag, Options{}))
+			default:
+				errors = append(errors, Diagnostic(diag, Options{}))
+			}
+		}
+		switch {
+		case r.SkipReason != "":
+			c.Skipped = &junitSkipped{Message: r.SkipReason}
+			suite.Skipped++
+		case len(errors) > 0:
+			c.Error = &junitProblem{Message: fmt.Sprintf("%d errors", len(errors)), Text: strings.Join(append(errors, failures...), "\n")}
+			suite.Errors++
+		case len(failures) > 0 && !r.FailedAsExpected():
+			c.Failure = &junitProblem{Message: fmt.Sprintf("%d assertions failed", len(failures)), Text: strings.Join(failures, "\n")}
+			suite.Failures++
+		}
+		c.SystemOut = strings.Join(passes, "\n")
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Tests = len(suite.Cases)
+
+	report := junitSuites{Suites: []junitSuite{suite}, Tests: suite.Tests, Failures: suite.Failures, Errors: suite.Errors, Skipped: suite.Skipped, Time: suite.Time}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// codeQualityIssue is an issue of a GitLab Code Quality report
+type codeQualityIssue struct {
+	Description string              `json:"description"`
+	CheckName   string              `json:"check_name"`
+	Fingerprint string              `json:"fingerprint"`
+	Severity    string              `json:"severity"`
+	Location    codeQualityLocation `json:"location"`
+}
+
+type codeQualityLocation struct {
+	Path  string `json:"path"`
+	Lines struct {
+		Begin int `json:"begin"`
+	} `json:"lines"`
+}
+
+// CodeQuality writes the failed assertions and the errors of the results as a GitLab Code Quality report, located at the spec block
+// or the config they come from when it's known, and at the folder of their test case otherwise. Failed assertions are major issues,
+// and errors critical ones. The fingerprint of an issue identifies its test case and asserted path rather than the values compared,
+// so a failure is tracked across runs while it's not fixed
+func CodeQuality(w io.Writer, results *terraspec.Results) error {
+	issues := []codeQualityIssue{}
+	for _, r := range sortedCases(results) {
+		for _, diag := range r.Diagnostics {
+			if diag.Severity() != tfdiags.Error {
+				continue
+			}
+			issue := codeQualityIssue{CheckName: "terraspec-error", Severity: "critical"}
+			issue.Location.Path, issue.Location.Lines.Begin = r.Dir, 1
+			if subject := diag.Source().Subject; subject != nil {
+				issue.Location.Path, issue.Location.Lines.Begin = subject.Filename, subject.Start.Line
+			}
+			key := diag.Description().Summary
+			issue.Description = fmt.Sprintf("%s : %s", r.Name, Diagnostic(diag, Options{}))
+			if d, ok := diag.(*terraspec.TerraspecDiagnostic); ok {
+				if r.FailedAsExpected() {
+					continue
+				}
+				issue.CheckName, issue.Severity = "terraspec-assertion", "major"
+				message := d.Description().Detail
+				if d.FailureMessage != "" {
+					message = fmt.Sprintf("%s : %s", d.FailureMessage, message)
+				}
+				if path := tfdiags.GetAttribute(d.Diagnostic); path != nil {
+					key = terraspec.FormatPath(path)
+					message = fmt.Sprintf("%s : %s", key, message)
+				}
+				if d.Mismatch != nil {
+					key += " " + string(d.Mismatch.Reason)
+				}
+				issue.Description = fmt.Sprintf("%s : %s", r.Name, message)
+			}
+			sum := sha256.Sum256([]byte(strings.Join([]string{r.Name, issue.CheckName, key}, "\x00")))
+			issue.Fingerprint = hex.EncodeToString(sum[:])
+			issues = append(issues, issue)
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(issues)
+}
+
+// isAssertion tells if diag is the result of an assertion rather than an error raised while running the test case
+func isAssertion(diag tfdiags.Diagnostic) bool {
+	_, ok := diag.(*terraspec.TerraspecDiagnostic)
+	return ok
+}
+
+// sortedCases returns the results of the test cases sorted by name, so reports don't depend on the order they completed
+func sortedCases(results *terraspec.Results) []*terraspec.CaseResult {
+	cases := append([]*terraspec.CaseResult(nil), results.Cases...)
+	sort.SliceStable(cases, func(i, j int) bool {
+		return cases[i].Name < cases[j].Name
+	})
+	return cases
+}
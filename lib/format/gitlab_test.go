@@ -0,0 +1,89 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/tfdiags"
+	terraspec "github.com/nhurel/terraspec/lib"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func gitlabResults() *terraspec.Results {
+	path := cty.GetAttrPath("aws_instance.web").GetAttr("ami")
+	failed := terraspec.AssertErrorDiags(path, "ami-2", "ami-1")
+	failed.Mismatch = &terraspec.Mismatch{Path: path, Reason: terraspec.MismatchValue, Expected: cty.StringVal("ami-2"), Actual: cty.StringVal("ami-1")}
+	failed.Subject = &hcl.Range{Filename: "spec/web/web.tfspec", Start: hcl.Pos{Line: 3, Column: 1}}
+	return &terraspec.Results{
+		Duration: 3 * time.Second,
+		Cases: []*terraspec.CaseResult{
+			{Name: "web", Dir: "spec/web", Duration: time.Second, Diagnostics: tfdiags.Diagnostics{}.Append(terraspec.SuccessDiags(path.GetAttr("id"), "i-1"), failed)},
+			{Name: "broken", Dir: "spec/broken", Duration: time.Second, Diagnostics: tfdiags.Diagnostics{}.Append(errors.New("Could not compute the plan"))},
+			{Name: "passing", Dir: "spec/passing", Duration: time.Second, Diagnostics: tfdiags.Diagnostics{}.Append(terraspec.SuccessDiags(path, "ami-1"))},
+			{Name: "parked", Dir: "spec/parked", SkipReason: "waiting for a fix"},
+		},
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	var out bytes.Buffer
+	if err := JUnit(&out, gitlabResults()); err != nil {
+		t.Fatal(err)
+	}
+	report := out.String()
+	for _, expected := range []string{
+		`<testsuites tests="4" failures="1" errors="1" skipped="1" time="3">`,
+		`<testcase name="broken" classname="terraspec" file="spec/broken" time="1">`,
+		`<error message="1 errors">Could not compute the plan</error>`,
+		`<skipped message="waiting for a fix"></skipped>`,
+		`<failure message="1 assertions failed"> FAIL aws_instance.web.ami : ami-1 != ami-2 (spec/web/web.tfspec#3,1)</failure>`,
+		`<system-out> PASS aws_instance.web.ami.id = i-1</system-out>`,
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("The report should contain %s, got\n%s", expected, report)
+		}
+	}
+	if strings.Index(report, `name="broken"`) > strings.Index(report, `name="web"`) {
+		t.Errorf("Test cases should be sorted by name, got\n%s", report)
+	}
+}
+
+func TestCodeQuality(t *testing.T) {
+	var out bytes.Buffer
+	if err := CodeQuality(&out, gitlabResults()); err != nil {
+		t.Fatal(err)
+	}
+	var issues []codeQualityIssue
+	if err := json.Unmarshal(out.Bytes(), &issues); err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 2 {
+		t.Fatalf("Expected an issue for the error and one for the failed assertion, got %v", issues)
+	}
+	if issue := issues[0]; issue.Description != "broken : Could not compute the plan" || issue.Severity != "critical" || issue.Location.Path != "spec/broken" || issue.Location.Lines.Begin != 1 {
+		t.Errorf("The error should be reported at the folder of its test case, got %+v", issue)
+	}
+	if issue := issues[1]; issue.Description != "web : aws_instance.web.ami : ami-1 != ami-2" || issue.Severity != "major" || issue.Location.Path != "spec/web/web.tfspec" || issue.Location.Lines.Begin != 3 {
+		t.Errorf("The failed assertion should be reported at its spec block, got %+v", issue)
+	}
+
+	// the fingerprint doesn't change with the values compared
+	results := gitlabResults()
+	results.Cases[0].Diagnostics[1].(*terraspec.TerraspecDiagnostic).Mismatch.Actual = cty.StringVal("ami-3")
+	out.Reset()
+	if err := CodeQuality(&out, results); err != nil {
+		t.Fatal(err)
+	}
+	var again []codeQualityIssue
+	if err := json.Unmarshal(out.Bytes(), &again); err != nil {
+		t.Fatal(err)
+	}
+	if again[1].Fingerprint != issues[1].Fingerprint || issues[0].Fingerprint == issues[1].Fingerprint {
+		t.Errorf("Fingerprints should identify the test case and the asserted path, got %s, %s and %s", issues[0].Fingerprint, issues[1].Fingerprint, again[1].Fingerprint)
+	}
+}
@@ -0,0 +1,90 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	terraspec "github.com/nhurel/terraspec/lib"
+)
+
+// Metrics writes the results in the Prometheus text exposition format, as read by the textfile collector of the node exporter
+// and by the Pushgateway : the number of test cases by result, of assertions by result and of skipped blocks, the duration and outcome
+// of the run and of every test case, and the time the run completed, at, so alerts can fire when scheduled runs stop
+func Metrics(w io.Writer, results *terraspec.Results, at time.Time) error {
+	cases := map[string]int{"passed": 0, "failed": 0, "skipped": 0, "cached": 0}
+	assertions := map[string]int{"passed": 0, "failed": 0}
+	var skippedBlocks int
+	for _, r := range results.Cases {
+		switch {
+		case r.SkipReason != "":
+			cases["skipped"]++
+		case r.Failed():
+			cases["failed"]++
+		case r.Cached:
+			cases["cached"]++
+		default:
+			cases["passed"]++
+		}
+		for _, a := range r.Assertions {
+			if a.Passed {
+				assertions["passed"]++
+			} else {
+				assertions["failed"]++
+			}
+		}
+		skippedBlocks += r.Skipped
+	}
+
+	var b strings.Builder
+	metric(&b, "terraspec_test_cases", "Number of test cases of the last run, by result")
+	for _, result := range []string{"passed", "failed", "skipped", "cached"} {
+		fmt.Fprintf(&b, "terraspec_test_cases{result=%q} %d\n", result, cases[result])
+	}
+	metric(&b, "terraspec_assertions", "Number of assertions evaluated by the last run, by result")
+	for _, result := range []string{"passed", "failed"} {
+		fmt.Fprintf(&b, "terraspec_assertions{result=%q} %d\n", result, assertions[result])
+	}
+	metric(&b, "terraspec_skipped_blocks", "Number of assert and reject blocks that gave no assertion in the last run")
+	fmt.Fprintf(&b, "terraspec_skipped_blocks %d\n", skippedBlocks)
+	metric(&b, "terraspec_run_failed", "Whether the last run failed")
+	fmt.Fprintf(&b, "terraspec_run_failed %d\n", boolMetric(results.Failed()))
+	metric(&b, "terraspec_run_duration_seconds", "Duration of the last run")
+	fmt.Fprintf(&b, "terraspec_run_duration_seconds %g\n", results.Duration.Seconds())
+	metric(&b, "terraspec_last_run_timestamp_seconds", "Unix time the last run completed")
+	fmt.Fprintf(&b, "terraspec_last_run_timestamp_seconds %d\n", at.Unix())
+
+	sorted := sortedCases(results)
+	metric(&b, "terraspec_test_case_failed", "Whether the test case failed in the last run")
+	for _, r := range sorted {
+		if r.SkipReason == "" {
+			fmt.Fprintf(&b, "terraspec_test_case_failed{test_case=\"%s\"} %d\n", labelValue(r.Name), boolMetric(r.Failed()))
+		}
+	}
+	metric(&b, "terraspec_test_case_duration_seconds", "Duration of the test case in the last run")
+	for _, r := range sorted {
+		if r.SkipReason == "" {
+			fmt.Fprintf(&b, "terraspec_test_case_duration_seconds{test_case=\"%s\"} %g\n", labelValue(r.Name), r.Duration.Seconds())
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// metric writes the help and the type of a gauge
+func metric(b *strings.Builder, name, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+func boolMetric(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// labelValue escapes a label value of the text exposition format
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,46 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	terraspec "github.com/nhurel/terraspec/lib"
+)
+
+func TestMetrics(t *testing.T) {
+	results := gitlabResults()
+	results.Cases[0].Assertions = []*terraspec.Assertion{{Passed: true}, {Passed: false}}
+	results.Cases[2].Assertions = []*terraspec.Assertion{{Passed: true}}
+	results.Cases[2].Skipped = 1
+	results.Cases = append(results.Cases, &terraspec.CaseResult{Name: `quoted "name"`, Cached: true, Duration: 1500 * time.Millisecond})
+
+	var out bytes.Buffer
+	if err := Metrics(&out, results, time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"# TYPE terraspec_test_cases gauge\n",
+		`terraspec_test_cases{result="passed"} 1`,
+		`terraspec_test_cases{result="failed"} 2`,
+		`terraspec_test_cases{result="skipped"} 1`,
+		`terraspec_test_cases{result="cached"} 1`,
+		`terraspec_assertions{result="passed"} 2`,
+		`terraspec_assertions{result="failed"} 1`,
+		"terraspec_skipped_blocks 1\n",
+		"terraspec_run_failed 1\n",
+		"terraspec_run_duration_seconds 3\n",
+		"terraspec_last_run_timestamp_seconds 1700000000\n",
+		`terraspec_test_case_failed{test_case="broken"} 1`,
+		`terraspec_test_case_failed{test_case="passing"} 0`,
+		`terraspec_test_case_duration_seconds{test_case="quoted \"name\""} 1.5`,
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("The metrics should contain %s, got\n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), `test_case="parked"`) {
+		t.Errorf("Skipped test cases should have no metric, got\n%s", out.String())
+	}
+}
@@ -0,0 +1,86 @@
+package terraspec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// FunctionsSymbol is the name of the variable a function plugin exports, of type map[string]function.Function
+const FunctionsSymbol = "Functions"
+
+var functions = make(map[string]function.Function)
+
+// RegisterFunction makes an additional function available in the expressions of spec files.
+// It panics if a function or a matcher is already registered with this name
+func RegisterFunction(name string, fn function.Function) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	_, dupMatcher := matchers[name]
+	if _, dup := functions[name]; dup || dupMatcher {
+		panic("terraspec: RegisterFunction called twice for function " + name)
+	}
+	functions[name] = fn
+}
+
+// LoadFunctionPlugins registers the functions exported by the go plugins (.so files) found in dir.
+// Every plugin must export a Functions variable of type map[string]function.Function and be built with the same
+// version of go and of the dependencies as terraspec, which go plugins require.
+// Go plugins need cgo and only work on linux and darwin : other builds of terraspec fail to load any plugin
+func LoadFunctionPlugins(dir string) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("Could not read function plugins directory : %v", err)
+	}
+	for _, fi := range fis {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != ".so" {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		fns, err := openFunctionPlugin(path)
+		if err != nil {
+			return fmt.Errorf("Could not load function plugin %s : %v", path, err)
+		}
+		if err := registerPluginFunctions(path, *fns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerPluginFunctions registers the functions exported by the plugin at path. Unlike RegisterFunction, it returns an error
+// naming the plugin and the function when a function or a matcher is already registered with the name of one of them,
+// and none of the functions of the plugin are registered then
+func registerPluginFunctions(path string, fns map[string]function.Function) error {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	names := make([]string, 0, len(fns))
+	for name := range fns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, dupMatcher := matchers[name]
+		if _, dup := functions[name]; dup || dupMatcher {
+			return fmt.Errorf("Could not load function plugin %s : a function or a matcher is already registered with the name of its function %s", path, name)
+		}
+	}
+	for name, fn := range fns {
+		functions[name] = fn
+	}
+	return nil
+}
+
+// specFunctions returns all the functions available in spec files : the registered functions and matchers
+func specFunctions() map[string]function.Function {
+	funcs := matcherFunctions()
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	for name, fn := range functions {
+		funcs[name] = fn
+	}
+	return funcs
+}
@@ -0,0 +1,18 @@
+//go:build !cgo || (!linux && !darwin)
+// +build !cgo !linux,!darwin
+
+package terraspec
+
+import (
+	"errors"
+
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// errNoPluginSupport tells go plugins can't be loaded by this build of terraspec
+var errNoPluginSupport = errors.New("this terraspec binary is built without support for go plugins, build terraspec from source with CGO_ENABLED=1 on linux or darwin to load function plugins")
+
+// openFunctionPlugin fails : go plugins need cgo, and only work on linux and darwin
+func openFunctionPlugin(path string) (*map[string]function.Function, error) {
+	return nil, errNoPluginSupport
+}
@@ -0,0 +1,26 @@
+//go:build !cgo || (!linux && !darwin)
+// +build !cgo !linux,!darwin
+
+package terraspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFunctionPluginsWithoutPluginSupport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-functions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "names.so"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFunctionPlugins(dir); err == nil || !strings.Contains(err.Error(), "CGO_ENABLED=1") {
+		t.Errorf("Plugins should fail to load with a hint to build from source, got %v", err)
+	}
+}
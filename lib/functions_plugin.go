@@ -0,0 +1,28 @@
+//go:build (cgo && linux) || (cgo && darwin)
+// +build cgo,linux cgo,darwin
+
+package terraspec
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// openFunctionPlugin opens the go plugin at path and returns the functions it exports
+func openFunctionPlugin(path string) (*map[string]function.Function, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(FunctionsSymbol)
+	if err != nil {
+		return nil, err
+	}
+	fns, ok := sym.(*map[string]function.Function)
+	if !ok {
+		return nil, fmt.Errorf("%s is a %T, not a map[string]function.Function", FunctionsSymbol, sym)
+	}
+	return fns, nil
+}
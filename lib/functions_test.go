@@ -0,0 +1,78 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+func init() {
+	RegisterFunction("env_name", function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "env", Type: cty.String}, {Name: "name", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.StringVal(args[0].AsString() + "-" + args[1].AsString()), nil
+		},
+	}))
+}
+
+func TestParsingWithFunction(t *testing.T) {
+	spec := readSpecWithSchemas(t, "testdata/scenario_function.tfspec")
+	if property := spec.Asserts[0].Value.GetAttr("property"); !property.RawEquals(cty.StringVal("prod-web")) {
+		t.Errorf("property should be computed by the registered function, got %#v", property)
+	}
+}
+
+func TestRegisterFunctionWithMatcherName(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Registering a function with the name of a matcher should panic")
+		}
+	}()
+	RegisterFunction("has_prefix", function.New(&function.Spec{}))
+}
+
+func TestLoadFunctionPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-functions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := LoadFunctionPlugins(dir); err != nil {
+		t.Errorf("A directory without plugins should be loaded, got %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "invalid.so"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFunctionPlugins(dir); err == nil || !strings.Contains(err.Error(), "invalid.so") {
+		t.Errorf("An invalid plugin should fail to load, got %v", err)
+	}
+	if err := LoadFunctionPlugins(filepath.Join(dir, "missing")); err == nil {
+		t.Error("A missing directory should fail to load")
+	}
+}
+
+func TestRegisterPluginFunctions(t *testing.T) {
+	fn := function.New(&function.Spec{})
+	if err := registerPluginFunctions("dup.so", map[string]function.Function{"plugin_new": fn, "env_name": fn}); err == nil || !strings.Contains(err.Error(), "dup.so") || !strings.Contains(err.Error(), "env_name") {
+		t.Errorf("A function already registered should be an error naming the plugin and the function, got %v", err)
+	}
+	if _, ok := specFunctions()["plugin_new"]; ok {
+		t.Error("No function of a plugin should be registered when one of them is a duplicate")
+	}
+	if err := registerPluginFunctions("matcher.so", map[string]function.Function{"has_prefix": fn}); err == nil || !strings.Contains(err.Error(), "has_prefix") {
+		t.Errorf("A function named after a matcher should be an error, got %v", err)
+	}
+	if err := registerPluginFunctions("new.so", map[string]function.Function{"plugin_new": fn}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := specFunctions()["plugin_new"]; !ok {
+		t.Error("The function of the plugin should be registered")
+	}
+}
@@ -0,0 +1,372 @@
+package terraspec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// jsonPlan holds the parts of a plan in the JSON format of terraform show -json read by terraspec
+type jsonPlan struct {
+	ResourceChanges []jsonResourceChange  `json:"resource_changes"`
+	OutputChanges   map[string]jsonChange `json:"output_changes"`
+}
+
+type jsonResourceChange struct {
+	Address       string `json:"address"`
+	ModuleAddress string `json:"module_address"`
+	// PreviousAddress is set by terraform 1.1 onwards when the resource moves, eg with a moved block
+	PreviousAddress string     `json:"previous_address"`
+	Mode            string     `json:"mode"`
+	Type            string     `json:"type"`
+	ProviderName    string     `json:"provider_name"`
+	Change          jsonChange `json:"change"`
+}
+
+type jsonChange struct {
+	Actions      []string        `json:"actions"`
+	Before       json.RawMessage `json:"before"`
+	After        json.RawMessage `json:"after"`
+	AfterUnknown json.RawMessage `json:"after_unknown"`
+	// Importing is set by terraform 1.5 onwards when the resource is imported, eg with an import block
+	Importing *jsonImporting `json:"importing"`
+}
+
+type jsonImporting struct {
+	ID string `json:"id"`
+}
+
+func (c jsonChange) deleted() bool {
+	return len(c.Actions) == 1 && c.Actions[0] == "delete"
+}
+
+// eachResourceChange calls found with every resource change of a plan in the JSON format of terraform show -json.
+// Changes are decoded one at a time, so a plan with thousands of resources is never held decoded as a whole.
+// It stops at the first error returned by found
+func eachResourceChange(planJSON []byte, found func(rc *jsonResourceChange) error) error {
+	dec := json.NewDecoder(bytes.NewReader(planJSON))
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key != "resource_changes" {
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return err
+			}
+			continue
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == nil {
+			continue
+		}
+		if tok != json.Delim('[') {
+			return fmt.Errorf("expected resource_changes array, found %v", tok)
+		}
+		for dec.More() {
+			var rc jsonResourceChange
+			if err := dec.Decode(&rc); err != nil {
+				return err
+			}
+			if err := found(&rc); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, found %v", delim, tok)
+	}
+	return nil
+}
+
+// GenerateSpec returns the content of a .tfspec file asserting the resources and outputs of a plan
+// in the JSON format of terraform show -json.
+// Only the known attributes holding a primitive value, or a collection of primitive values, are asserted.
+// Nested blocks are left out as they can't be told apart from object attributes without the provider schemas
+func GenerateSpec(planJSON []byte) ([]byte, error) {
+	var plan jsonPlan
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return nil, fmt.Errorf("Could not read plan : %v", err)
+	}
+
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+	body.SetAttributeValue(versionAttribute, cty.NumberIntVal(SpecVersion))
+	body.AppendNewline()
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != "managed" || rc.Change.deleted() {
+			continue
+		}
+		after, err := decodeJSONValue(rc.Change.After)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read planned values of %s : %v", rc.Address, err)
+		}
+
+		typeLabel := rc.Type
+		if rc.ModuleAddress != "" {
+			typeLabel = fmt.Sprintf("%s.%s", rc.ModuleAddress, rc.Type)
+		}
+		nameLabel := strings.TrimPrefix(rc.Address, typeLabel+".")
+		appendAssert(body, typeLabel, nameLabel, after, nil)
+		if rc.PreviousAddress != "" && rc.PreviousAddress != rc.Address {
+			appendMovedAssert(body, rc.Address, rc.PreviousAddress)
+		}
+		if rc.Change.Importing != nil {
+			appendImportAssert(body, rc.Address, rc.Change.Importing.ID)
+		}
+	}
+
+	names := make([]string, 0, len(plan.OutputChanges))
+	for name := range plan.OutputChanges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		change := plan.OutputChanges[name]
+		if change.deleted() {
+			continue
+		}
+		after, err := decodeJSONValue(change.After)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read planned value of output %s : %v", name, err)
+		}
+		if !after.Type().IsPrimitiveType() || after.IsNull() {
+			continue
+		}
+		appendOutputAssert(body, name, after)
+	}
+
+	return f.Bytes(), nil
+}
+
+// jsonState holds the parts of a state file read by terraspec
+type jsonState struct {
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey            json.RawMessage   `json:"index_key"`
+			Attributes          json.RawMessage   `json:"attributes"`
+			SensitiveAttributes []json.RawMessage `json:"sensitive_attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+	Outputs map[string]struct {
+		Value     json.RawMessage `json:"value"`
+		Sensitive bool            `json:"sensitive"`
+	} `json:"outputs"`
+}
+
+// GenerateSpecFromState returns the content of a .tfspec file asserting the current attributes of the resources of a state file,
+// and its outputs. Only the resources whose address is, or starts with, one of the given addresses are asserted, eg module.db
+// or aws_instance.web, and all of them when none is given.
+// Like GenerateSpec, only the attributes holding a primitive value, or a collection of primitive values, are asserted. Sensitive
+// attributes and outputs are left out, and so are the attributes the provider computes, as they're unknown in a plan :
+// the ones whose schema is computed when schemas are given, and id otherwise
+func GenerateSpecFromState(stateJSON []byte, addresses []string, schemas *terraform.Schemas) ([]byte, error) {
+	var state jsonState
+	if err := json.Unmarshal(stateJSON, &state); err != nil {
+		return nil, fmt.Errorf("Could not read state : %v", err)
+	}
+
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+	body.SetAttributeValue(versionAttribute, cty.NumberIntVal(SpecVersion))
+	body.AppendNewline()
+	for _, resource := range state.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+		typeLabel := resource.Type
+		if resource.Module != "" {
+			typeLabel = fmt.Sprintf("%s.%s", resource.Module, resource.Type)
+		}
+		computed := func(name string) bool {
+			return name == "id"
+		}
+		if schema := managedResourceSchema(schemas, resource.Type); schema != nil {
+			computed = func(name string) bool {
+				attr, ok := schema.Attributes[name]
+				return ok && attr.Computed && !attr.Optional && !attr.Required
+			}
+		}
+		for _, instance := range resource.Instances {
+			nameLabel := resource.Name
+			if len(instance.IndexKey) > 0 {
+				var key interface{}
+				if err := json.Unmarshal(instance.IndexKey, &key); err != nil {
+					return nil, fmt.Errorf("Could not read index of %s.%s : %v", typeLabel, resource.Name, err)
+				}
+				if k, ok := key.(string); ok {
+					nameLabel += fmt.Sprintf("[%q]", k)
+				} else {
+					nameLabel += fmt.Sprintf("[%v]", key)
+				}
+			}
+			if !selected(typeLabel+"."+nameLabel, addresses) {
+				continue
+			}
+			attributes, err := decodeJSONValue(instance.Attributes)
+			if err != nil {
+				return nil, fmt.Errorf("Could not read attributes of %s.%s : %v", typeLabel, nameLabel, err)
+			}
+			sensitive := sensitiveAttributes(instance.SensitiveAttributes)
+			appendAssert(body, typeLabel, nameLabel, attributes, func(name string) bool {
+				return sensitive[name] || computed(name)
+			})
+		}
+	}
+
+	names := make([]string, 0, len(state.Outputs))
+	for name := range state.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		output := state.Outputs[name]
+		if output.Sensitive {
+			continue
+		}
+		val, err := decodeJSONValue(output.Value)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read value of output %s : %v", name, err)
+		}
+		if !val.Type().IsPrimitiveType() || val.IsNull() {
+			continue
+		}
+		appendOutputAssert(body, name, val)
+	}
+
+	return f.Bytes(), nil
+}
+
+// selected tells if the resource at address is one of addresses, or in one of them. Every resource is selected when addresses is empty
+func selected(address string, addresses []string) bool {
+	if len(addresses) == 0 {
+		return true
+	}
+	for _, a := range addresses {
+		if address == a || strings.HasPrefix(address, a+".") || strings.HasPrefix(address, a+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// sensitiveAttributes returns the names of the top level attributes holding sensitive values, read from the paths of the state file
+func sensitiveAttributes(paths []json.RawMessage) map[string]bool {
+	names := make(map[string]bool)
+	for _, raw := range paths {
+		var path []struct {
+			Type  string      `json:"type"`
+			Value interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &path); err != nil || len(path) == 0 {
+			continue
+		}
+		if name, ok := path[0].Value.(string); ok && path[0].Type == "get_attr" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// appendAssert appends to body an assert block of the assertable attributes of val, except the ones skip returns true for
+func appendAssert(body *hclwrite.Body, typeLabel, nameLabel string, val cty.Value, skip func(string) bool) {
+	block := body.AppendNewBlock("assert", []string{typeLabel, nameLabel})
+	if val.Type().IsObjectType() && !val.IsNull() {
+		attrs := val.AsValueMap()
+		names := make([]string, 0, len(attrs))
+		for name := range attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if assertable(attrs[name]) && (skip == nil || !skip(name)) {
+				block.Body().SetAttributeValue(name, attrs[name])
+			}
+		}
+	}
+	body.AppendNewline()
+}
+
+// appendOutputAssert appends to body an assert block of the primitive value of an output
+func appendOutputAssert(body *hclwrite.Body, name string, val cty.Value) {
+	block := body.AppendNewBlock("assert", []string{"output", name})
+	// output assertions only compare string values
+	block.Body().SetAttributeValue("value", cty.StringVal(fmt.Sprintf("%v", PrimitiveValue(val))))
+	body.AppendNewline()
+}
+
+// appendMovedAssert appends to body an assert block of the move of a resource from its previous address
+func appendMovedAssert(body *hclwrite.Body, addr, from string) {
+	block := body.AppendNewBlock("assert", []string{MovedAssertType, addr})
+	block.Body().SetAttributeValue("from", cty.StringVal(from))
+	body.AppendNewline()
+}
+
+// appendImportAssert appends to body an assert block of the import of a resource with the given ID
+func appendImportAssert(body *hclwrite.Body, addr, id string) {
+	block := body.AppendNewBlock("assert", []string{ImportAssertType, addr})
+	block.Body().SetAttributeValue("id", cty.StringVal(id))
+	body.AppendNewline()
+}
+
+// decodeJSONValue decodes a JSON value into a cty.Value of the implied type
+func decodeJSONValue(raw json.RawMessage) (cty.Value, error) {
+	if len(raw) == 0 {
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	}
+	ty, err := ctyjson.ImpliedType(raw)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyjson.Unmarshal(raw, ty)
+}
+
+// assertable tells if val is a non empty primitive value or collection of primitive values
+func assertable(val cty.Value) bool {
+	if val.IsNull() {
+		return false
+	}
+	ty := val.Type()
+	if ty.IsPrimitiveType() {
+		return true
+	}
+	if !ty.IsTupleType() && !ty.IsObjectType() || val.LengthInt() == 0 {
+		return false
+	}
+	for it := val.ElementIterator(); it.Next(); {
+		_, v := it.Element()
+		if !v.Type().IsPrimitiveType() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+package terraspec
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestGenerateSpec(t *testing.T) {
+	planJSON, err := ioutil.ReadFile("testdata/generate/plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := GenerateSpec(planJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `terraspec_version = 2
+
+assert "module.db.ressource_type" "name[0]" {
+  count    = 2
+  property = "value"
+  tags = {
+    owner = "team"
+  }
+  zones = ["a", "b"]
+}
+
+assert "output" "size" {
+  value = "3"
+}
+
+`
+	if string(spec) != expected {
+		t.Errorf("Wrong generated spec. Got\n%s\nwant\n%s", spec, expected)
+	}
+}
+
+func TestGenerateSpecMoved(t *testing.T) {
+	planJSON := `{"resource_changes": [{"address": "ressource_type.new", "previous_address": "ressource_type.old", "mode": "managed", "type": "ressource_type", "name": "new", "change": {"actions": ["no-op"], "after": {"property": "value"}}}]}`
+
+	spec, err := GenerateSpec([]byte(planJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `terraspec_version = 2
+
+assert "ressource_type" "new" {
+  property = "value"
+}
+
+assert "moved" "ressource_type.new" {
+  from = "ressource_type.old"
+}
+
+`
+	if string(spec) != expected {
+		t.Errorf("Wrong generated spec. Got\n%s\nwant\n%s", spec, expected)
+	}
+}
+
+func TestGenerateSpecImported(t *testing.T) {
+	planJSON := `{"resource_changes": [{"address": "ressource_type.legacy", "mode": "managed", "type": "ressource_type", "name": "legacy", "change": {"actions": ["no-op"], "after": {"property": "value"}, "importing": {"id": "legacy-id"}}}]}`
+
+	spec, err := GenerateSpec([]byte(planJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `terraspec_version = 2
+
+assert "ressource_type" "legacy" {
+  property = "value"
+}
+
+assert "import" "ressource_type.legacy" {
+  id = "legacy-id"
+}
+
+`
+	if string(spec) != expected {
+		t.Errorf("Wrong generated spec. Got\n%s\nwant\n%s", spec, expected)
+	}
+}
+
+func TestGenerateSpecFromState(t *testing.T) {
+	stateJSON, err := ioutil.ReadFile("testdata/generate/terraform.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas := &terraform.Schemas{
+		Providers: map[addrs.Provider]*terraform.ProviderSchema{
+			addrs.NewDefaultProvider("ressource"): {
+				ResourceTypes: map[string]*configschema.Block{
+					"ressource_type": {
+						Attributes: map[string]*configschema.Attribute{
+							"id":       {Type: cty.String, Optional: true, Computed: true},
+							"arn":      {Type: cty.String, Computed: true},
+							"property": {Type: cty.String, Optional: true},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		addresses []string
+		schemas   *terraform.Schemas
+		expected  string
+	}{
+		"Module without schemas": {
+			addresses: []string{"module.db"},
+			expected: `terraspec_version = 2
+
+assert "module.db.ressource_type" "name[0]" {
+  arn      = "arn:r-0"
+  property = "value"
+  zones    = ["a", "b"]
+}
+
+assert "module.db.ressource_type" "name[\"b\"]" {
+  arn      = "arn:r-b"
+  property = "other"
+}
+
+assert "output" "size" {
+  value = "3"
+}
+
+`,
+		},
+		"Resource with schemas": {
+			addresses: []string{"ressource_type.web", "module.db.ressource_type.name[0]"},
+			schemas:   schemas,
+			expected: `terraspec_version = 2
+
+assert "module.db.ressource_type" "name[0]" {
+  id       = "r-0"
+  property = "value"
+  zones    = ["a", "b"]
+}
+
+assert "ressource_type" "web" {
+  id       = "r-web"
+  property = "web"
+}
+
+assert "output" "size" {
+  value = "3"
+}
+
+`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			spec, err := GenerateSpecFromState(stateJSON, tt.addresses, tt.schemas)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(spec) != tt.expected {
+				t.Errorf("Wrong generated spec. Got\n%s\nwant\n%s", spec, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEachResourceChange(t *testing.T) {
+	tests := map[string]struct {
+		plan      string
+		addresses []string
+		err       bool
+	}{
+		"changes": {
+			plan:      `{"format_version":"0.1","planned_values":{"root_module":{}},"resource_changes":[{"address":"a.one","change":{"actions":["create"]}},{"address":"a.two"}],"output_changes":{}}`,
+			addresses: []string{"a.one", "a.two"},
+		},
+		"no changes":   {plan: `{"format_version":"0.1"}`},
+		"null changes": {plan: `{"resource_changes":null}`},
+		"not a plan":   {plan: `[]`, err: true},
+		"invalid":      {plan: `{"resource_changes":[{"address":1}]}`, err: true},
+		"truncated":    {plan: `{"resource_changes":[{"address":"a.one"}`, addresses: []string{"a.one"}, err: true},
+	}
+	for name, tt := range tests {
+		var addresses []string
+		err := eachResourceChange([]byte(tt.plan), func(rc *jsonResourceChange) error {
+			addresses = append(addresses, rc.Address)
+			return nil
+		})
+		if (err != nil) != tt.err {
+			t.Errorf("%s : unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(addresses, tt.addresses) {
+			t.Errorf("%s : expected changes %v, got %v", name, tt.addresses, addresses)
+		}
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	err := eachResourceChange([]byte(`{"resource_changes":[{"address":"a.one"},{"address":"a.two"}]}`), func(rc *jsonResourceChange) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Errorf("iteration should stop at the first error, got %v after %d changes", err, count)
+	}
+}
@@ -0,0 +1,184 @@
+package terraspec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// HarnessModuleName is the name of the module call instantiating the module under test
+// in a generated harness root. Resources of the module are addressed as module.under_test.<type>.<name>
+const HarnessModuleName = "under_test"
+
+// Harness is a temporary root configuration whose only purpose is to instantiate a module under test
+type Harness struct {
+	Dir string
+}
+
+// moduleRecord mirrors the records terraform writes in .terraform/modules/modules.json
+type moduleRecord struct {
+	Key     string `json:"Key"`
+	Source  string `json:"Source"`
+	Version string `json:"Version,omitempty"`
+	Dir     string `json:"Dir"`
+}
+
+type moduleManifest struct {
+	Modules []moduleRecord `json:"Modules"`
+}
+
+// NewHarness generates a root configuration in a new temporary directory calling the module found in moduleDir.
+// Every variable of the module is declared in the root configuration and passed to the module,
+// and every output of the module is exposed as a root output.
+func NewHarness(moduleDir string) (*Harness, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	dir, err := ioutil.TempDir("", "terraspec-harness")
+	if err != nil {
+		return nil, diags.Append(err)
+	}
+	harness := &Harness{Dir: dir}
+	if diags = harness.generate(moduleDir); diags.HasErrors() {
+		harness.Close()
+		return nil, diags
+	}
+	return harness, diags
+}
+
+// generate writes in the existing folder h.Dir the root configuration calling the module found in moduleDir
+func (h *Harness) generate(moduleDir string) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+
+	absModuleDir, err := filepath.Abs(moduleDir)
+	if err != nil {
+		return diags.Append(err)
+	}
+
+	module, hclDiags := configs.NewParser(nil).LoadConfigDir(absModuleDir)
+	diags = diags.Append(hclDiags)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	source, err := filepath.Rel(h.Dir, absModuleDir)
+	if err != nil {
+		return diags.Append(err)
+	}
+	source = filepath.ToSlash(source)
+	if !strings.HasPrefix(source, "../") {
+		source = "./" + source
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(h.Dir, "main.tf"), harnessConfig(module, source), 0644); err != nil {
+		return diags.Append(err)
+	}
+
+	if err = writeHarnessManifest(h.Dir, absModuleDir, source); err != nil {
+		return diags.Append(err)
+	}
+
+	return diags
+}
+
+// Close removes all the files generated for the harness
+func (h *Harness) Close() error {
+	return os.RemoveAll(h.Dir)
+}
+
+// harnessConfig returns the content of the root configuration calling the module with given source
+func harnessConfig(module *configs.Module, source string) []byte {
+	f := hclwrite.NewEmptyFile()
+	root := f.Body()
+
+	for _, name := range sortedVariableNames(module.Variables) {
+		v := module.Variables[name]
+		b := root.AppendNewBlock("variable", []string{name}).Body()
+		// the type converts the values of the test case as the module expects them, eg a tuple to a list
+		if v.Type != cty.DynamicPseudoType {
+			b.SetAttributeRaw("type", hclwrite.Tokens{&hclwrite.Token{Type: hclsyntax.TokenIdent, Bytes: []byte(typeexpr.TypeString(v.Type))}})
+		}
+		if v.Default != cty.NilVal {
+			b.SetAttributeValue("default", v.Default)
+		}
+	}
+
+	call := root.AppendNewBlock("module", []string{HarnessModuleName}).Body()
+	call.SetAttributeValue("source", cty.StringVal(source))
+	for _, name := range sortedVariableNames(module.Variables) {
+		call.SetAttributeTraversal(name, hcl.Traversal{hcl.TraverseRoot{Name: "var"}, hcl.TraverseAttr{Name: name}})
+	}
+
+	outputs := make([]string, 0, len(module.Outputs))
+	for name := range module.Outputs {
+		outputs = append(outputs, name)
+	}
+	sort.Strings(outputs)
+	for _, name := range outputs {
+		b := root.AppendNewBlock("output", []string{name}).Body()
+		b.SetAttributeTraversal("value", hcl.Traversal{
+			hcl.TraverseRoot{Name: "module"},
+			hcl.TraverseAttr{Name: HarnessModuleName},
+			hcl.TraverseAttr{Name: name},
+		})
+	}
+
+	return f.Bytes()
+}
+
+// writeHarnessManifest writes the modules manifest of the harness so that terraform finds the module under test
+// as well as all the modules the module under test depends on, if they've been installed in its own .terraform folder
+func writeHarnessManifest(dir, moduleDir, source string) error {
+	manifest := moduleManifest{
+		Modules: []moduleRecord{
+			{Key: "", Source: "", Dir: "."},
+			{Key: HarnessModuleName, Source: source, Dir: filepath.ToSlash(moduleDir)},
+		},
+	}
+
+	if content, err := ioutil.ReadFile(filepath.Join(moduleDir, ".terraform/modules/modules.json")); err == nil {
+		var installed moduleManifest
+		if err = json.Unmarshal(content, &installed); err != nil {
+			return err
+		}
+		for _, record := range installed.Modules {
+			if record.Key == "" {
+				continue
+			}
+			record.Key = HarnessModuleName + "." + record.Key
+			if !filepath.IsAbs(record.Dir) {
+				record.Dir = filepath.ToSlash(filepath.Join(moduleDir, record.Dir))
+			}
+			manifest.Modules = append(manifest.Modules, record)
+		}
+	}
+
+	modulesDir := filepath.Join(dir, ".terraform/modules")
+	if err := os.MkdirAll(modulesDir, 0755); err != nil {
+		return err
+	}
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(modulesDir, "modules.json"), content, 0644)
+}
+
+// sortedVariableNames returns the names of the variables, sorted
+func sortedVariableNames(variables map[string]*configs.Variable) []string {
+	keys := make([]string, 0, len(variables))
+	for k := range variables {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
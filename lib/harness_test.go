@@ -0,0 +1,61 @@
+package terraspec
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/configs/configload"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNewHarness(t *testing.T) {
+	harness, diags := NewHarness("testdata/module")
+	if diags.HasErrors() {
+		t.Fatalf("Could not generate harness : %v", diags.Err())
+	}
+	defer harness.Close()
+
+	loader, err := configload.NewLoader(&configload.Config{ModulesDir: filepath.Join(harness.Dir, ".terraform/modules")})
+	if err != nil {
+		t.Fatalf("Could not create loader : %v", err)
+	}
+	cfg, hclDiags := loader.LoadConfig(harness.Dir)
+	if hclDiags.HasErrors() {
+		t.Fatalf("Could not load harness config : %v", hclDiags.Error())
+	}
+
+	if _, ok := cfg.Children[HarnessModuleName]; !ok {
+		t.Errorf("Harness should call module %s", HarnessModuleName)
+	}
+
+	name, ok := cfg.Module.Variables["name"]
+	if !ok {
+		t.Fatalf("Harness should declare variable name")
+	}
+	if name.Default != cty.NilVal {
+		t.Errorf("Variable name should not have a default value. Got %v", name.Default.GoString())
+	}
+
+	size, ok := cfg.Module.Variables["size"]
+	if !ok {
+		t.Fatalf("Harness should declare variable size")
+	}
+	if !size.Default.RawEquals(cty.NumberIntVal(2)) {
+		t.Errorf("Variable size should default to 2. Got %v", size.Default.GoString())
+	}
+
+	if !size.Type.Equals(cty.Number) {
+		t.Errorf("Variable size should keep its number type. Got %s", size.Type.FriendlyName())
+	}
+	tags, ok := cfg.Module.Variables["tags"]
+	if !ok {
+		t.Fatalf("Harness should declare variable tags")
+	}
+	if !tags.Type.Equals(cty.Map(cty.String)) {
+		t.Errorf("Variable tags should keep its map of strings type. Got %s", tags.Type.FriendlyName())
+	}
+
+	if _, ok := cfg.Module.Outputs["greeting"]; !ok {
+		t.Errorf("Harness should expose output greeting")
+	}
+}
@@ -0,0 +1,136 @@
+package terraspec
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// RunRecord is the outcome of a test suite run, as stored in a history file
+type RunRecord struct {
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+	Cases    []*CaseRecord `json:"cases"`
+}
+
+// CaseRecord is the outcome of a test case, as stored in a history file
+type CaseRecord struct {
+	Name     string        `json:"name"`
+	Dir      string        `json:"dir"`
+	Failed   bool          `json:"failed"`
+	Duration time.Duration `json:"duration"`
+}
+
+// NewRunRecord creates the record of a test suite run completed at the given time.
+// Skipped test cases are left out, as they didn't run
+func NewRunRecord(results *Results, at time.Time) *RunRecord {
+	record := &RunRecord{Time: at, Duration: results.Duration}
+	for _, c := range results.Cases {
+		if c.SkipReason != "" {
+			continue
+		}
+		record.Cases = append(record.Cases, &CaseRecord{Name: c.Name, Dir: c.Dir, Failed: c.Failed(), Duration: c.Duration})
+	}
+	return record
+}
+
+// AppendHistory adds record to the history file found at path, which holds one JSON record per line.
+// The file is created if needed
+func AppendHistory(path string, record *RunRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not open history file %s : %v", path, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("Could not write history file %s : %v", path, err)
+	}
+	return nil
+}
+
+// ReadHistory returns the records of the history file found at path, oldest first
+func ReadHistory(path string) ([]*RunRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open history file %s : %v", path, err)
+	}
+	defer f.Close()
+
+	var records []*RunRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		record := &RunRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, fmt.Errorf("Invalid record in history file %s at line %d : %v", path, line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Could not read history file %s : %v", path, err)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+// CaseTrend summarizes the history of a test case
+type CaseTrend struct {
+	Name     string
+	Runs     int
+	Failures int
+	// Flips is the number of times the outcome of the test case changed from a run to the next one
+	Flips int
+	// AverageDuration is the mean duration of all the runs, and LastDuration the duration of the latest one
+	AverageDuration time.Duration
+	LastDuration    time.Duration
+	LastFailed      bool
+}
+
+// Flaky tells if the test case both succeeded and failed in the history
+func (t *CaseTrend) Flaky() bool {
+	return t.Failures > 0 && t.Failures < t.Runs
+}
+
+// Trends returns the trend of every test case of the records, flaky ones first, then by name
+func Trends(records []*RunRecord) []*CaseTrend {
+	byName := make(map[string]*CaseTrend)
+	var total = make(map[string]time.Duration)
+	for _, record := range records {
+		for _, c := range record.Cases {
+			trend, ok := byName[c.Name]
+			if !ok {
+				trend = &CaseTrend{Name: c.Name}
+				byName[c.Name] = trend
+			} else if trend.LastFailed != c.Failed {
+				trend.Flips++
+			}
+			trend.Runs++
+			if c.Failed {
+				trend.Failures++
+			}
+			total[c.Name] += c.Duration
+			trend.LastDuration = c.Duration
+			trend.LastFailed = c.Failed
+		}
+	}
+
+	trends := make([]*CaseTrend, 0, len(byName))
+	for name, trend := range byName {
+		trend.AverageDuration = total[name] / time.Duration(trend.Runs)
+		trends = append(trends, trend)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Flaky() != trends[j].Flaky() {
+			return trends[i].Flaky()
+		}
+		return trends[i].Name < trends[j].Name
+	})
+	return trends
+}
@@ -0,0 +1,61 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	failure := tfdiags.Diagnostics{}.Append(ErrorDiags(nil, "failed"))
+	start := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	runs := []map[string]bool{
+		{"stable": false, "flaky": false},
+		{"stable": false, "flaky": true},
+		{"stable": false, "flaky": false},
+	}
+	for i, failed := range runs {
+		results := &Results{}
+		for _, name := range []string{"stable", "flaky"} {
+			var diags tfdiags.Diagnostics
+			if failed[name] {
+				diags = failure
+			}
+			results.Cases = append(results.Cases, newCaseResult(&TestCase{Dir: name}, caseOutput{}, diags, time.Duration(i+1)*time.Second))
+		}
+		if err := AppendHistory(path, NewRunRecord(results, start.Add(time.Duration(i)*time.Hour))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := ReadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+
+	trends := Trends(records)
+	if len(trends) != 2 {
+		t.Fatalf("Expected the trends of 2 test cases, got %d", len(trends))
+	}
+	flaky, stable := trends[0], trends[1]
+	if flaky.Name != "flaky" || !flaky.Flaky() || flaky.Failures != 1 || flaky.Flips != 2 {
+		t.Errorf("Expected flaky test case first, with 1 failure and 2 flips, got %+v", flaky)
+	}
+	if stable.Flaky() || stable.Runs != 3 || stable.AverageDuration != 2*time.Second || stable.LastDuration != 3*time.Second {
+		t.Errorf("Expected stable test case with 3 runs lasting 2s on average and 3s last, got %+v", stable)
+	}
+}
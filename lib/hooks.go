@@ -0,0 +1,191 @@
+package terraspec
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// Hook is a step run before or after the plan of a test case
+type Hook struct {
+	// Command is the program to run followed by its arguments. It runs from the folder of the spec file
+	Command []string
+	// Files are written before the plan and removed once the test case completed, restoring the files they replaced. Only before hooks have files
+	Files []*HookFile
+	// DeclRange is the source range of the hook block in the spec file
+	DeclRange hcl.Range
+	// dir is the folder of the spec file
+	dir string
+}
+
+// HookFile is a file written by a before hook
+type HookFile struct {
+	// Path of the file, relative to the spec file
+	Path    string
+	Content string
+}
+
+// hookBackupSuffix is appended to the name of the files replaced by the files of the before hooks, until they're restored
+const hookBackupSuffix = ".terraspec-backup"
+
+// hookFileLocks serializes the test cases whose before hooks write the same files, by absolute path,
+// so running in parallel they don't overwrite or remove the files of each other
+var hookFileLocks = struct {
+	sync.Mutex
+	paths map[string]*sync.Mutex
+}{paths: make(map[string]*sync.Mutex)}
+
+// writtenHookFile is a file written by a before hook, with the backup of the file it replaced, if any
+type writtenHookFile struct {
+	path   string
+	backup string
+}
+
+// RunBeforeHooks writes the files and runs the commands of the before hooks, in order.
+// It stops at the first hook that fails. A file, or link in a Workdir, found where a hook writes is renamed with hookBackupSuffix
+// and restored by RunAfterHooks. The test cases writing the same files wait for each other until RunAfterHooks is called
+func (s *Spec) RunBeforeHooks(ctx context.Context) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	s.releaseHookFiles = lockHookFiles(s.Before)
+	for _, hook := range s.Before {
+		for _, file := range hook.Files {
+			written, err := writeHookFile(file)
+			if err != nil {
+				return diags.Append(hookDiag("Before hook failed", err.Error(), hook))
+			}
+			s.hookFiles = append(s.hookFiles, written)
+		}
+		if diag := hook.run(ctx); diag != nil {
+			return diags.Append(hookDiag("Before hook failed", diag.Error(), hook))
+		}
+	}
+	return diags
+}
+
+// RunAfterHooks runs the commands of all the after hooks, then removes the files written by the before hooks and restores the files they replaced.
+// They're run even if the test case was cancelled, so they can clean up the before hooks
+func (s *Spec) RunAfterHooks() tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	for _, hook := range s.After {
+		if err := hook.run(context.Background()); err != nil {
+			diags = diags.Append(hookDiag("After hook failed", err.Error(), hook))
+		}
+	}
+	for i := len(s.hookFiles) - 1; i >= 0; i-- {
+		if err := s.hookFiles[i].restore(); err != nil {
+			diags = diags.Append(tfdiags.Sourceless(tfdiags.Error, "After hook failed", err.Error()))
+		}
+	}
+	s.hookFiles = nil
+	if s.releaseHookFiles != nil {
+		s.releaseHookFiles()
+		s.releaseHookFiles = nil
+	}
+	return diags
+}
+
+// writeHookFile writes the file of a before hook, after renaming the file found at its path with hookBackupSuffix.
+// An existing backup is never overwritten, eg the one left by a run that was killed : the file is not written then
+func writeHookFile(file *HookFile) (*writtenHookFile, error) {
+	written := &writtenHookFile{path: file.Path}
+	if _, err := os.Lstat(file.Path); err == nil {
+		written.backup = file.Path + hookBackupSuffix
+		if _, err := os.Lstat(written.backup); err == nil {
+			return nil, fmt.Errorf("Could not back up file %s : %s already exists, restore or remove it", file.Path, written.backup)
+		}
+		if err := os.Rename(file.Path, written.backup); err != nil {
+			return nil, fmt.Errorf("Could not back up file %s : %v", file.Path, err)
+		}
+	}
+	if err := ioutil.WriteFile(file.Path, []byte(file.Content), 0644); err != nil {
+		if restoreErr := written.restore(); restoreErr != nil {
+			return nil, fmt.Errorf("Could not write file %s : %v. %v", file.Path, err, restoreErr)
+		}
+		return nil, fmt.Errorf("Could not write file %s : %v", file.Path, err)
+	}
+	return written, nil
+}
+
+// restore removes the file written by the hook and renames its backup back
+func (f *writtenHookFile) restore() error {
+	if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Could not remove file %s : %v", f.path, err)
+	}
+	if f.backup == "" {
+		return nil
+	}
+	if err := os.Rename(f.backup, f.path); err != nil {
+		return fmt.Errorf("Could not restore file %s from %s : %v", f.path, f.backup, err)
+	}
+	return nil
+}
+
+// lockHookFiles locks the files written by the given hooks, in the order of their paths so test cases sharing several files
+// never wait for each other forever. The returned func unlocks them
+func lockHookFiles(hooks []*Hook) func() {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, hook := range hooks {
+		for _, file := range hook.Files {
+			path := absPath(file.Path)
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	locks := make([]*sync.Mutex, len(paths))
+	hookFileLocks.Lock()
+	for i, path := range paths {
+		if hookFileLocks.paths[path] == nil {
+			hookFileLocks.paths[path] = &sync.Mutex{}
+		}
+		locks[i] = hookFileLocks.paths[path]
+	}
+	hookFileLocks.Unlock()
+	for _, lock := range locks {
+		lock.Lock()
+	}
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
+}
+
+func (h *Hook) run(ctx context.Context) error {
+	if len(h.Command) == 0 {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Dir = h.dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Command %s failed : %v\n%s", strings.Join(h.Command, " "), err, out)
+	}
+	return nil
+}
+
+func hookDiag(summary, detail string, hook *Hook) *hcl.Diagnostic {
+	return &hcl.Diagnostic{Severity: hcl.DiagError, Summary: summary, Detail: detail, Subject: hook.DeclRange.Ptr()}
+}
+
+// newHook creates the hook declared in the given spec file
+func newHook(command []string, files []*HookFile, declRange hcl.Range, specFile string) *Hook {
+	dir := filepath.Dir(specFile)
+	for _, file := range files {
+		if !filepath.IsAbs(file.Path) {
+			file.Path = filepath.Join(dir, file.Path)
+		}
+	}
+	return &Hook{Command: command, Files: files, DeclRange: declRange, dir: dir}
+}
@@ -0,0 +1,149 @@
+package terraspec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+func TestHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	specFile := filepath.Join(dir, "hooks.tfspec")
+	spec, diags := ParseSpec([]byte(`
+before {
+  file "generated.json" {
+    content = "{}"
+  }
+  command = ["cp", "generated.json", "copied.json"]
+}
+
+after {
+  command = ["rm", "copied.json"]
+}
+
+after {
+  command = ["false"]
+}
+`), specFile, nil)
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if len(spec.Before) != 1 || len(spec.After) != 2 {
+		t.Fatalf("Expected 1 before and 2 after hooks, got %d and %d", len(spec.Before), len(spec.After))
+	}
+
+	if diags := spec.RunBeforeHooks(context.Background()); diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	for _, name := range []string{"generated.json", "copied.json"} {
+		if content, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(content) != "{}" {
+			t.Errorf("%s should have been written by the before hook, got %q, %v", name, content, err)
+		}
+	}
+
+	afterDiags := spec.RunAfterHooks()
+	if len(afterDiags) != 1 || afterDiags[0].Description().Summary != "After hook failed" {
+		t.Errorf("Expected the failure of the second after hook, got %v", afterDiags.Err())
+	} else if subject := afterDiags[0].Source().Subject; subject == nil || subject.Start.Line != 13 {
+		t.Errorf("The failure should be reported at the declaration of the hook, got %v", subject)
+	}
+	for _, name := range []string{"generated.json", "copied.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been removed after the test case, got %v", name, err)
+		}
+	}
+}
+
+func TestHooksRestoreFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"settings.json": "original",
+		"target.json":   "linked",
+	})
+	if err := os.Symlink(filepath.Join(dir, "target.json"), filepath.Join(dir, "link.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	newSpec := func() *Spec {
+		spec, diags := ParseSpec([]byte(`
+before {
+  file "settings.json" {
+    content = "generated"
+  }
+  file "link.json" {
+    content = "generated"
+  }
+}
+`), filepath.Join(dir, "hooks.tfspec"), nil)
+		if diags.HasErrors() {
+			t.Fatal(diags.Error())
+		}
+		return spec
+	}
+
+	spec := newSpec()
+	if diags := spec.RunBeforeHooks(context.Background()); diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	for _, name := range []string{"settings.json", "link.json"} {
+		if content, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(content) != "generated" {
+			t.Errorf("%s should have been written by the before hook, got %q, %v", name, content, err)
+		}
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "target.json")); string(content) != "linked" {
+		t.Errorf("The target of the link should not be written, got %q", content)
+	}
+
+	// a test case writing the same files waits until the files are restored
+	other := newSpec()
+	started := make(chan tfdiags.Diagnostics)
+	go func() { started <- other.RunBeforeHooks(context.Background()) }()
+	select {
+	case <-started:
+		t.Fatal("The before hooks writing the same files should wait for the first test case")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if diags := spec.RunAfterHooks(); diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	if diags := <-started; diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	if diags := other.RunAfterHooks(); diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "settings.json")); err != nil || string(content) != "original" {
+		t.Errorf("settings.json should have been restored, got %q, %v", content, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "link.json")); err != nil || target != filepath.Join(dir, "target.json") {
+		t.Errorf("link.json should have been restored, got %q, %v", target, err)
+	}
+
+	// an existing backup is never overwritten
+	writeFiles(t, dir, map[string]string{"settings.json" + hookBackupSuffix: "left by a killed run"})
+	spec = newSpec()
+	if diags := spec.RunBeforeHooks(context.Background()); !diags.HasErrors() {
+		t.Error("Writing a file whose backup already exists should fail")
+	}
+	if diags := spec.RunAfterHooks(); diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "settings.json")); string(content) != "original" {
+		t.Errorf("settings.json should not have been changed, got %q", content)
+	}
+}
@@ -0,0 +1,57 @@
+package terraspec
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ImportAssertType is the type of the assert blocks checking the imports planned by the import blocks of terraform 1.5 onwards,
+// eg assert "import" "aws_instance.web" { id = "i-0123" }. The name of the block is the address the resource is imported into
+const ImportAssertType = "import"
+
+// importSchema is the schema of the body of the import assert blocks. id is the ID of the imported resource,
+// any import into the address of the block passes when it's not set
+var importSchema = &configschema.Block{
+	Attributes: map[string]*configschema.Attribute{
+		"id": {Type: cty.String, Optional: true},
+	},
+}
+
+// readPlannedImports records the ID of the resources the plan imports, from the importing object of its resource changes
+// in the JSON format of terraform show -json. The plan is only read when the spec has import asserts
+func (s *Spec) readPlannedImports(planJSON []byte) error {
+	if !s.hasAssertOfType(ImportAssertType) {
+		return nil
+	}
+	s.imports = make(map[string]string)
+	err := eachResourceChange(planJSON, func(rc *jsonResourceChange) error {
+		if rc.Change.Importing != nil {
+			s.imports[rc.Address] = rc.Change.Importing.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Could not read the imports of the plan : %v", err)
+	}
+	return nil
+}
+
+// checkImport checks that the plan imports a resource into the address named by assert, with the asserted ID when it's set.
+// Plans computed by the embedded terraform never import resources, as it doesn't support import blocks
+func (s *Spec) checkImport(assert *Assert) *TerraspecDiagnostic {
+	path := cty.GetAttrPath(ImportAssertType).GetAttr(assert.Name)
+	expected := cty.NullVal(cty.String)
+	if !assert.Value.IsNull() {
+		expected = assert.Value.GetAttr("id")
+	}
+	id, ok := s.imports[assert.Name]
+	if !ok {
+		return ErrorDiags(path, "No import planned into this address").withMismatch(MismatchMissing, expected, cty.NilVal)
+	}
+	if !expected.IsNull() && expected.AsString() != id {
+		return AssertErrorDiags(path.GetAttr("id"), expected.AsString(), id).withMismatch(MismatchValue, expected, cty.StringVal(id))
+	}
+	return SuccessDiags(path.GetAttr("id"), id)
+}
@@ -0,0 +1,202 @@
+package terraspec
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	getter "github.com/hashicorp/go-getter"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// importedBlocks are the blocks a spec file imported by an import block can hold
+var importedBlocks = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: versionAttribute}},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "assert", LabelNames: []string{"type", "name"}},
+		{Type: "reject", LabelNames: []string{"type", "name"}},
+		{Type: "mock", LabelNames: []string{"type", "name"}},
+		{Type: "import"},
+	},
+}
+
+// fetchedImports are the folders the remote sources of import blocks were downloaded to by this process,
+// so a source imported by several spec files is only downloaded once per run
+var fetchedImports = struct {
+	sync.Mutex
+	dirs map[string]string
+}{dirs: make(map[string]string)}
+
+// importSpecs parses the spec files imported by an import block of specFile. The source is addressed like the source of a module :
+// a local path relative to specFile, or a remote address, eg git::https://example.com/specs.git//tags?ref=v1.2. A folder imports
+// all its .tfspec files, and remote sources are always folders. Imported files may only hold assert, reject, mock and import blocks.
+// importing holds the spec files being parsed, to report import cycles
+func importSpecs(source string, rng hcl.Range, specFile string, schemas *terraform.Schemas, importing map[string]bool) ([]*Spec, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	files, err := importedFiles(source, specFile)
+	if err != nil {
+		return nil, diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid import",
+			Detail:   err.Error(),
+			Subject:  rng.Ptr(),
+		})
+	}
+
+	var specs []*Spec
+	for _, file := range files {
+		if importing[file] {
+			return nil, diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Import cycle",
+				Detail:   fmt.Sprintf("%s is already being imported, it can't import itself", file),
+				Subject:  rng.Ptr(),
+			})
+		}
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, diags.Append(&hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Invalid import", Detail: err.Error(), Subject: rng.Ptr()})
+		}
+		parsed, fileDiags := hclparse.NewParser().ParseHCL(src, file)
+		if fileDiags.HasErrors() {
+			return nil, append(diags, fileDiags...)
+		}
+		if _, contentDiags := parsed.Body.Content(importedBlocks); contentDiags.HasErrors() {
+			for _, diag := range contentDiags {
+				diag.Detail = fmt.Sprintf("%s Imported spec files may only hold assert, reject, mock and import blocks.", diag.Detail)
+			}
+			return nil, append(diags, contentDiags...)
+		}
+
+		nested := make(map[string]bool, len(importing)+1)
+		for f := range importing {
+			nested[f] = true
+		}
+		nested[file] = true
+		spec, specDiags := parseSpec(src, file, schemas, nested)
+		diags = append(diags, specDiags...)
+		if specDiags.HasErrors() {
+			return nil, diags
+		}
+		specs = append(specs, spec)
+	}
+	return specs, diags
+}
+
+// importedFiles returns the absolute paths of the spec files imported from source by specFile
+func importedFiles(source, specFile string) ([]string, error) {
+	detected, err := getter.Detect(source, filepath.Dir(absPath(specFile)), getter.Detectors)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid source %s : %v", source, err)
+	}
+	var path string
+	if strings.HasPrefix(detected, "file://") {
+		path = filepath.FromSlash(strings.TrimPrefix(detected, "file://"))
+	} else if path, err = fetchImport(source); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{absPath(path)}, nil
+	}
+	files, err := filepath.Glob(filepath.Join(path, "*.tfspec"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No .tfspec file found in %s", source)
+	}
+	sort.Strings(files)
+	for i, file := range files {
+		files[i] = absPath(file)
+	}
+	return files, nil
+}
+
+// importSourcesSchema reads the sources of the import blocks of a spec file, without decoding its other blocks
+var importSourcesSchema = &hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{{Type: "import"}}}
+
+// eachImportedFile calls found with the source of every import block of specFile, and of the files it imports, recursively,
+// and with the files imported from it. Remote sources are downloaded, like when the spec is read
+func eachImportedFile(specFile string, found func(source, file string) error) error {
+	return walkImports(absPath(specFile), map[string]bool{absPath(specFile): true}, found)
+}
+
+func walkImports(specFile string, seen map[string]bool, found func(source, file string) error) error {
+	src, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		return err
+	}
+	parsed, diags := hclparse.NewParser().ParseHCL(src, specFile)
+	if diags.HasErrors() {
+		return diags
+	}
+	content, _, diags := parsed.Body.PartialContent(importSourcesSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+	for _, block := range content.Blocks {
+		var imp struct {
+			Source string `hcl:"source,attr"`
+		}
+		if diags := gohcl.DecodeBody(block.Body, nil, &imp); diags.HasErrors() {
+			return diags
+		}
+		files, err := importedFiles(imp.Source, specFile)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := found(imp.Source, file); err != nil {
+				return err
+			}
+			if seen[file] {
+				continue
+			}
+			seen[file] = true
+			if err := walkImports(file, seen, found); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fetchImport downloads the remote source of an import block in the cache folder of the user, once per run, and returns its folder
+func fetchImport(source string) (string, error) {
+	fetchedImports.Lock()
+	defer fetchedImports.Unlock()
+	if dir, ok := fetchedImports.dirs[source]; ok {
+		return dir, nil
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(source))
+	dir := filepath.Join(cacheDir, "terraspec", "imports", hex.EncodeToString(hash[:]))
+	// the source may have changed since a previous run, eg a branch, so it's downloaded again
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := FetchSpecs(context.Background(), source, ".", dir); err != nil {
+		return "", err
+	}
+	fetchedImports.dirs[source] = dir
+	return dir, nil
+}
@@ -0,0 +1,110 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportSpecs(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-imports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"shared/tags.tfspec":         "assert \"ressource_type\" \"name\" {\n  property = \"value\"\n}",
+		"shared/data/mocks.tfspec":   "mock \"data_type\" \"name\" {\n  query = 1\n  return {\n    id = 2\n  }\n}",
+		"shared/data/rejects.tfspec": `reject "ressource_type" "removed" {}`,
+		"shared/cycle.tfspec":        "import {\n  source = \"./cycle.tfspec\"\n}",
+		"shared/hooks.tfspec":        "after {\n  command = [\"true\"]\n}",
+		"shared/conflict.tfspec":     "assert \"ressource_type\" \"name\" {\n  property = \"other\"\n}",
+		"shared/nested.tfspec":       "import {\n  source = \"./tags.tfspec\"\n}",
+	})
+
+	tests := map[string]struct {
+		spec    string
+		asserts int
+		mocks   int
+		rejects int
+		error   string
+	}{
+		"File":        {spec: "import {\n  source = \"../shared/tags.tfspec\"\n}", asserts: 1},
+		"Folder":      {spec: "import {\n  source = \"../shared/data\"\n}\nassert \"ressource_type\" \"other\" {}", asserts: 1, mocks: 1, rejects: 1},
+		"Nested":      {spec: "import {\n  source = \"../shared/nested.tfspec\"\n}", asserts: 1},
+		"Missing":     {spec: "import {\n  source = \"../shared/missing.tfspec\"\n}", error: "Invalid import"},
+		"Cycle":       {spec: "import {\n  source = \"../shared/cycle.tfspec\"\n}", error: "Import cycle"},
+		"Other block": {spec: "import {\n  source = \"../shared/hooks.tfspec\"\n}", error: "may only hold assert, reject, mock and import blocks"},
+		"Conflict":    {spec: "import {\n  source = \"../shared/tags.tfspec\"\n}\nimport {\n  source = \"../shared/conflict.tfspec\"\n}", error: "Conflicting assertions"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			specFile := filepath.Join(root, "spec", strings.Replace(name, " ", "_", -1)+".tfspec")
+			writeFiles(t, root, map[string]string{filepath.Join("spec", filepath.Base(specFile)): tt.spec})
+			spec, diags := ReadSpec(specFile, testSchemas())
+			if tt.error != "" {
+				if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), tt.error) {
+					t.Errorf("Expected an error about %s, got %v", tt.error, diags.Err())
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatal(diags.Err())
+			}
+			if len(spec.Asserts) != tt.asserts || len(spec.Mocks) != tt.mocks || len(spec.Rejects) != tt.rejects {
+				t.Errorf("Expected %d asserts, %d mocks and %d rejects, got %d, %d and %d", tt.asserts, tt.mocks, tt.rejects, len(spec.Asserts), len(spec.Mocks), len(spec.Rejects))
+			}
+			for _, assert := range spec.Asserts {
+				if name != "Folder" && assert.DeclRange.Filename != filepath.Join(root, "shared", "tags.tfspec") {
+					t.Errorf("Imported assertions should be located in the file they're written in, got %s", assert.DeclRange.Filename)
+				}
+			}
+		})
+	}
+}
+
+func TestImportRemoteSpecs(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root, err := ioutil.TempDir("", "terraspec-remote-imports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	// remote sources are downloaded in the cache folder of the user
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(root, "cache"))
+
+	repo := filepath.Join(root, "library")
+	writeFiles(t, root, map[string]string{
+		"library/tags/tags.tfspec": "assert \"ressource_type\" \"name\" {\n  property = \"value\"\n}",
+		"spec/case.tfspec":         "import {\n  source = \"git::file://" + filepath.ToSlash(repo) + "//tags\"\n}",
+	})
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}, {"-c", "user.name=terraspec", "-c", "user.email=terraspec@example.com", "commit", "-q", "-m", "init"}} {
+		if _, err := git(repo, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spec, diags := ReadSpec(filepath.Join(root, "spec", "case.tfspec"), testSchemas())
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	if len(spec.Asserts) != 1 || !strings.HasPrefix(spec.Asserts[0].DeclRange.Filename, filepath.Join(root, "cache", "terraspec", "imports")) {
+		t.Errorf("Expected the assert of the remote library, got %v", spec.Asserts)
+	}
+
+	// the result cache hashes the remote source with the files downloaded from it
+	var imported []string
+	err = eachImportedFile(filepath.Join(root, "spec", "case.tfspec"), func(source, file string) error {
+		imported = append(imported, source+" "+filepath.Base(file))
+		return nil
+	})
+	if expected := "git::file://" + filepath.ToSlash(repo) + "//tags tags.tfspec"; err != nil || len(imported) != 1 || imported[0] != expected {
+		t.Errorf("Expected the remote file imported from %s, got %v, %v", expected, imported, err)
+	}
+}
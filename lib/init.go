@@ -0,0 +1,79 @@
+package terraspec
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/hashicorp/terraform/configs/configload"
+)
+
+// moduleInstallErrors are the summaries of the diagnostics terraform returns
+// when the installed modules don't match the configuration
+var moduleInstallErrors = map[string]bool{
+	"Module not installed":                     true,
+	"Module source has changed":                true,
+	"Module version requirements have changed": true,
+}
+
+// InitNeeded checks if the terraform working directory in dir is missing modules or providers required by the config.
+// Providers are also searched in the given pluginDirs.
+// It returns the reason why init is needed, or an empty string if the working directory is up to date
+func InitNeeded(dir string, pluginDirs ...string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(filepath.Join(absDir, ".terraform")); os.IsNotExist(err) {
+		return ".terraform directory is missing", nil
+	}
+
+	loader, err := configload.NewLoader(&configload.Config{
+		ModulesDir: filepath.Join(absDir, ".terraform/modules"),
+	})
+	if err != nil {
+		return "", err
+	}
+	cfg, diags := loader.LoadConfig(absDir)
+	for _, diag := range diags {
+		if moduleInstallErrors[diag.Summary] {
+			if diag.Subject != nil {
+				return fmt.Sprintf("%s (%s)", diag.Summary, diag.Subject), nil
+			}
+			return diag.Summary, nil
+		}
+	}
+	if diags.HasErrors() {
+		// Init won't fix errors in the config, they'll be reported when running the test cases
+		return "", nil
+	}
+
+	resolver, err := BuildProviderResolver(absDir, pluginDirs...)
+	if err != nil {
+		return "", err
+	}
+	for _, provider := range cfg.ProviderTypes() {
+		if provider.IsBuiltIn() {
+			continue
+		}
+		if _, ok := resolver.KnownPlugins[provider]; !ok {
+			return fmt.Sprintf("Provider %s is not installed", provider), nil
+		}
+	}
+
+	return "", nil
+}
+
+// RunInit runs terraform init in dir with the given terraform binary, without initializing the backend.
+// It returns the output of the command
+func RunInit(dir, terraformBin string) (string, error) {
+	cmd := exec.Command(terraformBin, "init", "-backend=false", "-input=false")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("%s init failed : %v\n%s", terraformBin, err, output)
+	}
+	return string(output), nil
+}
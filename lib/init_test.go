@@ -0,0 +1,25 @@
+package terraspec
+
+import "testing"
+
+func TestInitNeeded(t *testing.T) {
+	tests := map[string]struct {
+		dir      string
+		expected string
+	}{
+		"missing .terraform": {dir: "testdata/module", expected: ".terraform directory is missing"},
+		"up to date":         {dir: "testdata", expected: ""},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reason, err := InitNeeded(tt.dir)
+			if err != nil {
+				t.Fatalf("Unexpected error : %v", err)
+			}
+			if reason != tt.expected {
+				t.Errorf("Wrong reason. Got %q want %q", reason, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package terraspec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// jsonPriorState holds the data sources read in the prior state of a plan in the JSON format of terraform show -json
+type jsonPriorState struct {
+	PriorState struct {
+		Values struct {
+			RootModule jsonStateModule `json:"root_module"`
+		} `json:"values"`
+	} `json:"prior_state"`
+}
+
+type jsonStateModule struct {
+	Resources []struct {
+		Mode         string          `json:"mode"`
+		Type         string          `json:"type"`
+		ProviderName string          `json:"provider_name"`
+		Values       json.RawMessage `json:"values"`
+	} `json:"resources"`
+	ChildModules []jsonStateModule `json:"child_modules"`
+}
+
+// InferSchemas returns provider schemas implied by the values of a plan in the JSON format of terraform show -json,
+// so a spec can be checked against the plan without the provider plugins. Every attribute planned for a resource type,
+// or read for a data source of the prior state, is an optional attribute of its type. Objects are single nested blocks,
+// eg tags, and repeated blocks are attributes holding lists of objects, which specs can write as blocks as well.
+// The attributes only null or unknown in the plan are strings
+func InferSchemas(planJSON []byte) (*terraform.Schemas, error) {
+	var plan jsonPlan
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return nil, fmt.Errorf("Could not read plan : %v", err)
+	}
+	var prior jsonPriorState
+	if err := json.Unmarshal(planJSON, &prior); err != nil {
+		return nil, fmt.Errorf("Could not read prior state of the plan : %v", err)
+	}
+
+	inferred := make(map[addrs.Provider]map[addrs.ResourceMode]map[string]map[string]cty.Type)
+	infer := func(mode addrs.ResourceMode, typeName, providerName string, values []json.RawMessage, unknown json.RawMessage) error {
+		provider := addrs.NewDefaultProvider(strings.Split(typeName, "_")[0])
+		if providerName != "" {
+			var diags tfdiags.Diagnostics
+			if provider, diags = addrs.ParseProviderSourceString(providerName); diags.HasErrors() {
+				return fmt.Errorf("Invalid provider of %s : %v", typeName, diags.Err())
+			}
+		}
+		if inferred[provider] == nil {
+			inferred[provider] = make(map[addrs.ResourceMode]map[string]map[string]cty.Type)
+		}
+		if inferred[provider][mode] == nil {
+			inferred[provider][mode] = make(map[string]map[string]cty.Type)
+		}
+		attributes := inferred[provider][mode][typeName]
+		if attributes == nil {
+			attributes = make(map[string]cty.Type)
+			inferred[provider][mode][typeName] = attributes
+		}
+		for _, raw := range values {
+			if err := inferAttributes(attributes, raw); err != nil {
+				return fmt.Errorf("Could not infer the schema of %s : %v", typeName, err)
+			}
+		}
+		inferUnknownAttributes(attributes, unknown)
+		return nil
+	}
+
+	for _, rc := range plan.ResourceChanges {
+		mode := addrs.ManagedResourceMode
+		if rc.Mode == "data" {
+			mode = addrs.DataResourceMode
+		}
+		if err := infer(mode, rc.Type, rc.ProviderName, []json.RawMessage{rc.Change.Before, rc.Change.After}, rc.Change.AfterUnknown); err != nil {
+			return nil, err
+		}
+	}
+	var priorErr error
+	var eachModule func(m jsonStateModule)
+	eachModule = func(m jsonStateModule) {
+		for _, r := range m.Resources {
+			if r.Mode == "data" && priorErr == nil {
+				priorErr = infer(addrs.DataResourceMode, r.Type, r.ProviderName, []json.RawMessage{r.Values}, nil)
+			}
+		}
+		for _, child := range m.ChildModules {
+			eachModule(child)
+		}
+	}
+	eachModule(prior.PriorState.Values.RootModule)
+	if priorErr != nil {
+		return nil, priorErr
+	}
+
+	schemas := &terraform.Schemas{Providers: make(map[addrs.Provider]*terraform.ProviderSchema, len(inferred))}
+	for provider, modes := range inferred {
+		schema := &terraform.ProviderSchema{
+			Provider:                   &configschema.Block{},
+			ResourceTypes:              make(map[string]*configschema.Block),
+			DataSources:                make(map[string]*configschema.Block),
+			ResourceTypeSchemaVersions: make(map[string]uint64),
+		}
+		for mode, types := range modes {
+			for typeName, attributes := range types {
+				block := inferredBlock(attributes)
+				if mode == addrs.DataResourceMode {
+					schema.DataSources[typeName] = block
+				} else {
+					schema.ResourceTypes[typeName] = block
+					schema.ResourceTypeSchemaVersions[typeName] = 0
+				}
+			}
+		}
+		schemas.Providers[provider] = schema
+	}
+	return schemas, nil
+}
+
+// inferAttributes merges into attributes the types of the attributes of the JSON object raw
+func inferAttributes(attributes map[string]cty.Type, raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ty, err := ctyjson.ImpliedType(values[name])
+		if err != nil {
+			return err
+		}
+		ty = looseType(ty)
+		if previous, ok := attributes[name]; ok {
+			merged, ok := mergeTypes(previous, ty)
+			if !ok {
+				return fmt.Errorf("attribute %s is planned with incompatible types %s and %s", name, previous.FriendlyName(), ty.FriendlyName())
+			}
+			ty = merged
+		}
+		attributes[name] = ty
+	}
+	return nil
+}
+
+// inferUnknownAttributes adds to attributes the attributes of the after_unknown object unknown, which are only known after apply.
+// Their type is left unknown, so it's given by the other values of the resource type or defaults to a string
+func inferUnknownAttributes(attributes map[string]cty.Type, unknown json.RawMessage) {
+	var flags map[string]json.RawMessage
+	if err := json.Unmarshal(unknown, &flags); err != nil {
+		return
+	}
+	for name, flag := range flags {
+		if _, ok := attributes[name]; !ok && string(flag) == "true" {
+			attributes[name] = cty.DynamicPseudoType
+		}
+	}
+}
+
+// looseType turns tuples into lists whose element type is the merged type of the elements, eg the blocks of a nested block type.
+// A tuple whose elements can't be merged stays a tuple
+func looseType(ty cty.Type) cty.Type {
+	switch {
+	case ty.IsObjectType():
+		attrs := make(map[string]cty.Type, len(ty.AttributeTypes()))
+		for name, attr := range ty.AttributeTypes() {
+			attrs[name] = looseType(attr)
+		}
+		return cty.Object(attrs)
+	case ty.IsTupleType():
+		elem := cty.DynamicPseudoType
+		for _, e := range ty.TupleElementTypes() {
+			merged, ok := mergeTypes(elem, looseType(e))
+			if !ok {
+				return ty
+			}
+			elem = merged
+		}
+		return cty.List(elem)
+	}
+	return ty
+}
+
+// mergeTypes returns a type holding the values of both types : objects get the attributes of both, and different primitive types are strings
+func mergeTypes(a, b cty.Type) (cty.Type, bool) {
+	switch {
+	case a.Equals(b):
+		return a, true
+	case a == cty.DynamicPseudoType:
+		return b, true
+	case b == cty.DynamicPseudoType:
+		return a, true
+	case a.IsPrimitiveType() && b.IsPrimitiveType():
+		return cty.String, true
+	case a.IsListType() && b.IsListType():
+		elem, ok := mergeTypes(a.ElementType(), b.ElementType())
+		return cty.List(elem), ok
+	case a.IsMapType() && b.IsMapType():
+		elem, ok := mergeTypes(a.ElementType(), b.ElementType())
+		return cty.Map(elem), ok
+	case a.IsObjectType() && b.IsObjectType():
+		attrs := make(map[string]cty.Type)
+		for name, ty := range a.AttributeTypes() {
+			attrs[name] = ty
+		}
+		for name, ty := range b.AttributeTypes() {
+			if previous, ok := attrs[name]; ok {
+				merged, ok := mergeTypes(previous, ty)
+				if !ok {
+					return cty.NilType, false
+				}
+				ty = merged
+			}
+			attrs[name] = ty
+		}
+		return cty.Object(attrs), true
+	}
+	return cty.NilType, false
+}
+
+// inferredBlock returns the schema of a block with the given attributes. Objects are nested blocks, so specs can write them
+// as blocks or as attributes, and the types left unknown are strings
+func inferredBlock(attributes map[string]cty.Type) *configschema.Block {
+	block := &configschema.Block{Attributes: make(map[string]*configschema.Attribute), BlockTypes: make(map[string]*configschema.NestedBlock)}
+	for name, ty := range attributes {
+		ty = concreteType(ty)
+		if ty.IsObjectType() {
+			block.BlockTypes[name] = &configschema.NestedBlock{Block: *inferredBlock(ty.AttributeTypes()), Nesting: configschema.NestingSingle}
+			continue
+		}
+		block.Attributes[name] = &configschema.Attribute{Type: ty, Optional: true}
+	}
+	return block
+}
+
+// concreteType replaces the unknown types left in ty, of values only null or unknown in the plan, by strings
+func concreteType(ty cty.Type) cty.Type {
+	switch {
+	case ty == cty.DynamicPseudoType:
+		return cty.String
+	case ty.IsListType():
+		return cty.List(concreteType(ty.ElementType()))
+	case ty.IsMapType():
+		return cty.Map(concreteType(ty.ElementType()))
+	case ty.IsObjectType():
+		attrs := make(map[string]cty.Type, len(ty.AttributeTypes()))
+		for name, attr := range ty.AttributeTypes() {
+			attrs[name] = concreteType(attr)
+		}
+		return cty.Object(attrs)
+	case ty.IsTupleType():
+		elems := make([]cty.Type, len(ty.TupleElementTypes()))
+		for i, e := range ty.TupleElementTypes() {
+			elems[i] = concreteType(e)
+		}
+		return cty.Tuple(elems)
+	}
+	return ty
+}
+
+// CheckPlanJSON checks the assertions and the policies of specFile against a plan in the JSON format of terraform show -json,
+// with the schemas implied by the plan, see InferSchemas. Neither the config nor the provider plugins are needed, so mocks,
+// states and hooks of the spec are ignored. Invalid specs are reported in the result, the error is only set when the plan can't be read
+func CheckPlanJSON(ctx context.Context, specFile string, planJSON []byte) (*CaseResult, error) {
+	start := time.Now()
+	schemas, err := InferSchemas(planJSON)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := PlanFromJSON(planJSON, schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := &TestCase{Dir: filepath.Dir(specFile), SpecFile: specFile}
+	out := caseOutput{json: planJSON}
+	spec, diags := ReadSpec(specFile, schemas)
+	if !diags.HasErrors() {
+		validateStart := time.Now()
+		diags = diags.Append(validatePlan(ctx, spec, plan, planJSON, nil))
+		out.timings.Validate = time.Since(validateStart)
+		out.blocks = spec.blockRanges()
+		out.expectedFailure = spec.Terraspec.ExpectFailure
+	}
+	result := newCaseResult(tc, out, diags, time.Since(start))
+	result.Name = specFile
+	return result, nil
+}
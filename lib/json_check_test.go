@@ -0,0 +1,212 @@
+package terraspec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const checkPlanJSON = `{
+  "format_version": "0.1",
+  "resource_changes": [
+    {
+      "address": "aws_instance.web",
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "web",
+      "provider_name": "registry.terraform.io/hashicorp/aws",
+      "change": {
+        "actions": ["create"],
+        "before": null,
+        "after": {"ami": "ami-123", "count": 2, "tags": {"env": "prod"}, "ebs_block_device": [{"size": 10}, {"size": 20, "encrypted": true}], "arn": null},
+        "after_unknown": {"id": true, "arn": true}
+      }
+    },
+    {
+      "address": "aws_instance.old",
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "old",
+      "provider_name": "registry.terraform.io/hashicorp/aws",
+      "change": {"actions": ["delete"], "before": {"ami": "ami-000", "count": "1", "id": "i-1"}, "after": null}
+    },
+    {
+      "address": "aws_instance.app",
+      "previous_address": "aws_instance.server",
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "app",
+      "provider_name": "registry.terraform.io/hashicorp/aws",
+      "change": {"actions": ["no-op"], "before": {"ami": "ami-000", "id": "i-2"}, "after": {"ami": "ami-000", "id": "i-2"}}
+    },
+    {
+      "address": "aws_instance.legacy",
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "legacy",
+      "provider_name": "registry.terraform.io/hashicorp/aws",
+      "change": {"actions": ["no-op"], "before": {"ami": "ami-000", "id": "i-3"}, "after": {"ami": "ami-000", "id": "i-3"}, "importing": {"id": "i-3"}}
+    }
+  ],
+  "prior_state": {
+    "values": {
+      "root_module": {
+        "resources": [
+          {"mode": "data", "type": "aws_ami", "name": "latest", "provider_name": "registry.terraform.io/hashicorp/aws", "values": {"id": "ami-123"}}
+        ]
+      }
+    }
+  }
+}`
+
+func TestInferSchemas(t *testing.T) {
+	schemas, err := InferSchemas([]byte(checkPlanJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, _ := schemas.ResourceTypeConfig(addrs.NewDefaultProvider("aws"), addrs.ManagedResourceMode, "aws_instance")
+	if schema == nil {
+		t.Fatal("Expected a schema for aws_instance")
+	}
+	expected := map[string]cty.Type{
+		"ami":              cty.String,
+		"count":            cty.String,
+		"ebs_block_device": cty.List(cty.Object(map[string]cty.Type{"size": cty.Number, "encrypted": cty.Bool})),
+		"arn":              cty.String,
+		"id":               cty.String,
+	}
+	if tags, ok := schema.BlockTypes["tags"]; !ok || tags.Nesting != configschema.NestingSingle || tags.Attributes["env"] == nil {
+		t.Errorf("Expected tags to be a nested block, got %v", schema.BlockTypes)
+	}
+	if len(schema.Attributes) != len(expected) {
+		t.Errorf("Expected %d attributes, got %v", len(expected), schema.Attributes)
+	}
+	for name, ty := range expected {
+		if attr, ok := schema.Attributes[name]; !ok || !attr.Type.Equals(ty) {
+			t.Errorf("Expected attribute %s of type %s, got %v", name, ty.FriendlyName(), attr)
+		}
+	}
+	if data, _ := schemas.ResourceTypeConfig(addrs.NewDefaultProvider("aws"), addrs.DataResourceMode, "aws_ami"); data == nil || data.Attributes["id"] == nil {
+		t.Errorf("Expected a schema for data source aws_ami, got %v", data)
+	}
+
+	if _, err := InferSchemas([]byte(`{"resource_changes": [{"type": "aws_instance", "change": {"before": {"ami": "a"}, "after": {"ami": ["a"]}}}]}`)); err == nil {
+		t.Errorf("Incompatible types of an attribute should be reported")
+	}
+}
+
+func TestCheckPlanJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-check-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		spec   string
+		failed bool
+		error  string
+	}{
+		"Passing": {
+			spec: `
+assert "aws_instance" "web" {
+  ami  = "ami-123"
+  tags = { env = "prod" }
+  ebs_block_device {
+    size = 10
+  }
+  ebs_block_device {
+    size      = 20
+    encrypted = true
+  }
+}
+reject "aws_instance" "old" {}
+assert "moved" "aws_instance.app" {
+  from = "aws_instance.server"
+}
+assert "import" "aws_instance.legacy" {
+  id = "i-3"
+}
+`,
+		},
+		"Wrong import": {
+			spec: `
+assert "import" "aws_instance.legacy" {
+  id = "i-4"
+}
+`,
+			failed: true,
+			error:  "i-4",
+		},
+		"No import": {
+			spec: `
+assert "import" "aws_instance.web" {}
+`,
+			failed: true,
+			error:  "No import planned",
+		},
+		"Wrong move": {
+			spec: `
+assert "moved" "aws_instance.app" {
+  from = "aws_instance.other"
+}
+`,
+			failed: true,
+			error:  "aws_instance.other",
+		},
+		"No move": {
+			spec: `
+assert "moved" "aws_instance.web" {}
+`,
+			failed: true,
+			error:  "No move planned",
+		},
+		"Failing": {
+			spec: `
+assert "aws_instance" "web" {
+  ami = "ami-456"
+}
+`,
+			failed: true,
+			error:  "ami-456",
+		},
+		"Unknown attribute": {
+			spec: `
+assert "aws_instance" "web" {
+  amii = "ami-123"
+}
+`,
+			failed: true,
+			error:  "amii",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			specFile := filepath.Join(dir, strings.Replace(name, " ", "_", -1)+".tfspec")
+			if err := ioutil.WriteFile(specFile, []byte(tt.spec), 0644); err != nil {
+				t.Fatal(err)
+			}
+			result, err := CheckPlanJSON(context.Background(), specFile, []byte(checkPlanJSON))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Failed() != tt.failed {
+				t.Fatalf("Expected failed to be %v, got %v", tt.failed, result.Diagnostics.Err())
+			}
+			if tt.failed && !strings.Contains(result.Diagnostics.Err().Error(), tt.error) {
+				t.Errorf("Expected an error about %s, got %v", tt.error, result.Diagnostics.Err())
+			}
+		})
+	}
+
+	if _, err := CheckPlanJSON(context.Background(), filepath.Join(dir, "none.tfspec"), []byte("not json")); err == nil {
+		t.Errorf("An invalid plan should be an error")
+	}
+}
@@ -0,0 +1,157 @@
+package terraspec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// assertMetaAttributes are the attributes of assert blocks that configure the assertion rather than assert a value
+var assertMetaAttributes = map[string]bool{
+	"depends_on":    true,
+	"provider":      true,
+	"message":       true,
+	"tolerance":     true,
+	"round_numbers": true,
+	"normalize":     true,
+}
+
+// LintSpec reports as warnings the anti-patterns of a spec file : assert blocks asserting nothing, attributes only computed
+// by the provider, mocks never called because an earlier mock matches the same calls and syntax deprecated by a newer
+// version of the spec language. The spec must be valid, its errors are returned otherwise.
+// FixSpec fixes the empty assert blocks and the deprecated syntax
+func LintSpec(src []byte, filename string, schemas *terraform.Schemas) hcl.Diagnostics {
+	spec, diags := ParseSpec(src, filename, schemas)
+	if diags.HasErrors() {
+		return diags
+	}
+	file, _ := hclsyntax.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
+
+	var lints hcl.Diagnostics
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		switch block.Type {
+		case "assert":
+			if emptyAssert(block) {
+				lints = lints.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Empty assert block",
+					Detail:   fmt.Sprintf("This assert block asserts nothing on %s : assert its attributes or remove it. Fixed by terraspec lint --fix.", strings.Join(block.Labels, ".")),
+					Subject:  block.AsHCLBlock().DefRange.Ptr(),
+				})
+			}
+			if schema := managedResourceSchema(schemas, block.Labels[0]); schema != nil {
+				lints = append(lints, computedAttributes(block.Labels[0]+"."+block.Labels[1], block.Body, schema)...)
+			}
+		case "mock_count":
+			if spec.Version < 2 {
+				lints = lints.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Deprecated mock_count block",
+					Detail:   "mock_count blocks are replaced by the mock_counts attribute of the terraspec block since version 2 of the spec language. Fixed by terraspec lint --fix.",
+					Subject:  block.AsHCLBlock().DefRange.Ptr(),
+				})
+			}
+		}
+	}
+
+	for i, mock := range spec.Mocks {
+		for _, previous := range spec.Mocks[:i] {
+			if previous.Query.RawEquals(mock.Query) {
+				lints = lints.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Shadowed mock",
+					Detail:   fmt.Sprintf("The mock at line %d matches the same data source calls and is used first, so this mock is never called.", previous.DeclRange.Start.Line),
+					Subject:  mock.DeclRange.Ptr(),
+				})
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(lints, func(i, j int) bool {
+		return lints[i].Subject.Start.Byte < lints[j].Subject.Start.Byte
+	})
+	return append(diags, lints...)
+}
+
+// FixSpec rewrites the content of a spec file without the anti-patterns LintSpec can fix : empty assert blocks are removed
+// and the spec is migrated to the current SpecVersion
+func FixSpec(src []byte, filename string) ([]byte, hcl.Diagnostics) {
+	fixed, diags := MigrateSpec(src, filename)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	file, parseDiags := hclsyntax.ParseConfig(fixed, filename, hcl.Pos{Line: 1, Column: 1})
+	diags = append(diags, parseDiags...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	var empty []*hclsyntax.Block
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type == "assert" && emptyAssert(block) {
+			empty = append(empty, block)
+		}
+	}
+	if len(empty) == 0 {
+		return fixed, diags
+	}
+	return cutBlocks(fixed, empty), diags
+}
+
+// emptyAssert tells if the assert block has no attribute or nested block other than its meta attributes
+func emptyAssert(block *hclsyntax.Block) bool {
+	if len(block.Body.Blocks) > 0 {
+		return false
+	}
+	for name := range block.Body.Attributes {
+		if !assertMetaAttributes[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// managedResourceSchema returns the schema of the resource type, or nil when no provider of schemas has it
+func managedResourceSchema(schemas *terraform.Schemas, resourceType string) *configschema.Block {
+	provider := LookupProviderSchema(schemas, strings.Split(resourceType, "_")[0])
+	if provider == nil {
+		return nil
+	}
+	schema, _ := provider.SchemaForResourceType(addrs.ManagedResourceMode, resourceType)
+	return schema
+}
+
+// computedAttributes reports the attributes of body the provider computes without letting the config set them.
+// They're usually unknown until apply, so asserting them in a plan reports unknown values rather than checking anything
+func computedAttributes(path string, body *hclsyntax.Body, schema *configschema.Block) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	var names []string
+	for name := range body.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attr, ok := schema.Attributes[name]
+		if !ok || !attr.Computed || attr.Optional || attr.Required {
+			continue
+		}
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  "Computed attribute asserted",
+			Detail:   fmt.Sprintf("%s.%s is computed by the provider and can't be set in the config : it's usually unknown until apply.", path, name),
+			Subject:  body.Attributes[name].NameRange.Ptr(),
+		})
+	}
+	for _, block := range body.Blocks {
+		if nested, ok := schema.BlockTypes[block.Type]; ok {
+			diags = append(diags, computedAttributes(path+"."+block.Type, block.Body, &nested.Block)...)
+		}
+	}
+	return diags
+}
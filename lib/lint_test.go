@@ -0,0 +1,129 @@
+package terraspec
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+func TestLintSpec(t *testing.T) {
+	schemas := testSchemas()
+	schemas.Providers[addrs.NewDefaultProvider("ressource")].ResourceTypes["ressource_type"].BlockTypes["inner"].Block.Attributes["inner_prop"].Computed = true
+
+	tests := map[string]struct {
+		spec     string
+		expected []string
+	}{
+		"No anti-pattern": {
+			spec: `
+assert "ressource_type" "name" {
+  property = "value"
+}
+mock "data_type" "name" {
+  query = 1
+  return {
+    id = 1
+  }
+}
+mock "data_type" "other" {
+  query = 2
+  return {
+    id = 2
+  }
+}
+`,
+		},
+		"Empty assert": {
+			spec: `
+assert "ressource_type" "name" {
+  message = "the resource must be planned"
+}
+`,
+			expected: []string{`lint.tfspec:2,1-31: Empty assert block; This assert block asserts nothing on ressource_type.name : assert its attributes or remove it. Fixed by terraspec lint --fix.`},
+		},
+		"Computed attribute": {
+			spec: `
+assert "ressource_type" "name" {
+  inner {
+    inner_prop = "value"
+  }
+}
+`,
+			expected: []string{`lint.tfspec:4,5-15: Computed attribute asserted; ressource_type.name.inner.inner_prop is computed by the provider and can't be set in the config : it's usually unknown until apply.`},
+		},
+		"Shadowed mock": {
+			spec: `
+mock "data_type" "name" {
+  query = 1
+  return {
+    id = 1
+  }
+}
+mock "data_type" "other" {
+  query = 1
+  return {
+    id = 2
+  }
+}
+`,
+			expected: []string{`lint.tfspec:8,1-25: Shadowed mock; The mock at line 2 matches the same data source calls and is used first, so this mock is never called.`},
+		},
+		"Deprecated mock_count": {
+			spec: `
+mock_count "ressource_type" "name" {
+  count = 2
+}
+`,
+			expected: []string{`lint.tfspec:2,1-35: Deprecated mock_count block; mock_count blocks are replaced by the mock_counts attribute of the terraspec block since version 2 of the spec language. Fixed by terraspec lint --fix.`},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			diags := LintSpec([]byte(tt.spec), "lint.tfspec", schemas)
+			if len(diags) != len(tt.expected) {
+				t.Fatalf("Expected %d diagnostics, got %v", len(tt.expected), diags)
+			}
+			for i, expected := range tt.expected {
+				if got := diags[i].Error(); got != expected {
+					t.Errorf("Expected diagnostic %s, got %s", expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFixSpec(t *testing.T) {
+	src := `assert "ressource_type" "name" {
+  property = "value"
+}
+
+assert "ressource_type" "empty" {
+}
+
+mock_count "ressource_type" "name" {
+  count = 2
+}
+`
+	expected := `terraspec_version = 2
+
+assert "ressource_type" "name" {
+  property = "value"
+}
+
+terraspec {
+  mock_counts = {
+    "ressource_type.name" = 2
+  }
+}
+`
+	fixed, diags := FixSpec([]byte(src), "lint.tfspec")
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	if string(fixed) != expected {
+		t.Errorf("Expected fixed spec\n%s\ngot\n%s", expected, fixed)
+	}
+	if diags := LintSpec(fixed, "lint.tfspec", testSchemas()); len(diags) > 0 {
+		t.Errorf("The fixed spec should have no anti-pattern, got %v", diags)
+	}
+}
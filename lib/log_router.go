@@ -0,0 +1,76 @@
+package terraspec
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/logging"
+)
+
+// terraformLogs routes the logs of the embedded terraform to the log outputs of the runs in progress.
+// Terraform logs through the standard logger, which the whole process shares, so its output is set once to terraformLogs
+// rather than changed by every run while other runs, or the program embedding terraspec, log
+var terraformLogs = &logRouter{outputs: make(map[int]io.Writer)}
+
+// logRouter writes the lines prefixed by a log level, eg [DEBUG], which terraform writes, to the outputs of the runs in progress.
+// The other lines, and all of them while no run is in progress, go to the output the standard logger had before
+type logRouter struct {
+	install sync.Once
+	mu      sync.Mutex
+	// previous is the output of the standard logger when the router was installed
+	previous io.Writer
+	outputs  map[int]io.Writer
+	next     int
+}
+
+// route writes the terraform logs to w until the returned func is called. The logs written while several runs are in progress
+// can't be told apart, so they go to the outputs of all of them
+func (r *logRouter) route(w io.Writer) func() {
+	r.install.Do(func() {
+		r.previous = log.Writer()
+		log.SetOutput(r)
+	})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.next
+	r.next++
+	r.outputs[id] = w
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.outputs, id)
+	}
+}
+
+func (r *logRouter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.outputs) == 0 || !hasLogLevel(p) {
+		return r.previous.Write(p)
+	}
+	for _, w := range r.outputs {
+		w.Write(p)
+	}
+	return len(p), nil
+}
+
+// hasLogLevel tells if the log line starts with one of the levels of terraform, after the date written by the standard logger
+func hasLogLevel(line []byte) bool {
+	start := bytes.IndexByte(line, '[')
+	if start < 0 {
+		return false
+	}
+	end := bytes.IndexByte(line[start:], ']')
+	if end < 0 {
+		return false
+	}
+	level := logging.LogLevel(line[start+1 : start+end])
+	for _, valid := range logging.ValidLevels {
+		if level == valid {
+			return true
+		}
+	}
+	return false
+}
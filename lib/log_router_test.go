@@ -0,0 +1,35 @@
+package terraspec
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogRouter(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	var previous, first, second bytes.Buffer
+	log.SetOutput(&previous)
+	router := &logRouter{outputs: make(map[int]io.Writer)}
+
+	unrouteFirst := router.route(&first)
+	unrouteSecond := router.route(&second)
+	log.Printf("[DEBUG] both runs")
+	log.Printf("not a terraform log")
+	unrouteSecond()
+	log.Printf("[WARN] first run")
+	unrouteFirst()
+	log.Printf("[INFO] no run")
+
+	if out := first.String(); !strings.Contains(out, "both runs") || !strings.Contains(out, "first run") || strings.Contains(out, "not a terraform log") {
+		t.Errorf("Unexpected logs of the first run %q", out)
+	}
+	if out := second.String(); !strings.Contains(out, "both runs") || strings.Contains(out, "first run") {
+		t.Errorf("Unexpected logs of the second run %q", out)
+	}
+	if out := previous.String(); !strings.Contains(out, "not a terraform log") || !strings.Contains(out, "no run") || strings.Contains(out, "both runs") {
+		t.Errorf("Unexpected logs of the previous output %q", out)
+	}
+}
@@ -0,0 +1,270 @@
+package lsp
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/terraform"
+	terraspec "github.com/nhurel/terraspec/lib"
+)
+
+var (
+	// headerRe matches the header of the top level blocks of a spec file labeled by a type and a name
+	headerRe      = regexp.MustCompile(`^\s*(assert|reject|mock|state|mock_count)\s+"([^"]*)"(?:\s+"([^"]*)")?`)
+	firstLabelRe  = regexp.MustCompile(`^\s*(assert|reject|mock|state|mock_count)\s+"([^"]*)$`)
+	secondLabelRe = regexp.MustCompile(`^\s*(assert|reject|mock|state|mock_count)\s+"([^"]*)"\s+"([^"]*)$`)
+	nestedBlockRe = regexp.MustCompile(`^\s*([\w-]+)\s*\{`)
+)
+
+// complete returns the completion items for the given position of a spec file
+func complete(text string, pos position, cfg *configs.Config, schemas *terraform.Schemas) []completionItem {
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return nil
+	}
+	line := lines[pos.Line]
+	if pos.Character < len(line) {
+		line = line[:pos.Character]
+	}
+
+	if m := firstLabelRe.FindStringSubmatch(line); m != nil {
+		return typeLabels(m[1], cfg)
+	}
+	if m := secondLabelRe.FindStringSubmatch(line); m != nil {
+		return nameLabels(m[1], m[2], cfg)
+	}
+
+	blocks := enclosingBlocks(lines[:pos.Line])
+	if len(blocks) == 0 {
+		return nil
+	}
+	header := headerRe.FindStringSubmatch(blocks[0])
+	if header == nil || (header[1] != "assert" && header[1] != "reject" && header[1] != "state") {
+		return nil
+	}
+	schema := resourceSchema(addrs.ManagedResourceMode, header[2], schemas)
+	for _, nested := range blocks[1:] {
+		if schema == nil {
+			return nil
+		}
+		name := nestedBlockRe.FindStringSubmatch(nested)[1]
+		if name == "reject" {
+			// reject blocks accept the attributes of the block they're in
+			continue
+		}
+		if blockType, ok := schema.BlockTypes[name]; ok {
+			schema = &blockType.Block
+		} else {
+			schema = nil
+		}
+	}
+	return schemaItems(schema, header[1] == "assert")
+}
+
+// enclosingBlocks returns the header lines of the blocks still open at the end of lines, outermost first
+func enclosingBlocks(lines []string) []string {
+	var open []string
+	for _, line := range lines {
+		inString := false
+		for i, c := range line {
+			switch {
+			case c == '"' && (i == 0 || line[i-1] != '\\'):
+				inString = !inString
+			case inString:
+			case c == '{':
+				open = append(open, line)
+			case c == '}' && len(open) > 0:
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	if len(open) > 0 && headerRe.FindStringSubmatch(open[0]) == nil {
+		return nil
+	}
+	for _, nested := range open[min(1, len(open)):] {
+		if nestedBlockRe.FindStringSubmatch(nested) == nil {
+			// the cursor is in an object or map value rather than a block
+			return nil
+		}
+	}
+	return open
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// resourceSchema returns the schema of the resource or data source type of typeLabel, eg module.db.aws_instance
+func resourceSchema(mode addrs.ResourceMode, typeLabel string, schemas *terraform.Schemas) *configschema.Block {
+	if schemas == nil {
+		return nil
+	}
+	rawType := rawType(typeLabel)
+	provider := terraspec.LookupProviderSchema(schemas, strings.Split(rawType, "_")[0])
+	if provider == nil {
+		return nil
+	}
+	schema, _ := provider.SchemaForResourceType(mode, rawType)
+	return schema
+}
+
+// schemaItems returns the attributes and nested blocks of schema as completion items
+func schemaItems(schema *configschema.Block, assert bool) []completionItem {
+	if schema == nil {
+		return nil
+	}
+	var items []completionItem
+	for name, attr := range schema.Attributes {
+		items = append(items, completionItem{Label: name, Kind: completionKindProperty, Detail: attr.Type.FriendlyName()})
+	}
+	for name := range schema.BlockTypes {
+		items = append(items, completionItem{Label: name, Kind: completionKindField, Detail: "block"})
+	}
+	if assert {
+		items = append(items, completionItem{Label: "reject", Kind: completionKindField, Detail: "block"})
+	}
+	sortItems(items)
+	return items
+}
+
+// typeLabels returns the resource types of the config usable as first label of a block
+func typeLabels(blockType string, cfg *configs.Config) []completionItem {
+	if cfg == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var items []completionItem
+	add := func(label string, kind int, detail string) {
+		if !seen[label] {
+			seen[label] = true
+			items = append(items, completionItem{Label: label, Kind: kind, Detail: detail})
+		}
+	}
+	if blockType == "assert" {
+		add("output", completionKindModule, "output value")
+		add("variable", completionKindModule, "input variable")
+	}
+	cfg.DeepEach(func(c *configs.Config) {
+		if blockType == "mock" {
+			for _, r := range c.Module.DataResources {
+				add(r.Type, completionKindClass, "data source")
+			}
+			return
+		}
+		for _, r := range c.Module.ManagedResources {
+			add(typeLabel(c.Path, r.Type), completionKindClass, "resource")
+		}
+	})
+	sortItems(items)
+	return items
+}
+
+// nameLabels returns the names of the resources, outputs or variables of the config usable as second label of a block
+func nameLabels(blockType, typeLabel string, cfg *configs.Config) []completionItem {
+	if cfg == nil {
+		return nil
+	}
+	var items []completionItem
+	if blockType == "assert" && typeLabel == "output" {
+		for name := range cfg.Module.Outputs {
+			items = append(items, completionItem{Label: name, Kind: completionKindModule, Detail: "output value"})
+		}
+	} else if blockType == "assert" && typeLabel == "variable" {
+		for name := range cfg.Module.Variables {
+			items = append(items, completionItem{Label: name, Kind: completionKindModule, Detail: "input variable"})
+		}
+	} else if blockType == "mock" {
+		cfg.DeepEach(func(c *configs.Config) {
+			for _, r := range c.Module.DataResources {
+				if r.Type == typeLabel {
+					items = append(items, completionItem{Label: r.Name, Kind: completionKindClass, Detail: "data source"})
+				}
+			}
+		})
+	} else if c := moduleOf(typeLabel, cfg); c != nil {
+		for _, r := range c.Module.ManagedResources {
+			if r.Type == rawType(typeLabel) {
+				items = append(items, completionItem{Label: r.Name, Kind: completionKindClass, Detail: "resource"})
+			}
+		}
+	}
+	sortItems(items)
+	return items
+}
+
+// definition returns the declaration, in the config, of the element asserted by the block header found in line
+func definition(line string, cfg *configs.Config) *hcl.Range {
+	m := headerRe.FindStringSubmatch(line)
+	if m == nil || m[3] == "" || cfg == nil {
+		return nil
+	}
+	blockType, typeLabel, name := m[1], m[2], m[3]
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+
+	switch {
+	case blockType == "assert" && typeLabel == "output":
+		if output, ok := cfg.Module.Outputs[name]; ok {
+			return &output.DeclRange
+		}
+	case blockType == "assert" && typeLabel == "variable":
+		if variable, ok := cfg.Module.Variables[name]; ok {
+			return &variable.DeclRange
+		}
+	case blockType == "mock":
+		var found *hcl.Range
+		cfg.DeepEach(func(c *configs.Config) {
+			if r := c.Module.ResourceByAddr(addrs.Resource{Mode: addrs.DataResourceMode, Type: typeLabel, Name: name}); r != nil && found == nil {
+				found = &r.DeclRange
+			}
+		})
+		return found
+	default:
+		if c := moduleOf(typeLabel, cfg); c != nil {
+			if r := c.Module.ResourceByAddr(addrs.Resource{Mode: addrs.ManagedResourceMode, Type: rawType(typeLabel), Name: name}); r != nil {
+				return &r.DeclRange
+			}
+		}
+	}
+	return nil
+}
+
+// typeLabel returns the first label of the blocks of a resource type declared in the module at path, eg module.db.aws_instance
+func typeLabel(path addrs.Module, resourceType string) string {
+	if path.IsRoot() {
+		return resourceType
+	}
+	return path.String() + "." + resourceType
+}
+
+// rawType returns the resource type of a type label, eg aws_instance for module.db.aws_instance
+func rawType(typeLabel string) string {
+	parts := strings.Split(typeLabel, ".")
+	return parts[len(parts)-1]
+}
+
+// moduleOf returns the module the resource type of typeLabel is declared in
+func moduleOf(typeLabel string, cfg *configs.Config) *configs.Config {
+	parts := strings.Split(typeLabel, ".")
+	var path addrs.Module
+	for i := 0; i+1 < len(parts)-1; i += 2 {
+		if parts[i] != "module" {
+			return nil
+		}
+		path = append(path, parts[i+1])
+	}
+	return cfg.Descendent(path)
+}
+
+func sortItems(items []completionItem) {
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+}
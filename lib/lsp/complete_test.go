@@ -0,0 +1,111 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/terraform"
+	terraspec "github.com/nhurel/terraspec/lib"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var schemas = &terraform.Schemas{
+	Providers: map[addrs.Provider]*terraform.ProviderSchema{
+		addrs.NewDefaultProvider("ressource"): {
+			ResourceTypes: map[string]*configschema.Block{
+				"ressource_type": {
+					Attributes: map[string]*configschema.Attribute{
+						"property": {Type: cty.String},
+					},
+					BlockTypes: map[string]*configschema.NestedBlock{
+						"inner": {
+							Block: configschema.Block{
+								Attributes: map[string]*configschema.Attribute{
+									"inner_prop": {Type: cty.Number},
+								},
+							},
+							Nesting: configschema.NestingSingle,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+func labels(items []completionItem) []string {
+	var result []string
+	for _, item := range items {
+		result = append(result, item.Label)
+	}
+	return result
+}
+
+func TestComplete(t *testing.T) {
+	cfg, diags := terraspec.LoadConfig("testdata/config")
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+
+	var tests = map[string]struct {
+		text     string
+		pos      position
+		expected []string
+	}{
+		"resource types":  {`assert "`, position{0, 8}, []string{"output", "ressource_type", "variable"}},
+		"data types":      {`mock "`, position{0, 6}, []string{"data_type"}},
+		"resource names":  {`reject "ressource_type" "`, position{0, 25}, []string{"server"}},
+		"output names":    {`assert "output" "`, position{0, 17}, []string{"name"}},
+		"variable names":  {`assert "variable" "s`, position{0, 19}, []string{"size"}},
+		"attributes":      {"assert \"ressource_type\" \"server\" {\n  \n}", position{1, 2}, []string{"inner", "property", "reject"}},
+		"nested":          {"assert \"ressource_type\" \"server\" {\n  reject {\n    inner {\n      \n", position{3, 6}, []string{"inner_prop", "reject"}},
+		"map value":       {"assert \"ressource_type\" \"server\" {\n  tags = {\n    \n", position{2, 4}, nil},
+		"outside a block": {"assert \"ressource_type\" \"server\" {\n}\n", position{2, 0}, nil},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := labels(complete(tt.text, tt.pos, cfg, schemas))
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected completions %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Expected completions %v, got %v", tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	cfg, diags := terraspec.LoadConfig("testdata/config")
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+
+	var tests = map[string]struct {
+		line     string
+		expected int
+	}{
+		"variable": {`assert "variable" "size" {`, 1},
+		"data":     {`mock "data_type" "selected" {`, 5},
+		"resource": {`assert "ressource_type" "server[0]" {`, 9},
+		"output":   {`assert "output" "name" {`, 13},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rng := definition(tt.line, cfg)
+			if rng == nil {
+				t.Fatal("Expected a definition, got none")
+			}
+			if rng.Start.Line != tt.expected {
+				t.Errorf("Expected definition at line %d, got %s", tt.expected, rng)
+			}
+		})
+	}
+
+	if rng := definition(`reject "ressource_type" "missing" {}`, cfg); rng != nil {
+		t.Errorf("Expected no definition of a resource missing from the config, got %s", rng)
+	}
+}
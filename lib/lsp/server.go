@@ -0,0 +1,227 @@
+// Package lsp implements a language server for .tfspec files, providing diagnostics, completion of
+// resource addresses and schema attributes, and go to definition into the terraform config
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/tfdiags"
+	terraspec "github.com/nhurel/terraspec/lib"
+)
+
+// Server is a language server for the spec files of the terraform config found in the root folder of the workspace
+type Server struct {
+	ctx        context.Context
+	pluginDirs []string
+	out        io.Writer
+	// docs holds the content of the opened documents, by URI
+	docs    map[string]string
+	rootDir string
+
+	loadOnce  sync.Once
+	config    *configs.Config
+	schemas   *terraform.Schemas
+	loadDiags tfdiags.Diagnostics
+}
+
+// NewServer creates a language server. Provider plugins are searched in pluginDirs too
+func NewServer(ctx context.Context, pluginDirs []string) *Server {
+	return &Server{ctx: ctx, pluginDirs: pluginDirs, docs: make(map[string]string), rootDir: "."}
+}
+
+// Serve answers the requests read from in on out, until the exit notification is received or in is closed
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.out = out
+	r := bufio.NewReader(in)
+	for {
+		msg, err := readMessage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		result, respErr := s.handle(msg)
+		if msg.ID == nil {
+			continue
+		}
+		if err := writeMessage(out, &message{ID: msg.ID, Result: result, Error: respErr}); err != nil {
+			return err
+		}
+	}
+}
+
+// handle processes a request or notification and returns the result of requests
+func (s *Server) handle(msg *message) (interface{}, *responseError) {
+	switch msg.Method {
+	case "initialize":
+		var params initializeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if params.RootURI != "" {
+			s.rootDir = uriToPath(params.RootURI)
+		}
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1,
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{"\""}},
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "terraspec"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []diagnostic{}})
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.load()
+		items := complete(s.docs[params.TextDocument.URI], params.Position, s.config, s.schemas)
+		if items == nil {
+			items = []completionItem{}
+		}
+		return items, nil
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.load()
+		lines := strings.Split(s.docs[params.TextDocument.URI], "\n")
+		if params.Position.Line >= len(lines) {
+			return nil, nil
+		}
+		if rng := definition(lines[params.Position.Line], s.config); rng != nil {
+			return location{URI: pathToURI(rng.Filename), Range: toLSPRange(rng)}, nil
+		}
+		return nil, nil
+	default:
+		if msg.ID != nil {
+			return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("Method %s is not supported", msg.Method)}
+		}
+	}
+	return nil, nil
+}
+
+// load loads the config and the provider schemas of the root folder, the first time they're needed
+func (s *Server) load() {
+	s.loadOnce.Do(func() {
+		var diags tfdiags.Diagnostics
+		s.config, diags = terraspec.LoadConfig(s.rootDir)
+		s.loadDiags = s.loadDiags.Append(diags)
+		if diags.HasErrors() {
+			s.config = nil
+			return
+		}
+		s.schemas, diags = terraspec.LoadSchemas(s.ctx, s.rootDir, s.pluginDirs)
+		s.loadDiags = s.loadDiags.Append(diags)
+	})
+}
+
+// update stores the new content of a document and publishes its diagnostics
+func (s *Server) update(uri, text string) {
+	s.docs[uri] = text
+	s.load()
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: s.diagnostics(uriToPath(uri), text)})
+}
+
+// diagnostics parses a spec file and returns its errors.
+// Only the syntax is checked when the provider schemas could not be loaded
+func (s *Server) diagnostics(filename, text string) []diagnostic {
+	result := []diagnostic{}
+	var hclDiags hcl.Diagnostics
+	if s.schemas != nil {
+		_, hclDiags = terraspec.ParseSpec([]byte(text), filename, s.schemas)
+	} else {
+		_, hclDiags = hclsyntax.ParseConfig([]byte(text), filename, hcl.Pos{Line: 1, Column: 1})
+		result = append(result, diagnostic{
+			Severity: severityWarning,
+			Source:   "terraspec",
+			Message:  fmt.Sprintf("Only the syntax is checked as the config could not be loaded : %v", s.loadDiags.Err()),
+		})
+	}
+	for _, diag := range hclDiags {
+		d := diagnostic{Severity: severityError, Source: "terraspec", Message: diag.Summary}
+		if diag.Detail != "" {
+			d.Message = fmt.Sprintf("%s : %s", diag.Summary, diag.Detail)
+		}
+		if diag.Severity == hcl.DiagWarning {
+			d.Severity = severityWarning
+		}
+		if diag.Subject != nil {
+			d.Range = toLSPRange(diag.Subject)
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	raw, _ := json.Marshal(params)
+	writeMessage(s.out, &message{Method: method, Params: raw})
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// toLSPRange converts a range of hcl, where lines and columns start at 1, into a range of the protocol, where they start at 0
+func toLSPRange(rng *hcl.Range) lspRange {
+	return lspRange{
+		Start: position{Line: rng.Start.Line - 1, Character: rng.Start.Column - 1},
+		End:   position{Line: rng.End.Line - 1, Character: rng.End.Column - 1},
+	}
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,55 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	var in bytes.Buffer
+	for _, msg := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootUri":"file:///nowhere"}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///nowhere/spec/case/case.tfspec","text":"assert \"ressource_type\" {"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/hover","params":{}}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	} {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+
+	var out bytes.Buffer
+	if err := NewServer(context.Background(), nil).Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(&out)
+	var replies []*message
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		replies = append(replies, msg)
+	}
+	if len(replies) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(replies))
+	}
+
+	var diags publishDiagnosticsParams
+	if err := json.Unmarshal(replies[1].Params, &diags); err != nil {
+		t.Fatal(err)
+	}
+	if replies[1].Method != "textDocument/publishDiagnostics" || len(diags.Diagnostics) != 2 {
+		t.Fatalf("Expected the load warning and a syntax error to be published, got %+v", diags)
+	}
+	if syntax := diags.Diagnostics[1]; syntax.Severity != severityError || syntax.Range.Start.Line != 0 {
+		t.Errorf("Expected a syntax error on the first line, got %+v", syntax)
+	}
+
+	if replies[2].Error == nil || replies[2].Error.Code != codeMethodNotFound {
+		t.Errorf("Unsupported methods should return an error, got %+v", replies[2])
+	}
+}
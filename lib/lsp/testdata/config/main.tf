@@ -0,0 +1,15 @@
+variable "size" {
+  default = 1
+}
+
+data "data_type" "selected" {
+  query = 1
+}
+
+resource "ressource_type" "server" {
+  property = "value"
+}
+
+output "name" {
+  value = ressource_type.server.property
+}
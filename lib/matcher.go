@@ -0,0 +1,118 @@
+package terraspec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Matcher is a custom assertion that can be compiled in terraspec.
+// A registered matcher is called like a function in spec files, in place of the expected value :
+//
+//	assert "aws_iam_role" "role" {
+//	  arn = account_arn("123456789012")
+//	}
+type Matcher interface {
+	// Params describes the arguments the matcher accepts in spec files
+	Params() []function.Parameter
+	// Match checks the planned value got against the arguments given in the spec file.
+	// It returns an error describing the mismatch, or nil if the value matches.
+	// The asserts of a spec, and the specs of the test cases run in parallel, are checked concurrently :
+	// Match may be called from several goroutines at once and must be safe for concurrent use
+	Match(args []cty.Value, got cty.Value) error
+}
+
+var (
+	// registryLock guards the registered matchers and functions, which share the same names
+	registryLock sync.RWMutex
+	matchers     = make(map[string]Matcher)
+)
+
+// RegisterMatcher makes a matcher available in spec files under the given function name.
+// It panics if a matcher or a function is already registered with this name, like database/sql.Register does
+func RegisterMatcher(name string, matcher Matcher) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if matcher == nil {
+		panic("terraspec: registered matcher is nil")
+	}
+	_, dupFunction := functions[name]
+	if _, dup := matchers[name]; dup || dupFunction {
+		panic("terraspec: RegisterMatcher called twice for matcher " + name)
+	}
+	matchers[name] = matcher
+}
+
+// Matchers returns the names of the registered matchers, sorted
+func Matchers() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(matchers))
+	for name := range matchers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// matcherCall is the mark of the values returned by a matcher function in spec files
+type matcherCall struct {
+	name    string
+	matcher Matcher
+	args    []cty.Value
+}
+
+func (c *matcherCall) String() string {
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		args[i] = fmt.Sprintf("%v", PrimitiveValue(arg))
+	}
+	return fmt.Sprintf("%s(%s)", c.name, strings.Join(args, ", "))
+}
+
+// check runs the matcher against the planned value
+func (c *matcherCall) check(path cty.Path, got cty.Value) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	if !got.IsKnown() {
+		return diags.Append(ErrorDiags(path, fmt.Sprintf("%s : value is unknown until apply", c)).withMismatch(MismatchMatcher, cty.NilVal, got))
+	}
+	if err := c.matcher.Match(c.args, got); err != nil {
+		return diags.Append(ErrorDiags(path, fmt.Sprintf("%s : %v", c, err)).withMismatch(MismatchMatcher, cty.NilVal, got))
+	}
+	return diags.Append(SuccessDiags(path, c))
+}
+
+// matcherCallOf returns the matcher call an expected value comes from, or nil if it's a plain value
+func matcherCallOf(val cty.Value) *matcherCall {
+	for mark := range val.Marks() {
+		if call, ok := mark.(*matcherCall); ok {
+			return call
+		}
+	}
+	return nil
+}
+
+// matcherFunctions returns the functions calling the registered matchers in spec files.
+// They return an unknown value of any type, marked with the matcher call
+func matcherFunctions() map[string]function.Function {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	funcs := make(map[string]function.Function, len(matchers))
+	for name, matcher := range matchers {
+		name, matcher := name, matcher
+		funcs[name] = function.New(&function.Spec{
+			Params: matcher.Params(),
+			Type:   function.StaticReturnType(cty.DynamicPseudoType),
+			Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+				call := &matcherCall{name: name, matcher: matcher, args: args}
+				return cty.UnknownVal(cty.DynamicPseudoType).Mark(call), nil
+			},
+		})
+	}
+	return funcs
+}
@@ -0,0 +1,65 @@
+package terraspec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/plans"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+type prefixMatcher struct{}
+
+func (prefixMatcher) Params() []function.Parameter {
+	return []function.Parameter{{Name: "prefix", Type: cty.String}}
+}
+
+func (prefixMatcher) Match(args []cty.Value, got cty.Value) error {
+	if got.Type() != cty.String || !strings.HasPrefix(got.AsString(), args[0].AsString()) {
+		return fmt.Errorf("%#v doesn't start with %q", got, args[0].AsString())
+	}
+	return nil
+}
+
+func init() {
+	RegisterMatcher("has_prefix", prefixMatcher{})
+}
+
+func TestValidateWithMatcher(t *testing.T) {
+	value := cty.ObjectVal(map[string]cty.Value{
+		"property": cty.StringVal("value"),
+		"inner":    cty.ObjectVal(map[string]cty.Value{"inner_prop": cty.StringVal("value")}),
+	})
+	rc := &plans.ResourceInstanceChange{
+		Addr:   resourceAddr("name"),
+		Change: plans.Change{Action: plans.Create, Before: cty.NullVal(value.Type()), After: value},
+	}
+	src, err := rc.Encode(value.Type())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := readSpecWithSchemas(t, "testdata/scenario_matcher.tfspec")
+	diags, err := spec.Validate(context.Background(), &plans.Plan{Changes: &plans.Changes{Resources: []*plans.ResourceInstanceChangeSrc{src}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %v", diags)
+	}
+	path := cty.GetAttrPath("ressource_type.name")
+	testDiagnostic(t, diags[0], ErrorDiags(path.GetAttr("inner").GetAttr("inner_prop"), `has_prefix(other) : cty.StringVal("value") doesn't start with "other"`))
+	testDiagnostic(t, diags[1], SuccessDiags(path.GetAttr("property"), `has_prefix(val)`))
+}
+
+func TestRegisterMatcherTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Registering a matcher twice should panic")
+		}
+	}()
+	RegisterMatcher("has_prefix", prefixMatcher{})
+}
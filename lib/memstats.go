@@ -0,0 +1,65 @@
+package terraspec
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// MemStats is the memory used when a test case completed, to tell which test cases make the memory of a long suite grow.
+// The process is shared by the test cases running at the same time, so the figures only describe a single test case
+// when they run one at a time
+type MemStats struct {
+	// PeakRSS is the highest resident set size of the terraspec process so far, in bytes.
+	// Provider plugins run in their own processes and are not part of it. It's 0 on other systems than linux
+	PeakRSS uint64
+	// Heap is the size of the objects allocated on the Go heap, in bytes
+	Heap uint64
+	// UnclosedPlugins are the provider plugins the test case started and didn't close, eg because terraform didn't stop them
+	UnclosedPlugins []string `json:",omitempty"`
+}
+
+// readMemStats returns the memory used by the process. Reading the Go heap briefly stops all goroutines
+func readMemStats() *MemStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return &MemStats{PeakRSS: readKBField("/proc/self/status", "VmHWM:"), Heap: ms.HeapAlloc}
+}
+
+// openedProviders records the providers instantiated for a test case, to tell which plugins were not closed once it completed.
+// Its zero value is ready to use and a nil openedProviders records nothing
+type openedProviders struct {
+	lock      sync.Mutex
+	providers []*ProviderInterface
+}
+
+func (o *openedProviders) add(p *ProviderInterface) {
+	if o == nil {
+		return
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.providers = append(o.providers, p)
+}
+
+// unclosed returns the names of the plugins of the providers that still hold their plugin, sorted
+func (o *openedProviders) unclosed() []string {
+	if o == nil {
+		return nil
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	seen := make(map[string]bool)
+	var names []string
+	for _, p := range o.providers {
+		p.lock.Lock()
+		started := p._plugin != nil
+		p.lock.Unlock()
+		if started && !seen[p.pluginMeta.Name] {
+			seen[p.pluginMeta.Name] = true
+			names = append(names, p.pluginMeta.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,76 @@
+package terraspec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/plugin"
+	"github.com/hashicorp/terraform/plugin/discovery"
+)
+
+func TestOpenedProviders(t *testing.T) {
+	var opened openedProviders
+	started := &ProviderInterface{pluginMeta: discovery.PluginMeta{Name: "google"}, _plugin: &plugin.GRPCProvider{}}
+	closed := &ProviderInterface{pluginMeta: discovery.PluginMeta{Name: "aws"}, _plugin: &plugin.GRPCProvider{}}
+	again := &ProviderInterface{pluginMeta: discovery.PluginMeta{Name: "google"}, _plugin: &plugin.GRPCProvider{}}
+	for _, p := range []*ProviderInterface{started, closed, again, {pluginMeta: discovery.PluginMeta{Name: "azurerm"}}} {
+		opened.add(p)
+	}
+	closed.Close()
+	if got := opened.unclosed(); !reflect.DeepEqual(got, []string{"google"}) {
+		t.Errorf("Only the started providers left open should be reported once, got %v", got)
+	}
+
+	var none *openedProviders
+	none.add(started)
+	if got := none.unclosed(); got != nil {
+		t.Errorf("A nil openedProviders should record nothing, got %v", got)
+	}
+}
+
+func TestRunSuiteMemStats(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-mem-stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"main.tf":             `output "size" { value = "size-1" }`,
+		"spec/one/one.tfspec": `reject "output" "missing" {}`,
+	})
+
+	results, err := RunSuite(context.Background(), Options{Dir: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := results.Cases[0].MemStats; m != nil || results.MemStats() != nil {
+		t.Errorf("Memory should only be reported when asked, got %+v", m)
+	}
+
+	results, err = RunSuite(context.Background(), Options{Dir: root, MemStats: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := results.Cases[0].MemStats
+	if m == nil || m.Heap == 0 || len(m.UnclosedPlugins) > 0 {
+		t.Fatalf("Memory of the test case should be reported without unclosed plugins, got %+v", m)
+	}
+	if total := results.MemStats(); total == nil || total.Heap != m.Heap || total.PeakRSS != m.PeakRSS {
+		t.Errorf("Memory of the suite should be the highest of its test cases, got %+v", total)
+	}
+}
+
+func TestResultsMemStats(t *testing.T) {
+	results := &Results{Cases: []*CaseResult{
+		{MemStats: &MemStats{PeakRSS: 200, Heap: 50, UnclosedPlugins: []string{"google"}}},
+		{Cached: true},
+		{MemStats: &MemStats{PeakRSS: 300, Heap: 40, UnclosedPlugins: []string{"aws", "google"}}},
+	}}
+	expected := &MemStats{PeakRSS: 300, Heap: 50, UnclosedPlugins: []string{"aws", "google"}}
+	if got := results.MemStats(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
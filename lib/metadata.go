@@ -0,0 +1,125 @@
+package terraspec
+
+import (
+	"sort"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ResourceTypeMetadata describes what can be asserted on a resource or data source type used in a config
+type ResourceTypeMetadata struct {
+	Type string `json:"type"`
+	// Mode is either managed or data
+	Mode string `json:"mode"`
+	// Labels are the labels of the spec blocks of every resource of this type in the config, eg module.db.aws_instance.replica
+	Labels []string `json:"labels"`
+	*BlockMetadata
+}
+
+// BlockMetadata describes the attributes and nested blocks of a resource type or block
+type BlockMetadata struct {
+	Attributes map[string]*AttributeMetadata   `json:"attributes,omitempty"`
+	Blocks     map[string]*NestedBlockMetadata `json:"blocks,omitempty"`
+}
+
+// AttributeMetadata describes an attribute of a resource type or block
+type AttributeMetadata struct {
+	// Type is serialized like in terraform providers schema -json, eg ["list","string"]
+	Type        cty.Type `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Optional    bool     `json:"optional,omitempty"`
+	Computed    bool     `json:"computed,omitempty"`
+}
+
+// NestedBlockMetadata describes a block nested in a resource type or block
+type NestedBlockMetadata struct {
+	// Nesting tells how many blocks are allowed and how they're collected, eg single, list or set
+	Nesting string `json:"nesting"`
+	*BlockMetadata
+}
+
+// SchemaMetadata returns the metadata of every resource and data source type used in cfg, sorted by mode and type.
+// Types without a schema in schemas are left out
+func SchemaMetadata(cfg *configs.Config, schemas *terraform.Schemas) []*ResourceTypeMetadata {
+	byType := make(map[addrs.Resource]*ResourceTypeMetadata)
+	cfg.DeepEach(func(c *configs.Config) {
+		for _, resources := range []map[string]*configs.Resource{c.Module.ManagedResources, c.Module.DataResources} {
+			for _, r := range resources {
+				key := addrs.Resource{Mode: r.Mode, Type: r.Type}
+				metadata, ok := byType[key]
+				if !ok {
+					provider := LookupProviderSchema(schemas, r.Provider.Type)
+					if provider == nil {
+						continue
+					}
+					schema, _ := provider.SchemaForResourceType(r.Mode, r.Type)
+					if schema == nil {
+						continue
+					}
+					metadata = &ResourceTypeMetadata{Type: r.Type, Mode: resourceModeName(r.Mode), BlockMetadata: blockMetadata(schema)}
+					byType[key] = metadata
+				}
+				metadata.Labels = append(metadata.Labels, r.Addr().Absolute(c.Path.UnkeyedInstanceShim()).String())
+			}
+		}
+	})
+
+	result := make([]*ResourceTypeMetadata, 0, len(byType))
+	for _, metadata := range byType {
+		sort.Strings(metadata.Labels)
+		result = append(result, metadata)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Mode != result[j].Mode {
+			return result[i].Mode > result[j].Mode
+		}
+		return result[i].Type < result[j].Type
+	})
+	return result
+}
+
+func resourceModeName(mode addrs.ResourceMode) string {
+	if mode == addrs.DataResourceMode {
+		return "data"
+	}
+	return "managed"
+}
+
+func blockMetadata(block *configschema.Block) *BlockMetadata {
+	metadata := &BlockMetadata{}
+	if len(block.Attributes) > 0 {
+		metadata.Attributes = make(map[string]*AttributeMetadata, len(block.Attributes))
+	}
+	for name, attr := range block.Attributes {
+		metadata.Attributes[name] = &AttributeMetadata{Type: attr.Type, Description: attr.Description, Required: attr.Required, Optional: attr.Optional, Computed: attr.Computed}
+	}
+	if len(block.BlockTypes) > 0 {
+		metadata.Blocks = make(map[string]*NestedBlockMetadata, len(block.BlockTypes))
+	}
+	for name, nested := range block.BlockTypes {
+		metadata.Blocks[name] = &NestedBlockMetadata{Nesting: nestingName(nested.Nesting), BlockMetadata: blockMetadata(&nested.Block)}
+	}
+	return metadata
+}
+
+func nestingName(nesting configschema.NestingMode) string {
+	switch nesting {
+	case configschema.NestingSingle:
+		return "single"
+	case configschema.NestingGroup:
+		return "group"
+	case configschema.NestingList:
+		return "list"
+	case configschema.NestingSet:
+		return "set"
+	case configschema.NestingMap:
+		return "map"
+	default:
+		return "invalid"
+	}
+}
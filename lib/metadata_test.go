@@ -0,0 +1,48 @@
+package terraspec
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSchemaMetadata(t *testing.T) {
+	cfg, diags := LoadConfig("testdata/expansion")
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	schemas := &terraform.Schemas{
+		Providers: map[addrs.Provider]*terraform.ProviderSchema{
+			addrs.NewDefaultProvider("ressource"): {
+				ResourceTypes: map[string]*configschema.Block{
+					"ressource_type": {
+						Attributes: map[string]*configschema.Attribute{
+							"property": {Type: cty.List(cty.String), Optional: true},
+						},
+						BlockTypes: map[string]*configschema.NestedBlock{
+							"inner": {Nesting: configschema.NestingSet},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	metadata := SchemaMetadata(cfg, schemas)
+	if len(metadata) != 1 {
+		t.Fatalf("Expected the metadata of the only resource type with a schema, got %d", len(metadata))
+	}
+
+	got, err := json.Marshal(metadata[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"type":"ressource_type","mode":"managed","labels":["ressource_type.replica"],"attributes":{"property":{"type":["list","string"],"optional":true}},"blocks":{"inner":{"nesting":"set"}}}`
+	if string(got) != expected {
+		t.Errorf("Wrong metadata. Got\n%s\nwant\n%s", got, expected)
+	}
+}
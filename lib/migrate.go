@@ -0,0 +1,160 @@
+package terraspec
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// SpecVersion is the version of the spec language read by this terraspec.
+// A spec file declares the version it's written in with a terraspec_version attribute, usually at the top of the file.
+// Files without it are read as version 1, and MigrateSpec rewrites them for the current version :
+//
+//	terraspec_version = 2
+const SpecVersion = 2
+
+const versionAttribute = "terraspec_version"
+
+// specMigrations rewrite the content of a spec file written in the version of their key to the next version
+var specMigrations = map[int]func(src []byte, filename string) ([]byte, hcl.Diagnostics){
+	1: migrateMockCounts,
+}
+
+// specVersion reads the version of the spec language declared in body.
+// It returns the rest of body, without the terraspec_version attribute
+func specVersion(body hcl.Body) (int, hcl.Body, hcl.Diagnostics) {
+	content, remain, diags := body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: versionAttribute}},
+	})
+	if diags.HasErrors() {
+		return 0, nil, diags
+	}
+	attr, ok := content.Attributes[versionAttribute]
+	if !ok {
+		return 1, remain, diags
+	}
+	var version int
+	if diags := gohcl.DecodeExpression(attr.Expr, nil, &version); diags.HasErrors() {
+		return 0, nil, diags
+	}
+	if version < 1 || version > SpecVersion {
+		return 0, nil, diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported spec version",
+			Detail:   fmt.Sprintf("This terraspec reads versions 1 to %d of the spec language, got version %d", SpecVersion, version),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+	return version, remain, diags
+}
+
+// MigrateSpec rewrites the content of a spec file written in an older version of the spec language, so it's read the same way
+// in the current SpecVersion. The content is returned unchanged when it's already written in the current version
+func MigrateSpec(src []byte, filename string) ([]byte, hcl.Diagnostics) {
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	version, _, diags := specVersion(file.Body)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if version == SpecVersion {
+		return src, diags
+	}
+
+	migrated := src
+	for v := version; v < SpecVersion; v++ {
+		var migrationDiags hcl.Diagnostics
+		migrated, migrationDiags = specMigrations[v](migrated, filename)
+		diags = diags.Extend(migrationDiags)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+	}
+
+	f, writeDiags := hclwrite.ParseConfig(migrated, filename, hcl.Pos{Line: 1, Column: 1})
+	diags = diags.Extend(writeDiags)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if f.Body().GetAttribute(versionAttribute) != nil {
+		f.Body().SetAttributeValue(versionAttribute, cty.NumberIntVal(SpecVersion))
+		return f.Bytes(), diags
+	}
+	header := fmt.Sprintf("%s = %d\n\n", versionAttribute, SpecVersion)
+	return append([]byte(header), f.Bytes()...), diags
+}
+
+// migrateMockCounts moves the counts of mock_count blocks to the mock_counts attribute of the terraspec block, introduced in version 2
+func migrateMockCounts(src []byte, filename string) ([]byte, hcl.Diagnostics) {
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	counts := make(map[string]cty.Value)
+	var mockCounts []*hclsyntax.Block
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		switch block.Type {
+		case "terraspec":
+			if attr, ok := block.Body.Attributes["mock_counts"]; ok {
+				return nil, diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Can't migrate mock_count blocks",
+					Detail:   "The terraspec block already sets mock_counts, move the counts of the mock_count blocks to it",
+					Subject:  attr.NameRange.Ptr(),
+				})
+			}
+		case "mock_count":
+			if len(block.Labels) != 2 {
+				return nil, diags.Append(&hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Invalid mock_count block", Detail: "A mock_count block must have a type and a name label", Subject: block.DefRange().Ptr()})
+			}
+			var mockCount struct {
+				Count int `hcl:"count,attr"`
+			}
+			if blockDiags := gohcl.DecodeBody(block.Body, nil, &mockCount); blockDiags.HasErrors() {
+				return nil, diags.Extend(blockDiags)
+			}
+			counts[fmt.Sprintf("%s.%s", block.Labels[0], block.Labels[1])] = cty.NumberIntVal(int64(mockCount.Count))
+			mockCounts = append(mockCounts, block)
+		}
+	}
+	if len(mockCounts) == 0 {
+		return src, diags
+	}
+
+	migrated := cutBlocks(src, mockCounts)
+
+	f, writeDiags := hclwrite.ParseConfig(migrated, filename, hcl.Pos{Line: 1, Column: 1})
+	diags = diags.Extend(writeDiags)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	terraspecBlock := f.Body().FirstMatchingBlock("terraspec", nil)
+	if terraspecBlock == nil {
+		f.Body().AppendNewline()
+		terraspecBlock = f.Body().AppendNewBlock("terraspec", nil)
+	}
+	terraspecBlock.Body().SetAttributeValue("mock_counts", cty.ObjectVal(counts))
+	return f.Bytes(), diags
+}
+
+// cutBlocks removes blocks, in the order of the source, and the blank line following them from src
+func cutBlocks(src []byte, blocks []*hclsyntax.Block) []byte {
+	// start from the end so the ranges of the first blocks remain valid
+	cut := append([]byte(nil), src...)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		rng := blocks[i].Range()
+		end := rng.End.Byte
+		for n := 0; n < 2 && end < len(cut) && cut[end] == '\n'; n++ {
+			end++
+		}
+		cut = append(cut[:rng.Start.Byte], cut[end:]...)
+	}
+	return append(bytes.TrimRight(cut, "\n"), '\n')
+}
@@ -0,0 +1,79 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrateSpec(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/migrate/v1.tfspec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("testdata/migrate/v2.tfspec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, diags := MigrateSpec(src, "v1.tfspec")
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	if string(migrated) != string(expected) {
+		t.Errorf("migrated spec not as expected. Got\n%s\nwant\n%s", migrated, expected)
+	}
+
+	again, diags := MigrateSpec(migrated, "v2.tfspec")
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	if string(again) != string(migrated) {
+		t.Errorf("spec written in the current version should be left unchanged, got\n%s", again)
+	}
+}
+
+func TestMigratedSpecIsReadTheSame(t *testing.T) {
+	v1 := readSpecWithSchemas(t, "testdata/migrate/v1.tfspec")
+	v2 := readSpecWithSchemas(t, "testdata/migrate/v2.tfspec")
+
+	if v1.Version != 1 || v2.Version != SpecVersion {
+		t.Errorf("versions should be read from the header, got %d and %d", v1.Version, v2.Version)
+	}
+	if !reflect.DeepEqual(v1.CountMocks, v2.CountMocks) {
+		t.Errorf("mocked counts should be kept, got %v and %v", v1.CountMocks, v2.CountMocks)
+	}
+	if len(v2.Asserts) != 1 {
+		t.Errorf("asserts should be kept, got %d", len(v2.Asserts))
+	}
+}
+
+func TestParsingSpecVersion(t *testing.T) {
+	var tests = map[string]struct {
+		file    string
+		summary string
+		line    int
+	}{
+		"newer version":  {"testdata/migrate/unsupported.tfspec", "Unsupported spec version", 1},
+		"removed syntax": {"testdata/migrate/mock_count_v2.tfspec", "Unsupported block type", 3},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, diags := ReadSpec(tt.file, testSchemas())
+			if !diags.HasErrors() {
+				t.Fatal("spec should be rejected")
+			}
+			desc := diags[0].Description()
+			if desc.Summary != tt.summary {
+				t.Errorf("unexpected error %s : %s", desc.Summary, desc.Detail)
+			}
+			if subject := diags[0].Source().Subject; subject == nil || subject.Start.Line != tt.line {
+				t.Errorf("error should point to line %d, got %v", tt.line, subject)
+			}
+			if tt.summary == "Unsupported block type" && !strings.Contains(desc.Detail, "terraspec migrate") {
+				t.Errorf("error should suggest migrating the spec, got %s", desc.Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package terraspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+var indexRe = regexp.MustCompile(`\[(\d+)\]`)
+
+// MismatchReason tells why an assertion failed
+type MismatchReason string
+
+const (
+	// MismatchValue means the planned value differs from the expected one
+	MismatchValue MismatchReason = "value"
+	// MismatchType means the planned value is not a collection or an object while the expected one is
+	MismatchType MismatchReason = "type"
+	// MismatchMissing means the expected element is not in the plan
+	MismatchMissing MismatchReason = "missing"
+	// MismatchRejected means the plan holds an element matching a reject assertion
+	MismatchRejected MismatchReason = "rejected"
+	// MismatchAction means the resource is not planned for the expected action, eg it will be destroyed
+	MismatchAction MismatchReason = "action"
+	// MismatchMatcher means a custom matcher rejected the planned value
+	MismatchMatcher MismatchReason = "matcher"
+	// MismatchUnexpected means the plan holds an element no assertion expects, see the strict attribute of the terraspec block
+	MismatchUnexpected MismatchReason = "unexpected"
+)
+
+// Mismatch describes a failed assertion for programmatic consumers, which don't have to parse diagnostic details
+type Mismatch struct {
+	Path   cty.Path
+	Reason MismatchReason
+	// Expected is the asserted value, or the rejected one. It's cty.NilVal when the assertion has no value, eg a matcher
+	Expected cty.Value
+	// Actual is the planned value. It's cty.NilVal when the element is missing from the plan
+	Actual cty.Value
+}
+
+// withMismatch attaches to d the structured description of the assertion failure it reports
+func (d *TerraspecDiagnostic) withMismatch(reason MismatchReason, expected, actual cty.Value) *TerraspecDiagnostic {
+	d.Mismatch = &Mismatch{Path: tfdiags.GetAttribute(d.Diagnostic), Reason: reason, Expected: expected, Actual: actual}
+	return d
+}
+
+// Mismatches returns the description of every failed assertion found in diags
+func Mismatches(diags tfdiags.Diagnostics) []*Mismatch {
+	var mismatches []*Mismatch
+	for _, diag := range diags {
+		if d, ok := diag.(*TerraspecDiagnostic); ok && d.Mismatch != nil {
+			mismatches = append(mismatches, d.Mismatch)
+		}
+	}
+	return mismatches
+}
+
+// MarshalJSON serializes the mismatch with its values in the JSON format of terraform.
+// Values that are missing or unknown are serialized as null
+func (m *Mismatch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Path     string          `json:"path"`
+		Reason   MismatchReason  `json:"reason"`
+		Expected json.RawMessage `json:"expected"`
+		Actual   json.RawMessage `json:"actual"`
+	}{FormatPath(m.Path), m.Reason, marshalMismatchValue(m.Expected), marshalMismatchValue(m.Actual)})
+}
+
+func marshalMismatchValue(val cty.Value) json.RawMessage {
+	if val == cty.NilVal || val.ContainsMarked() || !val.IsWhollyKnown() {
+		return json.RawMessage("null")
+	}
+	raw, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return raw
+}
+
+// UnmarshalJSON reads a mismatch serialized by MarshalJSON. Values get the type implied by their JSON form,
+// and the path is split on dots, so it is equivalent but not always identical to the serialized one
+func (m *Mismatch) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Path     string          `json:"path"`
+		Reason   MismatchReason  `json:"reason"`
+		Expected json.RawMessage `json:"expected"`
+		Actual   json.RawMessage `json:"actual"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	expected, err := unmarshalMismatchValue(raw.Expected)
+	if err != nil {
+		return fmt.Errorf("Invalid expected value : %v", err)
+	}
+	actual, err := unmarshalMismatchValue(raw.Actual)
+	if err != nil {
+		return fmt.Errorf("Invalid actual value : %v", err)
+	}
+	*m = Mismatch{Path: parsePath(raw.Path), Reason: raw.Reason, Expected: expected, Actual: actual}
+	return nil
+}
+
+func unmarshalMismatchValue(raw json.RawMessage) (cty.Value, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return cty.NilVal, nil
+	}
+	ty, err := ctyjson.ImpliedType(raw)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyjson.Unmarshal(raw, ty)
+}
+
+// parsePath reads a path formatted by FormatPath
+func parsePath(s string) cty.Path {
+	var path cty.Path
+	for _, part := range strings.Split(s, ".") {
+		name := part
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			name = part[:i]
+		}
+		if name != "" {
+			path = path.GetAttr(name)
+		}
+		for _, index := range indexRe.FindAllStringSubmatch(part, -1) {
+			i, _ := strconv.Atoi(index[1])
+			path = path.Index(cty.NumberIntVal(int64(i)))
+		}
+	}
+	return path
+}
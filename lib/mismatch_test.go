@@ -0,0 +1,62 @@
+package terraspec
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestCheckAssertMismatches(t *testing.T) {
+	path := cty.GetAttrPath("aws_instance.web")
+	expected := cty.ObjectVal(map[string]cty.Value{
+		"name": cty.StringVal("expected"),
+		"tags": cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		"ami":  cty.StringVal("ami-123"),
+	})
+	got := cty.ObjectVal(map[string]cty.Value{
+		"name": cty.StringVal("actual"),
+		"tags": cty.ListVal([]cty.Value{cty.StringVal("a")}),
+		"ami":  cty.StringVal("ami-123"),
+	})
+
+	mismatches := Mismatches(comparison{}.checkAssert(path, expected, got))
+	if len(mismatches) != 2 {
+		t.Fatalf("2 mismatches expected, got %d", len(mismatches))
+	}
+
+	byPath := make(map[string]*Mismatch)
+	for _, m := range mismatches {
+		byPath[FormatPath(m.Path)] = m
+	}
+	if m := byPath["aws_instance.web.name"]; m == nil || m.Reason != MismatchValue || !m.Expected.RawEquals(cty.StringVal("expected")) || !m.Actual.RawEquals(cty.StringVal("actual")) {
+		t.Errorf("Unexpected mismatch on name : %+v", m)
+	}
+	if m := byPath["aws_instance.web.tags[1]"]; m == nil || m.Reason != MismatchMissing || !m.Expected.RawEquals(cty.StringVal("b")) || m.Actual != cty.NilVal {
+		t.Errorf("Unexpected mismatch on tags : %+v", m)
+	}
+}
+
+func TestMismatchJSON(t *testing.T) {
+	m := &Mismatch{
+		Path:     cty.GetAttrPath("aws_instance").GetAttr("tags").Index(cty.NumberIntVal(1)),
+		Reason:   MismatchValue,
+		Expected: cty.ObjectVal(map[string]cty.Value{"count": cty.NumberIntVal(2)}),
+		Actual:   cty.NilVal,
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal failed : %v", err)
+	}
+	if want := `{"path":"aws_instance.tags[1]","reason":"value","expected":{"count":2},"actual":null}`; string(raw) != want {
+		t.Errorf("Unexpected JSON\nwant: %s\ngot:  %s", want, raw)
+	}
+
+	var read Mismatch
+	if err := json.Unmarshal(raw, &read); err != nil {
+		t.Fatalf("Unmarshal failed : %v", err)
+	}
+	if !read.Path.Equals(m.Path) || read.Reason != m.Reason || !read.Expected.RawEquals(m.Expected) || read.Actual != cty.NilVal {
+		t.Errorf("Unexpected mismatch read : %+v", read)
+	}
+}
@@ -0,0 +1,192 @@
+package terraspec
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans/objchange"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+var (
+	providersLock       sync.RWMutex
+	registeredProviders = make(map[addrs.Provider]providers.Factory)
+)
+
+// RegisterProvider makes test cases use the provider built by factory, in place of the plugin installed for source,
+// eg hashicorp/aws or aws. The provider doesn't have to be installed.
+// Mock blocks of spec files still apply to its data sources, and it's only asked to read the ones no mock matches.
+// It panics if source is invalid or a provider is already registered for it, like database/sql.Register does
+func RegisterProvider(source string, factory providers.Factory) {
+	provider, diags := addrs.ParseProviderSourceString(source)
+	if diags.HasErrors() {
+		panic(fmt.Sprintf("terraspec: invalid provider source %s : %v", source, diags.Err()))
+	}
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	if factory == nil {
+		panic("terraspec: registered provider factory is nil")
+	}
+	if _, dup := registeredProviders[provider]; dup {
+		panic("terraspec: RegisterProvider called twice for provider " + provider.String())
+	}
+	registeredProviders[provider] = factory
+}
+
+// registeredProviderFactories returns a copy of the registered provider factories
+func registeredProviderFactories() map[addrs.Provider]providers.Factory {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	factories := make(map[addrs.Provider]providers.Factory, len(registeredProviders))
+	for provider, factory := range registeredProviders {
+		factories[provider] = factory
+	}
+	return factories
+}
+
+// MockProvider implements a provider in go, for the cases mock blocks of spec files can't express,
+// eg computed attributes depending on the config. It's registered with RegisterProvider :
+//
+//	terraspec.RegisterProvider("acme/dns", func() (providers.Interface, error) {
+//		return &terraspec.MockProvider{ResourceTypes: schemas, PlanResourceFn: planRecord}, nil
+//	})
+type MockProvider struct {
+	// Provider is the schema of the provider configuration. Nil means the provider has no argument
+	Provider      *configschema.Block
+	ResourceTypes map[string]*configschema.Block
+	DataSources   map[string]*configschema.Block
+	// PlanResourceFn returns the planned values of a resource of the given type, from its prior state and the proposed new state
+	// merging the prior state with the config. It's not called when the resource is destroyed.
+	// When nil, computed attributes that are not set in the config are unknown
+	PlanResourceFn func(typeName string, prior, proposed cty.Value) (cty.Value, error)
+	// ReadDataSourceFn returns the values of a data source of the given type from its config.
+	// When nil, computed attributes that are not set in the config are null
+	ReadDataSourceFn func(typeName string, config cty.Value) (cty.Value, error)
+}
+
+var _ providers.Interface = (*MockProvider)(nil)
+
+// GetSchema returns the complete schema for the provider.
+func (p *MockProvider) GetSchema() providers.GetSchemaResponse {
+	resp := providers.GetSchemaResponse{
+		Provider:      providers.Schema{Block: p.Provider},
+		ResourceTypes: make(map[string]providers.Schema, len(p.ResourceTypes)),
+		DataSources:   make(map[string]providers.Schema, len(p.DataSources)),
+	}
+	if resp.Provider.Block == nil {
+		resp.Provider.Block = &configschema.Block{}
+	}
+	for name, schema := range p.ResourceTypes {
+		resp.ResourceTypes[name] = providers.Schema{Block: schema}
+	}
+	for name, schema := range p.DataSources {
+		resp.DataSources[name] = providers.Schema{Block: schema}
+	}
+	return resp
+}
+
+// PrepareProviderConfig allows the provider to validate the configuration
+// values, and set or override any values with defaults.
+func (p *MockProvider) PrepareProviderConfig(req providers.PrepareProviderConfigRequest) providers.PrepareProviderConfigResponse {
+	return providers.PrepareProviderConfigResponse{PreparedConfig: req.Config}
+}
+
+// ValidateResourceTypeConfig allows the provider to validate the resource
+// configuration values.
+func (p *MockProvider) ValidateResourceTypeConfig(req providers.ValidateResourceTypeConfigRequest) providers.ValidateResourceTypeConfigResponse {
+	return providers.ValidateResourceTypeConfigResponse{}
+}
+
+// ValidateDataSourceConfig allows the provider to validate the data source
+// configuration values.
+func (p *MockProvider) ValidateDataSourceConfig(req providers.ValidateDataSourceConfigRequest) providers.ValidateDataSourceConfigResponse {
+	return providers.ValidateDataSourceConfigResponse{}
+}
+
+// UpgradeResourceState decodes the prior state of a resource, which is always expected to match the current schema
+func (p *MockProvider) UpgradeResourceState(req providers.UpgradeResourceStateRequest) providers.UpgradeResourceStateResponse {
+	var resp providers.UpgradeResourceStateResponse
+	schema, ok := p.ResourceTypes[req.TypeName]
+	if !ok {
+		resp.Diagnostics = resp.Diagnostics.Append(fmt.Errorf("Unsupported resource type %s", req.TypeName))
+		return resp
+	}
+	state, err := ctyjson.Unmarshal(req.RawStateJSON, schema.ImpliedType())
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(fmt.Errorf("Could not read the state of %s : %v", req.TypeName, err))
+		return resp
+	}
+	resp.UpgradedState = state
+	return resp
+}
+
+// Configure configures and initialized the provider.
+func (p *MockProvider) Configure(req providers.ConfigureRequest) providers.ConfigureResponse {
+	return providers.ConfigureResponse{}
+}
+
+// Stop is called when the provider should halt any in-flight actions.
+func (p *MockProvider) Stop() error {
+	return nil
+}
+
+// ReadResource refreshes a resource and returns its current state.
+// Resources are never read so the prior state is returned unchanged
+func (p *MockProvider) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
+	return providers.ReadResourceResponse{NewState: req.PriorState, Private: req.Private}
+}
+
+// PlanResourceChange takes the current state and proposed state of a
+// resource, and returns the planned final state.
+func (p *MockProvider) PlanResourceChange(req providers.PlanResourceChangeRequest) providers.PlanResourceChangeResponse {
+	resp := providers.PlanResourceChangeResponse{PlannedState: req.ProposedNewState, PlannedPrivate: req.PriorPrivate}
+	if req.ProposedNewState.IsNull() {
+		return resp
+	}
+	if p.PlanResourceFn != nil {
+		planned, err := p.PlanResourceFn(req.TypeName, req.PriorState, req.ProposedNewState)
+		if err != nil {
+			resp.Diagnostics = resp.Diagnostics.Append(fmt.Errorf("Could not plan %s : %v", req.TypeName, err))
+		}
+		resp.PlannedState = planned
+		return resp
+	}
+	if schema, ok := p.ResourceTypes[req.TypeName]; ok {
+		resp.PlannedState = objchange.PlannedDataResourceObject(schema, req.ProposedNewState)
+	}
+	return resp
+}
+
+// ApplyResourceChange takes the planned state for a resource, which may
+// yet contain unknown computed values, and applies the changes returning
+// the final state.
+func (p *MockProvider) ApplyResourceChange(req providers.ApplyResourceChangeRequest) providers.ApplyResourceChangeResponse {
+	return providers.ApplyResourceChangeResponse{NewState: req.PlannedState}
+}
+
+// ImportResourceState requests that the given resource be imported.
+func (p *MockProvider) ImportResourceState(req providers.ImportResourceStateRequest) providers.ImportResourceStateResponse {
+	return providers.ImportResourceStateResponse{}
+}
+
+// ReadDataSource returns the data source's current state.
+func (p *MockProvider) ReadDataSource(req providers.ReadDataSourceRequest) providers.ReadDataSourceResponse {
+	resp := providers.ReadDataSourceResponse{State: req.Config}
+	if p.ReadDataSourceFn != nil {
+		state, err := p.ReadDataSourceFn(req.TypeName, req.Config)
+		if err != nil {
+			resp.Diagnostics = resp.Diagnostics.Append(fmt.Errorf("Could not read %s : %v", req.TypeName, err))
+		}
+		resp.State = state
+	}
+	return resp
+}
+
+// Close shuts down the plugin process if applicable.
+func (p *MockProvider) Close() error {
+	return nil
+}
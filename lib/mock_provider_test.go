@@ -0,0 +1,93 @@
+package terraspec
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var registerMockProvider sync.Once
+
+func TestRunSuiteWithMockProvider(t *testing.T) {
+	registerMockProvider.Do(func() {
+		RegisterProvider("mock", func() (providers.Interface, error) {
+			return &MockProvider{
+				ResourceTypes: map[string]*configschema.Block{
+					"mock_server": {
+						Attributes: map[string]*configschema.Attribute{
+							"id":    {Type: cty.String, Computed: true},
+							"name":  {Type: cty.String, Required: true},
+							"image": {Type: cty.String, Optional: true},
+							"fqdn":  {Type: cty.String, Computed: true},
+						},
+					},
+				},
+				DataSources: map[string]*configschema.Block{
+					"mock_image": {
+						Attributes: map[string]*configschema.Attribute{
+							"name": {Type: cty.String, Required: true},
+							"id":   {Type: cty.String, Computed: true},
+						},
+					},
+				},
+				PlanResourceFn: func(typeName string, prior, proposed cty.Value) (cty.Value, error) {
+					attrs := proposed.AsValueMap()
+					attrs["id"] = cty.UnknownVal(cty.String)
+					attrs["fqdn"] = cty.StringVal(attrs["name"].AsString() + ".example.com")
+					return cty.ObjectVal(attrs), nil
+				},
+				ReadDataSourceFn: func(typeName string, config cty.Value) (cty.Value, error) {
+					return cty.ObjectVal(map[string]cty.Value{
+						"name": config.GetAttr("name"),
+						"id":   cty.StringVal("img-" + config.GetAttr("name").AsString()),
+					}), nil
+				},
+			}, nil
+		})
+	})
+
+	results, err := RunSuite(context.Background(), Options{Dir: "testdata/mock_provider"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nb := len(results.Cases); nb != 1 {
+		t.Fatalf("1 test case expected, got %d", nb)
+	}
+	result := results.Cases[0]
+	if result.Failed() {
+		t.Fatalf("test case should pass, got %v", result.Diagnostics.ErrWithWarnings())
+	}
+	var passed []string
+	for _, assertion := range result.Assertions {
+		passed = append(passed, assertion.Path)
+	}
+	if got := strings.Join(passed, ","); !strings.Contains(got, "mock_server.db.image") || !strings.Contains(got, "mock_server.web.fqdn") || !strings.Contains(got, "mock_server.web.name") {
+		t.Errorf("assertions on both servers and on the plan expected, got %s", got)
+	}
+	if !strings.Contains(string(result.PlanJSON), `"resource_changes"`) {
+		t.Errorf("the JSON plan should be part of the result, got %s", result.PlanJSON)
+	}
+	if result.Coverage == nil || len(result.Coverage.Resources) != 2 {
+		t.Fatalf("coverage of both servers expected, got %+v", result.Coverage)
+	}
+	db := result.Coverage.Resources[0]
+	if db.Address != "mock_server.db" || !db.Covered || db.Attributes["name"] || !db.Attributes["image"] {
+		t.Errorf("mock_server.db should be covered except its name, got %+v", db)
+	}
+}
+
+func TestRegisterProviderTwice(t *testing.T) {
+	factory := func() (providers.Interface, error) { return &MockProvider{}, nil }
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a provider twice should panic")
+		}
+	}()
+	RegisterProvider("terraspec/twice", factory)
+	RegisterProvider("registry.terraform.io/terraspec/twice", factory)
+}
@@ -0,0 +1,267 @@
+package terraspec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/configs"
+)
+
+// moduleCacheFormat is hashed in every key, so the cache is ignored when the way modules are stored changes
+const moduleCacheFormat = 1
+
+// ModuleCache keeps the modules installed by terraform init in the .terraform/modules folder of configs,
+// so they're restored rather than downloaded again while the module calls of a config don't change.
+// Files are stored once by content, so configs calling the same modules share them,
+// and restored as read-only hard links when possible
+type ModuleCache struct {
+	// Dir is the folder holding the cached modules
+	Dir string
+}
+
+// NewModuleCache returns a ModuleCache storing modules in dir. The folder is created when the first modules are stored
+func NewModuleCache(dir string) *ModuleCache {
+	return &ModuleCache{Dir: dir}
+}
+
+// cachedModules lists the files of a .terraform/modules folder
+type cachedModules struct {
+	Files []cachedModuleFile
+}
+
+type cachedModuleFile struct {
+	// Path is relative to the .terraform/modules folder
+	Path string
+	// Object is the hash of the content of the file, or empty for a symbolic link
+	Object string `json:",omitempty"`
+	// Link is the target of a symbolic link
+	Link string `json:",omitempty"`
+	Exec bool   `json:",omitempty"`
+}
+
+// key returns the hash of the module calls of the config found in dir and of its local modules
+func (c *ModuleCache) key(dir string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "format %d\n", moduleCacheFormat)
+	if err := hashModuleCalls(h, configs.NewParser(nil), dir, ".", make(map[string]bool)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashModuleCalls writes the source and version constraint of every module call of the module found in dir, and of the local modules it calls, in h
+func hashModuleCalls(h io.Writer, parser *configs.Parser, dir, path string, seen map[string]bool) error {
+	if seen[dir] {
+		return nil
+	}
+	seen[dir] = true
+	module, diags := parser.LoadConfigDir(dir)
+	if diags.HasErrors() {
+		return diags
+	}
+	names := make([]string, 0, len(module.ModuleCalls))
+	for name := range module.ModuleCalls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		call := module.ModuleCalls[name]
+		fmt.Fprintf(h, "module %s.%s %s %s\n", path, name, call.SourceAddr, call.Version.Required)
+		if strings.HasPrefix(call.SourceAddr, "./") || strings.HasPrefix(call.SourceAddr, "../") {
+			if err := hashModuleCalls(h, parser, filepath.Join(dir, call.SourceAddr), path+"."+name, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Restore installs the cached modules of the config found in dir in its .terraform/modules folder, if this folder doesn't exist.
+// It returns true when modules were restored
+func (c *ModuleCache) Restore(dir string) (bool, error) {
+	modulesDir := filepath.Join(dir, ".terraform/modules")
+	if _, err := os.Stat(modulesDir); !os.IsNotExist(err) {
+		return false, err
+	}
+	key, err := c.key(dir)
+	if err != nil {
+		return false, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(c.Dir, "entries", key+".json"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var cached cachedModules
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return false, fmt.Errorf("Invalid cached modules %s : %v", key, err)
+	}
+
+	// modules are restored in a temporary folder, so an interrupted restore never leaves partial modules
+	if err := os.MkdirAll(filepath.Join(dir, ".terraform"), 0755); err != nil {
+		return false, err
+	}
+	tmp, err := ioutil.TempDir(filepath.Join(dir, ".terraform"), ".modules-")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return false, err
+	}
+	for _, f := range cached.Files {
+		target := filepath.Join(tmp, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return false, err
+		}
+		if f.Object == "" {
+			err = os.Symlink(f.Link, target)
+		} else {
+			err = c.restoreObject(f, target)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	if err := os.Rename(tmp, modulesDir); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// restoreObject links the stored content of f to target, or copies it when the cache is on another device
+func (c *ModuleCache) restoreObject(f cachedModuleFile, target string) error {
+	object := c.objectPath(f.Object)
+	if err := os.Link(object, target); err == nil {
+		return nil
+	}
+	src, err := os.Open(object)
+	if err != nil {
+		return fmt.Errorf("Missing cached object %s : %v", f.Object, err)
+	}
+	defer src.Close()
+	mode := os.FileMode(0644)
+	if f.Exec {
+		mode = 0755
+	}
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Save stores the modules installed in the .terraform/modules folder of the config found in dir
+func (c *ModuleCache) Save(dir string) error {
+	key, err := c.key(dir)
+	if err != nil {
+		return err
+	}
+	modulesDir := filepath.Join(dir, ".terraform/modules")
+	if _, err := os.Stat(modulesDir); os.IsNotExist(err) {
+		// terraform init installed no module
+		return nil
+	}
+	var cached cachedModules
+	err = filepath.Walk(modulesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(modulesDir, path)
+		if err != nil {
+			return err
+		}
+		f := cachedModuleFile{Path: filepath.ToSlash(rel)}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if f.Link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			f.Exec = info.Mode()&0111 != 0
+			if f.Object, err = c.storeObject(path, f.Exec); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		cached.Files = append(cached.Files, f)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Could not store the modules of %s : %v", dir, err)
+	}
+
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	return writeAtomically(filepath.Join(c.Dir, "entries", key+".json"), data, 0644)
+}
+
+// storeObject stores the content of the file found at path, unless it's already stored, and returns its hash.
+// Objects are read-only, so the hard links of restored modules can't change them
+func (c *ModuleCache) storeObject(path string, exec bool) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	// executable files are stored apart, as hard links share the mode of the object
+	if exec {
+		hash += "x"
+	}
+	object := c.objectPath(hash)
+	if _, err := os.Stat(object); err == nil {
+		return hash, nil
+	}
+	mode := os.FileMode(0444)
+	if exec {
+		mode = 0555
+	}
+	return hash, writeAtomically(object, data, mode)
+}
+
+func (c *ModuleCache) objectPath(hash string) string {
+	return filepath.Join(c.Dir, "objects", hash[:2], hash)
+}
+
+// writeAtomically writes data in file through a temporary file renamed once complete, so concurrent readers never see partial content
+func writeAtomically(file string, data []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestModuleCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-module-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	write := func(file, content string, mode os.FileMode) {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(file string) string {
+		content, err := ioutil.ReadFile(filepath.Join(root, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	for _, config := range []string{"prod", "staging"} {
+		write(config+"/main.tf", `module "network" { source = "./network" }`, 0644)
+		write(config+"/network/main.tf", "module \"vpc\" {\n  source  = \"terraform-aws-modules/vpc/aws\"\n  version = \"2.44.0\"\n}", 0644)
+		write(config+"/.terraform/modules/modules.json", `{"Modules":[]}`, 0644)
+		write(config+"/.terraform/modules/network.vpc/main.tf", "resource \"aws_vpc\" \"this\" {}", 0644)
+		write(config+"/.terraform/modules/network.vpc/scripts/run.sh", "#!/bin/sh", 0755)
+	}
+	cache := NewModuleCache(filepath.Join(root, "cache"))
+	for _, config := range []string{"prod", "staging"} {
+		if err := cache.Save(filepath.Join(root, config)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	objects, err := filepath.Glob(filepath.Join(root, "cache/objects/*/*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 3 {
+		t.Errorf("Expected the files of both configs to be stored once, got %d objects", len(objects))
+	}
+
+	prod := filepath.Join(root, "prod")
+	if restored, err := cache.Restore(prod); err != nil || restored {
+		t.Errorf("Expected installed modules not to be restored, got %t and error %v", restored, err)
+	}
+	if err := os.RemoveAll(filepath.Join(prod, ".terraform")); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := cache.Restore(prod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored {
+		t.Fatal("Expected the modules to be restored")
+	}
+	if content := read("prod/.terraform/modules/network.vpc/main.tf"); content != "resource \"aws_vpc\" \"this\" {}" {
+		t.Errorf("Unexpected restored content %q", content)
+	}
+	info, err := os.Stat(filepath.Join(prod, ".terraform/modules/network.vpc/scripts/run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&0111 == 0 {
+		t.Errorf("Expected the restored script to be executable, got mode %v", info.Mode())
+	}
+
+	// a new version of the module must be downloaded
+	write("prod/network/main.tf", "module \"vpc\" {\n  source  = \"terraform-aws-modules/vpc/aws\"\n  version = \"2.45.0\"\n}", 0644)
+	if err := os.RemoveAll(filepath.Join(prod, ".terraform")); err != nil {
+		t.Fatal(err)
+	}
+	if restored, err := cache.Restore(prod); err != nil || restored {
+		t.Errorf("Expected no modules restored for changed module calls, got %t and error %v", restored, err)
+	}
+}
@@ -0,0 +1,67 @@
+package terraspec
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// MovedAssertType is the type of the assert blocks checking the address moves planned by the moved blocks of terraform 1.1 onwards,
+// eg assert "moved" "aws_instance.new" { from = "aws_instance.old" }. The name of the block is the address the resource moves to
+const MovedAssertType = "moved"
+
+// movedSchema is the schema of the body of the moved assert blocks. from is the address the resource moves from,
+// any move to the address of the block passes when it's not set
+var movedSchema = &configschema.Block{
+	Attributes: map[string]*configschema.Attribute{
+		"from": {Type: cty.String, Optional: true},
+	},
+}
+
+// readPlannedMoves records the previous address of the resources the plan moves, from the previous_address of its resource changes
+// in the JSON format of terraform show -json. The plan is only read when the spec has moved asserts
+func (s *Spec) readPlannedMoves(planJSON []byte) error {
+	if !s.hasAssertOfType(MovedAssertType) {
+		return nil
+	}
+	s.moves = make(map[string]string)
+	err := eachResourceChange(planJSON, func(rc *jsonResourceChange) error {
+		if rc.PreviousAddress != "" && rc.PreviousAddress != rc.Address {
+			s.moves[rc.Address] = rc.PreviousAddress
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Could not read the moves of the plan : %v", err)
+	}
+	return nil
+}
+
+// hasAssertOfType tells if the spec has an assert block of the given type
+func (s *Spec) hasAssertOfType(assertType string) bool {
+	for _, assert := range s.Asserts {
+		if assert.Type == assertType {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMove checks that the plan moves a resource to the address named by assert, from the asserted address when it's set.
+// Plans computed by the embedded terraform never move resources, as it doesn't support moved blocks
+func (s *Spec) checkMove(assert *Assert) *TerraspecDiagnostic {
+	path := cty.GetAttrPath(MovedAssertType).GetAttr(assert.Name)
+	expected := cty.NullVal(cty.String)
+	if !assert.Value.IsNull() {
+		expected = assert.Value.GetAttr("from")
+	}
+	from, ok := s.moves[assert.Name]
+	if !ok {
+		return ErrorDiags(path, "No move planned to this address").withMismatch(MismatchMissing, expected, cty.NilVal)
+	}
+	if !expected.IsNull() && expected.AsString() != from {
+		return AssertErrorDiags(path.GetAttr("from"), expected.AsString(), from).withMismatch(MismatchValue, expected, cty.StringVal(from))
+	}
+	return SuccessDiags(path.GetAttr("from"), from)
+}
@@ -0,0 +1,190 @@
+package terraspec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// DefaultProjectFile is the name of the project config read from the folder of the terraform config
+const DefaultProjectFile = ".terraspec.hcl"
+
+// DefaultNotifyTemplate is the text/template of the message sent by notify blocks without a template
+const DefaultNotifyTemplate = `terraspec : {{.Failed}} of {{.Run}} test cases failed in {{.Duration}}{{range .FailedCases}}
+- {{.}}{{end}}`
+
+// notifyTimeout bounds the time a webhook takes to answer, so a notification never hangs the run
+const notifyTimeout = 10 * time.Second
+
+// ProjectConfig holds the settings of the project config file, shared by every run of the test suite :
+//
+//	notify "slack" {
+//	  url      = env("SLACK_WEBHOOK_URL")
+//	  template = "{{.Failed}} test cases failed"
+//	}
+type ProjectConfig struct {
+	// Notifiers are the webhooks the summary of a run is posted to
+	Notifiers []*Notifier
+}
+
+// Notifier posts the summary of a run to a webhook, eg a Slack or Teams incoming webhook, as a JSON object with a text attribute
+type Notifier struct {
+	Name string
+	URL  string
+	// Template is the text/template of the message, executed with a RunSummary. Defaults to DefaultNotifyTemplate
+	Template string
+	// Always notifies every run rather than only the failed ones
+	Always bool
+}
+
+// RunSummary is the outcome of a run given to the templates of the notifiers
+type RunSummary struct {
+	// Run is the number of test cases run, without the skipped ones
+	Run     int
+	Passed  int
+	Failed  int
+	Skipped int
+	// Duration is the duration of the run, rounded to the second
+	Duration time.Duration
+	// FailedCases are the names of the failed test cases, sorted
+	FailedCases []string
+}
+
+// NewRunSummary summarizes the results of a run
+func NewRunSummary(results *Results) *RunSummary {
+	passed, failed := results.Count()
+	summary := &RunSummary{Run: passed + failed, Passed: passed, Failed: failed, Skipped: results.SkippedCount(), Duration: results.Duration.Round(time.Second)}
+	for _, c := range results.Cases {
+		if c.SkipReason == "" && c.Failed() {
+			summary.FailedCases = append(summary.FailedCases, c.Name)
+		}
+	}
+	sort.Strings(summary.FailedCases)
+	return summary
+}
+
+// ReadProjectConfig reads the project config file. The env function of its expressions reads environment variables,
+// so secrets like webhook URLs are not written in the file
+func ReadProjectConfig(file string) (*ProjectConfig, hcl.Diagnostics) {
+	f, diags := hclparse.NewParser().ParseHCLFile(file)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	var project struct {
+		Notify []struct {
+			Name     string `hcl:"name,label"`
+			URL      string `hcl:"url"`
+			Template string `hcl:"template,optional"`
+			On       string `hcl:"on,optional"`
+		} `hcl:"notify,block"`
+	}
+	ctx := &hcl.EvalContext{Functions: map[string]function.Function{"env": envFunction}}
+	if diags := gohcl.DecodeBody(f.Body, ctx, &project); diags.HasErrors() {
+		return nil, diags
+	}
+
+	config := &ProjectConfig{}
+	ranges := blockRanges(f.Body, "notify", "name")
+	for i, notify := range project.Notify {
+		n := &Notifier{Name: notify.Name, URL: notify.URL, Template: notify.Template}
+		switch notify.On {
+		case "", "failure":
+		case "always":
+			n.Always = true
+		default:
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid on",
+				Detail:   fmt.Sprintf("The notify block %s is sent on failure or always, got %q", notify.Name, notify.On),
+				Subject:  &ranges[i],
+			})
+			continue
+		}
+		if n.Template == "" {
+			n.Template = DefaultNotifyTemplate
+		}
+		if _, err := template.New(n.Name).Parse(n.Template); err != nil {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid template",
+				Detail:   fmt.Sprintf("The template of the notify block %s can't be parsed : %v", notify.Name, err),
+				Subject:  &ranges[i],
+			})
+			continue
+		}
+		config.Notifiers = append(config.Notifiers, n)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return config, diags
+}
+
+// envFunction returns the value of an environment variable, or an empty string when it's not set
+var envFunction = function.New(&function.Spec{
+	Params: []function.Parameter{{Name: "name", Type: cty.String}},
+	Type:   function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(os.Getenv(args[0].AsString())), nil
+	},
+})
+
+// Notify posts the summary of the results to the webhook, unless the run passed and the notifier only reports failures.
+// Test cases failing as expected don't fail the run
+func (n *Notifier) Notify(ctx context.Context, results *Results) error {
+	if !n.Always && !results.Failed() {
+		return nil
+	}
+	var text bytes.Buffer
+	tmpl, err := template.New(n.Name).Parse(n.Template)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(&text, NewRunSummary(results)); err != nil {
+		return fmt.Errorf("Could not render the message of %s : %v", n.Name, err)
+	}
+	body, err := json.Marshal(map[string]string{"text": text.String()})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Could not notify %s : %v", n.Name, webhookError(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Could not notify %s : %v", n.Name, webhookError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		answer, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Could not notify %s : the webhook answered %s %s", n.Name, resp.Status, answer)
+	}
+	return nil
+}
+
+// webhookError returns err without the URL of the webhook, which usually holds its secret token
+func webhookError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
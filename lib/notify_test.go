@@ -0,0 +1,135 @@
+package terraspec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+func TestReadProjectConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("TERRASPEC_TEST_WEBHOOK", "https://hooks.example.com/abc")
+	defer os.Unsetenv("TERRASPEC_TEST_WEBHOOK")
+
+	tests := map[string]struct {
+		config   string
+		expected []*Notifier
+		err      string
+	}{
+		"Notifiers": {
+			config: `
+notify "slack" {
+  url = env("TERRASPEC_TEST_WEBHOOK")
+}
+notify "teams" {
+  url      = "https://teams.example.com"
+  template = "{{.Failed}} failed"
+  on       = "always"
+}
+`,
+			expected: []*Notifier{
+				{Name: "slack", URL: "https://hooks.example.com/abc", Template: DefaultNotifyTemplate},
+				{Name: "teams", URL: "https://teams.example.com", Template: "{{.Failed}} failed", Always: true},
+			},
+		},
+		"Invalid on":       {config: "notify \"slack\" {\n  url = \"u\"\n  on = \"success\"\n}\n", err: "Invalid on"},
+		"Invalid template": {config: "notify \"slack\" {\n  url = \"u\"\n  template = \"{{.Failed\"\n}\n", err: "Invalid template"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(dir, DefaultProjectFile)
+			if err := ioutil.WriteFile(file, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config, diags := ReadProjectConfig(file)
+			if tt.err != "" {
+				if !diags.HasErrors() || diags[0].Summary != tt.err {
+					t.Errorf("Expected a %q error, got %v", tt.err, diags)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+			if len(config.Notifiers) != len(tt.expected) {
+				t.Fatalf("Expected %d notifiers, got %d", len(tt.expected), len(config.Notifiers))
+			}
+			for i, expected := range tt.expected {
+				if *config.Notifiers[i] != *expected {
+					t.Errorf("Expected notifier %+v, got %+v", expected, config.Notifiers[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Text string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		received = append(received, body.Text)
+	}))
+	defer server.Close()
+
+	failed := &Results{Duration: 90 * time.Second, Cases: []*CaseResult{
+		{Name: "web", Diagnostics: tfdiags.Diagnostics{}.Append(errors.New("Could not compute the plan"))},
+		{Name: "db"},
+		{Name: "parked", SkipReason: "waiting for a fix"},
+	}}
+	passed := &Results{Cases: []*CaseResult{{Name: "db"}}}
+
+	notifier := &Notifier{Name: "slack", URL: server.URL, Template: DefaultNotifyTemplate}
+	for _, results := range []*Results{failed, passed} {
+		if err := notifier.Notify(context.Background(), results); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expected := "terraspec : 1 of 2 test cases failed in 1m30s\n- web"; len(received) != 1 || received[0] != expected {
+		t.Errorf("Only the failed run should be notified with %q, got %q", expected, received)
+	}
+
+	always := &Notifier{Name: "teams", URL: server.URL, Template: "{{.Passed}} passed", Always: true}
+	if err := always.Notify(context.Background(), passed); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[1] != "1 passed" {
+		t.Errorf("Every run should be notified, got %q", received)
+	}
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer broken.Close()
+	notifier.URL = broken.URL
+	if err := notifier.Notify(context.Background(), failed); err == nil || !strings.Contains(err.Error(), "403 Forbidden invalid_token") {
+		t.Errorf("The answer of the webhook should be reported, got %v", err)
+	}
+
+	// webhook URLs hold their secret token, they must not be printed
+	notifier.URL = broken.URL + "/hooks/secret-token"
+	broken.Close()
+	if err := notifier.Notify(context.Background(), failed); err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("The webhook URL should not be reported, got %v", err)
+	}
+	notifier.URL = "https://hooks.example.com/secret-token\x7f"
+	if err := notifier.Notify(context.Background(), failed); err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("An invalid webhook URL should not be reported, got %v", err)
+	}
+}
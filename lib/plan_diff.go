@@ -0,0 +1,181 @@
+package terraspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform/plans"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// PlanDiff is the structural difference between two plans, eg the plans of the same config with two variable sets
+type PlanDiff struct {
+	// Added are the addresses of the resources only planned in the second plan
+	Added []string
+	// Removed are the addresses of the resources only planned in the first plan
+	Removed []string
+	// Changed are the resources planned in both plans with a different action or different values
+	Changed []*ResourceDiff
+}
+
+// Empty tells whether both plans plan the same changes
+func (d *PlanDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// ResourceDiff is a resource planned differently by two plans
+type ResourceDiff struct {
+	Address string
+	// ActionA is the action planned for the resource in the first plan and ActionB the one in the second, eg Create or Update
+	ActionA, ActionB string
+	// Attributes are the attributes planned with different values. They're not compared when the resource is deleted by either plan
+	Attributes []*AttributeDiff
+}
+
+// AttributeDiff is an attribute planned with different values by two plans
+type AttributeDiff struct {
+	Path cty.Path
+	// A is the value planned in the first plan and B the one in the second.
+	// They're cty.NilVal when the attribute is not set by the plan, and unknown when the value is only known after apply
+	A, B cty.Value
+}
+
+// MarshalJSON writes the path like diagnostics show it and the values as JSON. Values that are not set or unknown are written as null
+func (d *AttributeDiff) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Path string
+		A, B json.RawMessage
+	}{FormatPath(d.Path), marshalMismatchValue(d.A), marshalMismatchValue(d.B)})
+}
+
+// DiffPlans compares the resource changes of two plans in the JSON format of terraform show -json.
+// Resources are matched by address, and their planned values are compared attribute by attribute
+func DiffPlans(a, b []byte) (*PlanDiff, error) {
+	changesA, err := readResourceChanges(a)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read first plan : %v", err)
+	}
+	changesB, err := readResourceChanges(b)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read second plan : %v", err)
+	}
+
+	diff := &PlanDiff{}
+	for addr, changeA := range changesA {
+		changeB, ok := changesB[addr]
+		if !ok {
+			diff.Removed = append(diff.Removed, addr)
+			continue
+		}
+		rd := &ResourceDiff{Address: addr, ActionA: changeA.action.String(), ActionB: changeB.action.String()}
+		if changeA.action != plans.Delete && changeB.action != plans.Delete {
+			rd.Attributes = diffValues(nil, changeA.after, changeB.after)
+		}
+		if rd.ActionA != rd.ActionB || len(rd.Attributes) > 0 {
+			diff.Changed = append(diff.Changed, rd)
+		}
+	}
+	for addr := range changesB {
+		if _, ok := changesA[addr]; !ok {
+			diff.Added = append(diff.Added, addr)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Address < diff.Changed[j].Address })
+	return diff, nil
+}
+
+// plannedResource is the planned action and values of a resource read from a JSON plan
+type plannedResource struct {
+	action plans.Action
+	after  cty.Value
+}
+
+// readResourceChanges reads the resource changes of a JSON plan, by resource address
+func readResourceChanges(planJSON []byte) (map[string]plannedResource, error) {
+	changes := make(map[string]plannedResource)
+	err := eachResourceChange(planJSON, func(rc *jsonResourceChange) error {
+		action, err := jsonAction(rc.Change.Actions)
+		if err != nil {
+			return fmt.Errorf("Invalid change of %s : %v", rc.Address, err)
+		}
+		after, err := decodeJSONChangeValue(rc.Change.After, rc.Change.AfterUnknown, cty.DynamicPseudoType)
+		if err != nil {
+			return fmt.Errorf("Could not read planned values of %s : %v", rc.Address, err)
+		}
+		changes[rc.Address] = plannedResource{action: action, after: after}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// diffValues returns the paths under path where a and b differ. Objects and tuples are compared element by element,
+// other values as a whole
+func diffValues(path cty.Path, a, b cty.Value) []*AttributeDiff {
+	differ := []*AttributeDiff{{Path: path.Copy(), A: a, B: b}}
+	switch {
+	case a == cty.NilVal || b == cty.NilVal:
+		return differ
+	case !a.IsKnown() || !b.IsKnown():
+		if a.IsKnown() != b.IsKnown() {
+			return differ
+		}
+		return nil
+	case a.IsNull() || b.IsNull():
+		if a.IsNull() != b.IsNull() {
+			return differ
+		}
+		return nil
+	}
+
+	tyA, tyB := a.Type(), b.Type()
+	switch {
+	case tyA.IsObjectType() && tyB.IsObjectType():
+		names := make(map[string]bool)
+		for name := range tyA.AttributeTypes() {
+			names[name] = true
+		}
+		for name := range tyB.AttributeTypes() {
+			names[name] = true
+		}
+		sorted := make([]string, 0, len(names))
+		for name := range names {
+			sorted = append(sorted, name)
+		}
+		sort.Strings(sorted)
+		var diffs []*AttributeDiff
+		for _, name := range sorted {
+			attrA, attrB := cty.NilVal, cty.NilVal
+			if tyA.HasAttribute(name) {
+				attrA = a.GetAttr(name)
+			}
+			if tyB.HasAttribute(name) {
+				attrB = b.GetAttr(name)
+			}
+			// attributes left out by one plan and null in the other are not set by either
+			if (attrA == cty.NilVal && attrB.IsNull()) || (attrB == cty.NilVal && attrA.IsNull()) {
+				continue
+			}
+			diffs = append(diffs, diffValues(path.GetAttr(name), attrA, attrB)...)
+		}
+		return diffs
+	case tyA.IsTupleType() && tyB.IsTupleType() && a.LengthInt() == b.LengthInt():
+		var diffs []*AttributeDiff
+		for i := 0; i < a.LengthInt(); i++ {
+			key := cty.NumberIntVal(int64(i))
+			diffs = append(diffs, diffValues(path.Index(key), a.Index(key), b.Index(key))...)
+		}
+		return diffs
+	case !tyA.Equals(tyB):
+		return differ
+	case a.Equals(b).True():
+		return nil
+	}
+	return differ
+}
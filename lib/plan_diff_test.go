@@ -0,0 +1,92 @@
+package terraspec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func readDiffPlans(t *testing.T) *PlanDiff {
+	staging, err := ioutil.ReadFile("testdata/diff_plans/staging.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod, err := ioutil.ReadFile("testdata/diff_plans/prod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := DiffPlans(staging, prod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return diff
+}
+
+func TestDiffPlans(t *testing.T) {
+	diff := readDiffPlans(t)
+
+	if expected := []string{"ressource_type.replica[0]"}; !reflect.DeepEqual(diff.Added, expected) {
+		t.Errorf("added resources should be %v, got %v", expected, diff.Added)
+	}
+	if expected := []string{"ressource_type.debug"}; !reflect.DeepEqual(diff.Removed, expected) {
+		t.Errorf("removed resources should be %v, got %v", expected, diff.Removed)
+	}
+	if len(diff.Changed) != 2 {
+		t.Fatalf("expected 2 changed resources, got %d", len(diff.Changed))
+	}
+
+	legacy := diff.Changed[0]
+	if legacy.Address != "ressource_type.legacy" || legacy.ActionA != "NoOp" || legacy.ActionB != "Delete" || len(legacy.Attributes) != 0 {
+		t.Errorf("deleted resource should only differ by action, got %+v", legacy)
+	}
+
+	web := diff.Changed[1]
+	if web.Address != "ressource_type.web" || web.ActionA != web.ActionB {
+		t.Errorf("ressource_type.web should be changed with the same action, got %+v", web)
+	}
+	var tests = []struct {
+		path string
+		a, b cty.Value
+	}{
+		{"property", cty.StringVal("small"), cty.StringVal("large")},
+		{"tags.env", cty.StringVal("staging"), cty.StringVal("prod")},
+		{"zones", cty.TupleVal([]cty.Value{cty.StringVal("a")}), cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")})},
+	}
+	if len(web.Attributes) != len(tests) {
+		t.Fatalf("expected %d changed attributes, got %d", len(tests), len(web.Attributes))
+	}
+	for i, tt := range tests {
+		got := web.Attributes[i]
+		if FormatPath(got.Path) != tt.path || !got.A.RawEquals(tt.a) || !got.B.RawEquals(tt.b) {
+			t.Errorf("attribute %d should be %s changed from %#v to %#v, got %s from %#v to %#v", i, tt.path, tt.a, tt.b, FormatPath(got.Path), got.A, got.B)
+		}
+	}
+}
+
+func TestDiffPlansIdentical(t *testing.T) {
+	prod, err := ioutil.ReadFile("testdata/diff_plans/prod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := DiffPlans(prod, prod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Empty() {
+		t.Errorf("a plan should not differ from itself, got %+v", diff)
+	}
+}
+
+func TestAttributeDiffJSON(t *testing.T) {
+	d := &AttributeDiff{Path: cty.GetAttrPath("tags").GetAttr("env"), A: cty.StringVal("staging"), B: cty.NilVal}
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"Path":"tags.env","A":"staging","B":null}`; string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
@@ -0,0 +1,89 @@
+package terraspec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/plans/planfile"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// ReadPlanFile reads a plan computed by terraform, either saved by terraform plan -out or in the JSON format of terraform show -json,
+// and returns it with its JSON representation. The config and the provider schemas of tfCtx decode the planned values.
+// Binary plans must have been saved by the terraform version embedded in terraspec, while JSON plans can come from any version
+func ReadPlanFile(filename string, tfCtx *terraform.Context) (*plans.Plan, []byte, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		plan, err := PlanFromJSON(content, tfCtx.Schemas())
+		if err != nil {
+			return nil, nil, fmt.Errorf("Could not read plan file %s : %v", filename, err)
+		}
+		return plan, content, nil
+	}
+
+	reader, err := planfile.Open(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not open plan file %s : %v", filename, err)
+	}
+	defer reader.Close()
+	plan, err := reader.ReadPlan()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not read plan file %s : %v", filename, err)
+	}
+	state := states.NewState()
+	if prior, err := reader.ReadStateFile(); err == nil {
+		state = prior.State
+	}
+	planJSON, err := MarshalPlan(tfCtx, plan, state)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not convert plan file %s to JSON : %v", filename, err)
+	}
+	return plan, planJSON, nil
+}
+
+// checkPlanFile checks the assertions of spec against the plan saved in planFile rather than computing the plan.
+// Mocks and the prior state of the spec are not used, and the validations of the variables are not checked
+func checkPlanFile(ctx context.Context, tfCtx *terraform.Context, spec *Spec, planFile string, display planDisplay) (caseOutput, tfdiags.Diagnostics) {
+	var out caseOutput
+	var diags tfdiags.Diagnostics
+
+	planStart := time.Now()
+	plan, planJSON, err := ReadPlanFile(planFile, tfCtx)
+	out.timings.Plan = time.Since(planStart)
+	if err != nil {
+		return out, diags.Append(err)
+	}
+	if display == displayAll {
+		out.rendered = renderPlan(tfCtx, plan)
+	}
+	out.json = planJSON
+
+	validateStart := time.Now()
+	diags = diags.Append(validatePlan(ctx, spec, plan, planJSON, nil))
+	out.timings.Validate = time.Since(validateStart)
+	if display == displayFailed && diags.HasErrors() {
+		out.rendered = renderPlan(tfCtx, plan)
+	}
+	return out, diags
+}
+
+// planFile returns the path of the plan file the test case is checked against, empty when its plan is computed
+func (s *Spec) planFile(tc *TestCase, tsCtx *Context) string {
+	if s.Terraspec.PlanFile != "" {
+		return s.Terraspec.PlanFile
+	}
+	if tsCtx.PlanFile != "" {
+		return filepath.Join(tc.Dir, tsCtx.PlanFile)
+	}
+	return ""
+}
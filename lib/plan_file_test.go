@@ -0,0 +1,69 @@
+package terraspec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSuiteWithPlanFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-plan-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	planJSON := `{"format_version":"0.1","output_changes":{"size":{"actions":["create"],"before":null,"after":["size-%s"],"after_unknown":false}}}`
+	files := map[string]string{
+		"main.tf": `
+variable "size" {
+  type = number
+}
+// output assertions compare the first element of the planned output
+output "size" {
+  value = ["size-${var.size}"]
+}`,
+		"spec/stage/case.tfspec":    "assert \"output\" \"size\" {\n  value = \"size-7\"\n}",
+		"spec/stage/case.tfvars":    `size = 2`,
+		"spec/stage/tfplan":         strings.Replace(planJSON, "%s", "7", 1),
+		"spec/override/case.tfspec": "terraspec {\n  plan_file = \"../other.json\"\n}\nassert \"output\" \"size\" {\n  value = \"size-9\"\n}",
+		"spec/override/case.tfvars": `size = 2`,
+		"spec/other.json":           strings.Replace(planJSON, "%s", "9", 1),
+		"spec/missing/case.tfspec":  "assert \"output\" \"size\" {\n  value = \"size-2\"\n}",
+		"spec/missing/case.tfvars":  `size = 2`,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := RunSuite(context.Background(), Options{Dir: root, PlanFile: "tfplan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Cases) != 3 {
+		t.Fatalf("Expected 3 test cases, got %d", len(results.Cases))
+	}
+	for _, r := range results.Cases {
+		switch r.Name {
+		case "missing":
+			if !r.Failed() || !strings.Contains(r.Diagnostics.Err().Error(), "tfplan") {
+				t.Errorf("Test case missing should fail as it has no plan file, got %v", r.Diagnostics.Err())
+			}
+		default:
+			if r.Failed() || len(r.Assertions) != 1 {
+				t.Errorf("Test case %s should be checked against its plan file, got %v", r.Name, r.Diagnostics.Err())
+			}
+			if r.Timings.Refresh != 0 {
+				t.Errorf("Test case %s should not refresh, got %+v", r.Name, r.Timings)
+			}
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package terraspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// PlanFromJSON reads a plan in the JSON format of terraform show -json, so that a Spec can be validated
+// against a plan computed by another tool. The provider schemas give the type of the planned resources.
+// Provider aliases are not part of the JSON format, so resources are always planned by the default provider configuration
+func PlanFromJSON(planJSON []byte, schemas *terraform.Schemas) (*plans.Plan, error) {
+	var plan jsonPlan
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return nil, fmt.Errorf("Could not read plan : %v", err)
+	}
+
+	changes := plans.NewChanges()
+	for _, rc := range plan.ResourceChanges {
+		addr, diags := addrs.ParseAbsResourceInstanceStr(rc.Address)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("Invalid resource address %s : %v", rc.Address, diags.Err())
+		}
+		provider := addrs.NewDefaultProvider(strings.Split(rc.Type, "_")[0])
+		if rc.ProviderName != "" {
+			if provider, diags = addrs.ParseProviderSourceString(rc.ProviderName); diags.HasErrors() {
+				return nil, fmt.Errorf("Invalid provider of %s : %v", rc.Address, diags.Err())
+			}
+		}
+		providerSchema := schemas.ProviderSchema(provider)
+		if providerSchema == nil {
+			providerSchema = LookupProviderSchema(schemas, provider.Type)
+		}
+		if providerSchema == nil {
+			return nil, fmt.Errorf("No schema found for provider %s of %s", provider, rc.Address)
+		}
+		schema, _ := providerSchema.SchemaForResourceAddr(addr.Resource.Resource)
+		if schema == nil {
+			return nil, fmt.Errorf("No schema found for resource type %s", rc.Type)
+		}
+
+		action, err := jsonAction(rc.Change.Actions)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid change of %s : %v", rc.Address, err)
+		}
+		ty := schema.ImpliedType()
+		before, err := decodeJSONChangeValue(rc.Change.Before, nil, ty)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read prior values of %s : %v", rc.Address, err)
+		}
+		after, err := decodeJSONChangeValue(rc.Change.After, rc.Change.AfterUnknown, ty)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read planned values of %s : %v", rc.Address, err)
+		}
+		change := &plans.ResourceInstanceChange{
+			Addr:         addr,
+			ProviderAddr: addrs.AbsProviderConfig{Module: addr.Module.Module(), Provider: provider},
+			Change:       plans.Change{Action: action, Before: before, After: after},
+		}
+		changeSrc, err := change.Encode(ty)
+		if err != nil {
+			return nil, fmt.Errorf("Could not encode change of %s : %v", rc.Address, err)
+		}
+		changes.Resources = append(changes.Resources, changeSrc)
+	}
+
+	for name, oc := range plan.OutputChanges {
+		action, err := jsonAction(oc.Actions)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid change of output %s : %v", name, err)
+		}
+		before, err := decodeJSONChangeValue(oc.Before, nil, cty.DynamicPseudoType)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read prior value of output %s : %v", name, err)
+		}
+		after, err := decodeJSONChangeValue(oc.After, oc.AfterUnknown, cty.DynamicPseudoType)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read planned value of output %s : %v", name, err)
+		}
+		change := &plans.OutputChange{
+			Addr:   addrs.OutputValue{Name: name}.Absolute(addrs.RootModuleInstance),
+			Change: plans.Change{Action: action, Before: before, After: after},
+		}
+		changeSrc, err := change.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("Could not encode change of output %s : %v", name, err)
+		}
+		changes.Outputs = append(changes.Outputs, changeSrc)
+	}
+
+	return &plans.Plan{Changes: changes}, nil
+}
+
+// jsonAction returns the action described by the list of actions of a change in the JSON plan format
+func jsonAction(actions []string) (plans.Action, error) {
+	switch strings.Join(actions, ",") {
+	case "no-op":
+		return plans.NoOp, nil
+	case "create":
+		return plans.Create, nil
+	case "read":
+		return plans.Read, nil
+	case "update":
+		return plans.Update, nil
+	case "delete":
+		return plans.Delete, nil
+	case "delete,create":
+		return plans.DeleteThenCreate, nil
+	case "create,delete":
+		return plans.CreateThenDelete, nil
+	}
+	return plans.NoOp, fmt.Errorf("Unsupported actions %v", actions)
+}
+
+// decodeJSONChangeValue decodes a value of a change in the JSON plan format into a value of type ty.
+// The attributes flagged as true in unknown, which mirrors the structure of the value, are unknown.
+// When ty is cty.DynamicPseudoType, the type is implied by the JSON value
+func decodeJSONChangeValue(raw, unknown json.RawMessage, ty cty.Type) (cty.Value, error) {
+	var unknowns interface{}
+	if len(unknown) > 0 {
+		if err := json.Unmarshal(unknown, &unknowns); err != nil {
+			return cty.NilVal, err
+		}
+	}
+	if unknowns == true {
+		return cty.UnknownVal(ty), nil
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return cty.NullVal(ty), nil
+	}
+
+	var val cty.Value
+	var err error
+	if ty == cty.DynamicPseudoType {
+		val, err = decodeJSONValue(raw)
+	} else {
+		val, err = ctyjson.Unmarshal(raw, ty)
+	}
+	if err != nil || unknowns == nil {
+		return val, err
+	}
+	return cty.Transform(val, func(path cty.Path, v cty.Value) (cty.Value, error) {
+		if unknownAt(unknowns, path) {
+			return cty.UnknownVal(v.Type()), nil
+		}
+		return v, nil
+	})
+}
+
+// unknownAt tells if the element at path is flagged as unknown in the after_unknown structure of a JSON plan
+func unknownAt(unknowns interface{}, path cty.Path) bool {
+	for _, step := range path {
+		switch s := step.(type) {
+		case cty.GetAttrStep:
+			m, ok := unknowns.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			unknowns = m[s.Name]
+		case cty.IndexStep:
+			switch u := unknowns.(type) {
+			case map[string]interface{}:
+				if s.Key.Type() != cty.String {
+					return false
+				}
+				unknowns = u[s.Key.AsString()]
+			case []interface{}:
+				if s.Key.Type() != cty.Number {
+					return false
+				}
+				i, _ := s.Key.AsBigFloat().Int64()
+				if i < 0 || int(i) >= len(u) {
+					return false
+				}
+				unknowns = u[i]
+			default:
+				return false
+			}
+		}
+	}
+	return len(path) > 0 && unknowns == true
+}
+
+// PlanVariable is the name of the variable holding the plan in spec expressions, in the JSON format of terraform show -json,
+// eg plan.resource_changes
+const PlanVariable = "plan"
+
+// BindPlan sets the plan variable of the spec expressions to the given JSON plan,
+// and decodes again the assertions referencing it. Until then, such assertions hold unknown values
+func (s *Spec) BindPlan(planJSON []byte) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	if s.evalCtx == nil {
+		return diags
+	}
+	var asserts []*Assert
+	for _, assert := range s.Asserts {
+		if assert.Config != nil && referencesPlan(assert.Config) {
+			asserts = append(asserts, assert)
+		}
+	}
+	if len(asserts) == 0 {
+		return diags
+	}
+
+	plan, err := decodeJSONValue(planJSON)
+	if err != nil {
+		return diags.Append(fmt.Errorf("Could not read the JSON plan : %v", err))
+	}
+	ctx := &hcl.EvalContext{Variables: make(map[string]cty.Value, len(s.evalCtx.Variables)), Functions: s.evalCtx.Functions}
+	for name, val := range s.evalCtx.Variables {
+		ctx.Variables[name] = val
+	}
+	ctx.Variables[PlanVariable] = plan
+	for _, assert := range asserts {
+		val, hclDiags := decodeBody(assert.Config, assert.Type, s.schemas, ctx)
+		diags = diags.Append(hclDiags)
+		if !hclDiags.HasErrors() {
+			assert.Value = val
+		}
+	}
+	return diags
+}
+
+// referencesPlan tells if an expression of body, or of its nested blocks, references the plan variable
+func referencesPlan(body hcl.Body) bool {
+	syntaxBody, ok := body.(*hclsyntax.Body)
+	if !ok {
+		return false
+	}
+	found := false
+	hclsyntax.VisitAll(syntaxBody, func(node hclsyntax.Node) hcl.Diagnostics {
+		if expr, ok := node.(*hclsyntax.ScopeTraversalExpr); ok && expr.Traversal.RootName() == PlanVariable {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
@@ -0,0 +1,96 @@
+package terraspec
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestPlanFromJSON(t *testing.T) {
+	planJSON, err := ioutil.ReadFile("testdata/plan_json/plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas := testSchemas()
+	plan, err := PlanFromJSON(planJSON, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nb := len(plan.Changes.Resources); nb != 3 {
+		t.Fatalf("3 resource changes expected, got %d", nb)
+	}
+	computed := findResource("module.db.ressource_type.computed[0]", plan.Changes.Resources)
+	if computed == nil {
+		t.Fatal("module.db.ressource_type.computed[0] not found")
+	}
+	if computed.ProviderAddr.Provider != addrs.NewDefaultProvider("ressource") {
+		t.Errorf("Unexpected provider %s", computed.ProviderAddr.Provider)
+	}
+	schema, _ := schemas.ResourceTypeConfig(addrs.NewDefaultProvider("ressource"), addrs.ManagedResourceMode, "ressource_type")
+	after, err := computed.After.Decode(schema.ImpliedType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.GetAttr("property").IsKnown() {
+		t.Errorf("property should be unknown, got %v", after.GetAttr("property"))
+	}
+	if removed := findResource("ressource_type.removed", plan.Changes.Resources); removed == nil || removed.Action != plans.Delete {
+		t.Errorf("ressource_type.removed should be deleted, got %v", removed)
+	}
+
+	spec, diags := ReadSpec("testdata/plan_json/scenario.tfspec", schemas)
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	diags, err = spec.Validate(context.Background(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatches := Mismatches(diags)
+	if len(mismatches) != 1 {
+		t.Fatalf("1 mismatch expected, got %d : %v", len(mismatches), diags.ErrWithWarnings())
+	}
+	if path := FormatPath(mismatches[0].Path); path != "ressource_type.name.inner.inner_prop" {
+		t.Errorf("Unexpected mismatch on %s", path)
+	}
+	if !mismatches[0].Actual.RawEquals(cty.StringVal("wrong")) {
+		t.Errorf("Unexpected actual value %v", mismatches[0].Actual)
+	}
+}
+
+func TestBindPlan(t *testing.T) {
+	spec, diags := ParseSpec([]byte(`
+assert "ressource_type" "name" {
+  property = [for rc in plan.resource_changes : rc.change.after.property if rc.name == "removed"][0]
+}
+
+assert "ressource_type" "other" {
+  property = "static"
+}
+`), "plan.tfspec", testSchemas())
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	if spec.Asserts[0].Value.GetAttr("property").IsKnown() {
+		t.Errorf("property should be unknown until the plan is bound")
+	}
+
+	planJSON := []byte(`{"resource_changes": [
+		{"name": "name", "change": {"after": {"property": "created"}}},
+		{"name": "removed", "change": {"after": {"property": "deleted"}}}
+	]}`)
+	if diags := spec.BindPlan(planJSON); diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	if got := spec.Asserts[0].Value.GetAttr("property"); !got.RawEquals(cty.StringVal("deleted")) {
+		t.Errorf("property should be read from the plan, got %#v", got)
+	}
+	if got := spec.Asserts[1].Value.GetAttr("property"); !got.RawEquals(cty.StringVal("static")) {
+		t.Errorf("asserts not referencing the plan should be left unchanged, got %#v", got)
+	}
+}
@@ -0,0 +1,90 @@
+package terraspec
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// Planning modes a test case can choose with the plan_mode attribute of the terraspec block
+const (
+	// PlanModeNormal plans the changes required to reach the configuration
+	PlanModeNormal = "normal"
+	// PlanModeDestroy plans the destruction of all the resources in state, like terraform plan -destroy
+	PlanModeDestroy = "destroy"
+	// PlanModeRefreshOnly only refreshes the prior state, like terraform plan -refresh-only
+	PlanModeRefreshOnly = "refresh-only"
+)
+
+var planModes = map[string]bool{
+	PlanModeNormal:      true,
+	PlanModeDestroy:     true,
+	PlanModeRefreshOnly: true,
+}
+
+// RefreshOnlyPlan builds the plan of a refresh-only run from the refreshed state :
+// every resource instance and root output of the state is reported as left unchanged with its refreshed value.
+// The terraform version embedded in terraspec can't plan in refresh-only mode so the plan is built here
+func RefreshOnlyPlan(state *states.State, schemas *terraform.Schemas) (*plans.Plan, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	changes := plans.NewChanges()
+	if state == nil {
+		return &plans.Plan{Changes: changes}, diags
+	}
+
+	for _, module := range state.Modules {
+		for _, resource := range module.Resources {
+			if resource.Addr.Resource.Mode != addrs.ManagedResourceMode {
+				continue
+			}
+			schema, _ := schemas.ResourceTypeConfig(resource.ProviderConfig.Provider, resource.Addr.Resource.Mode, resource.Addr.Resource.Type)
+			if schema == nil {
+				diags = diags.Append(fmt.Errorf("No schema found for resource %s", resource.Addr))
+				continue
+			}
+			ty := schema.ImpliedType()
+			for key, instance := range resource.Instances {
+				if instance.Current == nil {
+					continue
+				}
+				addr := resource.Addr.Instance(key)
+				obj, err := instance.Current.Decode(ty)
+				if err != nil {
+					diags = diags.Append(fmt.Errorf("Could not decode state of resource %s : %v", addr, err))
+					continue
+				}
+				change := &plans.ResourceInstanceChange{
+					Addr:         addr,
+					ProviderAddr: resource.ProviderConfig,
+					Change:       plans.Change{Action: plans.NoOp, Before: obj.Value, After: obj.Value},
+				}
+				src, err := change.Encode(ty)
+				if err != nil {
+					diags = diags.Append(fmt.Errorf("Could not encode state of resource %s : %v", addr, err))
+					continue
+				}
+				changes.Resources = append(changes.Resources, src)
+			}
+		}
+	}
+
+	for _, output := range state.RootModule().OutputValues {
+		change := &plans.OutputChange{
+			Addr:      output.Addr,
+			Sensitive: output.Sensitive,
+			Change:    plans.Change{Action: plans.NoOp, Before: output.Value, After: output.Value},
+		}
+		src, err := change.Encode()
+		if err != nil {
+			diags = diags.Append(fmt.Errorf("Could not encode output %s : %v", output.Addr, err))
+			continue
+		}
+		changes.Outputs = append(changes.Outputs, src)
+	}
+
+	return &plans.Plan{Changes: changes}, diags
+}
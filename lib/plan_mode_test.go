@@ -0,0 +1,119 @@
+package terraspec
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var planModeSchema = &configschema.Block{
+	Attributes: map[string]*configschema.Attribute{
+		"property": {Type: cty.String},
+	},
+}
+
+func resourceAddr(name string) addrs.AbsResourceInstance {
+	return addrs.Resource{Mode: addrs.ManagedResourceMode, Type: "ressource_type", Name: name}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance)
+}
+
+func TestRefreshOnlyPlan(t *testing.T) {
+	provider := addrs.AbsProviderConfig{Module: addrs.RootModule, Provider: addrs.NewDefaultProvider("ressource")}
+	schemas := &terraform.Schemas{
+		Providers: map[addrs.Provider]*terraform.ProviderSchema{
+			provider.Provider: {ResourceTypes: map[string]*configschema.Block{"ressource_type": planModeSchema}},
+		},
+	}
+
+	state := states.BuildState(func(s *states.SyncState) {
+		s.SetResourceInstanceCurrent(resourceAddr("name"), &states.ResourceInstanceObjectSrc{
+			Status:    states.ObjectReady,
+			AttrsJSON: []byte(`{"property":"refreshed"}`),
+		}, provider)
+		s.SetOutputValue(addrs.OutputValue{Name: "out"}.Absolute(addrs.RootModuleInstance), cty.StringVal("output"), false)
+	})
+
+	plan, diags := RefreshOnlyPlan(state, schemas)
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+
+	if nb := len(plan.Changes.Resources); nb != 1 {
+		t.Fatalf("plan should have 1 resource change, got %d", nb)
+	}
+	resource := plan.Changes.Resources[0]
+	if resource.Action != plans.NoOp {
+		t.Errorf("refreshed resource action should be NoOp, got %s", resource.Action)
+	}
+	after, err := resource.After.Decode(planModeSchema.ImpliedType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := after.GetAttr("property"); !got.RawEquals(cty.StringVal("refreshed")) {
+		t.Errorf("refreshed resource property should be refreshed, got %#v", got)
+	}
+
+	if nb := len(plan.Changes.Outputs); nb != 1 {
+		t.Fatalf("plan should have 1 output change, got %d", nb)
+	}
+	if got := plan.Changes.Outputs[0].Addr.String(); got != "output.out" {
+		t.Errorf("output address should be output.out, got %s", got)
+	}
+}
+
+func TestValidateDestroyMode(t *testing.T) {
+	value := cty.ObjectVal(map[string]cty.Value{
+		"property": cty.StringVal("value"),
+		"inner":    cty.NullVal(cty.Object(map[string]cty.Type{"inner_prop": cty.String})),
+	})
+	ty := value.Type()
+	change := func(name string, action plans.Action, before cty.Value) *plans.ResourceInstanceChangeSrc {
+		rc := &plans.ResourceInstanceChange{
+			Addr:   resourceAddr(name),
+			Change: plans.Change{Action: action, Before: before, After: cty.NullVal(ty)},
+		}
+		src, err := rc.Encode(ty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return src
+	}
+
+	spec := readSpecWithSchemas(t, "testdata/scenario_destroy.tfspec")
+	plan := &plans.Plan{Changes: &plans.Changes{Resources: []*plans.ResourceInstanceChangeSrc{
+		change("name", plans.Delete, value),
+	}}}
+	diags, err := spec.Validate(context.Background(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diags.HasErrors() {
+		t.Errorf("destroyed resource should match assertions, got %v", diags.Err())
+	}
+
+	plan.Changes.Resources = append(plan.Changes.Resources, change("kept", plans.Delete, value))
+	diags, err = spec.Validate(context.Background(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diags.HasErrors() {
+		t.Errorf("destroying a rejected resource should fail")
+	}
+
+	// every assertion is located at the header of its block
+	lines := map[string]int{"ressource_type.name.property": 5, "ressource_type.kept": 9}
+	for _, diag := range diags {
+		d := diag.(*TerraspecDiagnostic)
+		path := FormatPath(tfdiags.GetAttribute(d.Diagnostic))
+		subject := d.Source().Subject
+		if subject == nil || subject.Filename != "testdata/scenario_destroy.tfspec" || subject.Start.Line != lines[path] {
+			t.Errorf("%s should be located at line %d of the spec, got %+v", path, lines[path], subject)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package terraspec
+
+import (
+	"io"
+	"sync"
+
+	"github.com/hashicorp/terraform/plugin"
+	"github.com/hashicorp/terraform/plugin/discovery"
+)
+
+// pluginPool shares the provider plugin processes between the test cases of a run, one process per plugin executable.
+// Providers are never configured by terraspec, so a single process can serve the concurrent requests of all the test cases
+// like it serves the concurrent requests of a single plan. Its zero value is ready to use
+type pluginPool struct {
+	lock    sync.Mutex
+	plugins map[string]*pooledPlugin
+}
+
+type pooledPlugin struct {
+	lock     sync.Mutex
+	provider *plugin.GRPCProvider
+}
+
+// get returns the process of the given plugin, starting it if it's not running yet or if it exited
+func (p *pluginPool) get(meta discovery.PluginMeta, logOutput io.Writer) (*plugin.GRPCProvider, error) {
+	p.lock.Lock()
+	if p.plugins == nil {
+		p.plugins = make(map[string]*pooledPlugin)
+	}
+	pooled, ok := p.plugins[meta.Path]
+	if !ok {
+		pooled = &pooledPlugin{}
+		p.plugins[meta.Path] = pooled
+	}
+	p.lock.Unlock()
+
+	// only the first test case needing the plugin starts it, the others wait for it
+	pooled.lock.Lock()
+	defer pooled.lock.Unlock()
+	if pooled.provider != nil && !pooled.provider.PluginClient.Exited() {
+		return pooled.provider, nil
+	}
+	provider, err := startPlugin(meta, logOutput)
+	if err != nil {
+		return nil, err
+	}
+	pooled.provider = provider
+	return provider, nil
+}
+
+// close kills all the plugin processes of the pool
+func (p *pluginPool) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, pooled := range p.plugins {
+		pooled.lock.Lock()
+		if pooled.provider != nil {
+			pooled.provider.PluginClient.Kill()
+			pooled.provider = nil
+		}
+		pooled.lock.Unlock()
+	}
+}
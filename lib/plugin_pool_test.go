@@ -0,0 +1,24 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/hashicorp/terraform/plugin/discovery"
+)
+
+func TestPluginPoolStartFailure(t *testing.T) {
+	var pool pluginPool
+	meta := discovery.PluginMeta{Name: "missing", Path: "testdata/terraform-provider-missing"}
+
+	for i := 0; i < 2; i++ {
+		// a failed start is tried again by the next test case
+		if _, err := pool.get(meta, ioutil.Discard); err == nil {
+			t.Fatal("starting a missing plugin should fail")
+		}
+	}
+	if pooled := pool.plugins[meta.Path]; pooled == nil || pooled.provider != nil {
+		t.Errorf("no process should be pooled for a plugin that failed to start, got %+v", pooled)
+	}
+	pool.close()
+}
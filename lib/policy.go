@@ -0,0 +1,103 @@
+package terraspec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/command/jsonplan"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/states/statefile"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/open-policy-agent/opa/loader"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// PolicyRule is the name of the rego rules evaluated against the plan. Each value of the rule is reported as a violation
+const PolicyRule = "deny"
+
+// MarshalPlan returns the plan in the JSON format of terraform show -json
+func MarshalPlan(tfCtx *terraform.Context, plan *plans.Plan, state *states.State) ([]byte, error) {
+	return jsonplan.Marshal(tfCtx.Config(), plan, statefile.New(state, "", 0), tfCtx.Schemas())
+}
+
+// CheckPolicies evaluates the deny rules of the rego policies found in paths against the JSON plan.
+// Every package defining deny rules is reported as an assertion
+func CheckPolicies(ctx context.Context, paths []string, planJSON []byte) (tfdiags.Diagnostics, error) {
+	var diags tfdiags.Diagnostics
+
+	loaded, err := loader.AllRegos(paths)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load policies : %v", err)
+	}
+
+	var input interface{}
+	if err := json.Unmarshal(planJSON, &input); err != nil {
+		return nil, fmt.Errorf("Could not read JSON plan : %v", err)
+	}
+
+	modules := loaded.ParsedModules()
+	packages := make(map[string]bool)
+	options := make([]func(*rego.Rego), 0, len(modules)+2)
+	for _, module := range modules {
+		options = append(options, rego.ParsedModule(module))
+		for _, rule := range module.Rules {
+			if rule.Head.Name.String() == PolicyRule {
+				packages[module.Package.Path.String()] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(packages))
+	for pkg := range packages {
+		names = append(names, pkg)
+	}
+	sort.Strings(names)
+
+	for _, pkg := range names {
+		query := fmt.Sprintf("%s.%s", pkg, PolicyRule)
+		r := rego.New(append(options, rego.Query(query), rego.Input(input))...)
+		results, err := r.Eval(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Could not evaluate policy %s : %v", query, err)
+		}
+
+		path := cty.GetAttrPath("policy").GetAttr(strings.TrimPrefix(query, "data."))
+		violations := policyViolations(results)
+		for _, violation := range violations {
+			diags = diags.Append(ErrorDiags(path, violation))
+		}
+		if len(violations) == 0 {
+			diags = diags.Append(SuccessDiags(path, "No violation"))
+		}
+	}
+	return diags, nil
+}
+
+// policyViolations returns the values of a deny rule, either a set of messages or a boolean
+func policyViolations(results rego.ResultSet) []string {
+	var violations []string
+	for _, result := range results {
+		for _, expression := range result.Expressions {
+			switch value := expression.Value.(type) {
+			case []interface{}:
+				for _, v := range value {
+					violations = append(violations, fmt.Sprintf("%v", v))
+				}
+			case bool:
+				if value {
+					violations = append(violations, "Plan is denied")
+				}
+			default:
+				violations = append(violations, fmt.Sprintf("%v", value))
+			}
+		}
+	}
+	sort.Strings(violations)
+	return violations
+}
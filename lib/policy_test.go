@@ -0,0 +1,27 @@
+package terraspec
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestCheckPolicies(t *testing.T) {
+	planJSON := []byte(`{
+		"resource_changes": [
+			{"address": "aws_instance.tagged", "change": {"actions": ["create"], "after": {"tags": {"owner": "me"}}}},
+			{"address": "aws_instance.untagged", "change": {"actions": ["create"], "after": {"tags": {}}}}
+		]
+	}`)
+
+	diags, err := CheckPolicies(context.Background(), []string{"testdata/policies"}, planJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nb := len(diags); nb != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d : %v", nb, diags)
+	}
+	testDiagnostic(t, diags[0], SuccessDiags(cty.GetAttrPath("policy").GetAttr("terraform.actions.deny"), "No violation"))
+	testDiagnostic(t, diags[1], ErrorDiags(cty.GetAttrPath("policy").GetAttr("terraform.tags.deny"), "aws_instance.untagged has no owner tag"))
+}
@@ -2,16 +2,19 @@ package terraspec
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/facebookgo/symwalk"
 	"github.com/hashicorp/go-hclog"
+	goversion "github.com/hashicorp/go-version"
 	goplugin "github.com/hashicorp/go-plugin"
 	svchost "github.com/hashicorp/terraform-svchost"
 	"github.com/hashicorp/terraform/addrs"
@@ -19,6 +22,7 @@ import (
 	"github.com/hashicorp/terraform/plugin"
 	"github.com/hashicorp/terraform/plugin/discovery"
 	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
 	"github.com/mitchellh/go-homedir"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -27,6 +31,20 @@ import (
 type ProviderResolver struct {
 	KnownPlugins     map[addrs.Provider]discovery.PluginMeta
 	DataSourceReader *MockDataSourceReader
+	// LogOutput receives the logs of the provider plugins. Nil means stderr
+	LogOutput io.Writer
+	// SchemaCache keeps the schemas of the plugins between runs. Nil means schemas are always requested from the plugins
+	SchemaCache *SchemaCache
+	// plugins shares the plugin processes between test cases. Nil means every provider instance starts its own process
+	plugins *pluginPool
+	// opened records the providers instantiated from the installed plugins, when set
+	opened *openedProviders
+	// candidates holds all the versions found for each provider
+	candidates map[addrs.Provider][]discovery.PluginMeta
+	// searched are the folders where plugins were searched, with their os_arch subfolders, by order of precedence
+	searched []string
+	// Diagnostics warns about the plugins skipped because their path could not be parsed
+	Diagnostics tfdiags.Diagnostics
 }
 
 // MockDataSourceReader can mock a call to ReadDataSource and return appropriate mocked data
@@ -43,19 +61,25 @@ func (m *MockDataSourceReader) SetMock(mocks []*Mock) {
 
 // ReadDataSource returns a mock response for the datasource call
 func (m *MockDataSourceReader) ReadDataSource(config cty.Value) cty.Value {
-	var mockedResult cty.Value = config
-	for _, mock := range m.mockDataSources {
-		if mock.Query.RawEquals(config) {
-			mockedResult = mock.Call()
-			return mockedResult
-		}
+	if mockedResult, ok := m.lookup(config); ok {
+		return mockedResult
 	}
 
 	m.mux.Lock()
 	m.unmatchedCalls = append(m.unmatchedCalls, config)
 	m.mux.Unlock()
 
-	return mockedResult
+	return config
+}
+
+// lookup returns the result of the mock matching the datasource call, if any
+func (m *MockDataSourceReader) lookup(config cty.Value) (cty.Value, bool) {
+	for _, mock := range m.mockDataSources {
+		if mock.Query.RawEquals(config) {
+			return mock.Call(), true
+		}
+	}
+	return cty.NilVal, false
 }
 
 // UnmatchedCalls returns the list of all data source calls that were not mocked
@@ -84,19 +108,10 @@ func GetPluginFolder() (string, error) {
 }
 
 // parseProviderValues retrives the values for hostname, namespace and provider name from the path.
-func parseProviderValues(provMeta discovery.PluginMeta) (*addrs.Provider, error) {
-	parts := strings.Split(filepath.ToSlash(provMeta.Path), "/")
-
-	partCount := len(parts)
-
-	// overall the path does not have to be that long for tf12
-	if partCount < 3 {
-		return nil, fmt.Errorf("No valid provider path: %s", provMeta.Path)
-	}
-
-	if parts[partCount-3] == "plugins" {
-		// plugins folder was initialized by terraform <=0.12
-
+// Plugins of a flat plugin folder, as initialized by terraform <=0.12, are default providers.
+// Other plugins must follow the terraform 0.13 layout, an error is returned when the path can't be parsed
+func parseProviderValues(provMeta discovery.PluginMeta, flat bool) (*addrs.Provider, error) {
+	if flat {
 		// HACK: A default provider contains the default registry host and hashicorp namespace
 		// because we are using terraform 12 semantics without required spec in the terraform block
 		// this is exactly what terraform 13 searches for
@@ -104,12 +119,14 @@ func parseProviderValues(provMeta discovery.PluginMeta) (*addrs.Provider, error)
 		return &provider, nil
 	}
 
-	// for tf13 the path has to have a much longer length
-	if partCount < 6 {
-		return nil, fmt.Errorf("No valid provider path for tf13: %s", provMeta.Path)
+	parts := strings.Split(filepath.ToSlash(provMeta.Path), "/")
+	partCount := len(parts)
+
+	// terraform 0.13 layout is <hostname>/<namespace>/<type>/<version>/<os_arch>/<binary>
+	if partCount < 6 || parts[partCount-4] != provMeta.Name || parts[partCount-3] != string(provMeta.Version) {
+		return nil, fmt.Errorf("The plugin %s is neither in a plugin folder nor in a <hostname>/<namespace>/<type>/<version>/<os_arch> subfolder", provMeta.Path)
 	}
-	
-	// this is for terraform 0.13 onwards
+
 	return &addrs.Provider{
 		Hostname:  svchost.Hostname(parts[partCount-6]),
 		Namespace: parts[partCount-5],
@@ -117,11 +134,17 @@ func parseProviderValues(provMeta discovery.PluginMeta) (*addrs.Provider, error)
 	}, nil
 }
 
+// PluginCacheDirEnvVar is the environment variable terraform reads to find the plugin cache directory
+const PluginCacheDirEnvVar = "TF_PLUGIN_CACHE_DIR"
+
 // BuildProviderResolver returns a ProviderResolver able to find all providers
-// provided by plugins
-func BuildProviderResolver(dir string) (*ProviderResolver, error) {
+// provided by plugins.
+// Plugins installed in the project dir take precedence over the ones found in pluginDirs,
+// which take precedence over the ones in the plugin cache dir set with TF_PLUGIN_CACHE_DIR
+func BuildProviderResolver(dir string, pluginDirs ...string) (*ProviderResolver, error) {
 
 	pluginsSchema := make(map[addrs.Provider]discovery.PluginMeta)
+	candidates := make(map[addrs.Provider][]discovery.PluginMeta)
 
 	// find plugins in project dir
 	projectPluginDir := path.Join(dir, ".terraform/plugins/")
@@ -130,15 +153,10 @@ func BuildProviderResolver(dir string) (*ProviderResolver, error) {
 	_, err := os.Stat(path.Join(projectPluginDir, osArch))
 	isTf13 := os.IsNotExist(err)
 
-	pluginFolders := make([]string, 0)
-	// terraform init creates symlinks under linux
-	symwalk.Walk(projectPluginDir, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() && info.Name() == osArch {
-			pluginFolders = append(pluginFolders, path)
-		}
-
-		return nil
-	})
+	pluginFolders := findArchFolders(projectPluginDir, osArch)
+	searched := []string{projectPluginDir}
+	// plugins found directly in the searched folders or in their os_arch subfolder use the flat layout of terraform <=0.12
+	flatFolders := []string{projectPluginDir, filepath.Join(projectPluginDir, osArch)}
 
 	if !isTf13 {
 		// for terraform 12 add the global plugin folder
@@ -149,24 +167,169 @@ func BuildProviderResolver(dir string) (*ProviderResolver, error) {
 		}
 
 		pluginFolders = append(pluginFolders, pluginFolder, path.Join(pluginFolder, osArch))
+		searched = append(searched, pluginFolder)
+		flatFolders = append(flatFolders, pluginFolder, filepath.Join(pluginFolder, osArch))
 	}
 
-	projectPluginMetaSet := discovery.FindPlugins(plugin.ProviderPluginName, pluginFolders)
-	for k := range projectPluginMetaSet {
-		provider, err := parseProviderValues(k)
+	// every group of folders only provides plugins not found in the previous groups
+	folderGroups := [][]string{pluginFolders}
+	for _, pluginDir := range pluginDirs {
+		folderGroups = append(folderGroups, append([]string{pluginDir}, findArchFolders(pluginDir, osArch)...))
+		searched = append(searched, pluginDir)
+		flatFolders = append(flatFolders, pluginDir, filepath.Join(pluginDir, osArch))
+	}
+	if cacheDir := os.Getenv(PluginCacheDirEnvVar); cacheDir != "" {
+		folderGroups = append(folderGroups, append([]string{cacheDir}, findArchFolders(cacheDir, osArch)...))
+		searched = append(searched, fmt.Sprintf("%s (%s)", cacheDir, PluginCacheDirEnvVar))
+		flatFolders = append(flatFolders, cacheDir, filepath.Join(cacheDir, osArch))
+	}
+
+	var diags tfdiags.Diagnostics
+
+	for _, folders := range folderGroups {
+		found := make(map[addrs.Provider]discovery.PluginMeta)
+		for k := range discovery.FindPlugins(plugin.ProviderPluginName, folders) {
+			provider, err := parseProviderValues(k, isFlatFolder(filepath.Dir(k.Path), flatFolders))
+			if err != nil {
+				diags = diags.Append(tfdiags.Sourceless(tfdiags.Warning, "Provider plugin skipped", err.Error()))
+				continue
+			}
+			candidates[*provider] = append(candidates[*provider], k)
+			if _, ok := pluginsSchema[*provider]; ok {
+				continue
+			}
+			if other, ok := found[*provider]; ok && !isNewer(k, other) {
+				continue
+			}
+			found[*provider] = k
+		}
+		for provider, meta := range found {
+			pluginsSchema[provider] = meta
+		}
+	}
+	return &ProviderResolver{KnownPlugins: pluginsSchema, DataSourceReader: &MockDataSourceReader{}, candidates: candidates, searched: searched, Diagnostics: diags}, nil
+}
+
+// isFlatFolder returns true if dir is one of the given flat plugin folders.
+// Plugin paths are absolute while the folders may be relative to the working directory
+func isFlatFolder(dir string, flatFolders []string) bool {
+	for _, folder := range flatFolders {
+		if abs, err := filepath.Abs(folder); err == nil && abs == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// pluginNotFound returns the error of a provider required by the config that has no plugin.
+// It tells where plugins were searched, and the plugins found with the same type but another source address
+func (r *ProviderResolver) pluginNotFound(provider addrs.Provider) tfdiags.Diagnostic {
+	var detail strings.Builder
+	fmt.Fprintf(&detail, "The config requires provider %s but no plugin was found for it.", provider)
+	if len(r.searched) > 0 {
+		fmt.Fprintf(&detail, "\nPlugins were searched in these folders and their %s_%s subfolders :", runtime.GOOS, runtime.GOARCH)
+		for _, folder := range r.searched {
+			fmt.Fprintf(&detail, "\n  - %s", folder)
+		}
+	}
+	var others []string
+	for candidate, metas := range r.candidates {
+		if candidate.Type != provider.Type || candidate == provider {
+			continue
+		}
+		for _, meta := range metas {
+			others = append(others, fmt.Sprintf("%s %s (%s)", candidate, meta.Version, meta.Path))
+		}
+	}
+	sort.Strings(others)
+	if len(others) > 0 {
+		fmt.Fprintf(&detail, "\nPlugins of other %s providers were found, check the source of the provider in the required_providers block :", provider.Type)
+		for _, other := range others {
+			fmt.Fprintf(&detail, "\n  - %s", other)
+		}
+	}
+	detail.WriteString("\nRun terraform init, or give the folder holding the plugin with --plugin-dir.")
+	return tfdiags.Sourceless(tfdiags.Error, "Provider plugin not found", detail.String())
+}
+
+// Constrain selects, for every provider type in the given map, the newest plugin found that matches the version constraint.
+// It returns an error if no plugin matches a constraint
+func (r *ProviderResolver) Constrain(constraints map[string]string) error {
+	for providerType, constraint := range constraints {
+		required, err := goversion.NewConstraint(constraint)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("Invalid version constraint %q for provider %s : %v", constraint, providerType, err)
+		}
+
+		found := false
+		for provider, metas := range r.candidates {
+			if provider.Type != providerType {
+				continue
+			}
+			found = true
+			var selected *discovery.PluginMeta
+			versions := make([]string, 0, len(metas))
+			for i, meta := range metas {
+				versions = append(versions, string(meta.Version))
+				v, err := goversion.NewVersion(string(meta.Version))
+				if err != nil || !required.Check(v) {
+					continue
+				}
+				if selected == nil || isNewer(meta, *selected) {
+					selected = &metas[i]
+				}
+			}
+			if selected == nil {
+				return fmt.Errorf("No version of provider %s matches %s. Available versions are : %s", provider, constraint, strings.Join(versions, ", "))
+			}
+			r.KnownPlugins[provider] = *selected
+		}
+		if !found {
+			return fmt.Errorf("Provider %s is not installed : no plugin was found in %s", providerType, strings.Join(r.searched, ", "))
 		}
-		pluginsSchema[*provider] = k
 	}
-	return &ProviderResolver{KnownPlugins: pluginsSchema, DataSourceReader: &MockDataSourceReader{}}, nil
+	return nil
+}
+
+// findArchFolders returns all the folders named after the given os_arch under root
+func findArchFolders(root, osArch string) []string {
+	folders := make([]string, 0)
+	// terraform init creates symlinks under linux
+	symwalk.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// plugin dir doesn't exist when terraform init wasn't run
+			return nil
+		}
+		if info.IsDir() && info.Name() == osArch {
+			folders = append(folders, path)
+		}
+
+		return nil
+	})
+	return folders
+}
+
+// isNewer returns true if the version of plugin one is greater than the version of plugin other
+func isNewer(one, other discovery.PluginMeta) bool {
+	oneVersion, err := one.Version.Parse()
+	if err != nil {
+		return false
+	}
+	otherVersion, err := other.Version.Parse()
+	if err != nil {
+		return true
+	}
+	return oneVersion.NewerThan(otherVersion)
 }
 
-func newClient(pluginName discovery.PluginMeta) *goplugin.Client {
+func newClient(pluginName discovery.PluginMeta, logOutput io.Writer) *goplugin.Client {
+	if logOutput == nil {
+		logOutput = os.Stderr
+	}
 	logger := hclog.New(&hclog.LoggerOptions{
 		Name:   "plugin",
 		Level:  hclog.Error,
-		Output: os.Stderr,
+		Output: logOutput,
 	})
 
 	c := goplugin.NewClient(
@@ -187,17 +350,24 @@ func newClient(pluginName discovery.PluginMeta) *goplugin.Client {
 func (r *ProviderResolver) ResolveProviders() map[addrs.Provider]providers.Factory {
 	result := make(map[addrs.Provider]providers.Factory)
 	for k, p := range r.KnownPlugins {
-		result[k] = buildFactory(p, r.DataSourceReader)
+		result[k] = r.buildFactory(k, p)
 	}
 
 	tfProvider := terraformProvider.NewProvider()
 	result[addrs.NewBuiltInProvider("terraform")] = buildWrappedFactory(discovery.PluginMeta{Name: "terraform"}, r.DataSourceReader, tfProvider)
+
+	// registered providers take precedence over the installed plugins
+	for k, factory := range registeredProviderFactories() {
+		result[k] = buildRegisteredFactory(k, r.DataSourceReader, factory)
+	}
 	return result
 }
 
-func buildFactory(p discovery.PluginMeta, dsProvider *MockDataSourceReader) providers.Factory {
+func (r *ProviderResolver) buildFactory(provider addrs.Provider, p discovery.PluginMeta) providers.Factory {
 	return func() (providers.Interface, error) {
-		return &ProviderInterface{pluginMeta: p, dataSourceProvider: dsProvider}, nil
+		provider := &ProviderInterface{provider: provider, pluginMeta: p, dataSourceProvider: r.DataSourceReader, logOutput: r.LogOutput, schemaCache: r.SchemaCache, pool: r.plugins}
+		r.opened.add(provider)
+		return provider, nil
 	}
 }
 
@@ -207,11 +377,29 @@ func buildWrappedFactory(p discovery.PluginMeta, dsProvider *MockDataSourceReade
 	}
 }
 
+// buildRegisteredFactory returns a factory of the provider registered for p,
+// which reads the data sources that are not mocked by the spec
+func buildRegisteredFactory(p addrs.Provider, dsProvider *MockDataSourceReader, factory providers.Factory) providers.Factory {
+	return func() (providers.Interface, error) {
+		wrapped, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to instantiate the provider %s : %v", p, err)
+		}
+		return &WrappedProviderInterface{pluginMeta: discovery.PluginMeta{Name: p.Type}, dataSourceProvider: dsProvider, wrapped: wrapped, readUnmocked: true}, nil
+	}
+}
+
 // ProviderInterface implements providers.Interface for the purpose of
 // testing described config
 type ProviderInterface struct {
+	provider           addrs.Provider
 	pluginMeta         discovery.PluginMeta
 	dataSourceProvider *MockDataSourceReader
+	logOutput          io.Writer
+	// schemaCache serves the schema without starting the plugin when it's cached
+	schemaCache *SchemaCache
+	// pool provides the plugin process when set, and outlives the provider
+	pool *pluginPool
 	_plugin            *plugin.GRPCProvider
 	lock               sync.Mutex
 }
@@ -219,38 +407,63 @@ type ProviderInterface struct {
 var _ providers.Interface = (*ProviderInterface)(nil)
 
 func (m *ProviderInterface) plugin() (*plugin.GRPCProvider, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 	if m._plugin != nil {
 		return m._plugin, nil
 	}
-	m.lock.Lock()
-	defer m.lock.Unlock()
 
-	clientPlugin := newClient(m.pluginMeta)
+	var p *plugin.GRPCProvider
+	var err error
+	if m.pool != nil {
+		p, err = m.pool.get(m.pluginMeta, m.logOutput)
+	} else {
+		p, err = startPlugin(m.pluginMeta, m.logOutput)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m._plugin = p
+	return m._plugin, nil
+}
+
+// startPlugin starts the process of a provider plugin
+func startPlugin(meta discovery.PluginMeta, logOutput io.Writer) (*plugin.GRPCProvider, error) {
+	clientPlugin := newClient(meta, logOutput)
 	c, err := clientPlugin.Client()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to load plugin %s : %v", m.pluginMeta.Name, err)
+		return nil, fmt.Errorf("Failed to load plugin %s : %v", meta.Name, err)
 	}
 	raw, err := c.Dispense(plugin.ProviderPluginName)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to instantiate the plugin %s : %v", m.pluginMeta.Name, err)
+		clientPlugin.Kill()
+		return nil, fmt.Errorf("Failed to instantiate the plugin %s : %v", meta.Name, err)
 	}
 	p, ok := raw.(*plugin.GRPCProvider)
 	if !ok {
-		return nil, fmt.Errorf("plugin %s is not a provider : %v", m.pluginMeta.Name, err)
+		clientPlugin.Kill()
+		return nil, fmt.Errorf("plugin %s is not a provider", meta.Name)
 	}
 	p.PluginClient = clientPlugin
-	m._plugin = p
-	return m._plugin, nil
+	return p, nil
 }
 
 // GetSchema returns the complete schema for the provider.
 func (m *ProviderInterface) GetSchema() providers.GetSchemaResponse {
 	var s providers.GetSchemaResponse
+	if m.schemaCache != nil {
+		if cached, ok := m.schemaCache.get(m.provider, m.pluginMeta); ok {
+			return *cached
+		}
+	}
 	p, err := m.plugin()
 	if err != nil {
 		s.Diagnostics = s.Diagnostics.Append(err)
 	} else {
 		s = p.GetSchema()
+		if m.schemaCache != nil {
+			m.schemaCache.put(m.provider, m.pluginMeta, s)
+		}
 	}
 
 	return s
@@ -288,9 +501,15 @@ func (m *ProviderInterface) ValidateDataSourceConfig(req providers.ValidateDataS
 // currently-used version of the corresponding provider, and the upgraded
 // result is used for any further processing.
 func (m *ProviderInterface) UpgradeResourceState(req providers.UpgradeResourceStateRequest) providers.UpgradeResourceStateResponse {
-	// FIXME Hopefully this will never be required
-	// Make sure terraspec is always run from an empty state (may need to override the backend)
-	return providers.UpgradeResourceStateResponse{}
+	// Only called when a prior state is provided to the test case
+	var s providers.UpgradeResourceStateResponse
+	p, err := m.plugin()
+	if err != nil {
+		s.Diagnostics = s.Diagnostics.Append(err)
+	} else {
+		s = p.UpgradeResourceState(req)
+	}
+	return s
 }
 
 // Configure configures and initialized the provider.
@@ -313,8 +532,9 @@ func (m *ProviderInterface) Stop() error {
 }
 
 // ReadResource refreshes a resource and returns its current state.
+// Resources are never read from the cloud provider so the prior state is returned unchanged
 func (m *ProviderInterface) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
-	return providers.ReadResourceResponse{}
+	return providers.ReadResourceResponse{NewState: req.PriorState, Private: req.Private}
 }
 
 // PlanResourceChange takes the current state and proposed state of a
@@ -352,16 +572,13 @@ func (m *ProviderInterface) ReadDataSource(req providers.ReadDataSourceRequest)
 
 // Close shuts down the plugin process if applicable.
 func (m *ProviderInterface) Close() error {
-	if m._plugin != nil {
-		m.lock.Lock()
-		if m._plugin != nil {
-			if m._plugin.PluginClient != nil {
-				m._plugin.PluginClient.Kill()
-			}
-			m._plugin = nil
-		}
-		m.lock.Unlock()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	// pooled processes are killed once the run completes
+	if m._plugin != nil && m.pool == nil && m._plugin.PluginClient != nil {
+		m._plugin.PluginClient.Kill()
 	}
+	m._plugin = nil
 	return nil
 }
 
@@ -371,6 +588,8 @@ type WrappedProviderInterface struct {
 	pluginMeta         discovery.PluginMeta
 	dataSourceProvider *MockDataSourceReader
 	wrapped            providers.Interface
+	// readUnmocked lets the wrapped provider read the data sources no mock matches
+	readUnmocked bool
 }
 
 // GetSchema returns the complete schema for the provider.
@@ -424,8 +643,9 @@ func (w *WrappedProviderInterface) Stop() error {
 }
 
 // ReadResource refreshes a resource and returns its current state.
+// Resources are never read so the prior state is returned unchanged
 func (w *WrappedProviderInterface) ReadResource(req providers.ReadResourceRequest) providers.ReadResourceResponse {
-	return providers.ReadResourceResponse{}
+	return providers.ReadResourceResponse{NewState: req.PriorState, Private: req.Private}
 }
 
 // PlanResourceChange takes the current state and proposed state of a
@@ -448,6 +668,12 @@ func (w *WrappedProviderInterface) ImportResourceState(req providers.ImportResou
 
 // ReadDataSource returns the data source's current state.
 func (w *WrappedProviderInterface) ReadDataSource(req providers.ReadDataSourceRequest) providers.ReadDataSourceResponse {
+	if w.readUnmocked {
+		if mockedResult, ok := w.dataSourceProvider.lookup(req.Config); ok {
+			return providers.ReadDataSourceResponse{State: mockedResult}
+		}
+		return w.wrapped.ReadDataSource(req)
+	}
 	mockedResult := w.dataSourceProvider.ReadDataSource(req.Config)
 	return providers.ReadDataSourceResponse{State: mockedResult}
 }
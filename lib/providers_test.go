@@ -2,13 +2,16 @@ package terraspec
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/plugin/discovery"
+	"github.com/hashicorp/terraform/tfdiags"
 )
 
 func TestBuildProviderResolver(t *testing.T) {
@@ -79,4 +82,125 @@ func TestBuildProviderResolverLegacy(t *testing.T) {
 	if pluginMeta != expectedMeta  {
 		t.Errorf("PluginMeta not correct. Got %v. Expected %v.", pluginMeta, expectedMeta)
 	}
-}
\ No newline at end of file
+}
+
+// TestBuildProviderResolverPluginDirs test that providers are found in additional plugin dirs and in the plugin cache dir
+func TestBuildProviderResolverPluginDirs(t *testing.T) {
+	tests := map[string]struct {
+		pluginDirs []string
+		cacheDir   string
+		expected   addrs.Provider
+	}{
+		"plugin dir": {
+			pluginDirs: []string{"testdata12/.terraform/plugins"},
+			expected:   addrs.NewDefaultProvider("testprovider"),
+		},
+		"cache dir": {
+			cacheDir: "testdata/.terraform/plugins",
+			expected: addrs.Provider{Hostname: "no.registry.com", Namespace: "nocorp", Type: "testprovider"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			os.Setenv(PluginCacheDirEnvVar, tt.cacheDir)
+			defer os.Unsetenv(PluginCacheDirEnvVar)
+
+			provResolver, err := BuildProviderResolver("testdata/module", tt.pluginDirs...)
+			if err != nil {
+				t.Fatalf("Could not build provider resolver: %v", err)
+			}
+			if len(provResolver.KnownPlugins) != 1 {
+				t.Fatalf("Expected 1 provider. Got %v", provResolver.KnownPlugins)
+			}
+			if pluginMeta, ok := provResolver.KnownPlugins[tt.expected]; !ok || pluginMeta.Name != "testprovider" {
+				t.Errorf("Provider %v not found. Got %v", tt.expected, provResolver.KnownPlugins)
+			}
+		})
+	}
+}
+
+// TestBuildProviderResolverUnknownLayout test that plugins in neither layout are skipped with a warning
+func TestBuildProviderResolverUnknownLayout(t *testing.T) {
+	pluginDir, err := ioutil.TempDir("", "terraspec-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pluginDir)
+	osArch := fmt.Sprintf("%s_%s", runtime.GOOS, runtime.GOARCH)
+	writeFiles(t, pluginDir, map[string]string{
+		filepath.Join("no.registry.com", "testprovider", osArch, "terraform-provider-testprovider_v0.1.2"): "",
+	})
+
+	provResolver, err := BuildProviderResolver("testdata/module", pluginDir)
+	if err != nil {
+		t.Fatalf("Could not build provider resolver: %v", err)
+	}
+	if len(provResolver.KnownPlugins) != 0 {
+		t.Errorf("Expected no provider. Got %v", provResolver.KnownPlugins)
+	}
+	if len(provResolver.Diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic. Got %v", provResolver.Diagnostics)
+	}
+	desc := provResolver.Diagnostics[0].Description()
+	if provResolver.Diagnostics[0].Severity() != tfdiags.Warning || !strings.Contains(desc.Detail, filepath.Join("no.registry.com", "testprovider", osArch)) {
+		t.Errorf("Unexpected diagnostic %s: %s", desc.Summary, desc.Detail)
+	}
+}
+
+func TestProviderResolverConstrain(t *testing.T) {
+	provider := addrs.Provider{Hostname: "no.registry.com", Namespace: "nocorp", Type: "testprovider"}
+	tests := map[string]struct {
+		constraints map[string]string
+		expected    string
+		expectError bool
+	}{
+		"no constraint": {expected: "0.2.0"},
+		"older":         {constraints: map[string]string{"testprovider": "< 0.2"}, expected: "0.1.2"},
+		"no match":      {constraints: map[string]string{"testprovider": ">= 1.0"}, expectError: true},
+		"not installed": {constraints: map[string]string{"otherprovider": ">= 1.0"}, expectError: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			provResolver, err := BuildProviderResolver("testdata/module", "testdata/plugin_cache")
+			if err != nil {
+				t.Fatalf("Could not build provider resolver: %v", err)
+			}
+			err = provResolver.Constrain(tt.constraints)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Constrain should have failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := string(provResolver.KnownPlugins[provider].Version); got != tt.expected {
+				t.Errorf("Wrong provider version selected. Got %s. Expected %s.", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPluginNotFound(t *testing.T) {
+	provResolver, err := BuildProviderResolver("testdata/module", "testdata/plugin_cache")
+	if err != nil {
+		t.Fatalf("Could not build provider resolver: %v", err)
+	}
+
+	detail := provResolver.pluginNotFound(addrs.NewDefaultProvider("testprovider")).Description().Detail
+	for _, expected := range []string{
+		"The config requires provider registry.terraform.io/hashicorp/testprovider but no plugin was found for it.",
+		"  - " + filepath.Join("testdata/module", ".terraform/plugins"),
+		"  - testdata/plugin_cache",
+		"Plugins of other testprovider providers were found",
+		"  - no.registry.com/nocorp/testprovider 0.1.2",
+		"  - no.registry.com/nocorp/testprovider 0.2.0",
+	} {
+		if !strings.Contains(detail, expected) {
+			t.Errorf("Expected the error to contain %q, got %s", expected, detail)
+		}
+	}
+}
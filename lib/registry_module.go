@@ -0,0 +1,86 @@
+package terraspec
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	getter "github.com/hashicorp/go-getter"
+	goversion "github.com/hashicorp/go-version"
+	"github.com/hashicorp/terraform-svchost/disco"
+	"github.com/hashicorp/terraform/registry"
+	"github.com/hashicorp/terraform/registry/regsrc"
+)
+
+// RegistryModule is a module downloaded from a module registry
+type RegistryModule struct {
+	// Dir is the folder of the module, or of the submodule when the source addresses one
+	Dir string
+	// Version is the version of the module selected by the version constraint
+	Version string
+}
+
+// FetchRegistryModule downloads into dst, which must not exist yet, the module of a registry addressed by source like terraform does,
+// eg hashicorp/consul/aws or app.terraform.io/acme/network/aws//modules/vpc. The version is the latest one allowed by versionConstraint,
+// or the latest one when it's empty. Pre-releases are only selected when the constraint asks for them exactly.
+// Registry hosts are discovered with services, or disco.New() when nil
+func FetchRegistryModule(ctx context.Context, services *disco.Disco, source, versionConstraint, dst string) (*RegistryModule, error) {
+	module, err := regsrc.ParseModuleSource(source)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid registry source %s : %v", source, err)
+	}
+	var constraints goversion.Constraints
+	if versionConstraint != "" {
+		if constraints, err = goversion.NewConstraint(versionConstraint); err != nil {
+			return nil, fmt.Errorf("Invalid version constraint %s : %v", versionConstraint, err)
+		}
+	}
+	if services == nil {
+		services = disco.New()
+	}
+	// the registry client logs through the standard log package, like terraform, so its logs are filtered the same way
+	logOutput, err := terraformLogOutput(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open terraform log file : %v", err)
+	}
+	defer terraformLogs.route(logOutput)()
+	client := registry.NewClient(services, nil)
+
+	resp, err := client.ModuleVersions(module)
+	if err != nil {
+		return nil, fmt.Errorf("Could not list the versions of %s : %v", source, err)
+	}
+	var selected *goversion.Version
+	for _, m := range resp.Modules {
+		for _, v := range m.Versions {
+			version, err := goversion.NewVersion(v.Version)
+			if err != nil {
+				continue
+			}
+			if version.Prerelease() != "" && versionConstraint != version.String() {
+				continue
+			}
+			if constraints != nil && !constraints.Check(version) {
+				continue
+			}
+			if selected == nil || version.GreaterThan(selected) {
+				selected = version
+			}
+		}
+	}
+	if selected == nil {
+		return nil, fmt.Errorf("No version of %s matches %q", source, versionConstraint)
+	}
+
+	location, err := client.ModuleLocation(module, selected.String())
+	if err != nil {
+		return nil, fmt.Errorf("Could not find where to download %s %s : %v", source, selected, err)
+	}
+	// the download location may address a subfolder, in which the submodule of the source is
+	src, subdir := getter.SourceDirSubdir(location)
+	if err := download(ctx, src, ".", dst); err != nil {
+		return nil, fmt.Errorf("Could not download %s %s : %v", source, selected, err)
+	}
+	dir := filepath.Join(dst, filepath.FromSlash(subdir), filepath.FromSlash(module.RawSubmodule))
+	return &RegistryModule{Dir: dir, Version: selected.String()}, nil
+}
@@ -0,0 +1,82 @@
+package terraspec
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	svchost "github.com/hashicorp/terraform-svchost"
+	"github.com/hashicorp/terraform-svchost/disco"
+)
+
+func TestFetchRegistryModule(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"releases/1.2.0/main.tf":             `output "version" { value = "1.2.0" }`,
+		"releases/1.2.0/modules/vpc/main.tf": `output "cidr" { value = "10.0.0.0/16" }`,
+		"releases/1.3.0/main.tf":             `output "version" { value = "1.3.0" }`,
+	})
+
+	// the registry lists the versions of the module and tells where to download them
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/modules/acme/network/aws/versions":
+			fmt.Fprint(w, `{"modules":[{"versions":[{"version":"1.2.0"},{"version":"1.3.0"},{"version":"2.0.0-beta1"}]}]}`)
+		case "/v1/modules/acme/network/aws/1.2.0/download", "/v1/modules/acme/network/aws/1.3.0/download":
+			version := filepath.Base(filepath.Dir(r.URL.Path))
+			w.Header().Set("X-Terraform-Get", "file::"+filepath.Join(root, "releases", version))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer registry.Close()
+	services := disco.New()
+	services.ForceHostServices(svchost.Hostname("registry.example.com"), map[string]interface{}{"modules.v1": registry.URL + "/v1/modules/"})
+
+	tests := map[string]struct {
+		source     string
+		constraint string
+		version    string
+		output     string
+		error      bool
+	}{
+		"Latest":                {source: "registry.example.com/acme/network/aws", version: "1.3.0", output: `"1.3.0"`},
+		"Constraint":            {source: "registry.example.com/acme/network/aws", constraint: "~> 1.2.0", version: "1.2.0", output: `"1.2.0"`},
+		"Submodule":             {source: "registry.example.com/acme/network/aws//modules/vpc", constraint: "1.2.0", version: "1.2.0", output: `"10.0.0.0/16"`},
+		"No match":              {source: "registry.example.com/acme/network/aws", constraint: ">= 3.0", error: true},
+		"Not a registry source": {source: "./local", error: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dst := filepath.Join(root, "fetched", name)
+			module, err := FetchRegistryModule(context.Background(), services, tt.source, tt.constraint, dst)
+			if tt.error {
+				if err == nil {
+					t.Errorf("Expected an error, got module %+v", module)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if module.Version != tt.version {
+				t.Errorf("Expected version %s, got %s", tt.version, module.Version)
+			}
+			content, err := ioutil.ReadFile(filepath.Join(module.Dir, "main.tf"))
+			if err != nil || !strings.Contains(string(content), tt.output) {
+				t.Errorf("Expected the module of version %s in %s, got %s, %v", tt.version, module.Dir, content, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package terraspec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	tfe "github.com/hashicorp/go-tfe"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/states/statefile"
+)
+
+// RemoteTokenEnvVar is the environment variable holding the API token used to read remote states
+const RemoteTokenEnvVar = "TFE_TOKEN"
+
+// RemoteStateConfig points to a Terraform Cloud/Enterprise workspace whose current state
+// is used as prior state for a test case. The state is only ever read.
+type RemoteStateConfig struct {
+	Hostname     string
+	Organization string
+	Workspace    string
+}
+
+// FetchRemoteState downloads the current state of the workspace described by the given config
+func FetchRemoteState(ctx context.Context, config *RemoteStateConfig) (*states.State, error) {
+	token := os.Getenv(RemoteTokenEnvVar)
+	if token == "" {
+		return nil, fmt.Errorf("Reading remote state of workspace %s/%s requires an API token in %s environment variable", config.Organization, config.Workspace, RemoteTokenEnvVar)
+	}
+
+	client, err := tfe.NewClient(&tfe.Config{Address: fmt.Sprintf("https://%s", config.Hostname), Token: token})
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to %s : %v", config.Hostname, err)
+	}
+
+	workspace, err := client.Workspaces.Read(ctx, config.Organization, config.Workspace)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read workspace %s/%s : %v", config.Organization, config.Workspace, err)
+	}
+
+	version, err := client.StateVersions.Current(ctx, workspace.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find current state of workspace %s/%s : %v", config.Organization, config.Workspace, err)
+	}
+
+	content, err := client.StateVersions.Download(ctx, version.DownloadURL)
+	if err != nil {
+		return nil, fmt.Errorf("Could not download state of workspace %s/%s : %v", config.Organization, config.Workspace, err)
+	}
+
+	file, err := statefile.Read(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read state of workspace %s/%s : %v", config.Organization, config.Workspace, err)
+	}
+	return file.State, nil
+}
@@ -0,0 +1,225 @@
+package terraspec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/configs"
+)
+
+// resultCacheFormat is hashed in every key, so the cache is ignored when the way results are stored changes
+const resultCacheFormat = 2
+
+// resultCache keeps the results of the passing test cases in a folder, so test cases whose inputs didn't change are not run again.
+// A result is keyed by a hash of the files of the config and of the modules it calls, of the files of the test case folder,
+// of the spec files it imports, of the provider plugins found and of the options of the run.
+// Remote states, hooks and files read outside of these folders are not part of the key
+type resultCache struct {
+	// dir is the folder holding the cached results
+	dir string
+	// suiteHash is the hash of the inputs shared by all the test cases of a run
+	suiteHash string
+}
+
+// cachedResult is the content of a cached result file
+type cachedResult struct {
+	Plan            string
+	PlanJSON        json.RawMessage
+	Assertions      []*Assertion
+	Skipped         int
+	ExpectedFailure string
+	Coverage        *Coverage
+	Duration        time.Duration
+}
+
+// newResultCache returns a resultCache storing results in dir for the test suite described by opts.
+// It returns nil when the config can't be loaded, so its errors are reported by the test cases rather than hidden by the cache
+func newResultCache(dir string, opts Options) (*resultCache, error) {
+	cfg, diags := LoadConfig(opts.Dir)
+	if diags.HasErrors() {
+		return nil, nil
+	}
+	resolver, err := BuildProviderResolver(opts.Dir, opts.PluginDirs...)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "format %d\nterraform %s\nclaim %s\nmodule %t\ndisplay %d\nstrict %t\n", resultCacheFormat, terraformVersion, opts.ClaimVersion, opts.ModuleMode, opts.planDisplay(), opts.Strict)
+	fmt.Fprintf(h, "docker %s\nsensitive %t\n", opts.DockerImage, opts.ShowSensitive)
+	// the files given by the options are inputs of every test case
+	for _, input := range []struct{ name, file string }{{"variables", opts.BaseVariableFile}, {"plan", opts.PlanFile}} {
+		if input.file == "" {
+			continue
+		}
+		fmt.Fprintf(h, "%s %s\n", input.name, absPath(input.file))
+		if err := hashFile(h, absPath(input.file)); err != nil {
+			return nil, err
+		}
+	}
+	// so are the binaries run by the lint and scan blocks, whose upgrades may change the findings, and the terraform binary planning the test cases
+	for _, bin := range []struct{ name, file, fallback string }{{"tflint", opts.TflintBin, DefaultTflintBin}, {"checkov", opts.CheckovBin, DefaultCheckovBin}, {"terraform", opts.TerraformBin, ""}} {
+		if bin.file == "" {
+			bin.file = bin.fallback
+		}
+		fmt.Fprintf(h, "%s %s\n", bin.name, bin.file)
+		if path, err := exec.LookPath(bin.file); err == nil {
+			if err := hashFile(h, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var moduleDirs []string
+	cfg.DeepEach(func(c *configs.Config) {
+		moduleDirs = append(moduleDirs, absPath(c.Module.SourceDir))
+	})
+	sort.Strings(moduleDirs)
+	// the other test cases of the spec folder don't change the result of a test case, and the cache is not an input
+	skip := map[string]bool{absPath(opts.specPath()): true, absPath(dir): true}
+	for _, moduleDir := range moduleDirs {
+		if err := hashDir(h, moduleDir, skip); err != nil {
+			return nil, err
+		}
+	}
+
+	var plugins []string
+	for provider, metas := range resolver.candidates {
+		for _, meta := range metas {
+			plugins = append(plugins, fmt.Sprintf("plugin %s %s %s\n", provider, meta.Version, meta.Path))
+		}
+	}
+	sort.Strings(plugins)
+	for _, p := range plugins {
+		io.WriteString(h, p)
+	}
+	return &resultCache{dir: absPath(dir), suiteHash: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// key returns the hash of the inputs of the given test case
+func (c *resultCache) key(tc *TestCase) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "suite %s\ncase %s\n", c.suiteHash, tc.Name())
+	for _, file := range []string{tc.SpecFile, tc.VariableFile} {
+		if file == "" {
+			continue
+		}
+		if err := hashFile(h, absPath(file)); err != nil {
+			return "", err
+		}
+	}
+	if err := hashDir(h, absPath(tc.Dir), map[string]bool{c.dir: true}); err != nil {
+		return "", err
+	}
+	// imported spec files live outside of the test case folder, and remote ones may change while their source doesn't, eg a branch
+	err := eachImportedFile(tc.SpecFile, func(source, file string) error {
+		fmt.Fprintf(h, "import %s %s\n", source, file)
+		return hashFile(h, file)
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// get returns the cached result of the test case, if it passed with the same inputs. A nil cache holds no result
+func (c *resultCache) get(tc *TestCase) (*CaseResult, bool) {
+	if c == nil {
+		return nil, false
+	}
+	key, err := c.key(tc)
+	if err != nil {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, key+".json"))
+	if err != nil {
+		return nil, false
+	}
+	var cached cachedResult
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, false
+	}
+	return &CaseResult{Name: tc.Name(), Dir: tc.Dir, Plan: cached.Plan, PlanJSON: cached.PlanJSON, Assertions: cached.Assertions,
+		Skipped: cached.Skipped, ExpectedFailure: cached.ExpectedFailure, Coverage: cached.Coverage, Duration: cached.Duration, Cached: true}, true
+}
+
+// put stores the result of the test case if it passed. A nil cache stores nothing.
+// The cache only saves time, so the result is simply not stored when the file can't be written
+func (c *resultCache) put(tc *TestCase, result *CaseResult) {
+	if c == nil || result.Failed() {
+		return
+	}
+	key, err := c.key(tc)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(cachedResult{Plan: result.Plan, PlanJSON: result.PlanJSON, Assertions: result.Assertions, Skipped: result.Skipped, ExpectedFailure: result.ExpectedFailure, Coverage: result.Coverage, Duration: result.Duration})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return
+	}
+	// other terraspec processes may read the file while it's written, so it's renamed once complete
+	tmp, err := ioutil.TempFile(c.dir, ".result-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, key+".json")); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// hashDir writes the path relative to dir and the content of every file of dir and its subfolders in h.
+// Hidden folders, eg .terraform or .git, and the folders of skip are left out
+func hashDir(h hash.Hash, dir string, skip map[string]bool) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && (skip[path] || strings.HasPrefix(info.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "file %s\n", filepath.ToSlash(rel))
+		return hashFile(h, path)
+	})
+}
+
+func hashFile(h hash.Hash, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := io.Copy(h, f)
+	fmt.Fprintf(h, "\n%d\n", n)
+	return err
+}
@@ -0,0 +1,125 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+func TestResultCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-result-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	write := func(file, content string) {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.tf", `output "size" { value = 3 }`)
+	write("spec/prod/prod.tfspec", "")
+	write("spec/dev/dev.tfspec", "")
+	prod := &TestCase{Dir: filepath.Join(root, "spec/prod"), SpecFile: filepath.Join(root, "spec/prod/prod.tfspec")}
+	dev := &TestCase{Dir: filepath.Join(root, "spec/dev"), SpecFile: filepath.Join(root, "spec/dev/dev.tfspec")}
+
+	opts := Options{Dir: root}
+	opts.setDefaults()
+	newCache := func() *resultCache {
+		cache, err := newResultCache(filepath.Join(root, "cache"), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cache == nil {
+			t.Fatal("Expected a cache for a valid config")
+		}
+		return cache
+	}
+
+	cache := newCache()
+	if _, ok := cache.get(prod); ok {
+		t.Fatal("Expected no cached result before the first run")
+	}
+	cache.put(prod, &CaseResult{Name: "prod", Assertions: []*Assertion{{Path: "output.size", Passed: true}}})
+	cache.put(dev, &CaseResult{Name: "dev", Diagnostics: tfdiags.Diagnostics{}.Append(tfdiags.Sourceless(tfdiags.Error, "failed", ""))})
+
+	cached, ok := newCache().get(prod)
+	if !ok {
+		t.Fatal("Expected the passing result to be cached")
+	}
+	if !cached.Cached || len(cached.Assertions) != 1 || cached.Name != "prod" {
+		t.Errorf("Unexpected cached result %+v", cached)
+	}
+	if _, ok := cache.get(dev); ok {
+		t.Error("Expected the failing result not to be cached")
+	}
+
+	// other test cases don't invalidate the result
+	write("spec/dev/dev.tfspec", "terraspec_version = 2\n")
+	if _, ok := newCache().get(prod); !ok {
+		t.Error("Expected the result to stay cached when another test case changes")
+	}
+	write("spec/prod/state.json", "{}")
+	if _, ok := newCache().get(prod); ok {
+		t.Error("Expected a file added to the test case folder to invalidate the result")
+	}
+	cache = newCache()
+	cache.put(prod, &CaseResult{Name: "prod"})
+	write("main.tf", `output "size" { value = 4 }`)
+	if _, ok := newCache().get(prod); ok {
+		t.Error("Expected a change of the config to invalidate the result")
+	}
+
+	// like the inputs of a terragrunt stack, in a hidden folder left out of the hash of the config
+	write(".terragrunt-cache/inputs.tfvars", "size = 3")
+	write("plan.json", "{}")
+	write("bin/tflint", "#!/bin/sh\n")
+	cache = newCache()
+	cache.put(prod, &CaseResult{Name: "prod"})
+	changes := map[string]func(*Options){
+		"docker image":       func(o *Options) { o.DockerImage = "terraspec:1.0" },
+		"sensitive values":   func(o *Options) { o.ShowSensitive = true },
+		"base variable file": func(o *Options) { o.BaseVariableFile = filepath.Join(root, ".terragrunt-cache/inputs.tfvars") },
+		"plan file":          func(o *Options) { o.PlanFile = filepath.Join(root, "plan.json") },
+		"tflint binary":      func(o *Options) { o.TflintBin = filepath.Join(root, "bin/tflint") },
+		"checkov binary":     func(o *Options) { o.CheckovBin = filepath.Join(root, "bin/checkov") },
+	}
+	for name, change := range changes {
+		changed := opts
+		change(&changed)
+		cache, err := newResultCache(filepath.Join(root, "cache"), changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := cache.get(prod); ok {
+			t.Errorf("Expected a change of the %s to invalidate the result", name)
+		}
+	}
+
+	// imported spec files are outside of the test case folder, and so are the files they import
+	write("spec/_shared/tags.tfspec", "import {\n  source = \"./nested\"\n}")
+	write("spec/_shared/nested/owner.tfspec", "")
+	write("spec/prod/prod.tfspec", "import {\n  source = \"../_shared/tags.tfspec\"\n}")
+	newCache().put(prod, &CaseResult{Name: "prod"})
+	if _, ok := newCache().get(prod); !ok {
+		t.Error("Expected the result of a test case importing spec files to be cached")
+	}
+	write("spec/_shared/nested/owner.tfspec", `reject "output" "owner" {}`)
+	if _, ok := newCache().get(prod); ok {
+		t.Error("Expected a change of a file imported by an imported file to invalidate the result")
+	}
+
+	opts.BaseVariableFile = filepath.Join(root, ".terragrunt-cache/inputs.tfvars")
+	newCache().put(prod, &CaseResult{Name: "prod"})
+	write(".terragrunt-cache/inputs.tfvars", "size = 4")
+	if _, ok := newCache().get(prod); ok {
+		t.Error("Expected a change of the base variable file to invalidate the result")
+	}
+}
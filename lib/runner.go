@@ -0,0 +1,1140 @@
+package terraspec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	goversion "github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/backend/local"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/helper/logging"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/hashicorp/terraform/version"
+	"github.com/mitchellh/cli"
+	"github.com/mitchellh/colorstring"
+)
+
+// Options configures a run of the test suite of a terraform config
+type Options struct {
+	// Dir is the directory of the terraform config under test. Defaults to the current directory
+	Dir string
+	// SpecDir is the folder containing the test cases, relative to Dir. Defaults to spec
+	SpecDir string
+	// DisplayPlan renders the plan of every test case in its result
+	DisplayPlan bool
+	// DisplayPlanOnFailure renders the plan of the failing test cases only, so big plans don't slow down the runs that pass.
+	// It's ignored when DisplayPlan is set
+	DisplayPlanOnFailure bool
+	// ClaimVersion is the terraform version to claim when the config version constraints reject the embedded terraform.
+	// Terraform reads its version from a variable of the process, so claiming a version serializes the runs : a run claiming a version
+	// waits for the runs in progress to complete, and the runs started meanwhile wait for it. The claim only lasts for the run
+	ClaimVersion string
+	// ModuleMode tests Dir as a module, through a generated root config calling it
+	ModuleMode bool
+	// Isolate runs every test case in its own temporary copy of Dir, see Workdir, so the files written by a test case
+	// are not seen by the others. Files read outside of Dir, or through paths relative to the current directory, are still shared
+	Isolate bool
+	// PluginDirs are additional directories where provider plugins are searched
+	PluginDirs []string
+	// OnCaseResult is called with the result of every test case as soon as it completes.
+	// Calls are never concurrent, but the test cases still running may log meanwhile, so the output of a result should be written at once.
+	// To abort the run early, cancel the context given to RunSuite
+	OnCaseResult func(*CaseResult) `json:"-"`
+	// LogOutput receives the logs of terraform, filtered by the TF_LOG level if set, and of the provider plugins.
+	// Nil means logs are written where TF_LOG and TF_LOG_PATH tell, and plugin errors to stderr.
+	// Terraform logs through the standard log package : the first run sets its output once to a router writing the lines prefixed
+	// by a log level to the LogOutput of the runs in progress, and the other lines to the previous output of the standard logger.
+	// The terraform logs of concurrent runs can't be told apart, so they're written to the LogOutput of all of them
+	LogOutput io.Writer `json:"-"`
+	// Discovery finds the test cases of the spec folder. Defaults to DirectoryDiscovery
+	Discovery Discovery `json:"-"`
+	// SchemaCacheDir is a folder where the schemas of the provider plugins are kept, by provider version, to be reused by later runs.
+	// Schemas are requested from the plugins by every test case when empty
+	SchemaCacheDir string
+	// Parallelism is the maximum number of test cases run at the same time.
+	// Defaults to the number of CPUs, lowered so that the test cases fit in the available memory
+	Parallelism int
+	// MemoryPerCase is the memory, in bytes, a test case is expected to use when Parallelism is computed. Defaults to DefaultMemoryPerCase
+	MemoryPerCase int64
+	// ChangedSince is a git ref. When set, only the test cases affected by the files changed since this ref are run, see AffectedTestCases
+	ChangedSince string
+	// ChangedOnly only runs the test cases affected by the changes staged in git, eg from a pre-commit hook. It can't be set with ChangedSince
+	ChangedOnly bool
+	// WarmUp starts the provider plugins required by the config and loads their schemas before the test cases run,
+	// so the time of the first test cases doesn't include it. Schemas are kept in memory for the run when SchemaCacheDir is empty
+	WarmUp bool
+	// KeepArtifacts tells which temporary folders created for the test cases, eg the harness of ModuleMode or the copy of Isolate,
+	// are kept once they completed : KeepArtifactsNever, the default, KeepArtifactsOnFailure or KeepArtifactsAlways. See CaseResult.Artifacts
+	KeepArtifacts string
+	// ArtifactsDir is the folder the temporary folders of the test cases are created in. Defaults to the temporary folder of the system
+	ArtifactsDir string
+	// ReleasePlans drops the rendered and JSON plans of the results kept in Results.Cases once they're given to OnCaseResult,
+	// so the memory used by large suites doesn't grow with their plans
+	ReleasePlans bool
+	// CacheDir is a folder where the results of the passing test cases are kept, to be reused by later runs while their inputs don't change.
+	// Cached results are marked with CaseResult.Cached. Test cases always run when empty
+	CacheDir string
+	// MinCoverage is the minimum fraction, between 0 and 1, of the planned resources and of their attributes that the test cases
+	// must check, for all the resources and for the ones of every module. The run fails otherwise, see Results.CoverageShortfalls.
+	// A resource or an attribute is checked when a test case asserts it. No minimum is required when 0
+	MinCoverage float64
+	// MemStats reports the memory used by the process when every test case completed, and the provider plugins it didn't close,
+	// in CaseResult.MemStats
+	MemStats bool
+	// ShowSensitive prints the values of the attributes and outputs marked sensitive in the assertion results.
+	// They're redacted by default, so secrets don't end up in CI logs
+	ShowSensitive bool
+	// Skip are the names of the test cases not run, reported as skipped. Test cases whose terraspec block sets skip are skipped as well
+	Skip []string
+	// BaseVariableFile is a .tfvars or .tfvars.json file giving values to the variables of every test case.
+	// The variable file of a test case overrides them. It's relative to the current directory
+	BaseVariableFile string
+	// TflintBin is the tflint binary run by the lint blocks of the specs. Defaults to tflint, looked up in the PATH
+	TflintBin string
+	// CheckovBin is the checkov binary run by the scan blocks of the specs. Defaults to checkov, looked up in the PATH
+	CheckovBin string
+	// PlanFile is the name of a plan computed by terraform, saved by terraform plan -out or in the JSON format of terraform show -json,
+	// in the folder of every test case. The assertions of the test cases are checked against their plan file rather than planning the config,
+	// eg to check a plan computed by an earlier stage of the pipeline with real credentials. The plan_file attribute of the terraspec block overrides it
+	PlanFile string
+	// SpecSource is the address of the spec folder, used in place of SpecDir, like the source of a terraform module :
+	// a local path relative to Dir, or a remote address, eg git::https://example.com/specs.git//aws?ref=v1.2, s3:: or https:// archives.
+	// The specs are downloaded in a temporary folder before the run and removed once it completed, see FetchSpecs
+	SpecSource string
+	// DockerImage runs every test case in a container of this image, with the terraspec binary found in the image, so the terraform
+	// and provider versions pinned in the image are used whatever the host has. Dir is mounted in the container : files read outside of it
+	// are not found. Paths in the results are the paths of the host
+	DockerImage string
+	// DockerBin is the docker binary running the containers of DockerImage. Defaults to docker, looked up in the PATH
+	DockerBin string
+	// TerraformBin computes the plan of every test case with this terraform binary rather than the embedded terraform, see FindTerraform,
+	// so the config is tested with the terraform version it's applied with. The assertions are checked against the JSON plan like CheckPlanJSON :
+	// mocks, states and hooks of the specs are ignored, and the providers read the data sources, so they need their credentials
+	TerraformBin string
+	// Strict fails the test cases with warnings, from terraform like deprecations or from terraspec like duplicate assertions,
+	// so configs and specs are kept free of them
+	Strict bool
+}
+
+// TestCase is a folder containing a .tfspec file and optionally a .tfvars file
+type TestCase struct {
+	Dir          string
+	VariableFile string
+	SpecFile     string
+	// Label names the test case in place of its folder, eg when a manifest lists several test cases of the same folder
+	Label string `json:",omitempty"`
+}
+
+// Name returns the name of the test case, which is its label or the name of its folder
+func (tc *TestCase) Name() string {
+	if tc.Label != "" {
+		return tc.Label
+	}
+	return filepath.Base(tc.Dir)
+}
+
+// CaseResult is the outcome of a test case
+type CaseResult struct {
+	Name string
+	// Dir is the folder of the test case
+	Dir string
+	// Plan is the rendered plan, only set when Options.DisplayPlan is true, or when the test case failed and Options.DisplayPlanOnFailure is true
+	Plan string
+	// PlanJSON is the plan in the JSON format of terraform show -json, which github.com/hashicorp/terraform-json decodes.
+	// It's only set when the plan could be computed
+	PlanJSON json.RawMessage
+	// Diagnostics holds the results of the assertions and the errors raised while running the test case
+	Diagnostics tfdiags.Diagnostics
+	// Assertions holds the outcome of every assertion checked, in the order of Diagnostics
+	Assertions []*Assertion
+	// Skipped is the number of assert and reject blocks of the spec that gave no assertion, eg because the plan could not be computed
+	Skipped int `json:",omitempty"`
+	// Coverage tells which planned resources and attributes are checked by an assertion. It's only set when the plan could be computed
+	Coverage *Coverage `json:",omitempty"`
+	Duration time.Duration
+	// Started is the time the test case started running. It's zero for the test cases that didn't run, eg cached or skipped ones
+	Started time.Time
+	// Timings is the time spent in every phase of the test case. It's not kept in the cache
+	Timings *Timings `json:",omitempty"`
+	// Artifacts are the temporary folders created for the test case and kept, see Options.KeepArtifacts
+	Artifacts []string `json:",omitempty"`
+	// MemStats is the memory used when the test case completed, when Options.MemStats is set. It's not kept in the cache
+	MemStats *MemStats `json:",omitempty"`
+	// Cached tells the test case passed in a previous run with the same inputs and was not run again.
+	// Diagnostics are not kept in the cache, Assertions are
+	Cached bool `json:",omitempty"`
+	// SkipReason tells why the test case was not run, when it was skipped. Skipped test cases neither pass nor fail
+	SkipReason string `json:",omitempty"`
+	// ExpectedFailure is the reason the assertions of the test case are expected to fail, set by expect_failure in its terraspec block.
+	// The test case then passes when an assertion fails without any other error, and fails with an unexpected pass otherwise
+	ExpectedFailure string `json:",omitempty"`
+}
+
+// Assertion is the outcome of a single assertion of a test case
+type Assertion struct {
+	// Path is the asserted element, eg aws_instance.name.tags
+	Path   string
+	Passed bool
+	// Message is the value found when the assertion passed, or why it failed
+	Message string
+	// Mismatch describes the failure of the assertion, when it's about a planned value
+	Mismatch *Mismatch `json:",omitempty"`
+	// FailureMessage explains the rule a failed assertion checks, when its assert block has a message
+	FailureMessage string `json:",omitempty"`
+	// Range is the range of the header of the spec block of the assertion, when known
+	Range *hcl.Range `json:",omitempty"`
+}
+
+// Failed tells if an assertion of the test case failed or an error occurred.
+// When the test case is expected to fail, failed assertions are not a failure, other errors still are
+func (r *CaseResult) Failed() bool {
+	if r.ExpectedFailure != "" {
+		return len(r.Errors()) > 0
+	}
+	return r.Diagnostics.HasErrors()
+}
+
+// FailedAsExpected tells if the test case is expected to fail and an assertion failed, without any other error
+func (r *CaseResult) FailedAsExpected() bool {
+	return r.ExpectedFailure != "" && r.Diagnostics.HasErrors() && !r.Failed()
+}
+
+// Errors returns the errors that are not assertion failures, eg invalid config or spec
+func (r *CaseResult) Errors() tfdiags.Diagnostics {
+	var errs tfdiags.Diagnostics
+	for _, diag := range r.Diagnostics {
+		if _, ok := diag.(*TerraspecDiagnostic); !ok && diag.Severity() == tfdiags.Error {
+			errs = errs.Append(diag)
+		}
+	}
+	return errs
+}
+
+// newCaseResult builds the result of a test case from its diagnostics
+func newCaseResult(tc *TestCase, out caseOutput, diags tfdiags.Diagnostics, duration time.Duration) *CaseResult {
+	result := &CaseResult{Name: tc.Name(), Dir: tc.Dir, Plan: out.rendered, PlanJSON: out.json, Diagnostics: diags, Duration: duration, Timings: &out.timings}
+	for _, diag := range diags {
+		d, ok := diag.(*TerraspecDiagnostic)
+		if !ok {
+			continue
+		}
+		assertion := &Assertion{Passed: d.Severity() == Info, Message: d.Description().Detail, Mismatch: d.Mismatch, FailureMessage: d.FailureMessage, Range: d.Subject}
+		if path := tfdiags.GetAttribute(d.Diagnostic); path != nil {
+			assertion.Path = FormatPath(path)
+		}
+		result.Assertions = append(result.Assertions, assertion)
+	}
+	result.Skipped = countSkipped(out.blocks, result.Assertions) + out.skipped
+	if result.ExpectedFailure = out.expectedFailure; result.ExpectedFailure != "" && !diags.HasErrors() {
+		result.Diagnostics = result.Diagnostics.Append(tfdiags.Sourceless(tfdiags.Error, "Unexpected pass",
+			fmt.Sprintf("The test case is expected to fail (%s), but all its assertions passed. Remove expect_failure from its terraspec block once the bug is fixed.", result.ExpectedFailure)))
+	}
+	if out.json != nil {
+		coverage, err := PlanCoverage(out.json, diags)
+		if err != nil {
+			result.Diagnostics = result.Diagnostics.Append(tfdiags.Sourceless(tfdiags.Warning, "Could not compute coverage", err.Error()))
+		}
+		result.Coverage = coverage
+	}
+	return result
+}
+
+// countSkipped returns the number of blocks no assertion is located at
+func countSkipped(blocks []hcl.Range, assertions []*Assertion) int {
+	located := make(map[hcl.Range]bool, len(assertions))
+	for _, assertion := range assertions {
+		if assertion.Range != nil {
+			located[*assertion.Range] = true
+		}
+	}
+	skipped := 0
+	for _, block := range blocks {
+		if !located[block] {
+			skipped++
+		}
+	}
+	return skipped
+}
+
+// Results is the outcome of a test suite run
+type Results struct {
+	// Cases holds the result of every test case, in the order they completed
+	Cases    []*CaseResult
+	Duration time.Duration
+	// Started is the time the run started
+	Started time.Time
+	// ClaimedVersion is the terraform version claimed instead of the embedded one, if the claim was needed
+	ClaimedVersion *goversion.Version
+	// WarmUp is the time spent starting the provider plugins before the test cases, when Options.WarmUp is set. It's part of Duration
+	WarmUp time.Duration
+	// CoverageShortfalls are the parts of the planned resources checked less than Options.MinCoverage requires
+	CoverageShortfalls []*CoverageShortfall
+}
+
+// Failed tells if any test case failed, or if the test cases check too few planned resources, see Options.MinCoverage
+func (r *Results) Failed() bool {
+	_, failed := r.Count()
+	return failed > 0 || len(r.CoverageShortfalls) > 0
+}
+
+// Count returns the number of test cases that succeeded and failed, skipped ones excepted
+func (r *Results) Count() (success, failed int) {
+	for _, c := range r.Cases {
+		if c.SkipReason != "" {
+			continue
+		}
+		if c.Failed() {
+			failed++
+		} else {
+			success++
+		}
+	}
+	return success, failed
+}
+
+// AssertionCount returns the number of assertions evaluated by all the test cases, and the number of assert and reject blocks skipped
+func (r *Results) AssertionCount() (evaluated, skipped int) {
+	for _, c := range r.Cases {
+		evaluated += len(c.Assertions)
+		skipped += c.Skipped
+	}
+	return evaluated, skipped
+}
+
+// Timings returns the time spent in every phase by all the test cases, cached ones excepted
+func (r *Results) Timings() *Timings {
+	total := &Timings{}
+	for _, c := range r.Cases {
+		if c.Timings != nil {
+			total.add(c.Timings)
+		}
+	}
+	return total
+}
+
+// Coverage merges the coverage of the test cases : a planned resource, or one of its attributes, is covered when a test case checks it.
+// The test cases whose plan could not be computed are left out
+func (r *Results) Coverage() *Coverage {
+	var coverages []*Coverage
+	for _, c := range r.Cases {
+		if c.Coverage != nil {
+			coverages = append(coverages, c.Coverage)
+		}
+	}
+	return mergeCoverage(coverages)
+}
+
+// UncoveredResources returns the addresses of the resources planned by the test cases that none of them checks, sorted.
+// The test cases whose plan could not be computed are left out
+func (r *Results) UncoveredResources() []string {
+	covered := make(map[string]bool)
+	for _, c := range r.Cases {
+		if c.Coverage == nil {
+			continue
+		}
+		for _, res := range c.Coverage.Resources {
+			covered[res.Address] = covered[res.Address] || res.Covered
+		}
+	}
+	var uncovered []string
+	for addr, ok := range covered {
+		if !ok {
+			uncovered = append(uncovered, addr)
+		}
+	}
+	sort.Strings(uncovered)
+	return uncovered
+}
+
+// MemStats returns the highest memory used when a test case completed, and the provider plugins any test case didn't close.
+// It's nil when no test case reported its memory, see Options.MemStats
+func (r *Results) MemStats() *MemStats {
+	var total *MemStats
+	unclosed := make(map[string]bool)
+	for _, c := range r.Cases {
+		if c.MemStats == nil {
+			continue
+		}
+		if total == nil {
+			total = &MemStats{}
+		}
+		if c.MemStats.PeakRSS > total.PeakRSS {
+			total.PeakRSS = c.MemStats.PeakRSS
+		}
+		if c.MemStats.Heap > total.Heap {
+			total.Heap = c.MemStats.Heap
+		}
+		for _, name := range c.MemStats.UnclosedPlugins {
+			if !unclosed[name] {
+				unclosed[name] = true
+				total.UnclosedPlugins = append(total.UnclosedPlugins, name)
+			}
+		}
+	}
+	if total != nil {
+		sort.Strings(total.UnclosedPlugins)
+	}
+	return total
+}
+
+// CachedCount returns the number of test cases whose result was read from the cache
+func (r *Results) CachedCount() int {
+	var cached int
+	for _, c := range r.Cases {
+		if c.Cached {
+			cached++
+		}
+	}
+	return cached
+}
+
+// SkippedCount returns the number of test cases that were skipped
+func (r *Results) SkippedCount() int {
+	var skipped int
+	for _, c := range r.Cases {
+		if c.SkipReason != "" {
+			skipped++
+		}
+	}
+	return skipped
+}
+
+// Append adds the results of other, a run following r, eg against another config, so both runs are reported at once.
+// The names of the test cases of other are prefixed with name, so they're not mistaken for the test cases of r
+func (r *Results) Append(name string, other *Results) {
+	for _, c := range other.Cases {
+		c.Name = path.Join(name, c.Name)
+		r.Cases = append(r.Cases, c)
+	}
+	if r.Started.IsZero() {
+		r.Started = other.Started
+	}
+	r.Duration += other.Duration
+	r.WarmUp += other.WarmUp
+	if r.ClaimedVersion == nil {
+		r.ClaimedVersion = other.ClaimedVersion
+	}
+	r.CoverageShortfalls = append(r.CoverageShortfalls, other.CoverageShortfalls...)
+}
+
+// Runner runs the test suite of terraform configs
+type Runner struct{}
+
+// NewRunner creates a Runner
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+// RunSuite runs all the test cases of a terraform config with a new Runner
+func RunSuite(ctx context.Context, opts Options) (*Results, error) {
+	return NewRunner().RunSuite(ctx, opts)
+}
+
+// ValidateSuite checks the config and the spec files of a terraform config with a new Runner
+func ValidateSuite(ctx context.Context, opts Options) (*Results, error) {
+	return NewRunner().ValidateSuite(ctx, opts)
+}
+
+// ListTestCases returns the test cases found in the spec folder of the config described by opts
+func ListTestCases(opts Options) ([]*TestCase, error) {
+	opts.setDefaults()
+	return opts.Discovery.Discover(opts.specPath())
+}
+
+func (o *Options) setDefaults() {
+	if o.Dir == "" {
+		o.Dir = "."
+	}
+	if o.SpecDir == "" {
+		o.SpecDir = "spec"
+	}
+	if o.Discovery == nil {
+		o.Discovery = DirectoryDiscovery{}
+	}
+	if o.MemoryPerCase <= 0 {
+		o.MemoryPerCase = DefaultMemoryPerCase
+	}
+}
+
+// specPath returns the path of the spec folder
+func (o *Options) specPath() string {
+	if filepath.IsAbs(o.SpecDir) {
+		return o.SpecDir
+	}
+	return filepath.Join(o.Dir, o.SpecDir)
+}
+
+// skipReason returns why tc must not be run : its name is one of skip, or its terraspec block sets skip.
+// It returns an empty string when the test case runs. A spec that can't be read is run, so its errors are reported
+func skipReason(tc *TestCase, skip []string) string {
+	for _, name := range skip {
+		if name == tc.Name() {
+			return "skipped by name"
+		}
+	}
+	config, diags := ReadTerraspecConfig(tc.SpecFile)
+	if diags.HasErrors() {
+		return ""
+	}
+	return config.Skip
+}
+
+// caseFunc runs a single test case against the config found in dir. The temporary folders it needs are created with artifacts.
+// It returns the plan of the test case, and its diagnostics
+type caseFunc func(ctx context.Context, dir string, tc *TestCase, tsCtx *Context, display planDisplay, artifacts *caseArtifacts) (caseOutput, tfdiags.Diagnostics)
+
+// recoveredPanic is a panic recovered with the stack trace of the goroutine it happened in, to be raised again in another goroutine
+type recoveredPanic struct {
+	value interface{}
+	stack []byte
+}
+
+// recoverPanic turns the panic r, recovered in the current goroutine, into a recoveredPanic
+func recoverPanic(r interface{}) recoveredPanic {
+	if p, ok := r.(recoveredPanic); ok {
+		return p
+	}
+	return recoveredPanic{value: r, stack: debug.Stack()}
+}
+
+// isolated returns run reporting a panic of the test case as an error with its stack trace, so it doesn't crash the whole suite
+// and the results of the other test cases are kept. Only the panics of the goroutine of the test case, and of the assertions
+// checked concurrently, are recovered
+func isolated(run caseFunc) caseFunc {
+	return func(ctx context.Context, dir string, tc *TestCase, tsCtx *Context, display planDisplay, artifacts *caseArtifacts) (out caseOutput, diags tfdiags.Diagnostics) {
+		defer func() {
+			if r := recover(); r != nil {
+				p := recoverPanic(r)
+				diags = diags.Append(tfdiags.Sourceless(tfdiags.Error, "Test case panicked", fmt.Sprintf("%v\n\n%s", p.value, p.stack)))
+			}
+		}()
+		return run(ctx, dir, tc, tsCtx, display, artifacts)
+	}
+}
+
+// planDisplay tells which test cases render their plan
+type planDisplay int
+
+const (
+	displayNone planDisplay = iota
+	displayAll
+	displayFailed
+)
+
+// planDisplay returns which test cases render their plan
+func (o *Options) planDisplay() planDisplay {
+	switch {
+	case o.DisplayPlan:
+		return displayAll
+	case o.DisplayPlanOnFailure:
+		return displayFailed
+	}
+	return displayNone
+}
+
+// caseOutput is the plan computed by a test case
+type caseOutput struct {
+	// rendered is the rendered plan, only set when the plan display asks for it
+	rendered string
+	// json is the plan in the JSON format of terraform show -json
+	json []byte
+	// timings is the time spent in every phase of the test case
+	timings Timings
+	// unclosedPlugins are the provider plugins the test case started and didn't close
+	unclosedPlugins []string
+	// blocks are the header ranges of the assert and reject blocks of the spec, once it's parsed
+	blocks []hcl.Range
+	// expectedFailure is the reason the assertions of the spec are expected to fail, once it's parsed
+	expectedFailure string
+	// skipped is the number of assert and reject blocks skipped by a test case whose blocks are not known, eg run in a container
+	skipped int
+}
+
+// RunSuite runs all the test cases found in the spec folder of the config in parallel.
+// The returned error is only set when the suite could not run at all. Failed assertions are reported in the Results
+func (r *Runner) RunSuite(ctx context.Context, opts Options) (*Results, error) {
+	return r.runCases(ctx, opts, runTestCase)
+}
+
+// ValidateSuite checks the config and the spec file of all the test cases found in the spec folder, without computing any plan.
+// The returned error is only set when the suite could not run at all. Invalid configs or spec files are reported in the Results
+func (r *Runner) ValidateSuite(ctx context.Context, opts Options) (*Results, error) {
+	// validation results are never cached
+	opts.CacheDir = ""
+	return r.runCases(ctx, opts, validateTestCase)
+}
+
+// runCases calls run for all the test cases found in the spec folder of the config in parallel
+func (r *Runner) runCases(ctx context.Context, opts Options, run caseFunc) (*Results, error) {
+	opts.setDefaults()
+	if opts.MinCoverage < 0 || opts.MinCoverage > 1 {
+		return nil, fmt.Errorf("Invalid minimum coverage %v : expected a fraction between 0 and 1", opts.MinCoverage)
+	}
+	if opts.ChangedSince != "" && opts.ChangedOnly {
+		return nil, fmt.Errorf("Invalid options : ChangedSince and ChangedOnly can't both be set")
+	}
+	if !artifactRetentions[opts.KeepArtifacts] {
+		return nil, fmt.Errorf("Invalid artifacts retention %q : expected %s, %s or %s", opts.KeepArtifacts, KeepArtifactsNever, KeepArtifactsOnFailure, KeepArtifactsAlways)
+	}
+
+	if opts.SpecSource != "" {
+		specDir, tmp, err := fetchSpecSource(ctx, opts.SpecSource, opts.Dir)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		opts.SpecDir = specDir
+	}
+
+	var claimedVersion *goversion.Version
+	if opts.ClaimVersion != "" {
+		var err error
+		claimedVersion, err = goversion.NewSemver(opts.ClaimVersion)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid terraform version to claim : %v", err)
+		}
+	}
+	defer claimVersion(claimedVersion)()
+	tsCtx := &Context{TerraformVersion: terraformVersion, UserVersion: claimedVersion, ModuleMode: opts.ModuleMode, Isolate: opts.Isolate, PluginDirs: opts.PluginDirs, LogOutput: opts.LogOutput, ShowSensitive: opts.ShowSensitive, BaseVariableFile: opts.BaseVariableFile, TflintBin: opts.TflintBin, CheckovBin: opts.CheckovBin, PlanFile: opts.PlanFile, DockerImage: opts.DockerImage, DockerBin: opts.DockerBin, TerraformBin: opts.TerraformBin}
+	// the CPUs left by the test cases run at the same time check the asserts of their specs
+	parallelism := opts.parallelism()
+	tsCtx.AssertWorkers = assertWorkers(runtime.NumCPU(), parallelism)
+	if opts.SchemaCacheDir != "" {
+		tsCtx.SchemaCache = NewSchemaCache(opts.SchemaCacheDir)
+	}
+
+	var err error
+	affected := func(*TestCase) bool { return true }
+	if opts.ChangedSince != "" || opts.ChangedOnly {
+		if affected, err = changedFilter(opts); err != nil {
+			return nil, err
+		}
+	}
+	var cache *resultCache
+	if opts.CacheDir != "" {
+		if cache, err = newResultCache(opts.CacheDir, opts); err != nil {
+			return nil, fmt.Errorf("Could not hash the inputs of the test cases : %v", err)
+		}
+	}
+
+	logOutput, err := terraformLogOutput(opts.LogOutput)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open terraform log file : %v", err)
+	}
+	defer terraformLogs.route(logOutput)()
+	// the plugin processes are shared by all the test cases
+	defer tsCtx.plugins.close()
+
+	results := &Results{}
+	reports := make(chan *CaseResult)
+
+	// Start measuring execution time of test suites
+	var startTime = time.Now()
+	results.Started = startTime
+	if opts.WarmUp {
+		results.WarmUp = warmUp(opts.Dir, tsCtx)
+	}
+	run = isolated(run)
+	// a bounded number of workers run the test cases as soon as they're found, so large suites don't exhaust the memory of the machine
+	specDir := opts.specPath()
+	cases := make(chan *TestCase)
+	var discovered, scheduled int
+	var discoverErr error
+	go func() {
+		defer close(cases)
+		discoverErr = discoverEach(opts.Discovery, specDir, func(tc *TestCase) error {
+			discovered++
+			if affected(tc) {
+				scheduled++
+				cases <- tc
+			}
+			return nil
+		})
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tc := range cases {
+				if err := ctx.Err(); err != nil {
+					reports <- newCaseResult(tc, caseOutput{}, tfdiags.Diagnostics{}.Append(err), 0)
+					continue
+				}
+				if reason := skipReason(tc, opts.Skip); reason != "" {
+					reports <- &CaseResult{Name: tc.Name(), Dir: tc.Dir, SkipReason: reason}
+					continue
+				}
+				if cached, ok := cache.get(tc); ok {
+					reports <- cached
+					continue
+				}
+				caseStart := time.Now()
+				artifacts := &caseArtifacts{parent: opts.ArtifactsDir, name: tc.Name()}
+				out, diags := run(ctx, opts.Dir, tc, tsCtx, opts.planDisplay(), artifacts)
+				if opts.Strict {
+					diags = strictDiags(diags)
+				}
+				result := newCaseResult(tc, out, diags, time.Since(caseStart))
+				result.Started = caseStart
+				result.Artifacts = artifacts.release(opts.KeepArtifacts, result.Failed())
+				if opts.MemStats {
+					result.MemStats = readMemStats()
+					result.MemStats.UnclosedPlugins = out.unclosedPlugins
+				}
+				cache.put(tc, result)
+				reports <- result
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(reports)
+	}()
+
+	for report := range reports {
+		results.Cases = append(results.Cases, report)
+		if opts.OnCaseResult != nil {
+			opts.OnCaseResult(report)
+		}
+		if opts.ReleasePlans {
+			report.Plan, report.PlanJSON = "", nil
+		}
+	}
+	// the workers are done once the discovery completed
+	if discoverErr != nil {
+		return nil, fmt.Errorf("Could not find the test cases of %s directory : %v", specDir, discoverErr)
+	}
+	if discovered == 0 {
+		return nil, fmt.Errorf("No test case found in %s directory", specDir)
+	}
+	if scheduled == 0 {
+		return &Results{}, nil
+	}
+	// End measuring execution time of test suites onces they all finished
+	results.Duration = time.Since(startTime)
+	if opts.MinCoverage > 0 {
+		results.CoverageShortfalls = results.Coverage().shortfalls(opts.MinCoverage)
+	}
+	if version.SemVer != terraformVersion {
+		results.ClaimedVersion = tsCtx.UserVersion
+	}
+	return results, nil
+}
+
+// terraformLogOutput returns the writer terraform logs go to : w, filtered by the TF_LOG level if set,
+// or the destination told by TF_LOG and TF_LOG_PATH when w is nil
+func terraformLogOutput(w io.Writer) (io.Writer, error) {
+	if w == nil {
+		out, err := logging.LogOutput()
+		if err != nil {
+			return nil, err
+		}
+		if out == nil {
+			out = ioutil.Discard
+		}
+		return out, nil
+	}
+	if level := logging.CurrentLogLevel(); level != "" && level != "TRACE" {
+		return &logging.LevelFilter{Levels: logging.ValidLevels, MinLevel: logging.LogLevel(level), Writer: w}, nil
+	}
+	return w, nil
+}
+
+// validateTestCase checks the config and the spec file of a test case, without computing any plan
+func validateTestCase(ctx context.Context, dir string, tc *TestCase, tsCtx *Context, display planDisplay, artifacts *caseArtifacts) (caseOutput, tfdiags.Diagnostics) {
+	configDir := dir
+	if tsCtx.ModuleMode {
+		harness, diags := artifacts.harness(dir)
+		if diags.HasErrors() {
+			return caseOutput{}, diags
+		}
+		configDir = harness.Dir
+	}
+
+	var out caseOutput
+	_, _, diags := prepareTestSuite(ctx, dir, configDir, tc, tsCtx, &out.timings, nil)
+	return out, diags
+}
+
+// runTestCase runs a single test case against the config found in dir.
+// It returns the plan of the test case, and its diagnostics
+func runTestCase(ctx context.Context, dir string, tc *TestCase, tsCtx *Context, display planDisplay, artifacts *caseArtifacts) (caseOutput, tfdiags.Diagnostics) {
+	if tsCtx.DockerImage != "" {
+		return runInContainer(ctx, dir, tc, tsCtx, display)
+	}
+	var out caseOutput
+
+	configDir := dir
+	if tsCtx.Isolate {
+		workdir, err := artifacts.workdir(dir)
+		if err != nil {
+			var diags tfdiags.Diagnostics
+			return out, diags.Append(fmt.Errorf("Could not copy %s for the test case : %v", dir, err))
+		}
+		configDir = workdir.Dir
+		tc = workdir.TestCase(tc)
+	}
+	if tsCtx.ModuleMode {
+		harness, diags := artifacts.harness(configDir)
+		if diags.HasErrors() {
+			return out, diags
+		}
+		configDir = harness.Dir
+	}
+	if tsCtx.TerraformBin != "" {
+		return runWithTerraform(ctx, configDir, tc, tsCtx, display)
+	}
+
+	var timings Timings
+	var opened openedProviders
+	tfCtx, spec, ctxDiags := prepareTestSuite(ctx, dir, configDir, tc, tsCtx, &timings, &opened)
+	if ctxDiags.HasErrors() {
+		return caseOutput{timings: timings, unclosedPlugins: opened.unclosed()}, ctxDiags
+	}
+
+	hookDiags := spec.RunBeforeHooks(ctx)
+	if !hookDiags.HasErrors() {
+		var checkDiags tfdiags.Diagnostics
+		if planFile := spec.planFile(tc, tsCtx); planFile != "" {
+			out, checkDiags = checkPlanFile(ctx, tfCtx, spec, planFile, display)
+		} else {
+			out, checkDiags = checkTestCase(ctx, tfCtx, spec, display)
+		}
+		ctxDiags = ctxDiags.Append(checkDiags)
+		// the lint and scan blocks run external tools, their time is part of the validation
+		checksStart := time.Now()
+		ctxDiags = ctxDiags.Append(spec.RunLints(ctx, tsCtx.TflintBin, configDir, []string{tsCtx.BaseVariableFile, tc.VariableFile}))
+		if out.json != nil {
+			ctxDiags = ctxDiags.Append(spec.RunScans(ctx, tsCtx.CheckovBin, out.json))
+		}
+		out.timings.Validate += time.Since(checksStart)
+	}
+	out.timings.add(&timings)
+	out.blocks = spec.blockRanges()
+	out.expectedFailure = spec.Terraspec.ExpectFailure
+	hookDiags = hookDiags.Append(spec.RunAfterHooks())
+	out.unclosedPlugins = opened.unclosed()
+	return out, ctxDiags.Append(hookDiags)
+}
+
+// checkTestCase computes the plan of tfCtx and checks the assertions of spec against it.
+// It returns the plan, rendered when display asks for it, and the diagnostics of the test case
+func checkTestCase(ctx context.Context, tfCtx *terraform.Context, spec *Spec, display planDisplay) (caseOutput, tfdiags.Diagnostics) {
+	var out caseOutput
+
+	var refreshedState *states.State
+	var ctxDiags tfdiags.Diagnostics
+	if refreshNeeded(tfCtx.Config(), spec.Terraspec.PlanMode) {
+		//Refresh is required to have datasources read
+		refreshStart := time.Now()
+		refreshedState, ctxDiags = Refresh(ctx, tfCtx)
+		out.timings.Refresh = time.Since(refreshStart)
+		ctxDiags = ExplainUnknownExpansion(ctxDiags, tfCtx.Config())
+	} else {
+		// resources are never read from the cloud provider, so the refresh would leave the prior state unchanged
+		refreshedState = tfCtx.State()
+	}
+	failedValidations, ctxDiags := FailedValidations(ctxDiags, tfCtx.Config())
+	variableDiags := spec.ValidateVariables(failedValidations)
+	if len(failedValidations) > 0 {
+		// no plan can be computed when variables are invalid
+		return out, ctxDiags.Append(variableDiags)
+	}
+	ctxDiags = ctxDiags.Append(spec.ValidateMocks())
+	if ctxDiags.HasErrors() {
+		return out, ctxDiags
+	}
+
+	// Finally, compute the terraform plan
+	var plan *plans.Plan
+	var planDiags tfdiags.Diagnostics
+	planStart := time.Now()
+	if spec.Terraspec.PlanMode == PlanModeRefreshOnly {
+		plan, planDiags = RefreshOnlyPlan(refreshedState, tfCtx.Schemas())
+	} else {
+		plan, planDiags = Plan(ctx, tfCtx)
+		planDiags = ExplainUnknownExpansion(planDiags, tfCtx.Config())
+	}
+	out.timings.Plan = time.Since(planStart)
+	// variables are validated by the plan when the refresh was skipped
+	if failedValidations, planDiags = FailedValidations(planDiags, tfCtx.Config()); len(failedValidations) > 0 {
+		return out, ctxDiags.Append(spec.ValidateVariables(failedValidations))
+	}
+	ctxDiags = ctxDiags.Append(planDiags)
+	if ctxDiags.HasErrors() {
+		return out, ctxDiags
+	}
+
+	if display == displayAll {
+		out.rendered = renderPlan(tfCtx, plan)
+	}
+
+	planJSON, err := MarshalPlan(tfCtx, plan, refreshedState)
+	if err != nil {
+		return out, ctxDiags.Append(fmt.Errorf("Could not convert the plan to JSON : %v", err))
+	}
+	out.json = planJSON
+	validateStart := time.Now()
+	ctxDiags = ctxDiags.Append(validatePlan(ctx, spec, plan, planJSON, variableDiags))
+	out.timings.Validate = time.Since(validateStart)
+	if display == displayFailed && ctxDiags.HasErrors() {
+		out.rendered = renderPlan(tfCtx, plan)
+	}
+	return out, ctxDiags
+}
+
+// renderPlan renders the plan as terraform plan prints it
+func renderPlan(tfCtx *terraform.Context, plan *plans.Plan) string {
+	var stdout = &strings.Builder{}
+	ui := &cli.BasicUi{
+		Reader:      os.Stdin,
+		Writer:      stdout,
+		ErrorWriter: stdout,
+	}
+	local.RenderPlan(plan, nil, nil, tfCtx.Schemas(), ui, &colorstring.Colorize{Colors: colorstring.DefaultColors})
+	return stdout.String()
+}
+
+// validatePlan checks the assertions and the policies of spec against the plan.
+// variableDiags are the results of the assertions on variables, reported along with the other assertions
+func validatePlan(ctx context.Context, spec *Spec, plan *plans.Plan, planJSON []byte, variableDiags tfdiags.Diagnostics) tfdiags.Diagnostics {
+	diags := tfdiags.Diagnostics{}.Append(spec.BindPlan(planJSON))
+	diags = diags.Append(spec.readPlannedMoves(planJSON))
+	diags = diags.Append(spec.readPlannedImports(planJSON))
+	if diags.HasErrors() {
+		return diags
+	}
+
+	validateDiags, err := spec.Validate(ctx, plan)
+	diags = diags.Append(variableDiags)
+	diags = diags.Append(validateDiags)
+	if err != nil {
+		diags = diags.Append(err)
+	}
+	if len(spec.Terraspec.Policies) > 0 {
+		diags = diags.Append(checkPolicies(ctx, planJSON, spec.Terraspec.Policies))
+	}
+	return diags
+}
+
+// refreshNeeded tells if the refresh must run before the plan. Resources are never read from the cloud provider,
+// so the refresh only matters to read the data sources of the config, and to build the plan of the refresh-only mode.
+// Data sources are read by the refresh even when they're all mocked, as terraform would otherwise read them during the plan
+// and report them as changes
+func refreshNeeded(cfg *configs.Config, mode string) bool {
+	if mode == PlanModeRefreshOnly {
+		return true
+	}
+	needed := false
+	cfg.DeepEach(func(c *configs.Config) {
+		if len(c.Module.DataResources) > 0 {
+			needed = true
+		}
+	})
+	return needed
+}
+
+// checkPolicies evaluates the given rego policies against the JSON representation of the plan
+func checkPolicies(ctx context.Context, planJSON []byte, policies []string) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	policyDiags, err := CheckPolicies(ctx, policies, planJSON)
+	if err != nil {
+		return diags.Append(err)
+	}
+	return diags.Append(policyDiags)
+}
+
+// PrepareTestSuite builds the terraform.Context that can compute the plan of the config found in configDir,
+// using the providers initialized in dir, and parses the spec file containing all assertions.
+// Returned diagnostics may contain errors
+func PrepareTestSuite(ctx context.Context, dir, configDir string, tc *TestCase, tsCtx *Context) (*terraform.Context, *Spec, tfdiags.Diagnostics) {
+	return prepareTestSuite(ctx, dir, configDir, tc, tsCtx, nil, nil)
+}
+
+// prepareTestSuite is PrepareTestSuite recording the time spent loading the config and getting the schemas of the providers in timings,
+// and the providers instantiated in opened, when not nil
+func prepareTestSuite(ctx context.Context, dir, configDir string, tc *TestCase, tsCtx *Context, timings *Timings, opened *openedProviders) (*terraform.Context, *Spec, tfdiags.Diagnostics) {
+	var ctxDiags tfdiags.Diagnostics
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		ctxDiags = ctxDiags.Append(err)
+		return nil, nil, ctxDiags
+
+	}
+	providerResolver, err := BuildProviderResolver(absDir, tsCtx.PluginDirs...)
+	if err != nil {
+		ctxDiags = ctxDiags.Append(err)
+		return nil, nil, ctxDiags
+	}
+	ctxDiags = ctxDiags.Append(providerResolver.Diagnostics)
+	providerResolver.LogOutput = tsCtx.LogOutput
+	providerResolver.SchemaCache = tsCtx.SchemaCache
+	providerResolver.plugins = &tsCtx.plugins
+	providerResolver.opened = opened
+
+	// provider versions must be selected before schemas are loaded
+	tsConfig, diags := ReadTerraspecConfig(tc.SpecFile)
+	ctxDiags = ctxDiags.Append(diags)
+	if ctxDiags.HasErrors() {
+		return nil, nil, ctxDiags
+	}
+	if err = providerResolver.Constrain(tsConfig.ProviderVersions); err != nil {
+		ctxDiags = ctxDiags.Append(err)
+		return nil, nil, ctxDiags
+	}
+
+	// first we create a context to retrieve schemas for the providers, we need them to parse the spec file
+	tfCtxSchemas, diags := NewContext(configDir, tc.VariableFile, providerResolver, tsCtx, &NewContextOptions{Context: ctx, Workspace: "default", Timings: timings})
+	ctxDiags = ctxDiags.Append(diags)
+	if ctxDiags.HasErrors() {
+		return nil, nil, ctxDiags
+	}
+
+	// Parse specs may return mocked data source result
+	spec, diags := ReadSpec(tc.SpecFile, tfCtxSchemas.Schemas())
+	ctxDiags = ctxDiags.Append(diags)
+	if ctxDiags.HasErrors() {
+		return nil, nil, ctxDiags
+	}
+	spec.ShowSensitive = tsCtx.ShowSensitive
+	spec.AssertWorkers = tsCtx.AssertWorkers
+
+	ctxOpts := &NewContextOptions{Context: ctx, Workspace: spec.Terraspec.Workspace, Destroy: spec.Terraspec.Destroy(), Targets: spec.Terraspec.Targets, CountOverrides: spec.CountMocks, Timings: timings}
+	if priorStates := countPriorStates(spec); priorStates > 1 {
+		ctxDiags = ctxDiags.Append(fmt.Errorf("Only one of remote_state, state_file and state blocks can be used to set the prior state"))
+		return nil, nil, ctxDiags
+	}
+	if len(spec.State) > 0 {
+		state, diags := BuildState(spec.State, tfCtxSchemas.Config(), tfCtxSchemas.Schemas())
+		ctxDiags = ctxDiags.Append(diags)
+		if ctxDiags.HasErrors() {
+			return nil, nil, ctxDiags
+		}
+		ctxOpts.State = state
+	}
+	if spec.Terraspec.StateFile != "" {
+		state, err := ReadStateFile(spec.Terraspec.StateFile)
+		if err != nil {
+			ctxDiags = ctxDiags.Append(err)
+			return nil, nil, ctxDiags
+		}
+		ctxOpts.State = state
+	}
+	if spec.Terraspec.RemoteState != nil {
+		state, err := FetchRemoteState(ctx, spec.Terraspec.RemoteState)
+		if err != nil {
+			ctxDiags = ctxDiags.Append(err)
+			return nil, nil, ctxDiags
+		}
+		ctxOpts.State = state
+	}
+
+	// this is the actual tf context we use for testing
+	tfCtx, diags := NewContext(configDir, tc.VariableFile, providerResolver, tsCtx, ctxOpts) // Setting a different folder works to parse configuration but not the modules :/
+	ctxDiags = ctxDiags.Append(diags)
+	if ctxDiags.HasErrors() {
+		return nil, nil, ctxDiags
+	}
+
+	//If spec contains mocked data source results, they must be provided to the DataSourceReader
+	if len(spec.Mocks) > 0 {
+		providerResolver.DataSourceReader.SetMock(spec.Mocks)
+	}
+	spec.DataSourceReader = providerResolver.DataSourceReader
+	spec.Config = tfCtx.Config()
+	return tfCtx, spec, ctxDiags
+}
+
+// countPriorStates returns how many sources of prior state the spec uses
+func countPriorStates(spec *Spec) int {
+	count := 0
+	if spec.Terraspec.RemoteState != nil {
+		count++
+	}
+	if spec.Terraspec.StateFile != "" {
+		count++
+	}
+	if len(spec.State) > 0 {
+		count++
+	}
+	return count
+}
+
+// FindTestCases returns the test cases found in rootDir and its direct subfolders.
+// A test case is a folder containing a .tfspec file and optionally a .tfvars file.
+// Subfolders whose name starts with an underscore, eg _shared, hold the spec files imported by the test cases and are not test cases
+func FindTestCases(rootDir string) []*TestCase {
+	testCases := make([]*TestCase, 0)
+	if err := eachTestCase(rootDir, func(tc *TestCase) error {
+		testCases = append(testCases, tc)
+		return nil
+	}); err != nil {
+		return nil
+	}
+	return testCases
+}
+
+// eachTestCase calls found with every test case of rootDir and its direct subfolders, as soon as it's found.
+// It stops at the first error returned by found
+func eachTestCase(rootDir string, found func(*TestCase) error) error {
+	rootFis, err := ioutil.ReadDir(rootDir)
+	if err != nil {
+		return err
+	}
+
+	for _, rootFi := range rootFis {
+		if !rootFi.IsDir() || strings.HasPrefix(rootFi.Name(), "_") {
+			continue
+		}
+		if testCase := findCase(filepath.Join(rootDir, rootFi.Name())); testCase != nil {
+			if err := found(testCase); err != nil {
+				return err
+			}
+		}
+	}
+	if testCase := findCase(rootDir); testCase != nil {
+		return found(testCase)
+	}
+	return nil
+}
+
+func findCase(rootDir string) *TestCase {
+	fis, err := ioutil.ReadDir(rootDir)
+	if err != nil {
+		return nil
+	}
+	var varFile, specFile string
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+		if filepath.Ext(fi.Name()) == ".tfvars" {
+			varFile = filepath.Join(rootDir, fi.Name())
+		}
+		if filepath.Ext(fi.Name()) == ".tfspec" {
+			specFile = filepath.Join(rootDir, fi.Name())
+		}
+	}
+	if specFile != "" {
+		return &TestCase{Dir: rootDir, VariableFile: varFile, SpecFile: specFile}
+	}
+	return nil
+}
@@ -0,0 +1,474 @@
+package terraspec
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/hashicorp/terraform/version"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestFindTestCases(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-cases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeFiles(t, root, map[string]string{
+		"with_vars/case.tfspec":    "",
+		"with_vars/case.tfvars":    "",
+		"without_vars/case.tfspec": "",
+		"not_a_case/case.tfvars":   "",
+		"_shared/tags.tfspec":      "",
+	})
+
+	cases := FindTestCases(root)
+	if nb := len(cases); nb != 2 {
+		t.Fatalf("expected 2 test cases, got %d", nb)
+	}
+	expected := []*TestCase{
+		{Dir: filepath.Join(root, "with_vars"), SpecFile: filepath.Join(root, "with_vars/case.tfspec"), VariableFile: filepath.Join(root, "with_vars/case.tfvars")},
+		{Dir: filepath.Join(root, "without_vars"), SpecFile: filepath.Join(root, "without_vars/case.tfspec")},
+	}
+	for i, tc := range cases {
+		if *tc != *expected[i] {
+			t.Errorf("test case %d should be %+v, got %+v", i, expected[i], tc)
+		}
+	}
+	if name := cases[0].Name(); name != "with_vars" {
+		t.Errorf("test case name should be with_vars, got %s", name)
+	}
+}
+
+func TestRunSuiteWithoutTestCase(t *testing.T) {
+	if _, err := NewRunner().RunSuite(context.Background(), Options{Dir: "testdata", SpecDir: "missing"}); err == nil {
+		t.Errorf("running a suite without test case should fail")
+	}
+}
+
+func TestCaseResultAssertions(t *testing.T) {
+	var diags tfdiags.Diagnostics
+	diags = diags.Append(SuccessDiags(cty.GetAttrPath("aws_instance").GetAttr("name").GetAttr("ami"), "ami-123"))
+	diags = diags.Append(AssertErrorDiags(cty.GetAttrPath("output").GetAttr("ip"), "10.0.0.1", "10.0.0.2"))
+	diags = diags.Append(errors.New("Could not find resource aws_instance.other in changes"))
+
+	result := newCaseResult(&TestCase{Dir: "spec/case"}, caseOutput{}, diags, time.Second)
+	if result.Name != "case" || result.Duration != time.Second {
+		t.Errorf("test case name and duration not as expected, got %s and %s", result.Name, result.Duration)
+	}
+	expected := []*Assertion{
+		{Path: "aws_instance.name.ami", Passed: true, Message: "ami-123"},
+		{Path: "output.ip", Passed: false, Message: "10.0.0.2 != 10.0.0.1"},
+	}
+	if nb := len(result.Assertions); nb != len(expected) {
+		t.Fatalf("expected %d assertions, got %d", len(expected), nb)
+	}
+	for i, assertion := range result.Assertions {
+		if *assertion != *expected[i] {
+			t.Errorf("assertion %d should be %+v, got %+v", i, expected[i], assertion)
+		}
+	}
+	if errs := result.Errors(); len(errs) != 1 {
+		t.Errorf("test case should have 1 error, got %v", errs)
+	}
+
+	results := &Results{Cases: []*CaseResult{result, newCaseResult(&TestCase{Dir: "ok"}, caseOutput{}, nil, 0)}}
+	if success, failed := results.Count(); success != 1 || failed != 1 || !results.Failed() {
+		t.Errorf("results should count 1 success and 1 failure, got %d and %d", success, failed)
+	}
+}
+
+func TestCaseResultSkipped(t *testing.T) {
+	checked := hcl.Range{Filename: "spec.tfspec", Start: hcl.Pos{Line: 1, Column: 1}, End: hcl.Pos{Line: 1, Column: 30}}
+	skipped := hcl.Range{Filename: "spec.tfspec", Start: hcl.Pos{Line: 5, Column: 1}, End: hcl.Pos{Line: 5, Column: 30}}
+	var diags tfdiags.Diagnostics
+	diags = diags.Append(locate(tfdiags.Diagnostics{}.Append(SuccessDiags(cty.GetAttrPath("aws_instance").GetAttr("name").GetAttr("ami"), "ami-123")), checked))
+
+	result := newCaseResult(&TestCase{Dir: "spec/case"}, caseOutput{blocks: []hcl.Range{checked, skipped}}, diags, 0)
+	if result.Skipped != 1 {
+		t.Errorf("1 block should be skipped, got %d", result.Skipped)
+	}
+	failed := newCaseResult(&TestCase{Dir: "spec/failed"}, caseOutput{blocks: []hcl.Range{checked, skipped}}, tfdiags.Diagnostics{}.Append(errors.New("plan failed")), 0)
+	results := &Results{Cases: []*CaseResult{result, failed}}
+	if evaluated, skipped := results.AssertionCount(); evaluated != 1 || skipped != 3 {
+		t.Errorf("results should count 1 assertion evaluated and 3 blocks skipped, got %d and %d", evaluated, skipped)
+	}
+}
+
+func TestCaseResultExpectedFailure(t *testing.T) {
+	passed := SuccessDiags(cty.GetAttrPath("output").GetAttr("ip"), "10.0.0.1")
+	failed := AssertErrorDiags(cty.GetAttrPath("output").GetAttr("ip"), "10.0.0.1", "10.0.0.2")
+	tests := map[string]struct {
+		diags            tfdiags.Diagnostics
+		failed           bool
+		failedAsExpected bool
+	}{
+		"Failed assertion": {diags: tfdiags.Diagnostics{}.Append(passed, failed), failedAsExpected: true},
+		"Unexpected pass":  {diags: tfdiags.Diagnostics{}.Append(passed), failed: true},
+		"Other error":      {diags: tfdiags.Diagnostics{}.Append(failed, errors.New("Could not compute the plan")), failed: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := newCaseResult(&TestCase{Dir: "spec/case"}, caseOutput{expectedFailure: "known bug"}, tt.diags, 0)
+			if result.Failed() != tt.failed || result.FailedAsExpected() != tt.failedAsExpected {
+				t.Errorf("failed should be %v and failed as expected %v, got %v and %v", tt.failed, tt.failedAsExpected, result.Failed(), result.FailedAsExpected())
+			}
+		})
+	}
+
+	result := newCaseResult(&TestCase{Dir: "spec/case"}, caseOutput{expectedFailure: "known bug"}, tfdiags.Diagnostics{}.Append(passed), 0)
+	if errs := result.Errors(); len(errs) != 1 || errs[0].Description().Summary != "Unexpected pass" {
+		t.Errorf("an unexpected pass should be reported, got %v", errs)
+	}
+}
+
+func TestCaseResultStrict(t *testing.T) {
+	passed := SuccessDiags(cty.GetAttrPath("output").GetAttr("ip"), "10.0.0.1")
+	deprecated := tfdiags.Sourceless(tfdiags.Warning, "Deprecated attribute", "The attribute is deprecated")
+	diags := tfdiags.Diagnostics{}.Append(passed, deprecated)
+
+	if result := newCaseResult(&TestCase{Dir: "spec/case"}, caseOutput{}, diags, 0); result.Failed() {
+		t.Errorf("warnings should not fail the test case, got %v", result.Diagnostics)
+	}
+	result := newCaseResult(&TestCase{Dir: "spec/case"}, caseOutput{}, strictDiags(diags), 0)
+	if !result.Failed() || len(result.Assertions) != 1 {
+		t.Errorf("warnings should fail the test case in strict mode, without changing the assertions, got %v", result.Diagnostics)
+	}
+	if errs := result.Errors(); len(errs) != 1 || errs[0].Description().Summary != "Deprecated attribute (warning treated as an error by strict mode)" {
+		t.Errorf("the warning should be reported as an error, got %v", errs)
+	}
+}
+
+func TestResultsAppend(t *testing.T) {
+	failed := AssertErrorDiags(cty.GetAttrPath("output").GetAttr("ip"), "10.0.0.1", "10.0.0.2")
+	start := time.Now()
+	results := &Results{}
+	results.Append("network", &Results{Cases: []*CaseResult{{Name: "default"}}, Started: start, Duration: time.Second})
+	results.Append("cluster", &Results{Cases: []*CaseResult{{Name: "default", Diagnostics: tfdiags.Diagnostics{}.Append(failed)}}, Started: start.Add(time.Second), Duration: 2 * time.Second})
+
+	if len(results.Cases) != 2 || results.Cases[0].Name != "network/default" || results.Cases[1].Name != "cluster/default" {
+		t.Fatalf("the test cases should be named after their run, got %+v", results.Cases)
+	}
+	if !results.Started.Equal(start) || results.Duration != 3*time.Second {
+		t.Errorf("the runs should start with the first one and last as long as all of them, got %s and %s", results.Started, results.Duration)
+	}
+	if success, failed := results.Count(); success != 1 || failed != 1 || !results.Failed() {
+		t.Errorf("the test cases of every run should be counted, got %d success and %d failed", success, failed)
+	}
+}
+
+func TestRunSuiteCallsOnCaseResult(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-suite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"spec/first/case.tfspec":  "",
+		"spec/second/case.tfspec": "",
+	})
+
+	var received []*CaseResult
+	results, err := RunSuite(context.Background(), Options{Dir: root, OnCaseResult: func(r *CaseResult) {
+		received = append(received, r)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nb := len(received); nb != 2 {
+		t.Fatalf("callback should receive 2 results, got %d", nb)
+	}
+	for i, r := range received {
+		if r != results.Cases[i] {
+			t.Errorf("callback should receive results in completion order")
+		}
+	}
+}
+
+func TestRunCasesRecoversPanics(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"spec/broken/case.tfspec":  "",
+		"spec/working/case.tfspec": "",
+	})
+
+	run := func(ctx context.Context, dir string, tc *TestCase, tsCtx *Context, display planDisplay, artifacts *caseArtifacts) (caseOutput, tfdiags.Diagnostics) {
+		if tc.Name() == "broken" {
+			var schemas map[string]int
+			schemas["crash"]++
+		}
+		return caseOutput{}, nil
+	}
+	results, err := NewRunner().runCases(context.Background(), Options{Dir: root}, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Cases) != 2 {
+		t.Fatalf("Expected the results of both test cases, got %d", len(results.Cases))
+	}
+	for _, c := range results.Cases {
+		if c.Failed() != (c.Name == "broken") {
+			t.Errorf("Only the panicking test case should fail, %s failed : %v", c.Name, c.Failed())
+		}
+		if c.Name != "broken" {
+			continue
+		}
+		detail := c.Errors()[0].Description().Detail
+		if !strings.Contains(detail, "assignment to entry in nil map") || !strings.Contains(detail, "TestRunCasesRecoversPanics") {
+			t.Errorf("The panic should be reported with its stack trace, got %s", detail)
+		}
+	}
+}
+
+func TestRunCasesRestoresClaimedVersion(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-claim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{"spec/case/case.tfspec": ""})
+
+	embedded := version.SemVer
+	// like workaroundVersionCheck when the config requires another version
+	run := func(ctx context.Context, dir string, tc *TestCase, tsCtx *Context, display planDisplay, artifacts *caseArtifacts) (caseOutput, tfdiags.Diagnostics) {
+		if tsCtx.UserVersion != nil {
+			version.SemVer = tsCtx.UserVersion
+		}
+		return caseOutput{}, nil
+	}
+	claimed, err := NewRunner().runCases(context.Background(), Options{Dir: root, ClaimVersion: "0.12.29"}, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed.ClaimedVersion == nil || claimed.ClaimedVersion.String() != "0.12.29" {
+		t.Errorf("The run should report the claimed version, got %v", claimed.ClaimedVersion)
+	}
+	if version.SemVer != embedded {
+		t.Errorf("The version of the embedded terraform should be restored after the run, got %s", version.SemVer)
+	}
+	next, err := NewRunner().runCases(context.Background(), Options{Dir: root}, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ClaimedVersion != nil {
+		t.Errorf("A later run should not claim the version of a previous run, got %s", next.ClaimedVersion)
+	}
+}
+
+func TestRunSuiteSkipsTestCases(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-skip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"spec/parked/case.tfspec": "terraspec {\n  skip = \"waiting for a provider fix\"\n}\n",
+		"spec/named/case.tfspec":  "",
+		"spec/run/case.tfspec":    "",
+	})
+
+	results, err := RunSuite(context.Background(), Options{Dir: root, Skip: []string{"named"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"parked": "waiting for a provider fix", "named": "skipped by name", "run": ""}
+	for _, c := range results.Cases {
+		if c.SkipReason != expected[c.Name] {
+			t.Errorf("%s should be skipped with reason %q, got %q", c.Name, expected[c.Name], c.SkipReason)
+		}
+	}
+	if success, failed := results.Count(); success+failed != 1 || results.SkippedCount() != 2 {
+		t.Errorf("results should count 1 test case run and 2 skipped, got %d and %d", success+failed, results.SkippedCount())
+	}
+}
+
+func TestTerraformLogOutput(t *testing.T) {
+	defer os.Setenv("TF_LOG", os.Getenv("TF_LOG"))
+	os.Unsetenv("TF_LOG")
+
+	out, err := terraformLogOutput(nil)
+	if err != nil || out != ioutil.Discard {
+		t.Errorf("terraform logs should be discarded when TF_LOG is not set, got %v, %v", out, err)
+	}
+
+	var buf strings.Builder
+	if out, _ = terraformLogOutput(&buf); out != &buf {
+		t.Errorf("terraform logs should be written to the given output, got %v", out)
+	}
+
+	os.Setenv("TF_LOG", "WARN")
+	out, _ = terraformLogOutput(&buf)
+	logger := log.New(out, "", log.Ltime)
+	logger.Print("[DEBUG] filtered")
+	logger.Print("[WARN] kept")
+	if !strings.HasSuffix(buf.String(), "[WARN] kept\n") || strings.Contains(buf.String(), "filtered") {
+		t.Errorf("terraform logs should be filtered by the TF_LOG level, got %q", buf.String())
+	}
+}
+
+func TestRunSuiteWithoutDataSource(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-no-refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"main.tf": `
+variable "size" {
+  type = number
+  validation {
+    condition     = var.size > 0
+    error_message = "Size must be positive."
+  }
+}
+output "size" {
+  value = "size-${var.size}"
+}`,
+		"spec/valid/case.tfspec":   `reject "output" "missing" {}`,
+		"spec/valid/case.tfvars":   `size = 2`,
+		"spec/invalid/case.tfspec": "assert \"variable\" \"size\" {\n  valid         = false\n  error_message = \"Size must be positive.\"\n}",
+		"spec/invalid/case.tfvars": `size = -1`,
+	})
+
+	results, err := RunSuite(context.Background(), Options{Dir: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results.Cases {
+		if r.Failed() {
+			t.Errorf("Test case %s should pass, got %v", r.Name, r.Diagnostics.Err())
+		}
+		if len(r.Assertions) == 0 {
+			t.Errorf("Test case %s should have passed assertions, got %+v", r.Name, r.Assertions)
+		}
+		if r.Name == "valid" && !strings.Contains(string(r.PlanJSON), `"size-2"`) {
+			t.Errorf("Test case valid should plan the output size, got %s", r.PlanJSON)
+		}
+		if r.Timings == nil || r.Timings.ConfigLoad == 0 {
+			t.Errorf("Test case %s should record the time spent loading the config, got %+v", r.Name, r.Timings)
+		}
+		if r.Name == "valid" && (r.Timings.Plan == 0 || r.Timings.Refresh != 0) {
+			t.Errorf("Test case valid should record the plan without refresh, got %+v", r.Timings)
+		}
+	}
+}
+
+func TestRefreshNeeded(t *testing.T) {
+	for dir, expected := range map[string]bool{"testdata/module": false, "testdata/expansion": true} {
+		cfg, diags := LoadConfig(dir)
+		if diags.HasErrors() {
+			t.Fatal(diags.Err())
+		}
+		if got := refreshNeeded(cfg, PlanModeNormal); got != expected {
+			t.Errorf("Expected refresh needed to be %t for %s, got %t", expected, dir, got)
+		}
+		if !refreshNeeded(cfg, PlanModeRefreshOnly) {
+			t.Errorf("Expected the refresh-only mode to refresh %s", dir)
+		}
+	}
+}
+
+func TestRunSuiteDisplayPlanOnFailure(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-display-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"main.tf": `
+variable "size" {
+  type = number
+}
+output "size" {
+  value = "size-${var.size}"
+}`,
+		"spec/passing/case.tfspec": `reject "output" "missing" {}`,
+		"spec/passing/case.tfvars": `size = 2`,
+		"spec/failing/case.tfspec": `assert "output" "missing" {}`,
+		"spec/failing/case.tfvars": `size = 3`,
+	})
+
+	results, err := RunSuite(context.Background(), Options{Dir: root, DisplayPlanOnFailure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Cases) != 2 {
+		t.Fatalf("Expected 2 test cases, got %d", len(results.Cases))
+	}
+	for _, r := range results.Cases {
+		if r.Failed() != (r.Name == "failing") {
+			t.Errorf("Test case %s should fail only when named failing, got %v", r.Name, r.Diagnostics.Err())
+		}
+		if r.Failed() && !strings.Contains(r.Plan, "Plan:") {
+			t.Errorf("Test case %s failed and should render its plan, got %q", r.Name, r.Plan)
+		}
+		if !r.Failed() && r.Plan != "" {
+			t.Errorf("Test case %s passed and should not render its plan, got %q", r.Name, r.Plan)
+		}
+	}
+}
+
+func TestPlanDisplay(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts     Options
+		expected planDisplay
+	}{
+		"none":       {Options{}, displayNone},
+		"all":        {Options{DisplayPlan: true}, displayAll},
+		"on failure": {Options{DisplayPlanOnFailure: true}, displayFailed},
+		"both":       {Options{DisplayPlan: true, DisplayPlanOnFailure: true}, displayAll},
+	} {
+		if got := tc.opts.planDisplay(); got != tc.expected {
+			t.Errorf("%s : expected plan display %d, got %d", name, tc.expected, got)
+		}
+	}
+}
+
+func TestRunSuiteReleasePlans(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-release-plans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"main.tf":             `output "size" { value = "size-1" }`,
+		"spec/one/one.tfspec": `reject "output" "missing" {}`,
+		"spec/two/two.tfspec": `reject "output" "missing" {}`,
+	})
+
+	var reported int
+	results, err := RunSuite(context.Background(), Options{Dir: root, DisplayPlan: true, ReleasePlans: true, OnCaseResult: func(r *CaseResult) {
+		reported++
+		if r.Plan == "" || len(r.PlanJSON) == 0 {
+			t.Errorf("Test case %s should be reported with its plans", r.Name)
+		}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reported != 2 || len(results.Cases) != 2 {
+		t.Fatalf("Expected 2 test cases reported and kept, got %d and %d", reported, len(results.Cases))
+	}
+	for _, r := range results.Cases {
+		if r.Failed() {
+			t.Errorf("Test case %s should pass, got %v", r.Name, r.Diagnostics.Err())
+		}
+		if r.Plan != "" || r.PlanJSON != nil {
+			t.Errorf("Test case %s should not keep its plans once reported", r.Name)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package terraspec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DefaultCheckovBin is the checkov binary run by the scan blocks of the specs when Options.CheckovBin is not set
+const DefaultCheckovBin = "checkov"
+
+// scanners are the policy scanners a scan block can run
+var scanners = []string{"checkov"}
+
+// severities are the severities of the findings of a scanner, from the lowest
+var severities = []string{"INFO", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// Scan is a run of a policy scanner against the JSON plan of a test case, declared by a scan block of the spec
+type Scan struct {
+	// Scanner is the policy scanner run, eg checkov
+	Scanner string
+	// MinSeverity is the lowest severity of the findings reported, eg HIGH. Findings without severity are only reported when it's empty
+	MinSeverity string
+	// SkipChecks are the ids of the checks whose findings are not reported
+	SkipChecks []string
+	// DeclRange is the source range of the scan block in the spec file
+	DeclRange hcl.Range
+}
+
+// checkovReport is the output of checkov -o json for a single framework
+type checkovReport struct {
+	Results struct {
+		FailedChecks []struct {
+			CheckID   string  `json:"check_id"`
+			CheckName string  `json:"check_name"`
+			Resource  string  `json:"resource"`
+			Severity  *string `json:"severity"`
+		} `json:"failed_checks"`
+	} `json:"results"`
+}
+
+// RunScans runs the policy scanner of every scan block of the spec against the JSON plan, with checkovBin for checkov.
+// Every finding is reported as a failed assertion on scan.<scanner>.<check>, and a scan block without finding as a passed one
+func (s *Spec) RunScans(ctx context.Context, checkovBin string, planJSON []byte) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	if len(s.Scans) == 0 {
+		return diags
+	}
+	planFile, err := ioutil.TempFile("", "terraspec-plan-*.json")
+	if err != nil {
+		return diags.Append(err)
+	}
+	defer os.Remove(planFile.Name())
+	_, err = planFile.Write(planJSON)
+	if closeErr := planFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return diags.Append(err)
+	}
+	for _, scan := range s.Scans {
+		diags = diags.Append(scan.runCheckov(ctx, checkovBin, planFile.Name()))
+	}
+	return diags
+}
+
+func (s *Scan) runCheckov(ctx context.Context, bin, planFile string) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	if bin == "" {
+		bin = DefaultCheckovBin
+	}
+	args := []string{"-f", planFile, "--framework", "terraform_plan", "-o", "json", "--quiet", "--compact"}
+	if len(s.SkipChecks) > 0 {
+		args = append(args, "--skip-check", strings.Join(s.SkipChecks, ","))
+	}
+	cmd := exec.CommandContext(ctx, bin, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// checkov exits with a non zero code when a check fails, so only its output tells if it failed
+	runErr := cmd.Run()
+	report, err := readCheckovReport(stdout.Bytes())
+	if err != nil {
+		if runErr == nil {
+			runErr = err
+		}
+		return diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Scan failed",
+			Detail:   fmt.Sprintf("Could not run %s %s : %v\n%s", bin, strings.Join(args, " "), runErr, stderr.String()),
+			Subject:  s.DeclRange.Ptr(),
+		})
+	}
+
+	path := cty.GetAttrPath("scan").GetAttr(s.Scanner)
+	for _, check := range report.Results.FailedChecks {
+		severity := ""
+		if check.Severity != nil {
+			severity = strings.ToUpper(*check.Severity)
+		}
+		if !s.reported(severity) {
+			continue
+		}
+		message := fmt.Sprintf("%s : %s", check.Resource, check.CheckName)
+		if severity != "" {
+			message += fmt.Sprintf(" (%s)", severity)
+		}
+		diag := ErrorDiags(path.GetAttr(check.CheckID), message)
+		diag.Subject = s.DeclRange.Ptr()
+		diags = diags.Append(diag)
+	}
+	if !diags.HasErrors() {
+		diag := SuccessDiags(path, "No finding")
+		diag.Subject = s.DeclRange.Ptr()
+		diags = diags.Append(diag)
+	}
+	return diags
+}
+
+// reported tells if a finding of the given severity is reported, according to the minimum severity of the scan
+func (s *Scan) reported(severity string) bool {
+	if s.MinSeverity == "" {
+		return true
+	}
+	return severity != "" && severityRank(severity) >= severityRank(s.MinSeverity)
+}
+
+// readCheckovReport reads the output of checkov. It's a list of reports when several frameworks ran,
+// and a summary without results when the plan holds no resource checkov knows
+func readCheckovReport(output []byte) (*checkovReport, error) {
+	output = bytes.TrimSpace(output)
+	report := &checkovReport{}
+	if bytes.HasPrefix(output, []byte("[")) {
+		var reports []*checkovReport
+		if err := json.Unmarshal(output, &reports); err != nil {
+			return nil, err
+		}
+		for _, r := range reports {
+			report.Results.FailedChecks = append(report.Results.FailedChecks, r.Results.FailedChecks...)
+		}
+		return report, nil
+	}
+	return report, json.Unmarshal(output, report)
+}
+
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// newScan creates the scan declared by a scan block, checking its scanner and its minimum severity
+func newScan(scanner, minSeverity string, skipChecks []string, declRange hcl.Range) (*Scan, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	known := false
+	for _, s := range scanners {
+		known = known || s == scanner
+	}
+	if !known {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported scanner",
+			Detail:   fmt.Sprintf("%q is not a supported policy scanner. Supported scanners are %s.%s", scanner, strings.Join(scanners, ", "), didYouMean(scanner, scanners)),
+			Subject:  declRange.Ptr(),
+		})
+	}
+	minSeverity = strings.ToUpper(minSeverity)
+	if minSeverity != "" && severityRank(minSeverity) < 0 {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid severity",
+			Detail:   fmt.Sprintf("min_severity must be one of %s, got %q", strings.Join(severities, ", "), minSeverity),
+			Subject:  declRange.Ptr(),
+		})
+	}
+	return &Scan{Scanner: scanner, MinSeverity: minSeverity, SkipChecks: skipChecks, DeclRange: declRange}, diags
+}
@@ -0,0 +1,110 @@
+package terraspec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+func TestRunScans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the fake checkov records its arguments and the plan it's given, and prints the findings of checkov
+	bin := filepath.Join(dir, "checkov")
+	script := `#!/bin/sh
+echo "$@" > ` + filepath.Join(dir, "args") + `
+cp "$2" ` + filepath.Join(dir, "plan.json") + `
+echo '{"check_type":"terraform_plan","results":{"passed_checks":[],"failed_checks":[
+{"check_id":"CKV_AWS_19","check_name":"Ensure the S3 bucket has server-side-encryption enabled","resource":"aws_s3_bucket.logs","severity":"HIGH"},
+{"check_id":"CKV_AWS_18","check_name":"Ensure the S3 bucket has access logging enabled","resource":"aws_s3_bucket.logs","severity":"LOW"},
+{"check_id":"CKV_AWS_144","check_name":"Ensure that S3 bucket has cross-region replication enabled","resource":"aws_s3_bucket.logs","severity":null}]}}'
+exit 1
+`
+	if err := ioutil.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		block    string
+		expected []string
+		args     string
+	}{
+		"All findings": {
+			block: `scan "checkov" {}`,
+			expected: []string{
+				"aws_s3_bucket.logs : Ensure the S3 bucket has server-side-encryption enabled (HIGH)",
+				"aws_s3_bucket.logs : Ensure the S3 bucket has access logging enabled (LOW)",
+				"aws_s3_bucket.logs : Ensure that S3 bucket has cross-region replication enabled",
+			},
+		},
+		"Minimum severity": {
+			block:    "scan \"checkov\" {\n  min_severity = \"high\"\n}",
+			expected: []string{"aws_s3_bucket.logs : Ensure the S3 bucket has server-side-encryption enabled (HIGH)"},
+		},
+		"No finding": {
+			block:    "scan \"checkov\" {\n  min_severity = \"CRITICAL\"\n  skip_checks  = [\"CKV_AWS_20\"]\n}",
+			expected: nil,
+			args:     " --skip-check CKV_AWS_20",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			spec, diags := ParseSpec([]byte(tt.block), "scan.tfspec", nil)
+			if diags.HasErrors() {
+				t.Fatal(diags.Error())
+			}
+			scanDiags := spec.RunScans(context.Background(), bin, []byte(`{"format_version":"0.1"}`))
+			if args, err := ioutil.ReadFile(filepath.Join(dir, "args")); err != nil || !strings.HasSuffix(strings.TrimSpace(string(args)), "--framework terraform_plan -o json --quiet --compact"+tt.args) {
+				t.Errorf("Unexpected arguments of checkov %q, %v", args, err)
+			}
+			if len(tt.expected) == 0 {
+				if len(scanDiags) != 1 || scanDiags[0].Severity() != Info || scanDiags[0].Description().Detail != "No finding" {
+					t.Errorf("Expected a passed assertion, got %v", scanDiags.Err())
+				}
+				return
+			}
+			if len(scanDiags) != len(tt.expected) {
+				t.Fatalf("Expected %d findings, got %v", len(tt.expected), scanDiags.Err())
+			}
+			for i, expected := range tt.expected {
+				if scanDiags[i].Severity() != tfdiags.Error || scanDiags[i].Description().Detail != expected {
+					t.Errorf("Expected finding %q, got %q", expected, scanDiags[i].Description().Detail)
+				}
+			}
+			if path := tfdiags.GetAttribute(scanDiags[0].(*TerraspecDiagnostic).Diagnostic); FormatPath(path) != "scan.checkov.CKV_AWS_19" {
+				t.Errorf("Unexpected path of the finding %s", FormatPath(path))
+			}
+		})
+	}
+
+	if plan, err := ioutil.ReadFile(filepath.Join(dir, "plan.json")); err != nil || string(plan) != `{"format_version":"0.1"}` {
+		t.Errorf("checkov should scan the JSON plan, got %q, %v", plan, err)
+	}
+}
+
+func TestParseScanErrors(t *testing.T) {
+	tests := map[string]struct {
+		block   string
+		summary string
+	}{
+		"Unknown scanner":  {block: `scan "checkof" {}`, summary: "Unsupported scanner"},
+		"Unknown severity": {block: "scan \"checkov\" {\n  min_severity = \"urgent\"\n}", summary: "Invalid severity"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, diags := ParseSpec([]byte(tt.block), "scan.tfspec", nil)
+			if !diags.HasErrors() || diags[0].Summary != tt.summary {
+				t.Errorf("Expected a %q error, got %v", tt.summary, diags)
+			}
+		})
+	}
+}
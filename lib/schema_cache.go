@@ -0,0 +1,115 @@
+package terraspec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plugin/discovery"
+	"github.com/hashicorp/terraform/providers"
+)
+
+// schemaCacheFormat is written in every cached schema, so the cache is ignored when the way schemas are stored changes
+const schemaCacheFormat = 1
+
+// SchemaCache keeps the schemas of provider plugins in a folder, so they're loaded once per provider version
+// rather than requested from the plugin by every test case of every run.
+// Schemas of plugins without a version are never cached
+type SchemaCache struct {
+	// Dir is the folder holding the cached schemas. Empty means schemas are only kept in memory, for the current run
+	Dir    string
+	lock   sync.Mutex
+	loaded map[string]*providers.GetSchemaResponse
+}
+
+// NewSchemaCache returns a SchemaCache storing schemas in dir. The folder is created when the first schema is stored
+func NewSchemaCache(dir string) *SchemaCache {
+	return &SchemaCache{Dir: dir, loaded: make(map[string]*providers.GetSchemaResponse)}
+}
+
+// cachedSchema is the content of a cached schema file
+type cachedSchema struct {
+	Format        int
+	Provider      providers.Schema
+	ResourceTypes map[string]providers.Schema
+	DataSources   map[string]providers.Schema
+}
+
+// file returns the path of the cached schema of the given provider plugin, or an empty string if the plugin has no version
+func (c *SchemaCache) file(provider addrs.Provider, meta discovery.PluginMeta) string {
+	if meta.Version == "" {
+		return ""
+	}
+	return filepath.Join(c.Dir, provider.Hostname.String(), provider.Namespace, provider.Type, string(meta.Version)+".json")
+}
+
+// get returns the cached schema of the given provider plugin, if any
+func (c *SchemaCache) get(provider addrs.Provider, meta discovery.PluginMeta) (*providers.GetSchemaResponse, bool) {
+	file := c.file(provider, meta)
+	if file == "" {
+		return nil, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if resp, ok := c.loaded[file]; ok {
+		return resp, true
+	}
+	if c.Dir == "" {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+	var cached cachedSchema
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Format != schemaCacheFormat {
+		// the schema is requested again from the plugin and the invalid file is overwritten
+		return nil, false
+	}
+	resp := &providers.GetSchemaResponse{Provider: cached.Provider, ResourceTypes: cached.ResourceTypes, DataSources: cached.DataSources}
+	c.loaded[file] = resp
+	return resp, true
+}
+
+// put stores the schema of the given provider plugin.
+// The cache only saves time, so the schema is simply not stored when the file can't be written
+func (c *SchemaCache) put(provider addrs.Provider, meta discovery.PluginMeta, resp providers.GetSchemaResponse) {
+	file := c.file(provider, meta)
+	if file == "" || resp.Diagnostics.HasErrors() {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.loaded[file] = &resp
+	if c.Dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(cachedSchema{Format: schemaCacheFormat, Provider: resp.Provider, ResourceTypes: resp.ResourceTypes, DataSources: resp.DataSources})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return
+	}
+	// other terraspec processes may read the file while it's written, so it's renamed once complete
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".schema-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,120 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plugin/discovery"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSchemaCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	provider := addrs.NewDefaultProvider("acme")
+	meta := discovery.PluginMeta{Name: "acme", Version: "1.2.0", Path: filepath.Join(dir, "missing-plugin")}
+	schema := providers.GetSchemaResponse{
+		Provider: providers.Schema{Block: &configschema.Block{}},
+		ResourceTypes: map[string]providers.Schema{
+			"acme_record": {Version: 2, Block: &configschema.Block{
+				Attributes: map[string]*configschema.Attribute{
+					"name": {Type: cty.String, Required: true},
+					"tags": {Type: cty.Map(cty.String), Optional: true},
+				},
+				BlockTypes: map[string]*configschema.NestedBlock{
+					"target": {Nesting: configschema.NestingList, MaxItems: 2, Block: configschema.Block{
+						Attributes: map[string]*configschema.Attribute{"ip": {Type: cty.String, Computed: true}},
+					}},
+				},
+			}},
+		},
+		DataSources: map[string]providers.Schema{},
+	}
+	NewSchemaCache(dir).put(provider, meta, schema)
+
+	// a new cache reads the schema stored by an earlier run
+	cached, ok := NewSchemaCache(dir).get(provider, meta)
+	if !ok {
+		t.Fatal("schema should be cached")
+	}
+	if !reflect.DeepEqual(*cached, schema) {
+		t.Errorf("cached schema not as expected. Got %#v want %#v", *cached, schema)
+	}
+
+	// the plugin is not started when its schema is cached
+	p := &ProviderInterface{provider: provider, pluginMeta: meta, schemaCache: NewSchemaCache(dir)}
+	if resp := p.GetSchema(); resp.Diagnostics.HasErrors() || !reflect.DeepEqual(resp, schema) {
+		t.Errorf("schema should be served from the cache, got %v", resp.Diagnostics.Err())
+	}
+
+	if _, ok := NewSchemaCache(dir).get(provider, discovery.PluginMeta{Name: "acme", Version: "1.3.0"}); ok {
+		t.Error("schemas of other versions should not be cached")
+	}
+	unversioned := discovery.PluginMeta{Name: "acme"}
+	NewSchemaCache(dir).put(provider, unversioned, schema)
+	if _, ok := NewSchemaCache(dir).get(provider, unversioned); ok {
+		t.Error("schemas of unversioned plugins should not be cached")
+	}
+}
+
+func TestSchemaCacheIgnoresInvalidFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	provider := addrs.NewDefaultProvider("acme")
+	meta := discovery.PluginMeta{Name: "acme", Version: "1.2.0"}
+	cache := NewSchemaCache(dir)
+	file := cache.file(provider, meta)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(`{"Format": 0}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.get(provider, meta); ok {
+		t.Error("schemas stored in another format should be ignored")
+	}
+}
+
+func TestSchemaCacheInMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-schemas-memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	provider := addrs.NewDefaultProvider("acme")
+	meta := discovery.PluginMeta{Name: "acme", Version: "1.2.0"}
+	cache := NewSchemaCache("")
+	cache.put(provider, meta, providers.GetSchemaResponse{Provider: providers.Schema{Block: &configschema.Block{}}})
+	if _, ok := cache.get(provider, meta); !ok {
+		t.Error("schema should be kept in memory")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) > 0 {
+		t.Errorf("schemas kept in memory should not be written, got %d files", len(files))
+	}
+	if _, ok := NewSchemaCache("").get(provider, meta); ok {
+		t.Error("schemas kept in memory should not outlive their cache")
+	}
+}
@@ -0,0 +1,66 @@
+package terraspec
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// redactedValue replaces the sensitive values in assertion results
+const redactedValue = "(sensitive value)"
+
+// sensitivePath tells if path, relative to a resource described by schema, goes through an attribute the schema marks as sensitive
+func sensitivePath(schema *configschema.Block, path cty.Path) bool {
+	block := schema
+	for _, step := range path {
+		attr, ok := step.(cty.GetAttrStep)
+		if !ok {
+			// the index steps of nested blocks are left out, the ones of attributes are under a known attribute
+			continue
+		}
+		if a, ok := block.Attributes[attr.Name]; ok {
+			return a.Sensitive
+		}
+		nested, ok := block.BlockTypes[attr.Name]
+		if !ok {
+			return false
+		}
+		block = &nested.Block
+	}
+	return false
+}
+
+// redactSensitive hides the values of the assertions of diags that check a sensitive attribute of the resource described by schema,
+// or of all the assertions of diags when all is set, eg for a sensitive output. The paths of diags start with the address of the resource
+func redactSensitive(diags tfdiags.Diagnostics, schema *configschema.Block, all bool) tfdiags.Diagnostics {
+	for _, diag := range diags {
+		d, ok := diag.(*TerraspecDiagnostic)
+		if !ok {
+			continue
+		}
+		path := tfdiags.GetAttribute(d.Diagnostic)
+		if !all && (schema == nil || len(path) == 0 || !sensitivePath(schema, path[1:])) {
+			continue
+		}
+		detail := redactedValue
+		if d.Severity() == tfdiags.Error {
+			detail = "Sensitive value doesn't match the assertion"
+			if d.Mismatch != nil {
+				detail = fmt.Sprintf("%s (%s)", detail, d.Mismatch.Reason)
+				d.Mismatch.Expected, d.Mismatch.Actual = redactValue(d.Mismatch.Expected), redactValue(d.Mismatch.Actual)
+			}
+		}
+		d.Diagnostic = tfdiags.AttributeValue(d.Severity(), "", detail, path)
+	}
+	return diags
+}
+
+// redactValue replaces val with the redacted value, unless it's missing
+func redactValue(val cty.Value) cty.Value {
+	if val == cty.NilVal {
+		return val
+	}
+	return cty.StringVal(redactedValue)
+}
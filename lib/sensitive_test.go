@@ -0,0 +1,57 @@
+package terraspec
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRedactSensitive(t *testing.T) {
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"name":     {Type: cty.String, Optional: true},
+			"password": {Type: cty.String, Optional: true, Sensitive: true},
+			"secrets":  {Type: cty.Map(cty.String), Optional: true, Sensitive: true},
+		},
+		BlockTypes: map[string]*configschema.NestedBlock{
+			"credentials": {
+				Block:   configschema.Block{Attributes: map[string]*configschema.Attribute{"token": {Type: cty.String, Optional: true, Sensitive: true}}},
+				Nesting: configschema.NestingList,
+			},
+		},
+	}
+	resource := cty.GetAttrPath("aws_db_instance.main")
+	diags := func() tfdiags.Diagnostics {
+		var diags tfdiags.Diagnostics
+		diags = diags.Append(AssertErrorDiags(resource.GetAttr("name"), "prod", "dev").withMismatch(MismatchValue, cty.StringVal("prod"), cty.StringVal("dev")))
+		diags = diags.Append(AssertErrorDiags(resource.GetAttr("password"), "expected", "s3cr3t").withMismatch(MismatchValue, cty.StringVal("expected"), cty.StringVal("s3cr3t")))
+		diags = diags.Append(SuccessDiags(resource.GetAttr("secrets").GetAttr("key"), "s3cr3t"))
+		diags = diags.Append(SuccessDiags(resource.GetAttr("credentials").Index(cty.NumberIntVal(0)).GetAttr("token"), "s3cr3t"))
+		return diags
+	}
+
+	redacted := redactSensitive(diags(), schema, false)
+	expected := []string{"dev != prod", "Sensitive value doesn't match the assertion (value)", redactedValue, redactedValue}
+	for i, detail := range expected {
+		if got := redacted[i].Description().Detail; got != detail {
+			t.Errorf("Expected detail %q, got %q", detail, got)
+		}
+	}
+	if m := Mismatches(redacted)[1]; m.Expected != cty.StringVal(redactedValue) || m.Actual != cty.StringVal(redactedValue) {
+		t.Errorf("The values of the mismatch should be redacted, got %#v and %#v", m.Expected, m.Actual)
+	}
+	if m := Mismatches(redacted)[0]; m.Actual != cty.StringVal("dev") {
+		t.Errorf("The values of attributes that are not sensitive should be kept, got %#v", m.Actual)
+	}
+	if path := tfdiags.GetAttribute(redacted[1].(*TerraspecDiagnostic).Diagnostic); FormatPath(path) != "aws_db_instance.main.password" {
+		t.Errorf("The path of the assertion should be kept, got %s", FormatPath(path))
+	}
+
+	for _, diag := range redactSensitive(diags(), nil, true) {
+		if detail := diag.Description().Detail; detail != redactedValue && detail != "Sensitive value doesn't match the assertion (value)" {
+			t.Errorf("All the assertions should be redacted, got %q", detail)
+		}
+	}
+}
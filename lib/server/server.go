@@ -0,0 +1,185 @@
+// Package server exposes terraspec over JSON-RPC 1.0 so editors and other tools can run test cases
+// and get their diagnostics without parsing the command line output
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/tfdiags"
+	terraspec "github.com/nhurel/terraspec/lib"
+	"github.com/nhurel/terraspec/lib/format"
+)
+
+// ServiceName is the name the methods of Service are called with, eg Terraspec.Run
+const ServiceName = "Terraspec"
+
+// Service implements the JSON-RPC methods of terraspec
+type Service struct {
+	ctx context.Context
+}
+
+// CaseReport is the outcome of a test case, as sent to clients
+type CaseReport struct {
+	Name string
+	Dir  string
+	// Plan is the rendered plan, only set when Options.DisplayPlan is true, or when the test case failed and Options.DisplayPlanOnFailure is true
+	Plan       string `json:",omitempty"`
+	Failed     bool
+	Assertions []*terraspec.Assertion
+	// Skipped is the number of assert and reject blocks of the spec that gave no assertion
+	Skipped int `json:",omitempty"`
+	// Diagnostics are the errors and warnings that are not assertion results, eg invalid config or spec
+	Diagnostics []*Diagnostic
+	// Coverage tells which planned resources and attributes are checked by an assertion, when the plan could be computed
+	Coverage *terraspec.Coverage `json:",omitempty"`
+	Duration time.Duration
+	// Timings is the time spent in every phase of the test case, when it was run
+	Timings *terraspec.Timings `json:",omitempty"`
+	// Cached tells the test case passed in a previous run with the same inputs and was not run again
+	Cached bool `json:",omitempty"`
+	// SkipReason tells why the test case was not run, when it was skipped
+	SkipReason string `json:",omitempty"`
+	// ExpectedFailure is the reason the test case is expected to fail. Failed tells whether it failed otherwise, or unexpectedly passed
+	ExpectedFailure string `json:",omitempty"`
+	// Artifacts are the temporary folders of the test case kept for debugging, see Options.KeepArtifacts
+	Artifacts []string `json:",omitempty"`
+	// MemStats is the memory used when the test case completed, when Options.MemStats is set
+	MemStats *terraspec.MemStats `json:",omitempty"`
+	// PlanJSON is the plan in the JSON format of terraform show -json, when it could be computed
+	PlanJSON json.RawMessage `json:",omitempty"`
+	// Output is the outcome rendered as the terraspec command prints it, without colors
+	Output string
+}
+
+// Diagnostic is an error or warning raised while running a test case
+type Diagnostic struct {
+	// Severity is either error or warning
+	Severity string
+	Summary  string
+	Detail   string
+	// Range locates the cause of the diagnostic in the config or spec files, when known
+	Range *hcl.Range `json:",omitempty"`
+}
+
+// ListReply is the result of Terraspec.List
+type ListReply struct {
+	Cases []*terraspec.TestCase
+}
+
+// RunReply is the result of Terraspec.Run and Terraspec.Validate
+type RunReply struct {
+	Cases    []*CaseReport
+	Failed   bool
+	Duration time.Duration
+}
+
+// NewService creates a Service running test cases within ctx
+func NewService(ctx context.Context) *Service {
+	return &Service{ctx: ctx}
+}
+
+// List returns the test cases found in the spec folder described by opts
+func (s *Service) List(opts terraspec.Options, reply *ListReply) error {
+	cases, err := terraspec.ListTestCases(opts)
+	if err != nil {
+		return err
+	}
+	reply.Cases = cases
+	return nil
+}
+
+// Run runs the test cases found in the spec folder described by opts.
+// A single test case is run when opts.SpecDir is the folder of that test case
+func (s *Service) Run(opts terraspec.Options, reply *RunReply) error {
+	results, err := terraspec.RunSuite(s.ctx, opts)
+	if err != nil {
+		return err
+	}
+	*reply = newRunReply(results)
+	return nil
+}
+
+// Validate checks the config and the spec files of the test cases found in the spec folder described by opts, without computing any plan
+func (s *Service) Validate(opts terraspec.Options, reply *RunReply) error {
+	results, err := terraspec.ValidateSuite(s.ctx, opts)
+	if err != nil {
+		return err
+	}
+	*reply = newRunReply(results)
+	return nil
+}
+
+func newRunReply(results *terraspec.Results) RunReply {
+	reply := RunReply{Failed: results.Failed(), Duration: results.Duration}
+	for _, c := range results.Cases {
+		report := &CaseReport{Name: c.Name, Dir: c.Dir, Plan: c.Plan, Failed: c.Failed(), Assertions: c.Assertions, Skipped: c.Skipped, PlanJSON: c.PlanJSON, Coverage: c.Coverage, Duration: c.Duration, Timings: c.Timings, Cached: c.Cached, SkipReason: c.SkipReason, ExpectedFailure: c.ExpectedFailure, Artifacts: c.Artifacts, MemStats: c.MemStats}
+		for _, diag := range c.Diagnostics {
+			if _, ok := diag.(*terraspec.TerraspecDiagnostic); ok {
+				continue
+			}
+			report.Diagnostics = append(report.Diagnostics, newDiagnostic(diag))
+		}
+		var output strings.Builder
+		format.CaseResult(&output, c, format.Options{Emoji: true})
+		report.Output = output.String()
+		reply.Cases = append(reply.Cases, report)
+	}
+	return reply
+}
+
+func newDiagnostic(diag tfdiags.Diagnostic) *Diagnostic {
+	d := &Diagnostic{Severity: "error", Summary: diag.Description().Summary, Detail: diag.Description().Detail}
+	if diag.Severity() == tfdiags.Warning {
+		d.Severity = "warning"
+	}
+	if subj := diag.Source().Subject; subj != nil {
+		d.Range = &hcl.Range{
+			Filename: subj.Filename,
+			Start:    hcl.Pos{Line: subj.Start.Line, Column: subj.Start.Column, Byte: subj.Start.Byte},
+			End:      hcl.Pos{Line: subj.End.Line, Column: subj.End.Column, Byte: subj.End.Byte},
+		}
+	}
+	return d
+}
+
+// Serve answers the JSON-RPC requests read from conn until conn is closed or ctx is cancelled
+func Serve(ctx context.Context, conn io.ReadWriteCloser) error {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName(ServiceName, NewService(ctx)); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	return nil
+}
+
+// ServeStdio answers the JSON-RPC requests read from stdin on stdout
+func ServeStdio(ctx context.Context) error {
+	return Serve(ctx, stdio{os.Stdin, os.Stdout})
+}
+
+// stdio joins stdin and stdout in a single connection
+type stdio struct {
+	io.Reader
+	io.Writer
+}
+
+func (stdio) Close() error {
+	return os.Stdin.Close()
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"testing"
+
+	terraspec "github.com/nhurel/terraspec/lib"
+)
+
+func TestServe(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "spec", "case"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "spec", "case", "case.tfspec"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serverConn, clientConn := net.Pipe()
+	served := make(chan error)
+	go func() { served <- Serve(ctx, serverConn) }()
+
+	client := jsonrpc.NewClient(clientConn)
+
+	var list ListReply
+	if err := client.Call("Terraspec.List", terraspec.Options{Dir: root}, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Cases) != 1 || list.Cases[0].Name() != "case" {
+		t.Errorf("Expected test case named case, got %v", list.Cases)
+	}
+
+	var run RunReply
+	err = client.Call("Terraspec.Run", terraspec.Options{Dir: root, SpecDir: "missing"}, &run)
+	if err == nil || err.Error() != "No test case found in "+filepath.Join(root, "missing")+" directory" {
+		t.Errorf("Running a missing spec folder should fail, got %v", err)
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("Serve should stop without error once cancelled, got %v", err)
+	}
+}
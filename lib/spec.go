@@ -1,9 +1,14 @@
 package terraspec
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
 
@@ -14,31 +19,110 @@ import (
 	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
 	"github.com/hashicorp/terraform/configs/configschema"
 	"github.com/hashicorp/terraform/plans"
 	"github.com/hashicorp/terraform/terraform"
 	"github.com/hashicorp/terraform/tfdiags"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
 )
 
 // Spec struct contains the assertions described in .tfspec file
 type Spec struct {
+	// Version is the version of the spec language the file is written in, see SpecVersion
+	Version          int
 	Asserts          []*Assert
 	Rejects          []*TypeName
 	Mocks            []*Mock
 	DataSourceReader *MockDataSourceReader
 	Terraspec        *TerraspecConfig
+	// Config is the config under test. It resolves the provider configurations asserted by the provider argument of the asserts,
+	// which are looked up in the module of the resource with their implied provider when it's nil
+	Config *configs.Config
+	// CountMocks are the count values forced on resources, by resource address
+	CountMocks map[string]int
+	// State are the resources of the synthetic prior state described in the spec
+	State []*StateResource
+	// Before are the hooks run before the plan of the test case, and After the ones run once it completed
+	Before []*Hook
+	After  []*Hook
+	// hookFiles are the files written by the before hooks, restored by RunAfterHooks,
+	// and releaseHookFiles lets the test cases writing the same files run once they're restored
+	hookFiles        []*writtenHookFile
+	releaseHookFiles func()
+	// Lints are the tflint runs checking the config of the test case
+	Lints []*Tflint
+	// Scans are the policy scanners run against the plan of the test case
+	Scans []*Scan
+	// ShowSensitive keeps the values of the sensitive attributes and outputs in the assertion results. They're redacted otherwise
+	ShowSensitive bool
+	// AssertWorkers is the number of goroutines checking the asserts of the spec, one per CPU when not set.
+	// The runner lowers it to share the CPUs between the test cases run at the same time
+	AssertWorkers int
+
+	// evalCtx and schemas decoded the spec, they decode again the asserts referencing the plan once it's bound
+	evalCtx *hcl.EvalContext
+	schemas *terraform.Schemas
+	// moves are the previous addresses of the resources moved by the plan, by address, see readPlannedMoves
+	moves map[string]string
+	// imports are the IDs of the resources imported by the plan, by address, see readPlannedImports
+	imports map[string]string
 }
 
 // Terraspec contains a global element for a spec with common configuration similar to terraform hcl element.
 type TerraspecConfig struct {
-	Workspace string
+	Workspace   string
+	RemoteState *RemoteStateConfig
+	// ProviderVersions maps provider types to the version constraint of the plugin to use
+	ProviderVersions map[string]string
+	// StateFile is the path of a state file used as prior state, relative to the spec file
+	StateFile string
+	// PlanFile is the path of a plan computed by terraform the assertions are checked against, rather than planning the config.
+	// It's relative to the spec file, see ReadPlanFile
+	PlanFile string
+	// ExpectEmptyPlan requires all planned resources to be left unchanged
+	ExpectEmptyPlan bool
+	// Strict requires every managed resource the plan changes to be targeted by an assert or a reject block
+	Strict bool
+	// Skip is the reason the test case is not run. The test case runs when empty
+	Skip string
+	// ExpectFailure is the reason the assertions of the test case are expected to fail, eg a known bug of the config
+	ExpectFailure string
+	// Tolerance is the difference allowed between an asserted number and the planned one
+	Tolerance float64
+	// RoundNumbers compares asserted and planned numbers rounded to the nearest whole number
+	RoundNumbers bool
+	// Normalize are the encodings of the strings decoded before they're compared : json, yaml or base64
+	Normalize []string
+	// PlanMode is one of PlanModeNormal, PlanModeDestroy or PlanModeRefreshOnly
+	PlanMode string
+	// Targets restricts the plan to the given resources and modules, like terraform plan -target
+	Targets []addrs.Targetable
+	// MockCounts force the count of resources that depend on values unknown until apply, by resource address
+	MockCounts map[string]int
+	// Policies are the paths of the rego policies evaluated against the plan, relative to the spec file
+	Policies []string
+}
+
+// Destroy tells if the test case plans the destruction of its resources
+func (c *TerraspecConfig) Destroy() bool {
+	return c != nil && c.PlanMode == PlanModeDestroy
 }
 
 // Assert struct contains the definition of an assertion
 type Assert struct {
 	TypeName
 	Value cty.Value
+	// Provider is the provider configuration the resource must be bound to, eg aws.us_east_1
+	Provider string
+	// Message explains the rule the assert block checks. It's given along with its failed assertions
+	Message string
+	// Tolerance, RoundNumbers and Normalize override the ones of the terraspec block for the values of this assert, when set
+	Tolerance    *float64
+	RoundNumbers *bool
+	Normalize    []string
 }
 
 // Mock struct contains the definition of mocked data resources
@@ -55,11 +139,46 @@ type Context struct {
 	TerraformVersion *goversion.Version
 	UserVersion      *goversion.Version
 	WorkaroundOnce   sync.Once
+	ModuleMode       bool
+	// Isolate runs every test case in its own Workdir
+	Isolate    bool
+	PluginDirs []string
+	// LogOutput receives the logs of the provider plugins. Nil means stderr
+	LogOutput io.Writer
+	// SchemaCache keeps the schemas of the provider plugins between runs, when set
+	SchemaCache *SchemaCache
+	// ShowSensitive keeps the values of the sensitive attributes and outputs in the assertion results, see Spec.ShowSensitive
+	ShowSensitive bool
+	// BaseVariableFile holds the values of the variables of every test case, overridden by the variable file of the test case
+	BaseVariableFile string
+	// TflintBin is the tflint binary run by the lint blocks of the specs, DefaultTflintBin when empty
+	TflintBin string
+	// CheckovBin is the checkov binary run by the scan blocks of the specs, DefaultCheckovBin when empty
+	CheckovBin string
+	// PlanFile is the name of the plan file of every test case, in its folder, the assertions are checked against rather than planning the config
+	PlanFile string
+	// DockerImage is the image whose container runs every test case, when set
+	DockerImage string
+	// DockerBin is the docker binary running the containers of DockerImage, DefaultDockerBin when empty
+	DockerBin string
+	// TerraformBin is the terraform binary computing the plans of the test cases, the embedded terraform computes them when empty
+	TerraformBin string
+	// AssertWorkers is the number of goroutines checking the asserts of every spec, see Spec.AssertWorkers
+	AssertWorkers int
+	// configs are the configs loaded by the test cases
+	configs configCache
+	// plugins are the provider plugin processes started by the test cases
+	plugins pluginPool
 }
 
+// TypeName identifies a block of a spec file by its labels
 type TypeName struct {
 	Type string
 	Name string
+	// DeclRange is the source range of the block header in the spec file
+	DeclRange hcl.Range
+	// Config is the body of the block, giving access to its attributes and their source ranges
+	Config hcl.Body
 }
 
 func NewAssert(aType, aName string, aValue cty.Value) *Assert {
@@ -93,8 +212,9 @@ func (m *Mock) Called() bool {
 
 // Validate checks all the assertions of this Spec against the given terraform Plan.
 // It return all failed assertion in a Diagnostics and an error
-// if a technical error happened while testing the plan
-func (s *Spec) Validate(plan *plans.Plan) (tfdiags.Diagnostics, error) {
+// if a technical error happened while testing the plan.
+// Assertions are no longer checked once ctx is done, and its error is returned
+func (s *Spec) Validate(ctx context.Context, plan *plans.Plan) (tfdiags.Diagnostics, error) {
 	var diags tfdiags.Diagnostics
 
 	if plan.Changes == nil {
@@ -102,56 +222,239 @@ func (s *Spec) Validate(plan *plans.Plan) (tfdiags.Diagnostics, error) {
 		return diags, nil
 	}
 
-	for _, assert := range s.Asserts {
-		if assert.Type == "output" {
-			output := findOuput(assert.Key(), plan.Changes.Outputs)
-			path := cty.GetAttrPath("output").GetAttr(assert.Key())
-			if output == nil {
-				diags = diags.Append(ErrorDiags(path, "Missing value"))
-				continue
-			}
-			change, err := output.Decode()
-			if err != nil {
-				return nil, fmt.Errorf("Error happened while decoding planned output %s : %v", assert.Name, err)
-			}
+	// plans may have thousands of changes, so their addresses are formatted once
+	resources := indexResources(plan.Changes.Resources)
+	outputs := make(map[string]*plans.OutputChangeSrc, len(plan.Changes.Outputs))
+	for _, output := range plan.Changes.Outputs {
+		if _, ok := outputs[output.Addr.String()]; !ok {
+			outputs[output.Addr.String()] = output
+		}
+	}
 
-			assertDiags := checkOutput(path, assert.Value, change.Change.After)
-			diags = diags.Append(assertDiags)
-		} else {
-			resource := findResource(assert.Key(), plan.Changes.Resources)
-			if resource == nil {
-				diags = diags.Append(fmt.Errorf("Could not find resource %s in changes", assert.Key()))
-				continue
-			}
+	// asserts are independent, so the ones of large specs are checked concurrently, then reported in the order of the spec
+	results := make([]assertResult, len(s.Asserts))
+	workers := s.AssertWorkers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	eachConcurrently(len(s.Asserts), workers, func(i int) {
+		if err := ctx.Err(); err != nil {
+			results[i].err = err
+			return
+		}
+		results[i].diags, results[i].err = s.validateAssert(s.Asserts[i], resources, outputs)
+		results[i].diags = explain(locate(results[i].diags, s.Asserts[i].DeclRange), s.Asserts[i].Message)
+	})
+	for _, result := range results {
+		if result.err != nil {
+			return nil, result.err
+		}
+		diags = diags.Append(result.diags)
+	}
 
-			change, err := resource.After.Decode(untransformType(assert.Value.Type()))
-			if err != nil {
-				return nil, fmt.Errorf("Error happened while decoding planned resource %s : %v", assert.Name, err)
-			}
+	for _, reject := range s.Rejects {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		diags = diags.Append(locate(s.validateReject(reject, resources), reject.DeclRange))
+	}
+
+	if s.Terraspec != nil && s.Terraspec.ExpectEmptyPlan {
+		diags = diags.Append(checkEmptyPlan(plan.Changes))
+	}
+	if s.Terraspec != nil && s.Terraspec.Strict {
+		diags = diags.Append(s.checkStrictPlan(plan.Changes))
+	}
+
+	return diags, nil
+}
+
+// blockRanges returns the header ranges of the assert and reject blocks, where the assertions they give are located
+func (s *Spec) blockRanges() []hcl.Range {
+	var ranges []hcl.Range
+	for _, assert := range s.Asserts {
+		ranges = append(ranges, assert.DeclRange)
+	}
+	for _, reject := range s.Rejects {
+		ranges = append(ranges, reject.DeclRange)
+	}
+	return ranges
+}
 
-			assertDiags := checkAssert(cty.GetAttrPath(assert.Key()), assert.Value, change)
-			diags = diags.Append(assertDiags)
+// checkEmptyPlan returns an error for every managed resource the plan would change
+func checkEmptyPlan(changes *plans.Changes) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	for _, resource := range changes.Resources {
+		if resource.Addr.Resource.Resource.Mode != addrs.ManagedResourceMode || resource.Action == plans.NoOp {
+			continue
 		}
+		diags = diags.Append(ErrorDiags(cty.GetAttrPath(resource.Addr.String()), fmt.Sprintf("Planned action is %s while plan should be empty", resource.Action)).withMismatch(MismatchAction, cty.StringVal(plans.NoOp.String()), cty.StringVal(resource.Action.String())))
+	}
+	if !diags.HasErrors() {
+		diags = diags.Append(SuccessDiags(cty.GetAttrPath("plan"), "No changes"))
 	}
+	return diags
+}
 
+// checkStrictPlan returns an error for every managed resource the plan would change while no assert or reject block targets it,
+// so resources added by mistake are caught even though all the asserts pass
+func (s *Spec) checkStrictPlan(changes *plans.Changes) tfdiags.Diagnostics {
+	expected := make(map[string]bool, len(s.Asserts)+len(s.Rejects))
+	for _, assert := range s.Asserts {
+		expected[assert.Key()] = true
+	}
 	for _, reject := range s.Rejects {
-		fmt.Println(reject.Key())
-		resource := findResource(reject.Key(), plan.Changes.Resources)
-		if resource != nil {
-			diags = diags.Append(RejectErrorDiags(cty.GetAttrPath(reject.Key()), reject, resource))
-		} else {
-			diags = diags.Append(RejectSuccessDiags(cty.GetAttrPath(reject.Key()), "Resource not created", reject))
+		expected[reject.Key()] = true
+	}
+	var diags tfdiags.Diagnostics
+	for _, resource := range changes.Resources {
+		addr := resource.Addr.String()
+		if resource.Addr.Resource.Resource.Mode != addrs.ManagedResourceMode || resource.Action == plans.NoOp || expected[addr] {
+			continue
 		}
+		diags = diags.Append(ErrorDiags(cty.GetAttrPath(addr), fmt.Sprintf("Planned action is %s while no assert or reject block expects this resource in strict mode", resource.Action)).withMismatch(MismatchUnexpected, cty.NilVal, cty.StringVal(resource.Action.String())))
+	}
+	if !diags.HasErrors() {
+		diags = diags.Append(SuccessDiags(cty.GetAttrPath("plan"), "No unexpected resource"))
 	}
+	return diags
+}
 
+// assertResult is the outcome of a single assert of a spec
+type assertResult struct {
+	diags tfdiags.Diagnostics
+	err   error
+}
+
+// validateAssert checks a single assert against the planned resources and outputs, indexed by address
+func (s *Spec) validateAssert(assert *Assert, resources map[string]*plans.ResourceInstanceChangeSrc, outputs map[string]*plans.OutputChangeSrc) (tfdiags.Diagnostics, error) {
+	var diags tfdiags.Diagnostics
+	c := s.comparison(assert)
+	if assert.Type == "variable" {
+		// variables are checked by ValidateVariables
+		return nil, nil
+	}
+	if assert.Type == MovedAssertType {
+		return diags.Append(s.checkMove(assert)), nil
+	}
+	if assert.Type == ImportAssertType {
+		return diags.Append(s.checkImport(assert)), nil
+	}
+	if assert.Type == "output" {
+		output := outputs[assert.Key()]
+		path := cty.GetAttrPath("output").GetAttr(assert.Key())
+		if output == nil {
+			return diags.Append(ErrorDiags(path, "Missing value").withMismatch(MismatchMissing, assert.Value, cty.NilVal)), nil
+		}
+		change, err := output.Decode()
+		if err != nil {
+			return nil, fmt.Errorf("Error happened while decoding planned output %s : %v", assert.Name, err)
+		}
+		diags = c.checkOutput(path, assert.Value, change.Change.After)
+		if output.Sensitive && !s.ShowSensitive {
+			diags = redactSensitive(diags, nil, true)
+		}
+		return diags, nil
+	}
+
+	resource := resources[assert.Key()]
+	if resource == nil {
+		return diags.Append(missingResource(assert, resources)), nil
+	}
+	planned := resource.After
+	if s.Terraspec.Destroy() {
+		// in destroy mode, asserts check the resources that will be destroyed
+		if resource.Action != plans.Delete {
+			return diags.Append(ErrorDiags(cty.GetAttrPath(assert.Key()), "Resource won't be destroyed").withMismatch(MismatchAction, cty.StringVal(plans.Delete.String()), cty.StringVal(resource.Action.String()))), nil
+		}
+		planned = resource.Before
+	} else if resource.Action == plans.Delete {
+		return diags.Append(ErrorDiags(cty.GetAttrPath(assert.Key()), "Resource will be destroyed").withMismatch(MismatchAction, cty.NilVal, cty.StringVal(resource.Action.String()))), nil
+	}
+
+	change, err := planned.Decode(untransformType(assert.Value.Type()))
+	if err != nil {
+		return nil, fmt.Errorf("Error happened while decoding planned resource %s : %v", assert.Name, err)
+	}
+
+	diags = diags.Append(c.checkAssert(cty.GetAttrPath(assert.Key()), assert.Value, change))
+	if !s.ShowSensitive && s.schemas != nil {
+		schema, _ := s.schemas.ResourceTypeConfig(resource.ProviderAddr.Provider, resource.Addr.Resource.Resource.Mode, resource.Addr.Resource.Resource.Type)
+		diags = redactSensitive(diags, schema, false)
+	}
+	if assert.Provider != "" {
+		expected := providerConfigAddr(s.Config, resource.Addr.Module.Module(), assert.Provider)
+		diags = diags.Append(checkProvider(cty.GetAttrPath(assert.Key()).GetAttr("provider"), assert.Provider, expected, resource.ProviderAddr))
+	}
 	return diags, nil
 }
 
+// validateReject checks a single reject against the planned resources, indexed by address
+func (s *Spec) validateReject(reject *TypeName, resources map[string]*plans.ResourceInstanceChangeSrc) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	resource := resources[reject.Key()]
+	if s.Terraspec.Destroy() {
+		if resource != nil && resource.Action == plans.Delete {
+			return diags.Append(RejectErrorDiags(cty.GetAttrPath(reject.Key()), reject, resource).withMismatch(MismatchRejected, cty.NilVal, cty.StringVal(resource.Action.String())))
+		}
+		return diags.Append(RejectSuccessDiags(cty.GetAttrPath(reject.Key()), "Resource not destroyed", reject))
+	}
+	if resource != nil && resource.Action != plans.Delete {
+		return diags.Append(RejectErrorDiags(cty.GetAttrPath(reject.Key()), reject, resource).withMismatch(MismatchRejected, cty.NilVal, cty.StringVal(resource.Action.String())))
+	}
+	return diags.Append(RejectSuccessDiags(cty.GetAttrPath(reject.Key()), "Resource not created", reject))
+}
+
+// eachConcurrently calls fn with every index below n, from at most workers goroutines, and returns once all calls completed.
+// A panic of fn is raised again in the calling goroutine, with its stack trace, once all calls completed
+func eachConcurrently(n, workers int, fn func(i int)) {
+	if n < workers {
+		workers = n
+	}
+	if workers < 2 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	var panicked sync.Once
+	var recovered *recoveredPanic
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					p := recoverPanic(r)
+					panicked.Do(func() { recovered = &p })
+					// keep receiving, so the indexes left are still sent
+					for range indexes {
+					}
+				}
+			}()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	if recovered != nil {
+		panic(*recovered)
+	}
+}
+
 // ValidateMocks checks all mocks were called as expected
 func (s *Spec) ValidateMocks() tfdiags.Diagnostics {
 	var diags tfdiags.Diagnostics
 	var allMissedCalls string
 	for _, mock := range s.Mocks {
+		first := len(diags)
 		if !mock.Called() {
 			if allMissedCalls == "" {
 				var sb strings.Builder
@@ -165,6 +468,7 @@ func (s *Spec) ValidateMocks() tfdiags.Diagnostics {
 		} else {
 			diags = diags.Append(SuccessDiags(cty.GetAttrPath(mock.Type).GetAttr(mock.Name), fmt.Sprintf("mock has been called %d time(s)", mock.calls)))
 		}
+		locate(diags[first:], mock.DeclRange)
 	}
 	return diags
 }
@@ -177,6 +481,71 @@ func findOuput(name string, outputs []*plans.OutputChangeSrc) *plans.OutputChang
 	}
 	return nil
 }
+
+// indexResources returns the changes of resources by address. The first change of an address wins, like findResource
+func indexResources(resources []*plans.ResourceInstanceChangeSrc) map[string]*plans.ResourceInstanceChangeSrc {
+	index := make(map[string]*plans.ResourceInstanceChangeSrc, len(resources))
+	for _, resource := range resources {
+		if _, ok := index[resource.Addr.String()]; !ok {
+			index[resource.Addr.String()] = resource
+		}
+	}
+	return index
+}
+
+// maxPlannedCandidates is the number of planned resources listed when an asserted resource is not in the plan
+const maxPlannedCandidates = 10
+
+// missingResource returns the error of an assert on a resource that is not in the plan. It lists the planned instances
+// of the same resource, eg in another module or with another index key, or else the planned resources of the same type
+func missingResource(assert *Assert, resources map[string]*plans.ResourceInstanceChangeSrc) *hcl.Diagnostic {
+	diag := &hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Resource not planned", Detail: fmt.Sprintf("Could not find resource %s in changes", assert.Key())}
+	if assert.DeclRange.Filename != "" {
+		diag.Subject = assert.DeclRange.Ptr()
+	}
+	addr, addrDiags := addrs.ParseAbsResourceInstanceStr(assert.Key())
+	if addrDiags.HasErrors() {
+		return diag
+	}
+
+	var sameResource, sameType []string
+	for key, resource := range resources {
+		planned := resource.Addr.Resource.Resource
+		switch {
+		case planned.Mode != addr.Resource.Resource.Mode || planned.Type != addr.Resource.Resource.Type:
+		case planned.Name == addr.Resource.Resource.Name:
+			sameResource = append(sameResource, key)
+		case resource.Addr.Module.Equal(addr.Module):
+			sameType = append(sameType, key)
+		}
+	}
+	switch {
+	case len(sameResource) > 0:
+		diag.Detail += fmt.Sprintf(". The plan holds other instances of this resource, check the module path and the index key : %s", listCandidates(sameResource))
+	case len(sameType) > 0:
+		diag.Detail += fmt.Sprintf(". Resources of type %s planned in the same module : %s.", addr.Resource.Resource.Type, listCandidates(sameType))
+		diag.Detail += didYouMean(assert.Key(), sameType)
+	default:
+		diag.Detail += fmt.Sprintf(". No resource of type %s is planned.", addr.Resource.Resource.Type)
+		planned := make([]string, 0, len(resources))
+		for key := range resources {
+			planned = append(planned, key)
+		}
+		sort.Strings(planned)
+		diag.Detail += didYouMean(assert.Key(), planned)
+	}
+	return diag
+}
+
+// listCandidates joins the sorted addresses, up to maxPlannedCandidates of them
+func listCandidates(candidates []string) string {
+	sort.Strings(candidates)
+	if len(candidates) <= maxPlannedCandidates {
+		return strings.Join(candidates, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(candidates[:maxPlannedCandidates], ", "), len(candidates)-maxPlannedCandidates)
+}
+
 func findResource(name string, resources []*plans.ResourceInstanceChangeSrc) *plans.ResourceInstanceChangeSrc {
 	for _, resource := range resources {
 		if name == resource.Addr.String() {
@@ -186,7 +555,79 @@ func findResource(name string, resources []*plans.ResourceInstanceChangeSrc) *pl
 	return nil
 }
 
+// providerConfigAddr returns the address of the provider configuration ref refers to, written as the provider argument of a resource
+// of module, eg aws.us_east_1. Like terraform does, the configurations passed to the module by its caller, or the default ones
+// it inherits, are followed to the module declaring them. Without cfg, ref is resolved in module with the implied provider of its name
+func providerConfigAddr(cfg *configs.Config, module addrs.Module, ref string) addrs.AbsProviderConfig {
+	parts := strings.SplitN(ref, ".", 2)
+	local := addrs.LocalProviderConfig{LocalName: parts[0]}
+	if len(parts) == 2 {
+		local.Alias = parts[1]
+	}
+	var c *configs.Config
+	if cfg != nil {
+		c = cfg.Descendent(module)
+	}
+	if c == nil {
+		return addrs.AbsProviderConfig{Module: module, Provider: addrs.ImpliedProviderForUnqualifiedType(local.LocalName), Alias: local.Alias}
+	}
+
+	for {
+		provider := c.Module.ProviderForLocalConfig(local)
+		if _, declared := c.Module.ProviderConfigs[local.String()]; declared || c.Parent == nil {
+			return addrs.AbsProviderConfig{Module: c.Path, Provider: provider, Alias: local.Alias}
+		}
+		passed := false
+		if call := c.Parent.Module.ModuleCalls[c.Path[len(c.Path)-1]]; call != nil {
+			for _, p := range call.Providers {
+				if p.InChild.Name == local.LocalName && p.InChild.Alias == local.Alias {
+					local = addrs.LocalProviderConfig{LocalName: p.InParent.Name, Alias: p.InParent.Alias}
+					passed = true
+					break
+				}
+			}
+		}
+		if !passed {
+			// only the default configurations are inherited
+			if local.Alias != "" {
+				return addrs.AbsProviderConfig{Module: c.Path, Provider: provider, Alias: local.Alias}
+			}
+			local = addrs.LocalProviderConfig{LocalName: c.Parent.Module.LocalNameForProvider(provider)}
+		}
+		c = c.Parent
+	}
+}
+
+// checkProvider checks the provider configuration got a resource is bound to is the expected one, which the spec wrote as ref
+func checkProvider(path cty.Path, ref string, expected, got addrs.AbsProviderConfig) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	if got.String() != expected.String() {
+		diags = diags.Append(AssertErrorDiags(path, expected.String(), got.String()).withMismatch(MismatchValue, cty.StringVal(expected.String()), cty.StringVal(got.String())))
+	} else {
+		diags = diags.Append(SuccessDiags(path, ref))
+	}
+	return diags
+}
+
 func findAttribute(key, value cty.Value) cty.Value {
+	if value.IsNull() {
+		return cty.NilVal
+	}
+	// attributes of objects and keys of maps are looked up directly, rather than by iterating over all of them
+	if value.IsKnown() {
+		switch {
+		case value.Type().IsObjectType():
+			if value.Type().HasAttribute(key.AsString()) {
+				return value.GetAttr(key.AsString())
+			}
+			return cty.NilVal
+		case value.Type().IsMapType():
+			if value.HasIndex(key).True() {
+				return value.Index(key)
+			}
+			return cty.NilVal
+		}
+	}
 	if value.CanIterateElements() {
 		it := value.ElementIterator()
 		for it.Next() {
@@ -199,11 +640,14 @@ func findAttribute(key, value cty.Value) cty.Value {
 	return cty.NilVal
 }
 
-func checkAssert(path cty.Path, expected, got cty.Value) tfdiags.Diagnostics {
+func (c comparison) checkAssert(path cty.Path, expected, got cty.Value) tfdiags.Diagnostics {
 	var diags tfdiags.Diagnostics
+	if call := matcherCallOf(expected); call != nil {
+		return call.check(path, got)
+	}
 	if expected.Type().IsPrimitiveType() {
-		if !got.IsKnown() || !expected.Equals(got).True() {
-			diags = diags.Append(AssertErrorDiags(path, PrimitiveValue(expected), PrimitiveValue(got)))
+		if !c.equal(expected, got) {
+			diags = diags.Append(AssertErrorDiags(path, PrimitiveValue(expected), PrimitiveValue(got)).withMismatch(MismatchValue, expected, got))
 		} else {
 			diags = diags.Append(SuccessDiags(path, PrimitiveValue(got)))
 		}
@@ -211,9 +655,12 @@ func checkAssert(path cty.Path, expected, got cty.Value) tfdiags.Diagnostics {
 	}
 	if expected.CanIterateElements() {
 		if !got.CanIterateElements() {
-			diags = diags.Append(ErrorDiags(path, "Element don't have multiple properties"))
+			diags = diags.Append(ErrorDiags(path, "Element don't have multiple properties").withMismatch(MismatchType, expected, got))
 			return diags
 		}
+		if expected.Type().IsSetType() {
+			return diags.Append(c.checkSet(path, expected, got))
+		}
 
 		it := expected.ElementIterator()
 		gt := got.ElementIterator()
@@ -221,23 +668,27 @@ func checkAssert(path cty.Path, expected, got cty.Value) tfdiags.Diagnostics {
 		for it.Next() {
 			key, value := it.Element()
 			if key.Type() == cty.String && key.AsString() == "reject" {
-				diags = diags.Append(checkReject(path.GetAttr(key.AsString()), value, got))
+				diags = diags.Append(c.checkReject(path.GetAttr(key.AsString()), value, got))
 				continue
 			}
-			if IsNull(value) {
+			if matcherCallOf(value) == nil && IsNull(value) {
 				continue //skip attributes with no spec
 			}
 			if key.Type() == cty.String {
 				// Looping over object properties or a map
 				g := findAttribute(key, got)
-				diags = diags.Append(checkAssert(path.GetAttr(key.AsString()), value, g))
+				if suggestion := keySuggestion(key.AsString(), got); g == cty.NilVal && suggestion != "" {
+					diags = diags.Append(ErrorDiags(path.GetAttr(key.AsString()), fmt.Sprintf("No %s key in the plan. Did you mean %q?", key.AsString(), suggestion)).withMismatch(MismatchMissing, value, cty.NilVal))
+				} else {
+					diags = diags.Append(c.checkAssert(path.GetAttr(key.AsString()), value, g))
+				}
 			} else {
 				// looping over a set or an array:
 				if gt.Next() {
 					_, g := gt.Element()
-					diags = diags.Append(checkAssert(path.Index(cty.NumberIntVal(int64(childIndex))), value, g))
+					diags = diags.Append(c.checkAssert(path.Index(cty.NumberIntVal(int64(childIndex))), value, g))
 				} else {
-					diags = diags.Append(ErrorDiags(path.Index(cty.NumberIntVal(int64(childIndex))), fmt.Sprintf("Could not find child at index %d", childIndex)))
+					diags = diags.Append(ErrorDiags(path.Index(cty.NumberIntVal(int64(childIndex))), fmt.Sprintf("Could not find child at index %d", childIndex)).withMismatch(MismatchMissing, value, cty.NilVal))
 				}
 			}
 			childIndex++
@@ -248,29 +699,184 @@ func checkAssert(path cty.Path, expected, got cty.Value) tfdiags.Diagnostics {
 	return diags
 }
 
-// checkAssertAmong will test assertion among all element in given ElementIterator and only return
-// the diagnostict for the closest match
-func checkAssertAmong(path cty.Path, expected cty.Value, got cty.ElementIterator) tfdiags.Diagnostics {
-	var closestDiags, diags tfdiags.Diagnostics
-	// looping over a set or an array:
-	for got.Next() {
-		_, g := got.Element()
-		diags = checkAssert(path, expected, g)
-		if closestDiags == nil {
-			closestDiags = diags
-		} else {
-			if Compare(closestDiags, diags) > 0 {
-				closestDiags = diags
+// checkSet checks the elements of a set whatever their order : every expected element is checked against the planned element
+// it's paired with by pairSetElements. An expected element matching no planned element is checked against the closest planned
+// element left, the one with the fewest errors, so the report shows what differs rather than a missing element
+func (c comparison) checkSet(path cty.Path, expected, got cty.Value) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	if !got.IsKnown() {
+		return diags.Append(ErrorDiags(path, "Set is unknown until apply").withMismatch(MismatchValue, expected, got))
+	}
+	expectedElements, planned := setElements(expected), setElements(got)
+	pairs := c.pairSetElements(path, expectedElements, planned)
+	used := make([]bool, len(planned))
+	for _, p := range pairs {
+		if p >= 0 {
+			used[p] = true
+		}
+	}
+	for i, value := range expectedElements {
+		elementPath := path.Index(cty.NumberIntVal(int64(i)))
+		if pairs[i] >= 0 {
+			diags = diags.Append(c.checkAssert(elementPath, value, planned[pairs[i]]))
+			continue
+		}
+		var closest tfdiags.Diagnostics
+		closestIndex, fewestErrors := -1, 0
+		for j, g := range planned {
+			if used[j] {
+				continue
+			}
+			result := c.checkAssert(elementPath, value, g)
+			if errors := countErrors(result); closestIndex < 0 || errors < fewestErrors {
+				closest, closestIndex, fewestErrors = result, j, errors
 			}
 		}
-		if !closestDiags.HasErrors() {
-			break // early break as soon as there's a successDiags
+		if closestIndex < 0 {
+			diags = diags.Append(ErrorDiags(elementPath, fmt.Sprintf("Could not find child at index %d", i)).withMismatch(MismatchMissing, value, cty.NilVal))
+			continue
+		}
+		used[closestIndex] = true
+		diags = diags.Append(closest)
+	}
+	return diags
+}
+
+// setElements returns the elements of a set, leaving out the expected elements with no spec. A null set has no element
+func setElements(set cty.Value) []cty.Value {
+	if set.IsNull() {
+		return nil
+	}
+	var elements []cty.Value
+	for it := set.ElementIterator(); it.Next(); {
+		_, value := it.Element()
+		if matcherCallOf(value) == nil && IsNull(value) {
+			continue
 		}
+		elements = append(elements, value)
 	}
-	return closestDiags
+	return elements
 }
 
-func checkReject(path cty.Path, rejected, got cty.Value) tfdiags.Diagnostics {
+// pairSetElements pairs the expected elements of a set with distinct planned elements they match. An expected element
+// asserting only some attributes can match several planned elements, so rather than taking the first match, the pairing
+// is the one matching the most expected elements. pairs[i] is the index of the planned element paired with the expected
+// element i, or -1 when it's left without a match
+func (c comparison) pairSetElements(path cty.Path, expected, planned []cty.Value) []int {
+	match := make([][]bool, len(expected))
+	for i, value := range expected {
+		match[i] = make([]bool, len(planned))
+		for j, g := range planned {
+			match[i][j] = c.matches(path.Index(cty.NumberIntVal(int64(i))), value, g)
+		}
+	}
+
+	// owners[j] is the expected element paired with the planned element j. Pairs are built by augmenting paths :
+	// an expected element can take a planned element from another one that can be paired elsewhere
+	owners := make([]int, len(planned))
+	for j := range owners {
+		owners[j] = -1
+	}
+	var augment func(i int, visited []bool) bool
+	augment = func(i int, visited []bool) bool {
+		for j := range planned {
+			if !match[i][j] || visited[j] {
+				continue
+			}
+			visited[j] = true
+			if owners[j] < 0 || augment(owners[j], visited) {
+				owners[j] = i
+				return true
+			}
+		}
+		return false
+	}
+	for i := range expected {
+		augment(i, make([]bool, len(planned)))
+	}
+
+	pairs := make([]int, len(expected))
+	for i := range pairs {
+		pairs[i] = -1
+	}
+	for j, i := range owners {
+		if i >= 0 {
+			pairs[i] = j
+		}
+	}
+	return pairs
+}
+
+func countErrors(diags tfdiags.Diagnostics) int {
+	count := 0
+	for _, diag := range diags {
+		if diag.Severity() == tfdiags.Error {
+			count++
+		}
+	}
+	return count
+}
+
+// matches tells whether got satisfies the assertion expected, as checkAssert would report it without errors.
+// Rejects only need to know whether a value matches, so it stops at the first mismatch and builds no diagnostic
+func (c comparison) matches(path cty.Path, expected, got cty.Value) bool {
+	if call := matcherCallOf(expected); call != nil {
+		return !call.check(path, got).HasErrors()
+	}
+	if expected.Type().IsPrimitiveType() {
+		return c.equal(expected, got)
+	}
+	if !expected.CanIterateElements() {
+		return true
+	}
+	if !got.CanIterateElements() {
+		return false
+	}
+	if expected.Type().IsSetType() {
+		if !got.IsKnown() {
+			return false
+		}
+		for _, p := range c.pairSetElements(path, setElements(expected), setElements(got)) {
+			if p < 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	it := expected.ElementIterator()
+	gt := got.ElementIterator()
+	childIndex := 0
+	for it.Next() {
+		key, value := it.Element()
+		if key.Type() == cty.String && key.AsString() == "reject" {
+			if c.checkReject(path.GetAttr(key.AsString()), value, got).HasErrors() {
+				return false
+			}
+			continue
+		}
+		if matcherCallOf(value) == nil && IsNull(value) {
+			continue
+		}
+		if key.Type() == cty.String {
+			if !c.matches(path.GetAttr(key.AsString()), value, findAttribute(key, got)) {
+				return false
+			}
+		} else {
+			if !gt.Next() {
+				return false
+			}
+			_, g := gt.Element()
+			if !c.matches(path.Index(cty.NumberIntVal(int64(childIndex))), value, g) {
+				return false
+			}
+		}
+		childIndex++
+	}
+	return true
+}
+
+func (c comparison) checkReject(path cty.Path, rejected, got cty.Value) tfdiags.Diagnostics {
 	var diags tfdiags.Diagnostics
 	if rejected.CanIterateElements() && !rejected.IsNull() {
 		it := rejected.ElementIterator()
@@ -284,16 +890,15 @@ func checkReject(path cty.Path, rejected, got cty.Value) tfdiags.Diagnostics {
 				// If value is nil, it means that the rejected property is only defined as an empty block
 				if !IsNull(found) {
 					errorElement := cty.ObjectVal(map[string]cty.Value{key.AsString(): found})
-					diags = diags.Append(RejectErrorDiags(path.GetAttr(key.AsString()), key.AsString(), string(MarshalValue(errorElement))))
+					diags = diags.Append(RejectErrorDiags(path.GetAttr(key.AsString()), key.AsString(), string(MarshalValue(errorElement))).withMismatch(MismatchRejected, cty.NilVal, found))
 				} else {
 					diags = diags.Append(RejectSuccessDiags(path.GetAttr(key.AsString()), fmt.Sprintf("No attribute matching %v", key.AsString()), value))
 				}
 			} else {
 				if value.Type().IsListType() || value.Type().IsSetType() {
-					diags = diags.Append(checkRejectCollection(path, key, value, found))
+					diags = diags.Append(c.checkRejectCollection(path, key, value, found))
 				} else {
-					assertDiags := checkAssert(path.GetAttr(key.AsString()), value, found)
-					if assertDiags.HasErrors() {
+					if !c.matches(path.GetAttr(key.AsString()), value, found) {
 						//this means checkAssert is wrong, so found block doesn't match the reject block : it's a success
 						diags = diags.Append(RejectSuccessDiags(path, fmt.Sprintf("No attribute matching %v definition", key.AsString()), value))
 					} else {
@@ -308,17 +913,25 @@ func checkReject(path cty.Path, rejected, got cty.Value) tfdiags.Diagnostics {
 }
 
 // checkRejectCollection will check all rejections of a colllection type
-func checkRejectCollection(path cty.Path, key cty.Value, reject, found cty.Value) tfdiags.Diagnostics {
+func (c comparison) checkRejectCollection(path cty.Path, key cty.Value, reject, found cty.Value) tfdiags.Diagnostics {
 	var diags tfdiags.Diagnostics
 	if reject.CanIterateElements() {
 		it := reject.ElementIterator()
 		for it.Next() {
 			_, r := it.Element()
-			var assertDiags tfdiags.Diagnostics
+			// the rejected element is only missing when the collection has elements and none of them matches it
+			missing := false
 			if found.Type().IsSetType() || found.Type().IsListType() {
-				assertDiags = checkAssertAmong(path, r, found.ElementIterator())
+				for elements := found.ElementIterator(); elements.Next(); {
+					_, g := elements.Element()
+					if c.matches(path, r, g) {
+						missing = false
+						break
+					}
+					missing = true
+				}
 			}
-			if assertDiags.HasErrors() {
+			if missing {
 				//this means checkAssert is wrong, so found block doesn't match the reject block : it's a success
 				diags = diags.Append(RejectSuccessDiags(path, fmt.Sprintf("No attribute matching %v definition", key.AsString()), r))
 			} else {
@@ -330,7 +943,7 @@ func checkRejectCollection(path cty.Path, key cty.Value, reject, found cty.Value
 	return diags
 }
 
-func checkOutput(path cty.Path, expected, got cty.Value) tfdiags.Diagnostics {
+func (c comparison) checkOutput(path cty.Path, expected, got cty.Value) tfdiags.Diagnostics {
 	var diags tfdiags.Diagnostics
 	if !got.CanIterateElements() {
 		diags = diags.Append(ErrorDiags(path, "Cannot parse planned output"))
@@ -349,11 +962,12 @@ func checkOutput(path cty.Path, expected, got cty.Value) tfdiags.Diagnostics {
 		diags = diags.Append(ErrorDiags(path, "Bad Assertion : Assertion on outputs should have a value parameter"))
 		return diags
 	}
-	return checkAssert(path, exp, value)
+	return c.checkAssert(path, exp, value)
 
 }
 
 // ReadSpec reads the .tfspec file and returns the resulting Spec or a Diagnostics if error occured in the process
+// The asserts, rejects and mocks of the Spec keep the source range of their block, so tools can analyze spec files
 func ReadSpec(filename string, schemas *terraform.Schemas) (*Spec, tfdiags.Diagnostics) {
 	spec, err := ioutil.ReadFile(filename)
 	var tfdiags tfdiags.Diagnostics
@@ -366,8 +980,54 @@ func ReadSpec(filename string, schemas *terraform.Schemas) (*Spec, tfdiags.Diagn
 
 }
 
+// ReadTerraspecConfig only reads the terraspec block of the .tfspec file.
+// It's meant to get the settings of a test case before provider schemas are available to parse the full spec
+func ReadTerraspecConfig(filename string) (*TerraspecConfig, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	file, hclDiags := hclparse.NewParser().ParseHCLFile(filename)
+	if hclDiags.HasErrors() {
+		return nil, diags.Append(hclDiags)
+	}
+	content, _, hclDiags := file.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "terraspec"}},
+	})
+	if hclDiags.HasErrors() {
+		return nil, diags.Append(hclDiags)
+	}
+	ctx := &hcl.EvalContext{Variables: make(map[string]cty.Value)}
+	for _, block := range content.Blocks {
+		config, hclDiags := decodeTerraspecConfig(block.Body, ctx)
+		if hclDiags.HasErrors() {
+			return nil, diags.Append(hclDiags)
+		}
+		config.resolvePaths(filename)
+		return config, diags
+	}
+	return &TerraspecConfig{}, diags
+}
+
+// resolvePaths makes the paths of the config relative to the spec file they were written in
+func (c *TerraspecConfig) resolvePaths(specFile string) {
+	if c.StateFile != "" && !filepath.IsAbs(c.StateFile) {
+		c.StateFile = filepath.Join(filepath.Dir(specFile), c.StateFile)
+	}
+	if c.PlanFile != "" && !filepath.IsAbs(c.PlanFile) {
+		c.PlanFile = filepath.Join(filepath.Dir(specFile), c.PlanFile)
+	}
+	for i, policy := range c.Policies {
+		if !filepath.IsAbs(policy) {
+			c.Policies[i] = filepath.Join(filepath.Dir(specFile), policy)
+		}
+	}
+}
+
 // ParseSpec parses the spec contained in the []byte parameter and returns the resulting Spec or a Diagnostics if error occured in the process
 func ParseSpec(spec []byte, filename string, schemas *terraform.Schemas) (*Spec, hcl.Diagnostics) {
+	return parseSpec(spec, filename, schemas, map[string]bool{absPath(filename): true})
+}
+
+// parseSpec parses the spec file filename, while importing holds the absolute paths of the spec files importing it
+func parseSpec(spec []byte, filename string, schemas *terraform.Schemas, importing map[string]bool) (*Spec, hcl.Diagnostics) {
 	type terraspec struct {
 		Body hcl.Body `hcl:",remain"`
 	}
@@ -376,62 +1036,179 @@ func ParseSpec(spec []byte, filename string, schemas *terraform.Schemas) (*Spec,
 		Name      string         `hcl:"name,label"`
 		Config    hcl.Body       `hcl:",remain"`
 		DependsOn hcl.Expression `hcl:"depends_on,attr"`
+		Provider  hcl.Expression `hcl:"provider,attr"`
+		Message   hcl.Expression `hcl:"message,attr"`
+		// Tolerance, RoundNumbers and Normalize set how the values of the assert are compared
+		Tolerance    hcl.Expression `hcl:"tolerance,attr"`
+		RoundNumbers hcl.Expression `hcl:"round_numbers,attr"`
+		Normalize    hcl.Expression `hcl:"normalize,attr"`
 	}
 	type mock struct {
 		Type   string   `hcl:"type,label"`
 		Name   string   `hcl:"name,label"`
 		Config hcl.Body `hcl:",remain"`
 	}
+	type mockCount struct {
+		Type  string `hcl:"type,label"`
+		Name  string `hcl:"name,label"`
+		Count int    `hcl:"count,attr"`
+	}
+	type state struct {
+		Type   string   `hcl:"type,label"`
+		Name   string   `hcl:"name,label"`
+		Config hcl.Body `hcl:",remain"`
+	}
 	type reject struct {
 		Type   string   `hcl:"type,label"`
 		Name   string   `hcl:"name,label"`
 		Config hcl.Body `hcl:",remain"`
 	}
+	type hookFile struct {
+		Path    string `hcl:"path,label"`
+		Content string `hcl:"content,attr"`
+	}
+	type beforeHook struct {
+		Command []string    `hcl:"command,optional"`
+		Files   []*hookFile `hcl:"file,block"`
+	}
+	type afterHook struct {
+		Command []string `hcl:"command,optional"`
+	}
+	type scan struct {
+		Scanner     string   `hcl:"scanner,label"`
+		MinSeverity string   `hcl:"min_severity,optional"`
+		SkipChecks  []string `hcl:"skip_checks,optional"`
+	}
+	type importBlock struct {
+		Source string `hcl:"source,attr"`
+	}
+	type lint struct {
+		Ruleset string   `hcl:"ruleset,optional"`
+		Config  string   `hcl:"config,optional"`
+		Rules   []string `hcl:"rules,optional"`
+	}
 	type root struct {
 		Asserts []*assert `hcl:"assert,block"`
 		Rejects []*reject `hcl:"reject,block"`
 		Mocks   []*mock   `hcl:"mock,block"`
+		// MockCounts force the count of resources that depend on values unknown until apply
+		MockCounts []*mockCount `hcl:"mock_count,block"`
+		State      []*state     `hcl:"state,block"`
 		// Modules   []*Module   `hcl:"module,block"`
-		Terraspec *terraspec `hcl:"terraspec,block"`
+		Terraspec *terraspec    `hcl:"terraspec,block"`
+		Before    []*beforeHook `hcl:"before,block"`
+		After     []*afterHook  `hcl:"after,block"`
+		Lints     []*lint       `hcl:"lint,block"`
+		Scans     []*scan       `hcl:"scan,block"`
+		// Imports add the assert, reject and mock blocks of other spec files
+		Imports []*importBlock `hcl:"import,block"`
 	}
 
 	var r root
 	parsed := &Spec{}
 	file, diags := hclparse.NewParser().ParseHCL(spec, filename)
 	ctx := &hcl.EvalContext{
-		Variables: make(map[string]cty.Value),
+		// the plan is unknown until BindPlan is called
+		Variables: map[string]cty.Value{PlanVariable: cty.DynamicVal},
+		Functions: specFunctions(),
 	}
+	parsed.evalCtx = ctx
+	parsed.schemas = schemas
 
 	if diags.HasErrors() {
 		return nil, diags
 	}
-	diags = gohcl.DecodeBody(file.Body, nil, &r)
+	version, body, diags := specVersion(file.Body)
 	if diags.HasErrors() {
 		return nil, diags
 	}
+	parsed.Version = version
+	diags = gohcl.DecodeBody(body, nil, &r)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if version >= 2 && len(r.MockCounts) > 0 {
+		for _, rng := range blockRanges(file.Body, "mock_count", "type", "name") {
+			rng := rng
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported block type",
+				Detail:   "mock_count blocks were replaced by the mock_counts attribute of the terraspec block in version 2 of the spec language. Run terraspec migrate to rewrite spec files written for version 1",
+				Subject:  &rng,
+			})
+		}
+		return nil, diags
+	}
 
 	if r.Terraspec != nil && r.Terraspec.Body != nil {
 		terraspecConfig, diags := decodeTerraspecConfig(r.Terraspec.Body, ctx)
 		if diags.HasErrors() {
 			return nil, diags
 		}
+		terraspecConfig.resolvePaths(filename)
 		parsed.Terraspec = terraspecConfig
+		parsed.CountMocks = terraspecConfig.MockCounts
 	} else {
 		parsed.Terraspec = &TerraspecConfig{}
 	}
 
-	for _, assert := range r.Asserts {
+	// the errors of all the asserts are reported at once, so the typos of a spec are fixed in one go
+	var assertDiags hcl.Diagnostics
+	assertRanges := blockRanges(file.Body, "assert", "type", "name")
+	for i, assert := range r.Asserts {
 		val, diags := decodeBody(assert.Config, assert.Type, schemas, ctx)
 		if diags.HasErrors() {
+			assertDiags = append(assertDiags, diags...)
+			continue
+		}
+		provider, diags := decodeProviderRef(assert.Provider)
+		if diags.HasErrors() {
+			assertDiags = append(assertDiags, diags...)
+			continue
+		}
+		message, diags := decodeMessage(assert.Message, ctx)
+		if diags.HasErrors() {
+			assertDiags = append(assertDiags, diags...)
+			continue
+		}
+		a := NewAssert(assert.Type, assert.Name, val)
+		a.Provider = provider
+		a.Message = message
+		if diags := decodeComparison(a, assert.Tolerance, assert.RoundNumbers, assert.Normalize, ctx); diags.HasErrors() {
+			assertDiags = append(assertDiags, diags...)
+			continue
+		}
+		a.DeclRange = assertRanges[i]
+		a.Config = assert.Config
+		parsed.Asserts = append(parsed.Asserts, a)
+	}
+	if assertDiags.HasErrors() {
+		return nil, assertDiags
+	}
+	var imported []*Spec
+	importRanges := blockRanges(file.Body, "import")
+	for i, imp := range r.Imports {
+		specs, importDiags := importSpecs(imp.Source, importRanges[i], filename, schemas, importing)
+		diags = append(diags, importDiags...)
+		if importDiags.HasErrors() {
 			return nil, diags
 		}
-		parsed.Asserts = append(parsed.Asserts, NewAssert(assert.Type, assert.Name, val))
+		imported = append(imported, specs...)
+	}
+	for _, spec := range imported {
+		parsed.Asserts = append(parsed.Asserts, spec.Asserts...)
+	}
+	diags = append(diags, checkConflictingAsserts(parsed.Asserts)...)
+	if diags.HasErrors() {
+		return nil, diags
 	}
 
-	for _, assert := range r.Rejects {
-		parsed.Rejects = append(parsed.Rejects, &TypeName{Name: assert.Name, Type: assert.Type})
+	rejectRanges := blockRanges(file.Body, "reject", "type", "name")
+	for i, assert := range r.Rejects {
+		parsed.Rejects = append(parsed.Rejects, &TypeName{Name: assert.Name, Type: assert.Type, DeclRange: rejectRanges[i], Config: assert.Config})
 	}
-	for _, mock := range r.Mocks {
+	mockRanges := blockRanges(file.Body, "mock", "type", "name")
+	for i, mock := range r.Mocks {
 		query, mocked, diags := decodeMockBody(mock.Config, mock.Type, schemas, ctx)
 		if diags.HasErrors() {
 			return nil, diags
@@ -440,12 +1217,68 @@ func ParseSpec(spec []byte, filename string, schemas *terraform.Schemas) (*Spec,
 		if r, ok := mock.Config.(*hclsyntax.Body); ok {
 			body = r.Range().SliceBytes(file.Bytes)
 		}
-		parsed.Mocks = append(parsed.Mocks, NewMock(mock.Type, mock.Name, query, mocked, body))
+		m := NewMock(mock.Type, mock.Name, query, mocked, body)
+		m.DeclRange = mockRanges[i]
+		m.Config = mock.Config
+		parsed.Mocks = append(parsed.Mocks, m)
+	}
+	for _, spec := range imported {
+		parsed.Rejects = append(parsed.Rejects, spec.Rejects...)
+		parsed.Mocks = append(parsed.Mocks, spec.Mocks...)
+	}
+	for _, state := range r.State {
+		val, diags := decodeStateBody(state.Config, state.Type, schemas, ctx)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		parsed.State = append(parsed.State, NewStateResource(state.Type, state.Name, val))
+	}
+	beforeRanges := blockRanges(file.Body, "before")
+	for i, hook := range r.Before {
+		var files []*HookFile
+		for _, f := range hook.Files {
+			files = append(files, &HookFile{Path: f.Path, Content: f.Content})
+		}
+		parsed.Before = append(parsed.Before, newHook(hook.Command, files, beforeRanges[i], filename))
+	}
+	afterRanges := blockRanges(file.Body, "after")
+	for i, hook := range r.After {
+		parsed.After = append(parsed.After, newHook(hook.Command, nil, afterRanges[i], filename))
+	}
+	lintRanges := blockRanges(file.Body, "lint")
+	for i, lint := range r.Lints {
+		parsed.Lints = append(parsed.Lints, newTflint(lint.Ruleset, lint.Config, lint.Rules, lintRanges[i], filename))
+	}
+	scanRanges := blockRanges(file.Body, "scan", "scanner")
+	for i, scan := range r.Scans {
+		s, diags := newScan(scan.Scanner, scan.MinSeverity, scan.SkipChecks, scanRanges[i])
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		parsed.Scans = append(parsed.Scans, s)
+	}
+	for _, mockCount := range r.MockCounts {
+		if parsed.CountMocks == nil {
+			parsed.CountMocks = make(map[string]int, len(r.MockCounts))
+		}
+		parsed.CountMocks[fmt.Sprintf("%s.%s", mockCount.Type, mockCount.Name)] = mockCount.Count
 	}
 
 	return parsed, diags
 }
 
+// blockRanges returns the source ranges of the headers of the blocks of the given type, in declaration order
+func blockRanges(body hcl.Body, blockType string, labelNames ...string) []hcl.Range {
+	content, _, _ := body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: blockType, LabelNames: labelNames}},
+	})
+	ranges := make([]hcl.Range, len(content.Blocks))
+	for i, block := range content.Blocks {
+		ranges[i] = block.DefRange
+	}
+	return ranges
+}
+
 func decodeTerraspecConfig(body hcl.Body, ctx *hcl.EvalContext) (*TerraspecConfig, hcl.Diagnostics) {
 	spec := hcldec.ObjectSpec{
 		"workspace": &hcldec.AttrSpec{
@@ -453,6 +1286,87 @@ func decodeTerraspecConfig(body hcl.Body, ctx *hcl.EvalContext) (*TerraspecConfi
 			Type:     cty.String,
 			Required: false,
 		},
+		"state_file": &hcldec.AttrSpec{
+			Name:     "state_file",
+			Type:     cty.String,
+			Required: false,
+		},
+		"plan_file": &hcldec.AttrSpec{
+			Name:     "plan_file",
+			Type:     cty.String,
+			Required: false,
+		},
+		"plan_mode": &hcldec.AttrSpec{
+			Name:     "plan_mode",
+			Type:     cty.String,
+			Required: false,
+		},
+		"targets": &hcldec.AttrSpec{
+			Name:     "targets",
+			Type:     cty.List(cty.String),
+			Required: false,
+		},
+		"policies": &hcldec.AttrSpec{
+			Name:     "policies",
+			Type:     cty.List(cty.String),
+			Required: false,
+		},
+		"expect_empty_plan": &hcldec.AttrSpec{
+			Name:     "expect_empty_plan",
+			Type:     cty.Bool,
+			Required: false,
+		},
+		"strict": &hcldec.AttrSpec{
+			Name:     "strict",
+			Type:     cty.Bool,
+			Required: false,
+		},
+		"skip": &hcldec.AttrSpec{
+			Name:     "skip",
+			Type:     cty.String,
+			Required: false,
+		},
+		"tolerance": &hcldec.AttrSpec{
+			Name:     "tolerance",
+			Type:     cty.Number,
+			Required: false,
+		},
+		"round_numbers": &hcldec.AttrSpec{
+			Name:     "round_numbers",
+			Type:     cty.Bool,
+			Required: false,
+		},
+		"normalize": &hcldec.AttrSpec{
+			Name:     "normalize",
+			Type:     cty.List(cty.String),
+			Required: false,
+		},
+		"expect_failure": &hcldec.AttrSpec{
+			Name:     "expect_failure",
+			Type:     cty.String,
+			Required: false,
+		},
+		"provider_versions": &hcldec.AttrSpec{
+			Name:     "provider_versions",
+			Type:     cty.Map(cty.String),
+			Required: false,
+		},
+		"mock_counts": &hcldec.AttrSpec{
+			Name:     "mock_counts",
+			Type:     cty.Map(cty.Number),
+			Required: false,
+		},
+		"remote_state": &hcldec.BlockSpec{
+			TypeName: "remote_state",
+			Nested: hcldec.ObjectSpec{
+				"hostname": &hcldec.DefaultSpec{
+					Primary: &hcldec.AttrSpec{Name: "hostname", Type: cty.String},
+					Default: &hcldec.LiteralSpec{Value: cty.StringVal("app.terraform.io")},
+				},
+				"organization": &hcldec.AttrSpec{Name: "organization", Type: cty.String, Required: true},
+				"workspace":    &hcldec.AttrSpec{Name: "workspace", Type: cty.String, Required: true},
+			},
+		},
 	}
 
 	val, diags := hcldec.Decode(body, spec, nil)
@@ -460,22 +1374,154 @@ func decodeTerraspecConfig(body hcl.Body, ctx *hcl.EvalContext) (*TerraspecConfi
 		return nil, diags
 	}
 
-	workspaceName := ""
+	config := &TerraspecConfig{PlanMode: PlanModeNormal}
 	if !val.IsNull() {
-		workspace := val.GetAttr("workspace")
 		ctx.Variables["terraspec"] = val
-		workspaceName = workspace.AsString()
+		if workspace := val.GetAttr("workspace"); !workspace.IsNull() {
+			config.Workspace = workspace.AsString()
+		}
+		if stateFile := val.GetAttr("state_file"); !stateFile.IsNull() {
+			config.StateFile = stateFile.AsString()
+		}
+		if planFile := val.GetAttr("plan_file"); !planFile.IsNull() {
+			config.PlanFile = planFile.AsString()
+		}
+		if planMode := val.GetAttr("plan_mode"); !planMode.IsNull() {
+			config.PlanMode = planMode.AsString()
+			if !planModes[config.PlanMode] {
+				return nil, diags.Append(&hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Invalid plan_mode", Detail: fmt.Sprintf("plan_mode must be one of %q, %q or %q, got %q", PlanModeNormal, PlanModeDestroy, PlanModeRefreshOnly, config.PlanMode)})
+			}
+		}
+		if targets := val.GetAttr("targets"); !targets.IsNull() {
+			for _, target := range targets.AsValueSlice() {
+				addr, targetDiags := parseTarget(target.AsString())
+				if targetDiags.HasErrors() {
+					return nil, diags.Extend(targetDiags)
+				}
+				config.Targets = append(config.Targets, addr)
+			}
+		}
+		if policies := val.GetAttr("policies"); !policies.IsNull() {
+			for _, policy := range policies.AsValueSlice() {
+				config.Policies = append(config.Policies, policy.AsString())
+			}
+		}
+		if expectEmpty := val.GetAttr("expect_empty_plan"); !expectEmpty.IsNull() {
+			config.ExpectEmptyPlan = expectEmpty.True()
+		}
+		if strict := val.GetAttr("strict"); !strict.IsNull() {
+			config.Strict = strict.True()
+		}
+		if skip := val.GetAttr("skip"); !skip.IsNull() {
+			config.Skip = skip.AsString()
+		}
+		if tolerance := val.GetAttr("tolerance"); !tolerance.IsNull() {
+			config.Tolerance, _ = tolerance.AsBigFloat().Float64()
+			if config.Tolerance < 0 {
+				return nil, diags.Append(invalidTolerance(nil))
+			}
+		}
+		if round := val.GetAttr("round_numbers"); !round.IsNull() {
+			config.RoundNumbers = round.True()
+		}
+		if normalize := val.GetAttr("normalize"); !normalize.IsNull() {
+			for _, encoding := range normalize.AsValueSlice() {
+				config.Normalize = append(config.Normalize, encoding.AsString())
+			}
+			if diags := checkEncodings(config.Normalize, nil); diags.HasErrors() {
+				return nil, diags
+			}
+		}
+		if expectFailure := val.GetAttr("expect_failure"); !expectFailure.IsNull() {
+			config.ExpectFailure = expectFailure.AsString()
+		}
+		if versions := val.GetAttr("provider_versions"); !versions.IsNull() {
+			config.ProviderVersions = make(map[string]string, versions.LengthInt())
+			for k, v := range versions.AsValueMap() {
+				config.ProviderVersions[k] = v.AsString()
+			}
+		}
+		if counts := val.GetAttr("mock_counts"); !counts.IsNull() {
+			config.MockCounts = make(map[string]int, counts.LengthInt())
+			for addr, count := range counts.AsValueMap() {
+				var n int
+				if err := gocty.FromCtyValue(count, &n); err != nil {
+					return nil, diags.Append(&hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Invalid mock_counts", Detail: fmt.Sprintf("The count of %s must be a whole number : %v", addr, err)})
+				}
+				config.MockCounts[addr] = n
+			}
+		}
+		if remote := val.GetAttr("remote_state"); !remote.IsNull() {
+			config.RemoteState = &RemoteStateConfig{
+				Hostname:     remote.GetAttr("hostname").AsString(),
+				Organization: remote.GetAttr("organization").AsString(),
+				Workspace:    remote.GetAttr("workspace").AsString(),
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// parseTarget reads a resource or module address given as target, eg module.db
+func parseTarget(target string) (addrs.Targetable, hcl.Diagnostics) {
+	traversal, diags := hclsyntax.ParseTraversalAbs([]byte(target), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	addr, tfDiags := addrs.ParseTarget(traversal)
+	if tfDiags.HasErrors() {
+		return nil, diags.Append(&hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Invalid target", Detail: fmt.Sprintf("%q is not a valid resource or module address : %s", target, tfDiags.Err())})
 	}
+	return addr.Subject, diags
+}
 
-	return &TerraspecConfig{
-		Workspace: workspaceName,
-	}, nil
+// decodeMessage reads the message explaining the rule of an assert block, which must be a string known when the spec is parsed.
+// An empty string is returned if the attribute wasn't set
+func decodeMessage(expr hcl.Expression, ctx *hcl.EvalContext) (string, hcl.Diagnostics) {
+	val, diags := expr.Value(ctx)
+	if diags.HasErrors() || val.IsNull() {
+		return "", diags
+	}
+	val, err := convert.Convert(val, cty.String)
+	if err != nil || !val.IsWhollyKnown() || val.IsNull() {
+		return "", diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid message",
+			Detail:   "The message of an assert block must be a string known when the spec is parsed, it can't read the plan",
+			Subject:  expr.Range().Ptr(),
+		})
+	}
+	return val.AsString(), diags
+}
+
+// decodeProviderRef reads a provider reference written like in terraform config, eg aws.us_east_1
+// An empty string is returned if the attribute wasn't set
+func decodeProviderRef(expr hcl.Expression) (string, hcl.Diagnostics) {
+	if val, diags := expr.Value(nil); !diags.HasErrors() && val.IsNull() {
+		return "", nil
+	}
+	traversal, diags := hcl.AbsTraversalForExpr(expr)
+	if diags.HasErrors() {
+		return "", diags
+	}
+	parts := make([]string, 0, len(traversal))
+	for _, t := range traversal {
+		switch step := t.(type) {
+		case hcl.TraverseRoot:
+			parts = append(parts, step.Name)
+		case hcl.TraverseAttr:
+			parts = append(parts, step.Name)
+		default:
+			return "", diags.Append(&hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Invalid provider reference", Detail: "A provider reference must be a provider name optionally followed by an alias, eg aws.us_east_1", Subject: t.SourceRange().Ptr()})
+		}
+	}
+	return strings.Join(parts, "."), diags
 }
 
 func decodeBody(body hcl.Body, bodyType string, schemas *terraform.Schemas, ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
 	rawType := resourceType(bodyType)
 	provName := strings.Split(rawType, "_")[0]
-	var val cty.Value
 	var partialSchema *configschema.Block
 	if provName == "output" {
 		partialSchema = &configschema.Block{
@@ -483,28 +1529,105 @@ func decodeBody(body hcl.Body, bodyType string, schemas *terraform.Schemas, ctx
 				"value": {Type: cty.String, Computed: false},
 			},
 		}
+	} else if provName == MovedAssertType {
+		partialSchema = movedSchema
+	} else if provName == ImportAssertType {
+		partialSchema = importSchema
+	} else if provName == "variable" {
+		partialSchema = &configschema.Block{
+			Attributes: map[string]*configschema.Attribute{
+				"valid":         {Type: cty.Bool, Optional: true},
+				"error_message": {Type: cty.String, Optional: true},
+			},
+		}
 	} else {
-		schema := laxSchema(LookupProviderSchema(schemas, provName))
-		schema = transformSchema(schema)
+		providerSchema := LookupProviderSchema(schemas, provName)
+		if providerSchema == nil {
+			return cty.NilVal, unknownType("Unknown resource type", noProviderSchema("resource type", rawType, provName, schemas), rawType, resourceTypes(schemas, nil, addrs.ManagedResourceMode), body)
+		}
+		schema := transformSchema(laxSchema(providerSchema))
 		partialSchema, _ = schema.SchemaForResourceType(addrs.ManagedResourceMode, rawType)
+		if partialSchema == nil {
+			return cty.NilVal, unknownType("Unknown resource type", fmt.Sprintf("Provider %s has no resource type %s.", provName, rawType), rawType, resourceTypes(schemas, providerSchema, addrs.ManagedResourceMode), body)
+		}
 	}
 
-	val, diags := hcldec.Decode(body, partialSchema.DecoderSpec(), ctx)
-	return val, diags
+	return decodeSpecBody(body, partialSchema, ctx)
+}
+
+// decodeSpecBody decodes body against schema. The keys of object attributes that the schema doesn't have are reported
+// before decoding, as the decoding would only report the attributes missing from the object
+func decodeSpecBody(body hcl.Body, schema *configschema.Block, ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	body = specBody(body, schema)
+	if diags := checkAttributeKeys(body, schema); diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	return hcldec.Decode(body, schema.DecoderSpec(), ctx)
+}
+
+// noProviderSchema returns the detail of the error of a resource or data source type whose provider has no schema.
+// Schemas are only loaded for the providers the config requires
+func noProviderSchema(kind, typeName, provider string, schemas *terraform.Schemas) string {
+	var loaded []string
+	if schemas != nil {
+		for addr := range schemas.Providers {
+			if !addr.IsBuiltIn() {
+				loaded = append(loaded, addr.String())
+			}
+		}
+	}
+	sort.Strings(loaded)
+	detail := fmt.Sprintf("No provider schema found for %s %s : the config doesn't require a %s provider, and schemas are only loaded for the providers it requires", kind, typeName, provider)
+	if len(loaded) == 0 {
+		return detail + "."
+	}
+	return fmt.Sprintf("%s, ie %s.", detail, strings.Join(loaded, ", "))
+}
+
+// unknownType returns the error of a block of an unknown resource or data source type, suggesting the closest of the known types
+func unknownType(summary, detail, typeName string, known []string, body hcl.Body) hcl.Diagnostics {
+	return hcl.Diagnostics{&hcl.Diagnostic{Severity: hcl.DiagError, Summary: summary, Detail: detail + didYouMean(typeName, known), Subject: body.MissingItemRange().Ptr()}}
+}
+
+// decodeStateBody decodes the attributes of a resource of the synthetic prior state
+func decodeStateBody(body hcl.Body, bodyType string, schemas *terraform.Schemas, ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	rawType := resourceType(bodyType)
+	provName := strings.Split(rawType, "_")[0]
+	schema := LookupProviderSchema(schemas, provName)
+	if schema == nil {
+		return cty.NilVal, unknownType("Unknown resource type", noProviderSchema("resource type", rawType, provName, schemas), rawType, resourceTypes(schemas, nil, addrs.ManagedResourceMode), body)
+	}
+	partialSchema, _ := laxSchema(schema).SchemaForResourceType(addrs.ManagedResourceMode, rawType)
+	if partialSchema == nil {
+		return cty.NilVal, unknownType("Unknown resource type", fmt.Sprintf("Provider %s has no resource type %s.", provName, rawType), rawType, resourceTypes(schemas, schema, addrs.ManagedResourceMode), body)
+	}
+	return decodeSpecBody(body, partialSchema, ctx)
 }
 
 func decodeMockBody(body hcl.Body, bodyType string, schemas *terraform.Schemas, ctx *hcl.EvalContext) (query, mock cty.Value, diags hcl.Diagnostics) {
 	var codedMock hcl.Body
 	provName := strings.Split(bodyType, "_")[0]
 	schema := LookupProviderSchema(schemas, provName)
+	if schema == nil {
+		diags = unknownType("Unknown data source type", noProviderSchema("data source type", bodyType, provName, schemas), bodyType, resourceTypes(schemas, nil, addrs.DataResourceMode), body)
+		return
+	}
 	partialSchema, _ := schema.SchemaForResourceType(addrs.DataResourceMode, bodyType)
+	if partialSchema == nil {
+		diags = unknownType("Unknown data source type", fmt.Sprintf("Provider %s has no data source type %s.", provName, bodyType), bodyType, resourceTypes(schemas, schema, addrs.DataResourceMode), body)
+		return
+	}
 
+	body = specBody(body, partialSchema)
+	if diags = checkAttributeKeys(body, partialSchema); diags.HasErrors() {
+		return
+	}
 	query, codedMock, diags = hcldec.PartialDecode(body, partialSchema.DecoderSpec(), ctx)
 	if diags.HasErrors() {
 		return
 	}
 	mockedSchema := toMockSchema(partialSchema)
-	mock, moreDiags := hcldec.Decode(codedMock, mockedSchema.DecoderSpec(), ctx)
+	mock, moreDiags := hcldec.Decode(specBody(codedMock, mockedSchema), mockedSchema.DecoderSpec(), ctx)
 	diags = append(diags, moreDiags...)
 	if diags.HasErrors() {
 		return
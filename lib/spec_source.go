@@ -0,0 +1,54 @@
+package terraspec
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	getter "github.com/hashicorp/go-getter"
+)
+
+// FetchSpecs downloads the spec folder found at source into dst, which must not exist yet. Like the source of a terraform module,
+// source is a local path, relative to pwd, or a remote address, eg git::https://example.com/specs.git//aws?ref=v1.2 or
+// s3::https://s3.amazonaws.com/bucket/specs.zip, so a spec suite maintained centrally can be run against local configs
+func FetchSpecs(ctx context.Context, source, pwd, dst string) error {
+	if err := download(ctx, source, pwd, dst); err != nil {
+		return fmt.Errorf("Could not fetch the specs of %s : %v", source, err)
+	}
+	return nil
+}
+
+// download downloads the folder addressed by source like the source of a terraform module into dst
+func download(ctx context.Context, source, pwd, dst string) error {
+	client := &getter.Client{
+		Ctx:  ctx,
+		Src:  source,
+		Dst:  dst,
+		Pwd:  absPath(pwd),
+		Mode: getter.ClientModeDir,
+		// local folders are copied rather than linked, so the copy can be removed once the run completed
+		Getters: map[string]getter.Getter{},
+	}
+	for scheme, g := range getter.Getters {
+		client.Getters[scheme] = g
+	}
+	client.Getters["file"] = &getter.FileGetter{Copy: true}
+	return client.Get()
+}
+
+// fetchSpecSource downloads the specs of source in a temporary folder, see FetchSpecs.
+// It returns the folder of the specs, and the temporary folder to remove once the run completed
+func fetchSpecSource(ctx context.Context, source, pwd string) (string, string, error) {
+	tmp, err := ioutil.TempDir("", "terraspec-specs")
+	if err != nil {
+		return "", "", err
+	}
+	dir := filepath.Join(tmp, "spec")
+	if err := FetchSpecs(ctx, source, pwd, dir); err != nil {
+		os.RemoveAll(tmp)
+		return "", "", err
+	}
+	return dir, tmp, nil
+}
@@ -0,0 +1,60 @@
+package terraspec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunSuiteWithSpecSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root, err := ioutil.TempDir("", "terraspec-spec-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	repo := filepath.Join(root, "compliance")
+	writeFiles(t, root, map[string]string{
+		"config/main.tf": `output "size" { value = "size-1" }`,
+		"compliance/aws/no_missing/no_missing.tfspec":         `reject "output" "missing" {}`,
+		"compliance/aws/missing_output/missing_output.tfspec": `assert "output" "missing" {}`,
+		"compliance/gcp/other/other.tfspec":                   `reject "output" "other" {}`,
+	})
+	run := func(args ...string) {
+		if _, err := git(repo, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init", "-q")
+	run("add", ".")
+	run("-c", "user.name=terraspec", "-c", "user.email=terraspec@example.com", "commit", "-q", "-m", "init")
+	run("tag", "v1")
+	// the spec suite changed since the tag the config pins
+	run("rm", "-q", "aws/missing_output/missing_output.tfspec")
+	run("-c", "user.name=terraspec", "-c", "user.email=terraspec@example.com", "commit", "-q", "-m", "remove")
+
+	results, err := RunSuite(context.Background(), Options{Dir: filepath.Join(root, "config"), SpecSource: "git::file://" + filepath.ToSlash(repo) + "//aws?ref=v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Cases) != 2 {
+		t.Fatalf("Expected the 2 test cases of the aws folder at v1, got %d", len(results.Cases))
+	}
+	for _, r := range results.Cases {
+		if failed := r.Name == "missing_output"; r.Failed() != failed {
+			t.Errorf("Expected test case %s to fail : %v, got %v", r.Name, failed, r.Diagnostics.Err())
+		}
+		if _, err := os.Stat(r.Dir); !os.IsNotExist(err) {
+			t.Errorf("The specs fetched in %s should be removed once the run completed", r.Dir)
+		}
+	}
+
+	if _, err := RunSuite(context.Background(), Options{Dir: filepath.Join(root, "config"), SpecSource: "./missing"}); err == nil {
+		t.Errorf("A spec source that can't be fetched should be an error")
+	}
+}
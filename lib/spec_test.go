@@ -1,18 +1,27 @@
 package terraspec
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
 	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
 	"github.com/hashicorp/terraform/terraform"
 	"github.com/hashicorp/terraform/tfdiags"
 	"github.com/zclconf/go-cty/cty"
 )
 
-func readSpecWithSchemas(t *testing.T, tfSpecFile string) *Spec {
-	schemas := &terraform.Schemas{
+// testSchemas returns the provider schemas of the resource and data source types used in testdata
+func testSchemas() *terraform.Schemas {
+	return &terraform.Schemas{
 		Providers: map[addrs.Provider]*terraform.ProviderSchema{
 			addrs.NewDefaultProvider("ressource"): {
 				ResourceTypes: map[string]*configschema.Block{
@@ -50,7 +59,10 @@ func readSpecWithSchemas(t *testing.T, tfSpecFile string) *Spec {
 			},
 		},
 	}
-	spec, diags := ReadSpec(tfSpecFile, schemas)
+}
+
+func readSpecWithSchemas(t *testing.T, tfSpecFile string) *Spec {
+	spec, diags := ReadSpec(tfSpecFile, testSchemas())
 	if diags.HasErrors() {
 		t.Fatal(diags.ErrWithWarnings())
 	}
@@ -247,6 +259,49 @@ func TestFindAttribute(t *testing.T) {
 	if got := findAttribute(cty.StringVal("name"), deepObject); got.Equals(cty.StringVal("rootName")).False() {
 		t.Errorf("findAttribute(name) should return rootName. Got %v", got)
 	}
+
+	tags := cty.MapVal(map[string]cty.Value{"Name": cty.StringVal("web")})
+	if got := findAttribute(cty.StringVal("Name"), tags); got.Equals(cty.StringVal("web")).False() {
+		t.Errorf("findAttribute(Name) should return web. Got %v", got)
+	}
+	if got := findAttribute(cty.StringVal("Env"), tags); got != cty.NilVal {
+		t.Errorf("findAttribute(Env) should return NilVal. Got %v", got)
+	}
+	if got := findAttribute(cty.StringVal("name"), cty.NullVal(object.Type())); got != cty.NilVal {
+		t.Errorf("findAttribute(name) of a null object should return NilVal. Got %v", got)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	got := cty.ObjectVal(map[string]cty.Value{
+		"name": cty.StringVal("web"),
+		"tags": cty.MapVal(map[string]cty.Value{"Env": cty.StringVal("prod")}),
+		"ports": cty.ListVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(80)}),
+			cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(443)}),
+		}),
+		"id": cty.UnknownVal(cty.String),
+	})
+	portType := cty.Object(map[string]cty.Type{"port": cty.Number})
+	for name, expected := range map[string]cty.Value{
+		"same name":      cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("web")}),
+		"other name":     cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("db")}),
+		"unasserted":     cty.ObjectVal(map[string]cty.Value{"name": cty.NullVal(cty.String)}),
+		"missing":        cty.ObjectVal(map[string]cty.Value{"size": cty.NumberIntVal(2)}),
+		"unknown":        cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("i-123")}),
+		"same tag":       cty.ObjectVal(map[string]cty.Value{"tags": cty.MapVal(map[string]cty.Value{"Env": cty.StringVal("prod")})}),
+		"missing tag":    cty.ObjectVal(map[string]cty.Value{"tags": cty.MapVal(map[string]cty.Value{"Team": cty.StringVal("ops")})}),
+		"same ports":     cty.ObjectVal(map[string]cty.Value{"ports": cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(80)})})}),
+		"other ports":    cty.ObjectVal(map[string]cty.Value{"ports": cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(443)})})}),
+		"too many ports": cty.ObjectVal(map[string]cty.Value{"ports": cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(80)}), cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(443)}), cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(8080)})})}),
+		"no port":        cty.ObjectVal(map[string]cty.Value{"ports": cty.ListValEmpty(portType)}),
+		"not an object":  cty.ObjectVal(map[string]cty.Value{"name": cty.ObjectVal(map[string]cty.Value{"first": cty.StringVal("web")})}),
+	} {
+		path := cty.GetAttrPath("aws_instance.web")
+		if m, diags := (comparison{}).matches(path, expected, got), (comparison{}).checkAssert(path, expected, got); m == diags.HasErrors() {
+			t.Errorf("%s : matches returned %t while checkAssert returned %v", name, m, diags.Err())
+		}
+	}
 }
 
 func TestCheckAssert(t *testing.T) {
@@ -357,7 +412,7 @@ func TestCheckAssert(t *testing.T) {
 	expectedResult = expectedResult.Append(SuccessDiags(rootPath.GetAttr("tags").GetAttr("Name"), "test-name"))
 	expectedResult = expectedResult.Append(AssertErrorDiags(rootPath.GetAttr("tags").GetAttr("Wrong-Value"), "wrong-tag", "right-tag"))
 
-	result := checkAssert(rootPath, expected, got)
+	result := comparison{}.checkAssert(rootPath, expected, got)
 
 	if !result.HasErrors() {
 		t.Fatalf("checkAssert didn't return any errors. Got %+v", result)
@@ -378,6 +433,57 @@ func TestCheckAssert(t *testing.T) {
 
 }
 
+func TestCheckSet(t *testing.T) {
+	element := func(name string, value cty.Value) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal(name), "value": value})
+	}
+	path := cty.GetAttrPath("test").GetAttr("set")
+	testCases := map[string]struct {
+		expected cty.Value
+		got      cty.Value
+		errors   []tfdiags.Diagnostic
+	}{
+		"Strings in another order": {
+			expected: cty.SetVal([]cty.Value{cty.StringVal("b"), cty.StringVal("a")}),
+			got:      cty.SetVal([]cty.Value{cty.StringVal("c"), cty.StringVal("a"), cty.StringVal("b")}),
+		},
+		"Partial element matching several planned elements": {
+			expected: cty.SetVal([]cty.Value{element("a", cty.NullVal(cty.Number)), element("a", cty.NumberIntVal(1))}),
+			got:      cty.SetVal([]cty.Value{element("a", cty.NumberIntVal(1)), element("a", cty.NumberIntVal(2))}),
+		},
+		"Closest element reported": {
+			expected: cty.SetVal([]cty.Value{element("b", cty.NumberIntVal(2))}),
+			got:      cty.SetVal([]cty.Value{element("a", cty.NumberIntVal(1)), element("b", cty.NumberIntVal(3))}),
+			errors:   []tfdiags.Diagnostic{AssertErrorDiags(path.Index(cty.NumberIntVal(0)).GetAttr("value"), 2, 3)},
+		},
+		"Missing element": {
+			expected: cty.SetVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+			got:      cty.SetVal([]cty.Value{cty.StringVal("a")}),
+			errors:   []tfdiags.Diagnostic{ErrorDiags(path.Index(cty.NumberIntVal(1)), "Could not find child at index 1")},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result := comparison{}.checkAssert(path, tc.expected, tc.got)
+			var errors tfdiags.Diagnostics
+			for _, diag := range result {
+				if diag.Severity() == tfdiags.Error {
+					errors = append(errors, diag)
+				}
+			}
+			if len(errors) != len(tc.errors) {
+				t.Fatalf("Expected %d errors, got %v", len(tc.errors), errors.Err())
+			}
+			for i, expected := range tc.errors {
+				testDiagnostic(t, errors[i], expected)
+			}
+			if m := (comparison{}).matches(path, tc.expected, tc.got); m == result.HasErrors() {
+				t.Errorf("matches returned %t while checkAssert returned %v", m, result.Err())
+			}
+		})
+	}
+}
+
 func TestCheckReject(t *testing.T) {
 
 	valueA := cty.ObjectVal(map[string]cty.Value{
@@ -511,7 +617,7 @@ func TestCheckReject(t *testing.T) {
 
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
-			result := checkReject(cty.GetAttrPath("property").GetAttr("reject"), tt.rejection, got)
+			result := comparison{}.checkReject(cty.GetAttrPath("property").GetAttr("reject"), tt.rejection, got)
 			if tt.expectError {
 				att := tt.rejection.GetAttr(tt.rejectAttrName)
 				if att.Type().IsListType() || att.Type().IsSetType() {
@@ -566,7 +672,7 @@ func TestCheckOutput(t *testing.T) {
 
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
-			result := checkOutput(path, tt.given, output)
+			result := comparison{}.checkOutput(path, tt.given, output)
 			if nb := len(result); nb != 1 {
 				t.Errorf("checkOutput should return only 1 diagsnostic, got %d", nb)
 				if nb == 0 {
@@ -658,3 +764,472 @@ region = "us-east-1"
 		})
 	}
 }
+
+func TestParsingWithProvider(t *testing.T) {
+	spec := readSpecWithSchemas(t, "testdata/scenario_provider.tfspec")
+
+	if nb := len(spec.Asserts); nb != 2 {
+		t.Fatalf("spec should have 2 asserts, got %d", nb)
+	}
+	if got := spec.Asserts[0].Provider; got != "ressource.west" {
+		t.Errorf("assert provider is wrong. Got %s", got)
+	}
+	if got := spec.Asserts[1].Provider; got != "" {
+		t.Errorf("assert provider should be empty. Got %s", got)
+	}
+}
+
+func TestCheckProvider(t *testing.T) {
+	parser := configs.NewParser(nil)
+	root, diags := parser.LoadConfigDir("testdata/provider_configs")
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	cfg, diags := configs.BuildConfig(root, configs.ModuleWalkerFunc(func(req *configs.ModuleRequest) (*configs.Module, *version.Version, hcl.Diagnostics) {
+		mod, diags := parser.LoadConfigDir(filepath.Join("testdata/provider_configs", req.SourceAddr))
+		return mod, nil, diags
+	}))
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+
+	aws := addrs.NewDefaultProvider("aws")
+	network := addrs.RootModule.Child("network")
+	cluster := addrs.RootModule.Child("cluster")
+	path := cty.GetAttrPath("aws_instance.name").GetAttr("provider")
+	tests := map[string]struct {
+		config *configs.Config
+		module addrs.Module
+		ref    string
+		got    addrs.AbsProviderConfig
+		passed bool
+	}{
+		"default":            {config: cfg, module: addrs.RootModule, ref: "aws", got: addrs.AbsProviderConfig{Module: addrs.RootModule, Provider: aws}, passed: true},
+		"alias":              {config: cfg, module: addrs.RootModule, ref: "aws.west", got: addrs.AbsProviderConfig{Module: addrs.RootModule, Provider: aws, Alias: "west"}, passed: true},
+		"wrong alias":        {config: cfg, module: addrs.RootModule, ref: "aws.west", got: addrs.AbsProviderConfig{Module: addrs.RootModule, Provider: aws}},
+		"other namespace":    {config: cfg, module: addrs.RootModule, ref: "acme", got: addrs.AbsProviderConfig{Module: addrs.RootModule, Provider: aws}},
+		"passed to module":   {config: cfg, module: network, ref: "aws", got: addrs.AbsProviderConfig{Module: addrs.RootModule, Provider: aws, Alias: "west"}, passed: true},
+		"not passed":         {config: cfg, module: network, ref: "aws", got: addrs.AbsProviderConfig{Module: addrs.RootModule, Provider: aws}},
+		"inherited":          {config: cfg, module: cluster, ref: "aws", got: addrs.AbsProviderConfig{Module: addrs.RootModule, Provider: aws}, passed: true},
+		"declared in module": {config: cfg, module: cluster, ref: "aws.east", got: addrs.AbsProviderConfig{Module: cluster, Provider: aws, Alias: "east"}, passed: true},
+		"other module":       {config: cfg, module: cluster, ref: "aws.east", got: addrs.AbsProviderConfig{Module: network, Provider: aws, Alias: "east"}},
+		"without config":     {module: addrs.RootModule, ref: "aws.west", got: addrs.AbsProviderConfig{Module: addrs.RootModule, Provider: aws, Alias: "west"}, passed: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			expected := providerConfigAddr(tt.config, tt.module, tt.ref)
+			result := checkProvider(path, tt.ref, expected, tt.got)
+			if len(result) != 1 {
+				t.Fatalf("Expected 1 diagnostic, got %v", result)
+			}
+			want := AssertErrorDiags(path, expected.String(), tt.got.String())
+			if tt.passed {
+				want = SuccessDiags(path, tt.ref)
+			}
+			testDiagnostic(t, result[0], want)
+		})
+	}
+}
+
+func TestParsingWithRemoteState(t *testing.T) {
+	spec := readSpecWithSchemas(t, "testdata/scenario_remote_state.tfspec")
+
+	if spec.Terraspec.Workspace != "" {
+		t.Errorf("terraspec workspace should be empty")
+	}
+
+	expected := &RemoteStateConfig{Hostname: "app.terraform.io", Organization: "my-org", Workspace: "production"}
+	if got := spec.Terraspec.RemoteState; got == nil || *got != *expected {
+		t.Errorf("terraspec remote_state not as expected. Got %+v want %+v", got, expected)
+	}
+}
+
+func TestParsingWithStateFile(t *testing.T) {
+	spec := readSpecWithSchemas(t, "testdata/scenario_state_file.tfspec")
+
+	if expected := filepath.Join("testdata", "states", "existing.tfstate"); spec.Terraspec.StateFile != expected {
+		t.Errorf("terraspec state_file should be resolved relative to the spec file. Got %s want %s", spec.Terraspec.StateFile, expected)
+	}
+	if !spec.Terraspec.ExpectEmptyPlan {
+		t.Errorf("terraspec expect_empty_plan should be true")
+	}
+}
+
+func TestCheckEmptyPlan(t *testing.T) {
+	change := func(name string, action plans.Action) *plans.ResourceInstanceChangeSrc {
+		addr := addrs.Resource{Mode: addrs.ManagedResourceMode, Type: "aws_instance", Name: name}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance)
+		return &plans.ResourceInstanceChangeSrc{Addr: addr, ChangeSrc: plans.ChangeSrc{Action: action}}
+	}
+
+	result := checkEmptyPlan(&plans.Changes{Resources: []*plans.ResourceInstanceChangeSrc{change("unchanged", plans.NoOp)}})
+	if len(result) != 1 || result.HasErrors() {
+		t.Fatalf("Expected 1 success diagnostic, got %v", result)
+	}
+	testDiagnostic(t, result[0], SuccessDiags(cty.GetAttrPath("plan"), "No changes"))
+
+	result = checkEmptyPlan(&plans.Changes{Resources: []*plans.ResourceInstanceChangeSrc{change("unchanged", plans.NoOp), change("updated", plans.Update)}})
+	if len(result) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %v", result)
+	}
+	testDiagnostic(t, result[0], ErrorDiags(cty.GetAttrPath("aws_instance.updated"), "Planned action is Update while plan should be empty"))
+}
+
+func TestParseSpecReportsAllAsserts(t *testing.T) {
+	_, diags := ParseSpec([]byte(`
+assert "ressource_type" "first" {
+  propety = "value"
+}
+
+assert "ressource_type" "second" {
+  iner {
+    inner_prop = "value"
+  }
+}
+`), "typos.tfspec", testSchemas())
+	expected := []string{
+		`typos.tfspec:3,3-10: Unsupported argument; An argument named "propety" is not expected here. Did you mean "property"?`,
+		`typos.tfspec:7,3-7: Unsupported block type; Blocks of type "iner" are not expected here. Did you mean "inner"?`,
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("Expected the errors of both asserts, got %v", diags)
+	}
+	for i, e := range expected {
+		if got := diags[i].Error(); got != e {
+			t.Errorf("Expected error %s, got %s", e, got)
+		}
+	}
+}
+
+func TestCheckStrictPlan(t *testing.T) {
+	spec, diags := ParseSpec([]byte(`
+terraspec {
+  strict = true
+}
+
+assert "ressource_type" "asserted" {
+  property = "value"
+}
+
+reject "ressource_type" "rejected" {}
+`), "strict.tfspec", testSchemas())
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	if !spec.Terraspec.Strict {
+		t.Fatalf("terraspec strict should be true")
+	}
+
+	change := func(name string, action plans.Action) *plans.ResourceInstanceChangeSrc {
+		addr := addrs.Resource{Mode: addrs.ManagedResourceMode, Type: "ressource_type", Name: name}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance)
+		return &plans.ResourceInstanceChangeSrc{Addr: addr, ChangeSrc: plans.ChangeSrc{Action: action}}
+	}
+	testCases := map[string]struct {
+		changes  []*plans.ResourceInstanceChangeSrc
+		expected []tfdiags.Diagnostic
+	}{
+		"Only expected resources": {
+			changes:  []*plans.ResourceInstanceChangeSrc{change("asserted", plans.Create), change("rejected", plans.Delete), change("unchanged", plans.NoOp)},
+			expected: []tfdiags.Diagnostic{SuccessDiags(cty.GetAttrPath("plan"), "No unexpected resource")},
+		},
+		"Unexpected resources": {
+			changes: []*plans.ResourceInstanceChangeSrc{change("asserted", plans.Create), change("added", plans.Create), change("removed", plans.Delete)},
+			expected: []tfdiags.Diagnostic{
+				ErrorDiags(cty.GetAttrPath("ressource_type.added"), "Planned action is Create while no assert or reject block expects this resource in strict mode"),
+				ErrorDiags(cty.GetAttrPath("ressource_type.removed"), "Planned action is Delete while no assert or reject block expects this resource in strict mode"),
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result := spec.checkStrictPlan(&plans.Changes{Resources: tc.changes})
+			if len(result) != len(tc.expected) {
+				t.Fatalf("Expected %d diagnostics, got %v", len(tc.expected), result)
+			}
+			for i, expected := range tc.expected {
+				testDiagnostic(t, result[i], expected)
+			}
+		})
+	}
+	mismatches := Mismatches(spec.checkStrictPlan(&plans.Changes{Resources: []*plans.ResourceInstanceChangeSrc{change("added", plans.Create)}}))
+	if len(mismatches) != 1 || mismatches[0].Reason != MismatchUnexpected {
+		t.Errorf("Expected an unexpected resource mismatch, got %+v", mismatches)
+	}
+}
+
+func TestParsingWithPlanMode(t *testing.T) {
+	spec := readSpecWithSchemas(t, "testdata/scenario_destroy.tfspec")
+	if spec.Terraspec.PlanMode != PlanModeDestroy || !spec.Terraspec.Destroy() {
+		t.Errorf("terraspec plan_mode should be %s, got %s", PlanModeDestroy, spec.Terraspec.PlanMode)
+	}
+
+	spec = readSpecWithSchemas(t, "testdata/scenario_state_file.tfspec")
+	if spec.Terraspec.PlanMode != PlanModeNormal {
+		t.Errorf("terraspec plan_mode should default to %s, got %s", PlanModeNormal, spec.Terraspec.PlanMode)
+	}
+}
+
+func TestParsingWithTargets(t *testing.T) {
+	spec := readSpecWithSchemas(t, "testdata/scenario_targets.tfspec")
+
+	if nb := len(spec.Terraspec.Targets); nb != 2 {
+		t.Fatalf("terraspec should have 2 targets, got %d", nb)
+	}
+	for i, expected := range []string{"module.db", "ressource_type.name"} {
+		if got := spec.Terraspec.Targets[i].String(); got != expected {
+			t.Errorf("target %d should be %s, got %s", i, expected, got)
+		}
+	}
+}
+
+func TestParsingWithVariable(t *testing.T) {
+	spec := readSpecWithSchemas(t, "testdata/scenario_variable.tfspec")
+
+	if nb := len(spec.Asserts); nb != 1 {
+		t.Fatalf("spec should have 1 assert, got %d", nb)
+	}
+	expected := cty.ObjectVal(map[string]cty.Value{"valid": cty.False, "error_message": cty.StringVal("Size must be positive.")})
+	if got := spec.Asserts[0].Value; !got.RawEquals(expected) {
+		t.Errorf("variable assert not as expected. Got %#v want %#v", got, expected)
+	}
+}
+
+func TestParsingWithMockCount(t *testing.T) {
+	spec := readSpecWithSchemas(t, "testdata/scenario_mock_count.tfspec")
+
+	if got := spec.CountMocks["ressource_type.replica"]; got != 3 {
+		t.Errorf("count of ressource_type.replica should be mocked with 3, got %d", got)
+	}
+}
+
+func TestParsingSourceRanges(t *testing.T) {
+	spec := readSpecWithSchemas(t, "testdata/scenario.tfspec")
+
+	var tests = map[string]struct {
+		given TypeName
+		line  int
+	}{
+		"assert": {spec.Asserts[0].TypeName, 1},
+		"reject": {*spec.Rejects[0], 13},
+		"mock":   {spec.Mocks[0].TypeName, 15},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if tt.given.DeclRange.Filename != "testdata/scenario.tfspec" || tt.given.DeclRange.Start.Line != tt.line {
+				t.Errorf("%s should be declared at line %d, got %s", tt.given.Key(), tt.line, tt.given.DeclRange)
+			}
+			if tt.given.Config == nil {
+				t.Errorf("%s should keep its config body", tt.given.Key())
+			}
+		})
+	}
+
+	attrs, _ := spec.Asserts[0].Config.JustAttributes()
+	if property, ok := attrs["property"]; !ok || property.Range.Start.Line != 2 {
+		t.Errorf("property attribute should be found at line 2, got %v", attrs)
+	}
+}
+
+func TestValidateManyAsserts(t *testing.T) {
+	ty := cty.Object(map[string]cty.Type{"property": cty.String})
+	spec := &Spec{Terraspec: &TerraspecConfig{}}
+	plan := &plans.Plan{Changes: &plans.Changes{}}
+	var expected []tfdiags.Diagnostic
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("r%d", i)
+		path := cty.GetAttrPath("ressource_type." + name).GetAttr("property")
+		planned := fmt.Sprintf("value-%d", i)
+		rc := &plans.ResourceInstanceChange{
+			Addr:   resourceAddr(name),
+			Change: plans.Change{Action: plans.Create, Before: cty.NullVal(ty), After: cty.ObjectVal(map[string]cty.Value{"property": cty.StringVal(planned)})},
+		}
+		src, err := rc.Encode(ty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan.Changes.Resources = append(plan.Changes.Resources, src)
+
+		asserted := planned
+		if i%3 == 0 {
+			asserted = "other"
+			expected = append(expected, AssertErrorDiags(path, asserted, planned))
+		} else {
+			expected = append(expected, SuccessDiags(path, planned))
+		}
+		spec.Asserts = append(spec.Asserts, &Assert{TypeName: TypeName{Type: "ressource_type", Name: name}, Value: cty.ObjectVal(map[string]cty.Value{"property": cty.StringVal(asserted)})})
+	}
+
+	diags, err := spec.Validate(context.Background(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d", len(expected), len(diags))
+	}
+	for i := range expected {
+		testDiagnostic(t, diags[i], expected[i])
+	}
+
+	// the first technical error in the order of the spec is returned
+	spec.Asserts[50].Value = cty.ObjectVal(map[string]cty.Value{"property": cty.NumberIntVal(1)})
+	if _, err := spec.Validate(context.Background(), plan); err == nil || !strings.Contains(err.Error(), "r50") {
+		t.Errorf("Expected the error decoding r50, got %v", err)
+	}
+
+	// assertions are no longer checked once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := spec.Validate(ctx, plan); err != context.Canceled {
+		t.Errorf("Expected the error of the canceled context, got %v", err)
+	}
+}
+
+func TestEachConcurrently(t *testing.T) {
+	for _, n := range []int{0, 1, 1000} {
+		var lock sync.Mutex
+		calls := make(map[int]int)
+		eachConcurrently(n, 4, func(i int) {
+			lock.Lock()
+			calls[i]++
+			lock.Unlock()
+		})
+		if len(calls) != n {
+			t.Errorf("Expected %d indexes, got %d", n, len(calls))
+		}
+		for i, c := range calls {
+			if i < 0 || i >= n || c != 1 {
+				t.Errorf("Index %d should be called once, got %d calls", i, c)
+			}
+		}
+	}
+}
+
+func TestEachConcurrentlyPanics(t *testing.T) {
+	defer func() {
+		p := recoverPanic(recover())
+		if p.value != "index 500" || !strings.Contains(string(p.stack), "TestEachConcurrentlyPanics") {
+			t.Errorf("The panic should be raised again with its stack trace, got %v", p)
+		}
+	}()
+	eachConcurrently(1000, 4, func(i int) {
+		if i == 500 {
+			panic("index 500")
+		}
+	})
+	t.Error("eachConcurrently should panic")
+}
+
+func TestMissingResource(t *testing.T) {
+	var planned []*plans.ResourceInstanceChangeSrc
+	for _, addr := range []string{"aws_instance.web[0]", "aws_instance.web[1]", "module.db.aws_db_instance.main", "aws_s3_bucket.logs", "aws_s3_bucket.assets", "module.db.aws_s3_bucket.backups"} {
+		parsed, diags := addrs.ParseAbsResourceInstanceStr(addr)
+		if diags.HasErrors() {
+			t.Fatal(diags.Err())
+		}
+		planned = append(planned, &plans.ResourceInstanceChangeSrc{Addr: parsed})
+	}
+	resources := indexResources(planned)
+
+	tests := map[string]struct {
+		assert   *Assert
+		expected string
+	}{
+		"index key": {
+			assert:   &Assert{TypeName: TypeName{Type: "aws_instance", Name: "web"}},
+			expected: "Could not find resource aws_instance.web in changes. The plan holds other instances of this resource, check the module path and the index key : aws_instance.web[0], aws_instance.web[1]",
+		},
+		"module": {
+			assert:   &Assert{TypeName: TypeName{Type: "aws_db_instance", Name: "main"}},
+			expected: "Could not find resource aws_db_instance.main in changes. The plan holds other instances of this resource, check the module path and the index key : module.db.aws_db_instance.main",
+		},
+		"name": {
+			assert:   &Assert{TypeName: TypeName{Type: "aws_s3_bucket", Name: "log"}},
+			expected: "Could not find resource aws_s3_bucket.log in changes. Resources of type aws_s3_bucket planned in the same module : aws_s3_bucket.assets, aws_s3_bucket.logs. Did you mean \"aws_s3_bucket.logs\"?",
+		},
+		"type": {
+			assert:   &Assert{TypeName: TypeName{Type: "aws_vpc", Name: "main"}},
+			expected: "Could not find resource aws_vpc.main in changes. No resource of type aws_vpc is planned.",
+		},
+		"misspelled type": {
+			assert:   &Assert{TypeName: TypeName{Type: "aws_s3_buckt", Name: "logs"}},
+			expected: "Could not find resource aws_s3_buckt.logs in changes. No resource of type aws_s3_buckt is planned. Did you mean \"aws_s3_bucket.logs\"?",
+		},
+		"invalid address": {
+			assert:   &Assert{TypeName: TypeName{Type: "aws_vpc", Name: "main[x"}},
+			expected: "Could not find resource aws_vpc.main[x in changes",
+		},
+	}
+	for name, tt := range tests {
+		diag := missingResource(tt.assert, resources)
+		if diag.Detail != tt.expected {
+			t.Errorf("%s : unexpected detail\nwant: %s\ngot:  %s", name, tt.expected, diag.Detail)
+		}
+		if diag.Subject != nil {
+			t.Errorf("%s : an assert without range should not be located, got %v", name, diag.Subject)
+		}
+	}
+
+	located := &Assert{TypeName: TypeName{Type: "aws_vpc", Name: "main", DeclRange: hcl.Range{Filename: "spec.tfspec", Start: hcl.Pos{Line: 3, Column: 1}}}}
+	if diag := missingResource(located, resources); diag.Subject == nil || diag.Subject.Start.Line != 3 {
+		t.Errorf("The error should be located at the assert, got %v", diag.Subject)
+	}
+
+	var many []*plans.ResourceInstanceChangeSrc
+	for i := 0; i < maxPlannedCandidates+3; i++ {
+		parsed, _ := addrs.ParseAbsResourceInstanceStr(fmt.Sprintf("aws_vpc.main%02d", i))
+		many = append(many, &plans.ResourceInstanceChangeSrc{Addr: parsed})
+	}
+	if diag := missingResource(located, indexResources(many)); !strings.Contains(diag.Detail, "aws_vpc.main09 and 3 more.") {
+		t.Errorf("Only %d resources should be listed, got %s", maxPlannedCandidates, diag.Detail)
+	}
+}
+
+func TestAssertMessage(t *testing.T) {
+	spec, diags := ParseSpec([]byte(`
+assert "ressource_type" "name" {
+  message  = "property must be expected"
+  property = "expected"
+  inner {
+    inner_prop = "value"
+  }
+}
+`), "message.tfspec", testSchemas())
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	if spec.Asserts[0].Message != "property must be expected" {
+		t.Fatalf("Expected the message of the assert, got %q", spec.Asserts[0].Message)
+	}
+
+	value := cty.ObjectVal(map[string]cty.Value{
+		"property": cty.StringVal("value"),
+		"inner":    cty.ObjectVal(map[string]cty.Value{"inner_prop": cty.StringVal("value")}),
+	})
+	rc := &plans.ResourceInstanceChange{
+		Addr:   resourceAddr("name"),
+		Change: plans.Change{Action: plans.Create, Before: cty.NullVal(value.Type()), After: value},
+	}
+	src, err := rc.Encode(value.Type())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := spec.Validate(context.Background(), &plans.Plan{Changes: &plans.Changes{Resources: []*plans.ResourceInstanceChangeSrc{src}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, diag := range result {
+		d := diag.(*TerraspecDiagnostic)
+		if failed := d.Severity() == tfdiags.Error; failed != (d.FailureMessage != "") {
+			t.Errorf("Only failed assertions should carry the message, got %q on %v", d.FailureMessage, d.Description().Detail)
+		}
+	}
+
+	_, diags = ParseSpec([]byte(`
+assert "ressource_type" "name" {
+  message = plan.format_version
+}
+`), "message.tfspec", testSchemas())
+	if !diags.HasErrors() || diags[0].Summary != "Invalid message" {
+		t.Errorf("Expected an invalid message error, got %v", diags)
+	}
+}
@@ -0,0 +1,89 @@
+package terraspec
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/states/statefile"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// StateResource is a resource instance of a synthetic prior state
+type StateResource struct {
+	// Addr is the address of the resource instance, eg module.db.aws_instance.replica[0]
+	Addr string
+	// Value holds the attributes of the resource instance. Attributes not set are null
+	Value cty.Value
+}
+
+// NewStateResource creates a StateResource from the labels of a state block
+func NewStateResource(aType, aName string, aValue cty.Value) *StateResource {
+	return &StateResource{Addr: fmt.Sprintf("%s.%s", aType, aName), Value: aValue}
+}
+
+// ReadStateFile reads the terraform state file used as prior state of a test case
+func ReadStateFile(filename string) (*states.State, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open state file %s : %v", filename, err)
+	}
+	defer f.Close()
+
+	file, err := statefile.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read state file %s : %v", filename, err)
+	}
+	return file.State, nil
+}
+
+// BuildState builds a prior state containing only the given resources.
+// Resources are bound to the provider configuration cfg gives them, or to the default provider of their type
+// when they are not in cfg anymore
+func BuildState(resources []*StateResource, cfg *configs.Config, schemas *terraform.Schemas) (*states.State, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	state := states.NewState()
+	sync := state.SyncWrapper()
+	for _, resource := range resources {
+		addr, addrDiags := addrs.ParseAbsResourceInstanceStr(resource.Addr)
+		if addrDiags.HasErrors() {
+			diags = diags.Append(addrDiags)
+			continue
+		}
+
+		provider := stateResourceProvider(addr, cfg)
+		_, schemaVersion := schemas.ResourceTypeConfig(provider.Provider, addr.Resource.Resource.Mode, addr.Resource.Resource.Type)
+		attrs, err := ctyjson.Marshal(resource.Value, resource.Value.Type())
+		if err != nil {
+			diags = diags.Append(fmt.Errorf("Could not encode state of %s : %v", resource.Addr, err))
+			continue
+		}
+		sync.SetResourceInstanceCurrent(addr, &states.ResourceInstanceObjectSrc{
+			Status:        states.ObjectReady,
+			SchemaVersion: schemaVersion,
+			AttrsJSON:     attrs,
+		}, provider)
+	}
+	return state, diags
+}
+
+// stateResourceProvider returns the provider configuration of the resource at addr
+func stateResourceProvider(addr addrs.AbsResourceInstance, cfg *configs.Config) addrs.AbsProviderConfig {
+	module := addr.Module.Module()
+	if cfg != nil {
+		if c := cfg.Descendent(module); c != nil {
+			if r := c.Module.ResourceByAddr(addr.Resource.Resource); r != nil {
+				return cfg.ResolveAbsProviderAddr(r.ProviderConfigAddr(), module)
+			}
+		}
+	}
+	return addrs.AbsProviderConfig{
+		Module:   module,
+		Provider: addrs.NewDefaultProvider(addr.Resource.Resource.ImpliedProvider()),
+	}
+}
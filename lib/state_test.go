@@ -0,0 +1,40 @@
+package terraspec
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestBuildState(t *testing.T) {
+	spec := readSpecWithSchemas(t, "testdata/scenario_state.tfspec")
+	if nb := len(spec.State); nb != 2 {
+		t.Fatalf("spec should have 2 state resources, got %d", nb)
+	}
+
+	state, diags := BuildState(spec.State, nil, &terraform.Schemas{})
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+
+	tests := map[string]string{
+		"ressource_type.name":                 `{"inner":null,"property":"old_value"}`,
+		"module.db.ressource_type.replica[1]": `{"inner":null,"property":"replica"}`,
+	}
+	for addr, expected := range tests {
+		parsed, _ := addrs.ParseAbsResourceInstanceStr(addr)
+		instance := state.ResourceInstance(parsed)
+		if instance == nil || instance.Current == nil {
+			t.Errorf("state should contain %s", addr)
+			continue
+		}
+		if got := string(instance.Current.AttrsJSON); got != expected {
+			t.Errorf("attributes of %s should be %s, got %s", addr, expected, got)
+		}
+		provider := state.Resource(parsed.ContainingResource()).ProviderConfig
+		if provider.Provider != addrs.NewDefaultProvider("ressource") || !provider.Module.Equal(parsed.Module.Module()) {
+			t.Errorf("%s should be bound to default ressource provider, got %s", addr, provider)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package terraspec
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/helper/didyoumean"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// didYouMean returns a sentence suggesting the name closest to given among names, to end the detail of a diagnostic.
+// It's empty when no name is close enough, like the suggestions of terraform
+func didYouMean(given string, names []string) string {
+	if suggestion := didyoumean.NameSuggestion(given, names); suggestion != "" {
+		return fmt.Sprintf(" Did you mean %q?", suggestion)
+	}
+	return ""
+}
+
+// resourceTypes returns the sorted resource or data source types of the given provider schema,
+// or of all the providers of schemas when it's nil
+func resourceTypes(schemas *terraform.Schemas, provider *terraform.ProviderSchema, mode addrs.ResourceMode) []string {
+	providers := []*terraform.ProviderSchema{provider}
+	if provider == nil {
+		providers = providers[:0]
+		for _, p := range schemas.Providers {
+			providers = append(providers, p)
+		}
+	}
+	var types []string
+	for _, p := range providers {
+		if p == nil {
+			continue
+		}
+		blocks := p.ResourceTypes
+		if mode == addrs.DataResourceMode {
+			blocks = p.DataSources
+		}
+		for name := range blocks {
+			types = append(types, name)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// keySuggestion returns the key of the planned map or object val closest to the missing key name, or "" when there's none
+func keySuggestion(name string, val cty.Value) string {
+	if val == cty.NilVal || !val.IsKnown() || val.IsNull() {
+		return ""
+	}
+	var keys []string
+	switch ty := val.Type(); {
+	case ty.IsObjectType():
+		for key := range ty.AttributeTypes() {
+			keys = append(keys, key)
+		}
+	case ty.IsMapType():
+		for it := val.ElementIterator(); it.Next(); {
+			key, _ := it.Element()
+			keys = append(keys, key.AsString())
+		}
+	default:
+		return ""
+	}
+	sort.Strings(keys)
+	return didyoumean.NameSuggestion(name, keys)
+}
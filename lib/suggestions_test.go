@@ -0,0 +1,101 @@
+package terraspec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDecodeBodyUnknownType(t *testing.T) {
+	tests := map[string]struct {
+		decode   func(body hcl.Body) hcl.Diagnostics
+		expected string
+	}{
+		"misspelled resource type": {
+			decode: func(body hcl.Body) hcl.Diagnostics {
+				_, diags := decodeBody(body, "ressource_typ", testSchemas(), nil)
+				return diags
+			},
+			expected: `Provider ressource has no resource type ressource_typ. Did you mean "ressource_type"?`,
+		},
+		"misspelled provider": {
+			decode: func(body hcl.Body) hcl.Diagnostics {
+				_, diags := decodeStateBody(body, "resource_type", testSchemas(), nil)
+				return diags
+			},
+			expected: `No provider schema found for resource type resource_type : the config doesn't require a resource provider, and schemas are only loaded for the providers it requires, ie registry.terraform.io/hashicorp/data, registry.terraform.io/hashicorp/ressource. Did you mean "ressource_type"?`,
+		},
+		"unrelated resource type": {
+			decode: func(body hcl.Body) hcl.Diagnostics {
+				_, diags := decodeBody(body, "ressource_other", testSchemas(), nil)
+				return diags
+			},
+			expected: "Provider ressource has no resource type ressource_other.",
+		},
+		"misspelled data source": {
+			decode: func(body hcl.Body) hcl.Diagnostics {
+				_, _, diags := decodeMockBody(body, "data_typo", testSchemas(), nil)
+				return diags
+			},
+			expected: `Provider data has no data source type data_typo. Did you mean "data_type"?`,
+		},
+	}
+	for name, tt := range tests {
+		file, diags := hclsyntax.ParseConfig([]byte(""), "spec.tfspec", hcl.InitialPos)
+		if diags.HasErrors() {
+			t.Fatal(diags)
+		}
+		diags = tt.decode(file.Body)
+		if len(diags) != 1 || diags[0].Detail != tt.expected {
+			t.Errorf("%s : expected the error %q, got %v", name, tt.expected, diags)
+		}
+	}
+}
+
+func TestResourceTypes(t *testing.T) {
+	schemas := testSchemas()
+	if got := resourceTypes(schemas, nil, addrs.ManagedResourceMode); strings.Join(got, ",") != "ressource_type" {
+		t.Errorf("Expected the resource types of all providers, got %v", got)
+	}
+	if got := resourceTypes(schemas, LookupProviderSchema(schemas, "data"), addrs.DataResourceMode); strings.Join(got, ",") != "data_type" {
+		t.Errorf("Expected the data sources of the provider, got %v", got)
+	}
+}
+
+func TestKeySuggestion(t *testing.T) {
+	tests := map[string]struct {
+		val      cty.Value
+		expected string
+	}{
+		"map":       {val: cty.MapVal(map[string]cty.Value{"Name": cty.StringVal("web"), "Owner": cty.StringVal("ops")}), expected: "Owner"},
+		"object":    {val: cty.ObjectVal(map[string]cty.Value{"owners": cty.StringVal("ops")}), expected: "owners"},
+		"far":       {val: cty.MapVal(map[string]cty.Value{"environment": cty.StringVal("prod")})},
+		"primitive": {val: cty.StringVal("owner")},
+		"unknown":   {val: cty.UnknownVal(cty.Map(cty.String))},
+		"missing":   {val: cty.NilVal},
+	}
+	for name, tt := range tests {
+		if got := keySuggestion("owner", tt.val); got != tt.expected {
+			t.Errorf("%s : expected %q, got %q", name, tt.expected, got)
+		}
+	}
+}
+
+func TestCheckAssertSuggestsKeys(t *testing.T) {
+	path := cty.GetAttrPath("ressource_type.name").GetAttr("tags")
+	expected := cty.ObjectVal(map[string]cty.Value{"owner": cty.StringVal("ops"), "team": cty.StringVal("web")})
+	got := cty.MapVal(map[string]cty.Value{"Owner": cty.StringVal("ops"), "team": cty.StringVal("web")})
+	diags := comparison{}.checkAssert(path, expected, got)
+	if len(diags) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %v", diags)
+	}
+	testDiagnostic(t, diags[0], ErrorDiags(path.GetAttr("owner"), `No owner key in the plan. Did you mean "Owner"?`))
+	testDiagnostic(t, diags[1], SuccessDiags(path.GetAttr("team"), "web"))
+	if m := diags[0].(*TerraspecDiagnostic).Mismatch; m == nil || m.Reason != MismatchMissing {
+		t.Errorf("A missing key should be a missing mismatch, got %+v", m)
+	}
+}
@@ -1,11 +1,20 @@
 package terraspec
 
 import (
+	"context"
+	"fmt"
 	"path"
 	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/configs"
 	"github.com/hashicorp/terraform/configs/configload"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/states"
 	"github.com/hashicorp/terraform/terraform"
 	"github.com/hashicorp/terraform/tfdiags"
 	"github.com/hashicorp/terraform/version"
@@ -14,62 +23,308 @@ import (
 	goversion "github.com/hashicorp/go-version"
 )
 
+// NewContextOptions holds the settings of a test case that change how the terraform.Context is built
+type NewContextOptions struct {
+	// Context cancels the creation of the terraform.Context, which starts provider plugins to load their schemas.
+	// Nil means the creation can't be cancelled
+	Context context.Context
+	// Workspace is the name of the terraform workspace
+	Workspace string
+	// State is the prior state to plan against. Nil means an empty state
+	State *states.State
+	// Destroy plans the destruction of all the resources of State
+	Destroy bool
+	// Targets restricts the plan to the given addresses
+	Targets []addrs.Targetable
+	// CountOverrides forces the count of resources, by resource address
+	CountOverrides map[string]int
+	// Timings receives the time spent loading the config and getting the schemas of the providers. Nil means the time is not recorded
+	Timings *Timings
+}
+
 // NewContext creates a new terraform.Context able to compute configs in the context of terraspec
 // It returns the built Context or a Diagnostics if error occured
-func NewContext(dir, varFile string, resolver *ProviderResolver, tsCtx *Context, workspace string) (*terraform.Context, tfdiags.Diagnostics) {
+func NewContext(dir, varFile string, resolver *ProviderResolver, tsCtx *Context, ctxOpts *NewContextOptions) (*terraform.Context, tfdiags.Diagnostics) {
 	absDir, err := filepath.Abs(dir)
 	diags := make(tfdiags.Diagnostics, 0)
-	if err != nil {
-		diags = diags.Append(err)
+	if ctxOpts.Context != nil && ctxOpts.Context.Err() != nil {
+		diags = diags.Append(ctxOpts.Context.Err())
 		return nil, diags
 	}
-
-	modulesDir := path.Join(absDir, ".terraform/modules")
-
-	c, err := configload.NewLoader(&configload.Config{
-		ModulesDir: modulesDir,
-	})
 	if err != nil {
 		diags = diags.Append(err)
 		return nil, diags
 	}
-	cfg, hclDiag := c.LoadConfig(absDir)
-	if hclDiag.HasErrors() {
-		diags = diags.Append(hclDiag)
+
+	loadStart := time.Now()
+	cfg, cfgDiags := tsCtx.configs.load(absDir)
+	diags = diags.Append(cfgDiags)
+	if diags.HasErrors() {
 		return nil, diags
 	}
 	tsCtx.WorkaroundOnce.Do(func() { workaroundVersionCheck(cfg, tsCtx.UserVersion) })
 
-	var variables terraform.InputValues
-	if varFile != "" {
-		absVarFile, err := filepath.Abs(varFile)
+	if len(ctxOpts.CountOverrides) > 0 {
+		// the config is shared by all the test cases
+		cfg = copyConfig(cfg, nil)
+		diags = diags.Append(OverrideCounts(cfg, ctxOpts.CountOverrides))
+		if diags.HasErrors() {
+			return nil, diags
+		}
+	}
+
+	// the values of the variable file of the test case override the base ones
+	variables := make(terraform.InputValues)
+	for _, file := range []string{tsCtx.BaseVariableFile, varFile} {
+		if file == "" {
+			continue
+		}
+		absVarFile, err := filepath.Abs(file)
 		if err != nil {
 			diags = diags.Append(err)
 			return nil, diags
 		}
-		values, hclDiags := c.Parser().LoadValuesFile(absVarFile)
+		values, hclDiags := configs.NewParser(nil).LoadValuesFile(absVarFile)
 		if hclDiags.HasErrors() {
 			diags = diags.Append(hclDiags)
 			return nil, diags
 		}
+		for name, value := range InputValuesFromType(values, terraform.ValueFromNamedFile) {
+			variables[name] = value
+		}
+	}
 
-		variables = InputValuesFromType(values, terraform.ValueFromNamedFile)
+	if ctxOpts.Timings != nil {
+		ctxOpts.Timings.ConfigLoad += time.Since(loadStart)
 	}
 
-	providers := resolver.ResolveProviders()
+	// the schemas of the providers are loaded with the context
+	schemaStart := time.Now()
+	required := cfg.ProviderTypes()
+	for _, addr := range ctxOpts.State.ProviderAddrs() {
+		required = append(required, addr.Provider)
+	}
+	factories := resolver.ResolveProviders()
+	// terraform only reports it can't instantiate a provider, without telling where it looked for the plugin
+	reported := make(map[addrs.Provider]bool)
+	for _, provider := range required {
+		if _, ok := factories[provider]; !ok && !reported[provider] {
+			diags = diags.Append(resolver.pluginNotFound(provider))
+			reported[provider] = true
+		}
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	factories = fetchSchemas(factories, required)
 
 	opts := &terraform.ContextOpts{
 		Config:       cfg,
 		Parallelism:  10,
-		Providers:    providers,
+		Providers:    factories,
 		Provisioners: ProvisionersFactory(),
 		Variables:    variables,
+		State:        ctxOpts.State,
+		Destroy:      ctxOpts.Destroy,
+		Targets:      ctxOpts.Targets,
 		Meta: &terraform.ContextMeta{
-			Env: workspace,
+			Env: ctxOpts.Workspace,
 		},
 	}
 
-	return terraform.NewContext(opts)
+	tfCtx, diags := terraform.NewContext(opts)
+	if ctxOpts.Timings != nil {
+		ctxOpts.Timings.SchemaFetch += time.Since(schemaStart)
+	}
+	return tfCtx, diags
+}
+
+// fetchSchemas requests the schemas of the required providers at the same time, as terraform requests them one after the other
+// when the context is created. It returns the factories with the ones of the required providers serving the fetched schemas.
+// Providers that can't be instantiated keep their factory, so terraform reports the error
+func fetchSchemas(factories map[addrs.Provider]providers.Factory, required []addrs.Provider) map[addrs.Provider]providers.Factory {
+	fetched := make(map[addrs.Provider]providers.Factory, len(factories))
+	for addr, factory := range factories {
+		fetched[addr] = factory
+	}
+	toFetch := make(map[addrs.Provider]providers.Factory)
+	for _, addr := range required {
+		if factory, ok := factories[addr]; ok {
+			toFetch[addr] = factory
+		}
+	}
+	if len(toFetch) < 2 {
+		return fetched
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for addr, factory := range toFetch {
+		wg.Add(1)
+		go func(addr addrs.Provider, factory providers.Factory) {
+			defer wg.Done()
+			provider, err := factory()
+			if err != nil {
+				return
+			}
+			schema := provider.GetSchema()
+			provider.Close()
+			lock.Lock()
+			fetched[addr] = prefetchedFactory(factory, schema)
+			lock.Unlock()
+		}(addr, factory)
+	}
+	wg.Wait()
+	return fetched
+}
+
+// prefetchedFactory returns a factory of the providers of factory serving the given schema
+func prefetchedFactory(factory providers.Factory, schema providers.GetSchemaResponse) providers.Factory {
+	return func() (providers.Interface, error) {
+		provider, err := factory()
+		if err != nil {
+			return nil, err
+		}
+		return &prefetchedProvider{Interface: provider, schema: schema}, nil
+	}
+}
+
+// prefetchedProvider serves a schema fetched beforehand, so the plugin is not started only to get the schema again
+type prefetchedProvider struct {
+	providers.Interface
+	schema providers.GetSchemaResponse
+}
+
+// GetSchema returns the schema fetched beforehand
+func (p *prefetchedProvider) GetSchema() providers.GetSchemaResponse {
+	return p.schema
+}
+
+// configCache loads the config of every folder once, so the test cases of a run share the parsed config and its modules.
+// Its zero value is ready to use
+type configCache struct {
+	lock    sync.Mutex
+	configs map[string]*cachedConfig
+}
+
+type cachedConfig struct {
+	once  sync.Once
+	cfg   *configs.Config
+	diags tfdiags.Diagnostics
+}
+
+// load returns the config found in absDir, loading it on first call
+func (c *configCache) load(absDir string) (*configs.Config, tfdiags.Diagnostics) {
+	c.lock.Lock()
+	if c.configs == nil {
+		c.configs = make(map[string]*cachedConfig)
+	}
+	cached, ok := c.configs[absDir]
+	if !ok {
+		cached = &cachedConfig{}
+		c.configs[absDir] = cached
+	}
+	c.lock.Unlock()
+
+	cached.once.Do(func() { cached.cfg, cached.diags = LoadConfig(absDir) })
+	return cached.cfg, cached.diags
+}
+
+// copyConfig returns a copy of cfg and its children whose resources can be changed without changing cfg.
+// parent is the parent of the copy, nil for a root config
+func copyConfig(cfg *configs.Config, parent *configs.Config) *configs.Config {
+	c := *cfg
+	c.Parent = parent
+	c.Root = &c
+	if parent != nil {
+		c.Root = parent.Root
+	}
+
+	module := *cfg.Module
+	module.ManagedResources = copyResources(cfg.Module.ManagedResources)
+	module.DataResources = copyResources(cfg.Module.DataResources)
+	c.Module = &module
+
+	c.Children = make(map[string]*configs.Config, len(cfg.Children))
+	for name, child := range cfg.Children {
+		c.Children[name] = copyConfig(child, &c)
+	}
+	return &c
+}
+
+func copyResources(resources map[string]*configs.Resource) map[string]*configs.Resource {
+	copied := make(map[string]*configs.Resource, len(resources))
+	for key, r := range resources {
+		resource := *r
+		copied[key] = &resource
+	}
+	return copied
+}
+
+// Refresh refreshes the state of tfCtx, stopping the refresh when ctx is cancelled
+func Refresh(ctx context.Context, tfCtx *terraform.Context) (*states.State, tfdiags.Diagnostics) {
+	var state *states.State
+	diags := stoppable(ctx, tfCtx, func() (diags tfdiags.Diagnostics) {
+		state, diags = tfCtx.Refresh()
+		return diags
+	})
+	return state, diags
+}
+
+// Plan computes the plan of tfCtx, stopping the plan when ctx is cancelled
+func Plan(ctx context.Context, tfCtx *terraform.Context) (*plans.Plan, tfdiags.Diagnostics) {
+	var plan *plans.Plan
+	diags := stoppable(ctx, tfCtx, func() (diags tfdiags.Diagnostics) {
+		plan, diags = tfCtx.Plan()
+		return diags
+	})
+	return plan, diags
+}
+
+// stoppable runs the terraform operation op and stops tfCtx if ctx is cancelled before op returns.
+// The cancellation error is appended to the diagnostics of op
+func stoppable(ctx context.Context, tfCtx *terraform.Context, op func() tfdiags.Diagnostics) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	if err := ctx.Err(); err != nil {
+		return diags.Append(err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			tfCtx.Stop()
+		case <-done:
+		}
+	}()
+
+	diags = diags.Append(op())
+	if err := ctx.Err(); err != nil {
+		diags = diags.Append(err)
+	}
+	return diags
+}
+
+// terraformVersion is the version of the embedded terraform. version.SemVer is only changed to the claimed version while a run claims one
+var terraformVersion = version.SemVer
+
+// versionClaims lets a run claiming a terraform version change version.SemVer, which terraform reads, without other runs seeing the claim :
+// runs claiming a version hold it exclusively, and the other runs hold it shared
+var versionClaims sync.RWMutex
+
+// claimVersion locks versionClaims for a run, exclusively when it claims a version. The returned func unlocks it
+// and restores the version of the embedded terraform the run may have claimed
+func claimVersion(claimed *goversion.Version) func() {
+	if claimed == nil {
+		versionClaims.RLock()
+		return versionClaims.RUnlock
+	}
+	versionClaims.Lock()
+	return func() {
+		version.SemVer = terraformVersion
+		versionClaims.Unlock()
+	}
 }
 
 func workaroundVersionCheck(cfg *configs.Config, userVersion *goversion.Version) {
@@ -97,6 +352,9 @@ func InputValuesFromType(values map[string]cty.Value, sourceType terraform.Value
 
 // LookupProviderSchema searches for the schema matching the given type in the collection of known schemas
 func LookupProviderSchema(schemas *terraform.Schemas, providerType string) *terraform.ProviderSchema {
+	if schemas == nil {
+		return nil
+	}
 	for k, v := range schemas.Providers {
 		if k.Type == providerType {
 			return v
@@ -104,3 +362,63 @@ func LookupProviderSchema(schemas *terraform.Schemas, providerType string) *terr
 	}
 	return nil
 }
+
+// LoadConfig loads the config found in dir, and its modules installed by terraform init
+func LoadConfig(dir string) (*configs.Config, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, diags.Append(err)
+	}
+
+	c, err := configload.NewLoader(&configload.Config{
+		ModulesDir: path.Join(absDir, ".terraform/modules"),
+	})
+	if err != nil {
+		return nil, diags.Append(err)
+	}
+	cfg, hclDiags := c.LoadConfig(absDir)
+	return cfg, diags.Append(hclDiags)
+}
+
+// LoadSchemas starts the provider plugins required by the config found in dir to return their schemas
+func LoadSchemas(ctx context.Context, dir string, pluginDirs []string) (*terraform.Schemas, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, diags.Append(err)
+	}
+	resolver, err := BuildProviderResolver(absDir, pluginDirs...)
+	if err != nil {
+		return nil, diags.Append(err)
+	}
+	tsCtx := &Context{TerraformVersion: terraformVersion, PluginDirs: pluginDirs}
+	tfCtx, diags := NewContext(absDir, "", resolver, tsCtx, &NewContextOptions{Context: ctx, Workspace: "default"})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return tfCtx.Schemas(), diags
+}
+
+// CheckVersionConstraints checks the terraform version constraints of the config found in dir, and of all its modules,
+// accept the given terraform version
+func CheckVersionConstraints(dir string, tfVersion *goversion.Version) tfdiags.Diagnostics {
+	cfg, diags := LoadConfig(dir)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	cfg.DeepEach(func(c *configs.Config) {
+		for _, constraint := range c.Module.CoreVersionConstraints {
+			if !constraint.Required.Check(tfVersion) {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Unsupported Terraform Core version",
+					Detail:   fmt.Sprintf("Terraform %s doesn't match the version constraint %q", tfVersion, constraint.Required),
+					Subject:  constraint.DeclRange.Ptr(),
+				})
+			}
+		}
+	})
+	return diags
+}
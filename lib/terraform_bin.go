@@ -0,0 +1,213 @@
+package terraspec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	goversion "github.com/hashicorp/go-version"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// TerraformReleasesURL is where FindTerraform downloads the terraform binaries missing from the cache
+var TerraformReleasesURL = "https://releases.hashicorp.com/terraform"
+
+// backendOverride replaces the backend of the config in the copy planned by a terraform binary,
+// so the plan starts from an empty state, like the plans of the embedded terraform, and needs no access to the real state
+const backendOverride = `terraform {
+  backend "local" {}
+}
+`
+
+// FindTerraform returns the path of the terraform binary of the given version. It's looked up in the PATH as terraform_<version>,
+// eg terraform_1.5.7, then in the terraspec/terraform/<version> folder of the user cache, where it's downloaded from TerraformReleasesURL
+// when missing. Downloads are checked against the SHA256SUMS file of the release
+func FindTerraform(ctx context.Context, version string) (string, error) {
+	v, err := goversion.NewSemver(version)
+	if err != nil {
+		return "", fmt.Errorf("Invalid terraform version %s : %v", version, err)
+	}
+	version = v.String()
+	exe := "terraform"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	if path, err := exec.LookPath(fmt.Sprintf("terraform_%s", version)); err == nil {
+		return path, nil
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cacheDir, "terraspec", "terraform", version)
+	bin := filepath.Join(dir, exe)
+	if _, err := os.Stat(bin); err == nil {
+		return bin, nil
+	}
+
+	// the release is unpacked next to its final folder, then renamed, so an interrupted download is never found in the cache
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), ".download-"+version)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	release := fmt.Sprintf("%s/%s/terraform_%s", TerraformReleasesURL, version, version)
+	source := fmt.Sprintf("%s_%s_%s.zip?checksum=file:%s_SHA256SUMS", release, runtime.GOOS, runtime.GOARCH, release)
+	if err := download(ctx, source, ".", filepath.Join(tmp, version)); err != nil {
+		return "", fmt.Errorf("Could not download terraform %s : %v", version, err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, version, exe)); err != nil {
+		return "", fmt.Errorf("The release of terraform %s has no %s binary", version, exe)
+	}
+	if err := os.Rename(filepath.Join(tmp, version), dir); err != nil {
+		// another run may have downloaded the same version meanwhile
+		if _, statErr := os.Stat(bin); statErr != nil {
+			return "", err
+		}
+	}
+	return bin, nil
+}
+
+// terraformPlan is the plan of a test case computed by a terraform binary
+type terraformPlan struct {
+	// json is the plan in the JSON format of terraform show -json
+	json []byte
+	// rendered is the plan as printed by terraform show, only set when asked for
+	rendered string
+}
+
+// planWithTerraform computes the plan of the test case with the terraform binary bin, in a copy of the config found in configDir.
+// The copy is initialized with its own data dir and a local backend, so neither the .terraform folder nor the state of the config
+// are used. The providers are installed by terraform init and they read the data sources, so they need their credentials like terraform plan.
+// The workspace, plan mode and targets of the terraspec block of the spec are given to terraform
+func planWithTerraform(ctx context.Context, bin, configDir string, tc *TestCase, tsCtx *Context, render bool) (*terraformPlan, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	config, configDiags := ReadTerraspecConfig(tc.SpecFile)
+	diags = diags.Append(configDiags)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	workdir, err := NewWorkdir(configDir)
+	if err != nil {
+		return nil, diags.Append(fmt.Errorf("Could not copy %s to plan it : %v", configDir, err))
+	}
+	defer workdir.Close()
+	if err := ioutil.WriteFile(filepath.Join(workdir.Dir, "terraspec_override.tf"), []byte(backendOverride), 0644); err != nil {
+		return nil, diags.Append(err)
+	}
+	dataDir, err := ioutil.TempDir("", "terraspec-data")
+	if err != nil {
+		return nil, diags.Append(err)
+	}
+	defer os.RemoveAll(dataDir)
+	run := func(args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, bin, args...)
+		cmd.Dir = workdir.Dir
+		cmd.Env = append(os.Environ(), "TF_DATA_DIR="+dataDir, "TF_IN_AUTOMATION=1", "TF_INPUT=0")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("terraform %s failed : %v\n%s%s", args[0], err, out, stderr.Bytes())
+		}
+		return out, nil
+	}
+
+	if _, err := run("init", "-input=false", "-no-color"); err != nil {
+		return nil, diags.Append(err)
+	}
+	if config.Workspace != "" && config.Workspace != "default" {
+		if _, err := run("workspace", "new", "-no-color", config.Workspace); err != nil {
+			return nil, diags.Append(err)
+		}
+	}
+	planFile := filepath.Join(dataDir, "tfplan")
+	args := []string{"plan", "-input=false", "-lock=false", "-no-color", "-out=" + planFile}
+	switch config.PlanMode {
+	case PlanModeDestroy:
+		args = append(args, "-destroy")
+	case PlanModeRefreshOnly:
+		args = append(args, "-refresh-only")
+	}
+	for _, target := range config.Targets {
+		args = append(args, "-target="+target.String())
+	}
+	for _, file := range []string{tsCtx.BaseVariableFile, tc.VariableFile} {
+		if file != "" {
+			args = append(args, "-var-file="+absPath(file))
+		}
+	}
+	if _, err := run(args...); err != nil {
+		return nil, diags.Append(err)
+	}
+
+	plan := &terraformPlan{}
+	if plan.json, err = run("show", "-json", planFile); err != nil {
+		return nil, diags.Append(err)
+	}
+	if render {
+		rendered, err := run("show", "-no-color", planFile)
+		if err != nil {
+			return nil, diags.Append(err)
+		}
+		plan.rendered = string(rendered)
+	}
+	return plan, diags
+}
+
+// runWithTerraform runs the test case against the plan computed by the terraform binary of tsCtx, see planWithTerraform.
+// The spec is decoded with the schemas implied by the plan, like CheckPlanJSON, so the config only has to be supported by that
+// terraform version. Mocks, states and hooks of the spec are ignored
+func runWithTerraform(ctx context.Context, configDir string, tc *TestCase, tsCtx *Context, display planDisplay) (caseOutput, tfdiags.Diagnostics) {
+	var out caseOutput
+	var diags tfdiags.Diagnostics
+
+	planStart := time.Now()
+	tfPlan, planDiags := planWithTerraform(ctx, tsCtx.TerraformBin, configDir, tc, tsCtx, display != displayNone)
+	out.timings.Plan = time.Since(planStart)
+	diags = diags.Append(planDiags)
+	if diags.HasErrors() {
+		return out, diags
+	}
+	out.json = tfPlan.json
+	if display == displayAll {
+		out.rendered = tfPlan.rendered
+	}
+
+	schemas, err := InferSchemas(tfPlan.json)
+	if err != nil {
+		return out, diags.Append(err)
+	}
+	plan, err := PlanFromJSON(tfPlan.json, schemas)
+	if err != nil {
+		return out, diags.Append(err)
+	}
+	spec, specDiags := ReadSpec(tc.SpecFile, schemas)
+	diags = diags.Append(specDiags)
+	if diags.HasErrors() {
+		return out, diags
+	}
+	spec.ShowSensitive = tsCtx.ShowSensitive
+	spec.AssertWorkers = tsCtx.AssertWorkers
+
+	validateStart := time.Now()
+	diags = diags.Append(validatePlan(ctx, spec, plan, tfPlan.json, nil))
+	out.timings.Validate = time.Since(validateStart)
+	out.blocks = spec.blockRanges()
+	out.expectedFailure = spec.Terraspec.ExpectFailure
+	if display == displayFailed && diags.HasErrors() {
+		out.rendered = tfPlan.rendered
+	}
+	return out, diags
+}
@@ -0,0 +1,166 @@
+package terraspec
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunSuiteWithTerraformBin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake terraform binary is a shell script")
+	}
+	root, err := ioutil.TempDir("", "terraspec-terraform-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"config/main.tf": `resource "aws_instance" "app" {}`,
+		"config/spec/staging/staging.tfspec": `
+terraspec {
+  workspace = "staging"
+}
+assert "aws_instance" "app" {
+  ami = "ami-123"
+}
+assert "moved" "aws_instance.app" {
+  from = "aws_instance.server"
+}`,
+		"config/spec/staging/staging.tfvars": `size = 2`,
+	})
+
+	// the fake terraform records its arguments, and the backend override found in the folder it runs in
+	bin := filepath.Join(root, "terraform")
+	script := `#!/bin/sh
+echo "$@" >> ` + filepath.Join(root, "args") + `
+case "$1" in
+init)
+  cp terraspec_override.tf ` + filepath.Join(root, "override") + `
+  ;;
+show)
+  echo '{"format_version":"1.2","resource_changes":[{"address":"aws_instance.app","previous_address":"aws_instance.server","mode":"managed","type":"aws_instance","name":"app",
+"change":{"actions":["update"],"before":{"ami":"ami-000"},"after":{"ami":"ami-123"}}}]}' | tr -d '\n'
+  ;;
+esac
+`
+	if err := ioutil.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := RunSuite(context.Background(), Options{Dir: filepath.Join(root, "config"), TerraformBin: bin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Cases) != 1 {
+		t.Fatalf("Expected 1 test case, got %d", len(results.Cases))
+	}
+	if r := results.Cases[0]; r.Failed() || len(r.Assertions) != 2 {
+		t.Errorf("Expected the test case to pass its 2 assertions, got %v %v", r.Assertions, r.Diagnostics.Err())
+	}
+
+	args, err := ioutil.ReadFile(filepath.Join(root, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"init -input=false -no-color",
+		"workspace new -no-color staging",
+		"-var-file=" + filepath.Join(root, "config", "spec", "staging", "staging.tfvars"),
+		"show -json",
+	} {
+		if !strings.Contains(string(args), expected) {
+			t.Errorf("Expected terraform to be run with %q, got %s", expected, args)
+		}
+	}
+	if override, err := ioutil.ReadFile(filepath.Join(root, "override")); err != nil || string(override) != backendOverride {
+		t.Errorf("Expected the backend to be overridden, got %q, %v", override, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "config", "terraspec_override.tf")); !os.IsNotExist(err) {
+		t.Errorf("The backend override should only be written in the copy of the config, got %v", err)
+	}
+}
+
+func TestFindTerraform(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "terraspec-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	for _, env := range []string{"XDG_CACHE_HOME", "HOME", "PATH"} {
+		defer os.Setenv(env, os.Getenv(env))
+	}
+	os.Setenv("XDG_CACHE_HOME", cacheDir)
+	os.Setenv("HOME", cacheDir)
+
+	exe := "terraform"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	w, err := zw.Create(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("terraform 1.5.7"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipName := fmt.Sprintf("terraform_1.5.7_%s_%s.zip", runtime.GOOS, runtime.GOARCH)
+	sum := sha256.Sum256(archive.Bytes())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.5.7/" + zipName:
+			w.Write(archive.Bytes())
+		case "/1.5.7/terraform_1.5.7_SHA256SUMS":
+			fmt.Fprintf(w, "%x  %s\n", sum, zipName)
+		case "/1.5.8/terraform_1.5.8_SHA256SUMS":
+			fmt.Fprintf(w, "%x  %s\n", sha256.Sum256([]byte("other")), strings.Replace(zipName, "1.5.7", "1.5.8", 1))
+		case "/1.5.8/" + strings.Replace(zipName, "1.5.7", "1.5.8", 1):
+			w.Write(archive.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer func(url string) { TerraformReleasesURL = url }(TerraformReleasesURL)
+	TerraformReleasesURL = server.URL
+
+	bin, err := FindTerraform(context.Background(), "1.5.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(bin); err != nil || string(content) != "terraform 1.5.7" {
+		t.Errorf("Expected the downloaded binary, got %q, %v", content, err)
+	}
+	if _, err := FindTerraform(context.Background(), "1.5.8"); err == nil {
+		t.Errorf("A download not matching its checksum should be an error")
+	}
+
+	// the downloaded binary is found in the cache
+	server.Close()
+	if cached, err := FindTerraform(context.Background(), "1.5.7"); err != nil || cached != bin {
+		t.Errorf("Expected the cached binary %s, got %s, %v", bin, cached, err)
+	}
+
+	// binaries named after their version are found in the PATH
+	pathDir := filepath.Join(cacheDir, "bin")
+	writeFiles(t, pathDir, map[string]string{"terraform_1.6.0": ""})
+	if err := os.Chmod(filepath.Join(pathDir, "terraform_1.6.0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("PATH", pathDir)
+	if found, err := FindTerraform(context.Background(), "1.6.0"); err != nil || found != filepath.Join(pathDir, "terraform_1.6.0") {
+		t.Errorf("Expected terraform_1.6.0 to be found in the PATH, got %s, %v", found, err)
+	}
+}
@@ -0,0 +1,154 @@
+package terraspec
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	goversion "github.com/hashicorp/go-version"
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+func TestCheckVersionConstraints(t *testing.T) {
+	tests := map[string]bool{
+		"0.12.29": false,
+		"0.13.2":  true,
+		"1.5.7":   true,
+		"2.0.0":   false,
+	}
+	for v, supported := range tests {
+		t.Run(v, func(t *testing.T) {
+			diags := CheckVersionConstraints("testdata/version_constraints", goversion.Must(goversion.NewSemver(v)))
+			if diags.HasErrors() == supported {
+				t.Errorf("terraform %s should be supported : %v, got %v", v, supported, diags.Err())
+			}
+		})
+	}
+}
+
+func TestStoppable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	diags := stoppable(ctx, nil, func() tfdiags.Diagnostics {
+		called = true
+		return nil
+	})
+	if called {
+		t.Errorf("operation should not run once the context is cancelled")
+	}
+	if !diags.HasErrors() || diags.Err().Error() != context.Canceled.Error() {
+		t.Errorf("cancellation should be reported, got %v", diags.Err())
+	}
+}
+
+func TestConfigCache(t *testing.T) {
+	var cache configCache
+	dir, err := filepath.Abs("testdata/expansion")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	loaded := make([]*configs.Config, 4)
+	for i := range loaded {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cfg, diags := cache.load(dir)
+			if diags.HasErrors() {
+				t.Error(diags.Err())
+			}
+			loaded[i] = cfg
+		}(i)
+	}
+	wg.Wait()
+	for _, cfg := range loaded[1:] {
+		if cfg != loaded[0] {
+			t.Fatal("the config should be loaded once and shared")
+		}
+	}
+
+	copied := copyConfig(loaded[0], nil)
+	if diags := OverrideCounts(copied, map[string]int{"ressource_type.replica": 3}); diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	if copied.Root != copied {
+		t.Error("the copy should be its own root")
+	}
+	if count := copied.Module.ManagedResources["ressource_type.replica"].Count; len(count.Variables()) != 0 {
+		t.Error("count of the copy should be overridden")
+	}
+	if count := loaded[0].Module.ManagedResources["ressource_type.replica"].Count; len(count.Variables()) == 0 {
+		t.Error("overriding counts of the copy should leave the shared config unchanged")
+	}
+}
+
+// slowSchemaProvider takes some time to return its schema, counting how many schemas are requested at the same time
+type slowSchemaProvider struct {
+	providers.Interface
+	running, maxRunning, calls *int32
+}
+
+func (p *slowSchemaProvider) GetSchema() providers.GetSchemaResponse {
+	atomic.AddInt32(p.calls, 1)
+	running := atomic.AddInt32(p.running, 1)
+	defer atomic.AddInt32(p.running, -1)
+	for {
+		max := atomic.LoadInt32(p.maxRunning)
+		if running <= max || atomic.CompareAndSwapInt32(p.maxRunning, max, running) {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	return providers.GetSchemaResponse{}
+}
+
+func (p *slowSchemaProvider) Close() error {
+	return nil
+}
+
+func TestFetchSchemas(t *testing.T) {
+	var running, maxRunning, calls int32
+	factory := func() (providers.Interface, error) {
+		return &slowSchemaProvider{running: &running, maxRunning: &maxRunning, calls: &calls}, nil
+	}
+	factories := map[addrs.Provider]providers.Factory{
+		addrs.NewDefaultProvider("aws"):    factory,
+		addrs.NewDefaultProvider("google"): factory,
+		addrs.NewDefaultProvider("azurerm"): func() (providers.Interface, error) {
+			return nil, fmt.Errorf("not installed")
+		},
+		addrs.NewDefaultProvider("unused"): factory,
+	}
+	required := []addrs.Provider{addrs.NewDefaultProvider("aws"), addrs.NewDefaultProvider("google"), addrs.NewDefaultProvider("azurerm")}
+
+	fetched := fetchSchemas(factories, required)
+	if len(fetched) != len(factories) {
+		t.Fatalf("Expected %d factories, got %d", len(factories), len(fetched))
+	}
+	if maxRunning != 2 || calls != 2 {
+		t.Errorf("Expected the schemas of the 2 required providers to be fetched at the same time, got %d calls and %d at once", calls, maxRunning)
+	}
+	for _, name := range []string{"aws", "google"} {
+		provider, err := fetched[addrs.NewDefaultProvider(name)]()
+		if err != nil {
+			t.Fatal(err)
+		}
+		provider.GetSchema()
+	}
+	if calls != 2 {
+		t.Errorf("Fetched schemas should be served without requesting them again, got %d calls", calls)
+	}
+	if _, err := fetched[addrs.NewDefaultProvider("azurerm")](); err == nil {
+		t.Errorf("Providers failing to start should keep their error")
+	}
+}
@@ -0,0 +1,129 @@
+package terraspec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TerragruntFile is the name of the file declaring a terragrunt stack
+const TerragruntFile = "terragrunt.hcl"
+
+// TerragruntInputsFile is the name of the variable file the inputs of a terragrunt stack are written to, in its working folder
+const TerragruntInputsFile = "terragrunt-inputs.tfvars.json"
+
+// TerragruntStack is a folder of a terragrunt project, whose terragrunt.hcl file generates the terraform config the specs run against
+type TerragruntStack struct {
+	// Dir is the folder of the terragrunt.hcl file
+	Dir string
+	// WorkingDir is the folder terragrunt generated the terraform config of the stack in, eg in .terragrunt-cache
+	WorkingDir string
+	// InputsFile is the variable file holding the inputs of the stack, to be given as Options.BaseVariableFile
+	InputsFile string
+}
+
+// FindTerragruntStacks returns the folders under root holding a terragrunt.hcl file and a specDir folder, sorted.
+// The caches of terragrunt and terraform are not searched
+func FindTerragruntStacks(root, specDir string) ([]string, error) {
+	var stacks []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == ".terragrunt-cache" || info.Name() == ".terraform") {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || info.Name() != TerragruntFile {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		if specs, err := os.Stat(filepath.Join(dir, specDir)); err == nil && specs.IsDir() {
+			stacks = append(stacks, dir)
+		}
+		return nil
+	})
+	sort.Strings(stacks)
+	return stacks, err
+}
+
+// RenderTerragruntStack runs terragrunt in dir to generate the terraform config of the stack and initialize it,
+// then writes the inputs of the stack to a variable file of its working folder. terragruntBin runs terraform with terraformBin.
+// It needs a terragrunt version with the terragrunt-info and render-json commands
+func RenderTerragruntStack(ctx context.Context, dir, terragruntBin, terraformBin string) (*TerragruntStack, error) {
+	run := func(args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, terragruntBin, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "TERRAGRUNT_TFPATH="+terraformBin, "TG_TF_PATH="+terraformBin, "TF_IN_AUTOMATION=1")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("terragrunt %s failed in %s : %v\n%s", strings.Join(args, " "), dir, err, stderr.String())
+		}
+		return output, nil
+	}
+
+	if _, err := run("init", "-input=false"); err != nil {
+		return nil, err
+	}
+	output, err := run("terragrunt-info")
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		WorkingDir string
+	}
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, fmt.Errorf("Could not read the output of terragrunt-info in %s : %v", dir, err)
+	}
+
+	rendered, err := ioutil.TempFile("", "terragrunt-*.json")
+	if err != nil {
+		return nil, err
+	}
+	rendered.Close()
+	defer os.Remove(rendered.Name())
+	if _, err := run("render-json", "--terragrunt-json-out", rendered.Name()); err != nil {
+		return nil, err
+	}
+	config, err := ioutil.ReadFile(rendered.Name())
+	if err != nil {
+		return nil, err
+	}
+	inputsFile, err := writeTerragruntInputs(info.WorkingDir, config)
+	if err != nil {
+		return nil, fmt.Errorf("Could not write the inputs of %s : %v", dir, err)
+	}
+	return &TerragruntStack{Dir: dir, WorkingDir: info.WorkingDir, InputsFile: inputsFile}, nil
+}
+
+// writeTerragruntInputs writes the inputs of the config rendered by terragrunt render-json to TerragruntInputsFile in workingDir,
+// and returns its path. Like terragrunt does, the inputs the config doesn't declare as variables are left out
+func writeTerragruntInputs(workingDir string, rendered []byte) (string, error) {
+	var config struct {
+		Inputs map[string]json.RawMessage `json:"inputs"`
+	}
+	if err := json.Unmarshal(rendered, &config); err != nil {
+		return "", err
+	}
+	if cfg, diags := LoadConfig(workingDir); !diags.HasErrors() {
+		for name := range config.Inputs {
+			if _, ok := cfg.Module.Variables[name]; !ok {
+				delete(config.Inputs, name)
+			}
+		}
+	}
+	inputs, err := json.MarshalIndent(config.Inputs, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(workingDir, TerragruntInputsFile)
+	return file, ioutil.WriteFile(file, inputs, 0644)
+}
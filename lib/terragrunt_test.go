@@ -0,0 +1,69 @@
+package terraspec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindTerragruntStacks(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-terragrunt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, dir := range []string{"prod/app/spec", "dev/app/spec", "dev/db", "dev/app/.terragrunt-cache/abc/spec"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"terragrunt.hcl", "prod/app/terragrunt.hcl", "dev/app/terragrunt.hcl", "dev/db/terragrunt.hcl", "dev/app/.terragrunt-cache/abc/terragrunt.hcl"} {
+		if err := ioutil.WriteFile(filepath.Join(root, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stacks, err := FindTerragruntStacks(root, "spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(root, "dev/app"), filepath.Join(root, "prod/app")}
+	if !reflect.DeepEqual(stacks, expected) {
+		t.Errorf("Expected stacks %v, got %v", expected, stacks)
+	}
+}
+
+func TestWriteTerragruntInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-terragrunt-inputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("variable \"region\" {}\nvariable \"tags\" {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rendered := `{"terraform": {"source": "../modules/app"}, "inputs": {"region": "eu-west-1", "tags": {"env": "dev"}, "undeclared": true}}`
+	file, err := writeTerragruntInputs(dir, []byte(rendered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != filepath.Join(dir, TerragruntInputsFile) {
+		t.Errorf("Unexpected inputs file %s", file)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inputs map[string]interface{}
+	if err := json.Unmarshal(content, &inputs); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"region": "eu-west-1", "tags": map[string]interface{}{"env": "dev"}}
+	if !reflect.DeepEqual(inputs, expected) {
+		t.Errorf("Expected inputs %v, got %v", expected, inputs)
+	}
+}
@@ -0,0 +1,47 @@
+// Package terraspectest runs terraspec test suites from go tests
+package terraspectest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	terraspec "github.com/nhurel/terraspec/lib"
+	"github.com/nhurel/terraspec/lib/format"
+)
+
+// Run runs the test suite described by opts and reports every test case as a subtest of t.
+// Every failed assertion or error of a test case fails its subtest, and skipped test cases skip their subtest.
+// The failed assertions of a test case expected to fail are only logged
+func Run(t *testing.T, opts terraspec.Options) *terraspec.Results {
+	t.Helper()
+	results, err := terraspec.RunSuite(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range results.Cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			if c.SkipReason != "" {
+				t.Skip(c.SkipReason)
+			}
+			if c.FailedAsExpected() {
+				t.Logf("failed as expected : %s", c.ExpectedFailure)
+				return
+			}
+			Report(t, c.Diagnostics)
+		})
+	}
+	return results
+}
+
+// Report fails t with every failed assertion or error found in diags
+func Report(t testing.TB, diags tfdiags.Diagnostics) {
+	t.Helper()
+	for _, diag := range diags {
+		if diag.Severity() == tfdiags.Error {
+			t.Error(strings.TrimSpace(format.Diagnostic(diag, format.Options{})))
+		}
+	}
+}
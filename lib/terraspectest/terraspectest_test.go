@@ -0,0 +1,58 @@
+package terraspectest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	terraspec "github.com/nhurel/terraspec/lib"
+)
+
+func TestRun(t *testing.T) {
+	results := Run(t, terraspec.Options{Dir: "testdata/suite"})
+	if len(results.Cases) != 3 {
+		t.Fatalf("Expected the results of 3 test cases, got %d", len(results.Cases))
+	}
+	for _, c := range results.Cases {
+		switch c.Name {
+		case "passing":
+			if c.Failed() || len(c.Assertions) == 0 {
+				t.Errorf("Test case passing should pass its assertions, got %v", c.Diagnostics.Err())
+			}
+		case "parked":
+			if c.SkipReason != "waiting for a provider fix" {
+				t.Errorf("Test case parked should be skipped, got %q", c.SkipReason)
+			}
+		case "known_bug":
+			if !c.FailedAsExpected() {
+				t.Errorf("Test case known_bug should fail as expected, got %v", c.Diagnostics.Err())
+			}
+		}
+	}
+}
+
+// recorder records the errors reported to it
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Error(args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func TestReport(t *testing.T) {
+	var diags tfdiags.Diagnostics
+	diags = diags.Append(tfdiags.Sourceless(tfdiags.Warning, "Deprecated attribute", "ignored"))
+	diags = diags.Append(errors.New("Could not compute the plan"))
+
+	r := &recorder{TB: t}
+	Report(r, diags)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "Could not compute the plan") {
+		t.Errorf("Only the errors should be reported, got %q", r.errors)
+	}
+}
@@ -0,0 +1,7 @@
+variable "size" {
+  type = number
+}
+
+output "size" {
+  value = "size-${var.size}"
+}
@@ -0,0 +1,46 @@
+// Package terratest checks terraspec assertions against the plans computed by terratest,
+// for teams that already run terraform from go tests.
+// Plans are read in the JSON format of terraform show -json, eg as returned by terraform.InitAndPlanAndShow of terratest,
+// or by json.Marshal of the RawPlan of a terraform.PlanStruct
+package terratest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	terraspec "github.com/nhurel/terraspec/lib"
+	"github.com/nhurel/terraspec/lib/terraspectest"
+)
+
+// AssertPlan checks the assertions of specFile against planJSON and fails t with every failed assertion.
+// The provider schemas are loaded from terraformDir, which must have been initialized, as terratest does before planning
+func AssertPlan(t testing.TB, terraformDir, specFile, planJSON string) tfdiags.Diagnostics {
+	t.Helper()
+	diags, err := AssertPlanE(t, terraformDir, specFile, planJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	terraspectest.Report(t, diags)
+	return diags
+}
+
+// AssertPlanE checks the assertions of specFile against planJSON and returns their results.
+// It returns an error when the schemas, the spec or the plan can't be read, rather than failing t.
+// Mocks, states and hooks of the spec are ignored, as the plan has already been computed
+func AssertPlanE(t testing.TB, terraformDir, specFile, planJSON string) (tfdiags.Diagnostics, error) {
+	t.Helper()
+	schemas, diags := terraspec.LoadSchemas(context.Background(), terraformDir, nil)
+	if diags.HasErrors() {
+		return nil, diags.Err()
+	}
+	spec, diags := terraspec.ReadSpec(specFile, schemas)
+	if diags.HasErrors() {
+		return nil, diags.Err()
+	}
+	plan, err := terraspec.PlanFromJSON([]byte(planJSON), schemas)
+	if err != nil {
+		return nil, err
+	}
+	return spec.Validate(context.Background(), plan)
+}
@@ -0,0 +1,36 @@
+package terratest
+
+import (
+	"fmt"
+	"testing"
+)
+
+// recorder is a testing.TB recording the errors reported
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Error(args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func TestAssertPlan(t *testing.T) {
+	planJSON := `{
+  "format_version": "0.1",
+  "resource_changes": [],
+  "output_changes": {
+    "size": {"actions": ["create"], "before": null, "after": ["3"], "after_unknown": false}
+  }
+}`
+	r := &recorder{TB: t}
+	AssertPlan(r, "testdata/config", "testdata/config/spec.tfspec", planJSON)
+	if len(r.errors) != 1 {
+		t.Fatalf("1 error expected, got %v", r.errors)
+	}
+	if expected := "FAIL output.output.size : 3 != 4 (testdata/config/spec.tfspec#1,1)"; r.errors[0] != expected {
+		t.Errorf("Unexpected error\nwant: %s\ngot:  %s", expected, r.errors[0])
+	}
+}
@@ -0,0 +1,7 @@
+test_case "prod" {
+  spec = "prod.tfspec"
+}
+
+test_case "prod" {
+  spec = "other.tfspec"
+}
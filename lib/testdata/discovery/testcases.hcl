@@ -0,0 +1,8 @@
+test_case "prod" {
+  spec      = "../envs/prod/prod.tfspec"
+  variables = "../envs/prod/prod.tfvars"
+}
+
+test_case "staging" {
+  spec = "../envs/staging.tfspec"
+}
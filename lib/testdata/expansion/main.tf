@@ -0,0 +1,8 @@
+data "data_type" "selected" {
+  query = 1
+}
+
+resource "ressource_type" "replica" {
+  count    = length(data.data_type.selected.name)
+  property = "value"
+}
@@ -0,0 +1,17 @@
+data "mock_image" "ubuntu" {
+  name = "ubuntu"
+}
+
+data "mock_image" "debian" {
+  name = "debian"
+}
+
+resource "mock_server" "web" {
+  name  = "web"
+  image = data.mock_image.ubuntu.id
+}
+
+resource "mock_server" "db" {
+  name  = "db"
+  image = data.mock_image.debian.id
+}
@@ -0,0 +1,17 @@
+variable "name" {
+  type = string
+}
+
+variable "size" {
+  type    = number
+  default = 2
+}
+
+variable "tags" {
+  type    = map(string)
+  default = {}
+}
+
+output "greeting" {
+  value = "hello ${var.name}"
+}
@@ -0,0 +1,7 @@
+package terraform.actions
+
+deny[msg] {
+  change := input.resource_changes[_]
+  change.change.actions[_] == "delete"
+  msg := sprintf("%s must not be deleted", [change.address])
+}
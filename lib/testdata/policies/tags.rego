@@ -0,0 +1,7 @@
+package terraform.tags
+
+deny[msg] {
+  change := input.resource_changes[_]
+  not change.change.after.tags.owner
+  msg := sprintf("%s has no owner tag", [change.address])
+}
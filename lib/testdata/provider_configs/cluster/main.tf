@@ -0,0 +1,7 @@
+provider "aws" {
+  alias = "east"
+}
+
+resource "aws_instance" "node" {
+  provider = aws.east
+}
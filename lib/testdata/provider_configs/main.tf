@@ -0,0 +1,26 @@
+terraform {
+  required_providers {
+    acme = {
+      source = "acme/aws"
+    }
+  }
+}
+
+provider "aws" {}
+
+provider "aws" {
+  alias = "west"
+}
+
+provider "acme" {}
+
+module "network" {
+  source = "./network"
+  providers = {
+    aws = aws.west
+  }
+}
+
+module "cluster" {
+  source = "./cluster"
+}
@@ -0,0 +1 @@
+resource "aws_vpc" "main" {}
@@ -0,0 +1,17 @@
+variable "size" {
+  type = number
+
+  validation {
+    condition     = var.size > 0
+    error_message = "Size must be positive."
+  }
+}
+
+variable "name" {
+  type = string
+
+  validation {
+    condition     = length(var.name) > 2
+    error_message = "Name is too short."
+  }
+}
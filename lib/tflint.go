@@ -0,0 +1,145 @@
+package terraspec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DefaultTflintBin is the tflint binary run by the lint blocks of the specs when Options.TflintBin is not set
+const DefaultTflintBin = "tflint"
+
+// Tflint is a run of tflint against the config of a test case, declared by a lint block of the spec
+type Tflint struct {
+	// Ruleset is the tflint plugin whose rules are enabled, eg aws. The rules enabled by the tflint config file run when it's empty
+	Ruleset string
+	// Config is the path of the tflint config file, relative to the spec file. tflint looks for .tflint.hcl when it's empty
+	Config string
+	// Rules restricts the run to the given rules, like tflint --only
+	Rules []string
+	// DeclRange is the source range of the lint block in the spec file
+	DeclRange hcl.Range
+}
+
+// tflintOutput is the output of tflint --format=json
+type tflintOutput struct {
+	Issues []struct {
+		Rule struct {
+			Name     string `json:"name"`
+			Severity string `json:"severity"`
+		} `json:"rule"`
+		Message string      `json:"message"`
+		Range   tflintRange `json:"range"`
+	} `json:"issues"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+type tflintRange struct {
+	Filename string `json:"filename"`
+	Start    struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"start"`
+}
+
+// RunLints runs tflint with bin for every lint block of the spec, against the config of configDir with the given variable files.
+// Every issue tflint finds is reported as a failed assertion on lint.<ruleset>.<rule>, and a lint block without issue as a passed one
+func (s *Spec) RunLints(ctx context.Context, bin, configDir string, varFiles []string) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	for _, lint := range s.Lints {
+		diags = diags.Append(lint.run(ctx, bin, configDir, varFiles))
+	}
+	return diags
+}
+
+func (l *Tflint) run(ctx context.Context, bin, configDir string, varFiles []string) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	if bin == "" {
+		bin = DefaultTflintBin
+	}
+	dir, err := filepath.Abs(configDir)
+	if err != nil {
+		return diags.Append(err)
+	}
+	args := []string{"--format=json", "--chdir=" + dir}
+	if l.Ruleset != "" {
+		args = append(args, "--enable-plugin="+l.Ruleset)
+	}
+	if l.Config != "" {
+		args = append(args, "--config="+l.Config)
+	}
+	for _, rule := range l.Rules {
+		args = append(args, "--only="+rule)
+	}
+	for _, file := range varFiles {
+		if file == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+		args = append(args, "--var-file="+file)
+	}
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// tflint exits with a non zero code when it finds issues, so only its output tells if it failed
+	runErr := cmd.Run()
+	var output tflintOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		if runErr == nil {
+			runErr = err
+		}
+		return diags.Append(l.failure(fmt.Sprintf("Could not run %s %s : %v\n%s", bin, strings.Join(args, " "), runErr, stderr.String())))
+	}
+	if len(output.Errors) > 0 {
+		var messages []string
+		for _, e := range output.Errors {
+			messages = append(messages, e.Message)
+		}
+		return diags.Append(l.failure(strings.Join(messages, "\n")))
+	}
+
+	ruleset := l.Ruleset
+	if ruleset == "" {
+		ruleset = "terraform"
+	}
+	path := cty.GetAttrPath("lint").GetAttr(ruleset)
+	for _, issue := range output.Issues {
+		message := fmt.Sprintf("%s (%s#%d,%d)", issue.Message, issue.Range.Filename, issue.Range.Start.Line, issue.Range.Start.Column)
+		diag := ErrorDiags(path.GetAttr(issue.Rule.Name), message)
+		diag.Subject = l.DeclRange.Ptr()
+		diags = diags.Append(diag)
+	}
+	if len(output.Issues) == 0 {
+		diag := SuccessDiags(path, "No violation")
+		diag.Subject = l.DeclRange.Ptr()
+		diags = diags.Append(diag)
+	}
+	return diags
+}
+
+func (l *Tflint) failure(detail string) *hcl.Diagnostic {
+	return &hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Lint failed", Detail: detail, Subject: l.DeclRange.Ptr()}
+}
+
+// newTflint creates the tflint run declared in the given spec file
+func newTflint(ruleset, config string, rules []string, declRange hcl.Range, specFile string) *Tflint {
+	if config != "" && !filepath.IsAbs(config) {
+		if abs, err := filepath.Abs(filepath.Join(filepath.Dir(specFile), config)); err == nil {
+			config = abs
+		}
+	}
+	return &Tflint{Ruleset: ruleset, Config: config, Rules: rules, DeclRange: declRange}
+}
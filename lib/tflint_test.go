@@ -0,0 +1,96 @@
+package terraspec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+func TestRunLints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-tflint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the fake tflint records its arguments and prints the output of the ruleset it's run with
+	bin := filepath.Join(dir, "tflint")
+	script := `#!/bin/sh
+echo "$@" >> ` + filepath.Join(dir, "args") + `
+case "$*" in
+*--enable-plugin=aws*)
+  echo '{"issues":[{"rule":{"name":"aws_instance_invalid_type","severity":"error"},"message":"\"t1.2xlarge\" is an invalid value as instance_type","range":{"filename":"main.tf","start":{"line":3,"column":19}}}],"errors":[]}'
+  exit 2;;
+*--enable-plugin=broken*)
+  echo '{"issues":[],"errors":[{"message":"Plugin \"broken\" not found","severity":"error"}]}'
+  exit 1;;
+esac
+echo '{"issues":[],"errors":[]}'
+`
+	if err := ioutil.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	specFile := filepath.Join(dir, "spec", "lint.tfspec")
+	spec, diags := ParseSpec([]byte(`
+lint {
+  config = ".tflint.hcl"
+  rules  = ["terraform_unused_declarations"]
+}
+
+lint {
+  ruleset = "aws"
+}
+
+lint {
+  ruleset = "broken"
+}
+`), specFile, nil)
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if len(spec.Lints) != 3 {
+		t.Fatalf("Expected 3 lint blocks, got %d", len(spec.Lints))
+	}
+
+	lintDiags := spec.RunLints(context.Background(), bin, dir, []string{"", filepath.Join(dir, "spec", "lint.tfvars")})
+	if len(lintDiags) != 3 {
+		t.Fatalf("Expected 3 diagnostics, got %v", lintDiags.Err())
+	}
+	expected := []struct {
+		severity tfdiags.Severity
+		detail   string
+		line     int
+	}{
+		{Info, "No violation", 2},
+		{tfdiags.Error, `"t1.2xlarge" is an invalid value as instance_type (main.tf#3,19)`, 7},
+		{tfdiags.Error, `Plugin "broken" not found`, 11},
+	}
+	for i, e := range expected {
+		if lintDiags[i].Severity() != e.severity || lintDiags[i].Description().Detail != e.detail {
+			t.Errorf("Expected diagnostic %q, got %q", e.detail, lintDiags[i].Description().Detail)
+		}
+		if subject := lintDiags[i].Source().Subject; subject == nil || subject.Start.Line != e.line {
+			t.Errorf("Diagnostic %d should be reported at its lint block, got %v", i, subject)
+		}
+	}
+	if path := tfdiags.GetAttribute(lintDiags[1].(*TerraspecDiagnostic).Diagnostic); FormatPath(path) != "lint.aws.aws_instance_invalid_type" {
+		t.Errorf("Unexpected path of the issue %s", FormatPath(path))
+	}
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := strings.Split(string(args), "\n")[0]
+	expectedArgs := "--format=json --chdir=" + dir + " --config=" + filepath.Join(dir, "spec", ".tflint.hcl") +
+		" --only=terraform_unused_declarations --var-file=" + filepath.Join(dir, "spec", "lint.tfvars")
+	if first != expectedArgs {
+		t.Errorf("Expected tflint to run with %s, got %s", expectedArgs, first)
+	}
+}
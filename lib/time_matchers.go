@@ -0,0 +1,138 @@
+package terraspec
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// now returns the current time the timestamps are checked against
+var now = time.Now
+
+// timestampLayouts are the layouts planned timestamps are parsed with, RFC3339 first
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02",
+}
+
+func init() {
+	RegisterMatcher("recent", recentMatcher{})
+	RegisterMatcher("within", withinMatcher{})
+	RegisterMatcher("same_time", sameTimeMatcher{})
+}
+
+// recentMatcher matches the timestamps of the last hour
+type recentMatcher struct{}
+
+func (recentMatcher) Params() []function.Parameter {
+	return nil
+}
+
+func (recentMatcher) Match(args []cty.Value, got cty.Value) error {
+	t, err := parseTimestamp(got)
+	if err != nil {
+		return err
+	}
+	if age := now().Sub(t); age < -time.Minute || age > time.Hour {
+		return fmt.Errorf("%s is not in the last hour", t.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// withinMatcher matches the timestamps at most the given duration before or after now
+type withinMatcher struct{}
+
+func (withinMatcher) Params() []function.Parameter {
+	return []function.Parameter{{Name: "duration", Type: cty.String}}
+}
+
+func (withinMatcher) Match(args []cty.Value, got cty.Value) error {
+	d, err := parseDuration(args[0].AsString())
+	if err != nil {
+		return err
+	}
+	t, err := parseTimestamp(got)
+	if err != nil {
+		return err
+	}
+	if diff := now().Sub(t); diff < -d || diff > d {
+		return fmt.Errorf("%s is not within %s of now", t.Format(time.RFC3339), args[0].AsString())
+	}
+	return nil
+}
+
+// sameTimeMatcher matches the timestamps of the same instant as the given one, whatever their format and time zone
+type sameTimeMatcher struct{}
+
+func (sameTimeMatcher) Params() []function.Parameter {
+	return []function.Parameter{{Name: "timestamp", Type: cty.String}}
+}
+
+func (sameTimeMatcher) Match(args []cty.Value, got cty.Value) error {
+	expected, err := parseTimestamp(args[0])
+	if err != nil {
+		return err
+	}
+	t, err := parseTimestamp(got)
+	if err != nil {
+		return err
+	}
+	if !t.Equal(expected) {
+		return fmt.Errorf("%s is not the same time as %s", t.Format(time.RFC3339Nano), expected.Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// parseTimestamp reads the timestamp val holds : a string in one of the timestampLayouts, or a number of seconds since
+// the unix epoch. Timestamps without a time zone are in UTC
+func parseTimestamp(val cty.Value) (time.Time, error) {
+	if val.IsNull() {
+		return time.Time{}, fmt.Errorf("timestamp is null")
+	}
+	switch val.Type() {
+	case cty.Number:
+		seconds, _ := val.AsBigFloat().Float64()
+		sec, frac := int64(seconds), seconds-float64(int64(seconds))
+		return time.Unix(sec, int64(frac*float64(time.Second))).UTC(), nil
+	case cty.String:
+		s := strings.TrimSpace(val.AsString())
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			f, _, _ := big.ParseFloat(s, 10, 64, big.ToNearestEven)
+			return parseTimestamp(cty.NumberVal(f))
+		}
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("%q is not a timestamp", s)
+	}
+	return time.Time{}, fmt.Errorf("%s is not a timestamp", val.Type().FriendlyName())
+}
+
+// parseDuration reads a duration like time.ParseDuration does, eg 1h30m, with d for days, eg 7d
+func parseDuration(s string) (time.Duration, error) {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
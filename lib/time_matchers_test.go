@@ -0,0 +1,47 @@
+package terraspec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestTimeMatchers(t *testing.T) {
+	defer func(previous func() time.Time) { now = previous }(now)
+	now = func() time.Time { return time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC) }
+
+	tests := map[string]struct {
+		matcher  Matcher
+		args     []cty.Value
+		got      cty.Value
+		expected string
+	}{
+		"Recent":                     {matcher: recentMatcher{}, got: cty.StringVal("2024-01-02T11:30:00Z")},
+		"Recent in another zone":     {matcher: recentMatcher{}, got: cty.StringVal("2024-01-02T13:30:00+02:00")},
+		"Not recent":                 {matcher: recentMatcher{}, got: cty.StringVal("2024-01-01T12:00:00Z"), expected: "2024-01-01T12:00:00Z is not in the last hour"},
+		"In the future":              {matcher: recentMatcher{}, got: cty.StringVal("2024-01-02T13:00:00Z"), expected: "2024-01-02T13:00:00Z is not in the last hour"},
+		"Within":                     {matcher: withinMatcher{}, args: []cty.Value{cty.StringVal("24h")}, got: cty.StringVal("2024-01-01 18:00:00")},
+		"Within days":                {matcher: withinMatcher{}, args: []cty.Value{cty.StringVal("7d")}, got: cty.StringVal("2024-01-08T11:00:00Z")},
+		"Not within":                 {matcher: withinMatcher{}, args: []cty.Value{cty.StringVal("1h")}, got: cty.StringVal("2024-01-02T10:00:00Z"), expected: "2024-01-02T10:00:00Z is not within 1h of now"},
+		"Invalid duration":           {matcher: withinMatcher{}, args: []cty.Value{cty.StringVal("a day")}, got: cty.StringVal("2024-01-02T12:00:00Z"), expected: `invalid duration "a day"`},
+		"Same time":                  {matcher: sameTimeMatcher{}, args: []cty.Value{cty.StringVal("2024-01-01T00:00:00Z")}, got: cty.StringVal("2024-01-01T01:00:00.000+01:00")},
+		"Same time as epoch seconds": {matcher: sameTimeMatcher{}, args: []cty.Value{cty.StringVal("2024-01-01T00:00:00Z")}, got: cty.NumberIntVal(1704067200)},
+		"Same time in RFC1123":       {matcher: sameTimeMatcher{}, args: []cty.Value{cty.StringVal("2024-01-01T00:00:00Z")}, got: cty.StringVal("Mon, 01 Jan 2024 00:00:00 GMT")},
+		"Other time":                 {matcher: sameTimeMatcher{}, args: []cty.Value{cty.StringVal("2024-01-01T00:00:00Z")}, got: cty.StringVal("2024-01-01T00:00:01Z"), expected: "2024-01-01T00:00:01Z is not the same time as 2024-01-01T00:00:00Z"},
+		"Not a timestamp":            {matcher: recentMatcher{}, got: cty.StringVal("yesterday"), expected: `"yesterday" is not a timestamp`},
+		"Not a string":               {matcher: recentMatcher{}, got: cty.True, expected: "bool is not a timestamp"},
+		"Null":                       {matcher: recentMatcher{}, got: cty.NullVal(cty.String), expected: "timestamp is null"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tt.matcher.Match(tt.args, tt.got)
+			if tt.expected == "" && err != nil {
+				t.Errorf("Expected a match, got %v", err)
+			}
+			if tt.expected != "" && (err == nil || err.Error() != tt.expected) {
+				t.Errorf("Expected error %s, got %v", tt.expected, err)
+			}
+		})
+	}
+}
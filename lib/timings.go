@@ -0,0 +1,25 @@
+package terraspec
+
+import "time"
+
+// Timings is the time a test case spent in every phase of its run,
+// to tell whether a suite is slowed down by the provider plugins or by the assertions
+type Timings struct {
+	// ConfigLoad is the time spent loading the config and the variables of the test case
+	ConfigLoad time.Duration
+	// SchemaFetch is the time spent getting the schemas of the providers, which starts their plugins
+	SchemaFetch time.Duration
+	Refresh     time.Duration
+	Plan        time.Duration
+	// Validate is the time spent checking the assertions and the policies of the spec against the plan
+	Validate time.Duration
+}
+
+// add adds the other timings to t
+func (t *Timings) add(other *Timings) {
+	t.ConfigLoad += other.ConfigLoad
+	t.SchemaFetch += other.SchemaFetch
+	t.Refresh += other.Refresh
+	t.Plan += other.Plan
+	t.Validate += other.Validate
+}
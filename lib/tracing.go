@@ -0,0 +1,192 @@
+package terraspec
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TraceExporter sends the spans of a run to an OpenTelemetry collector, or any tracing backend accepting OTLP over HTTP
+// in the JSON encoding. The run is a span, with a span for every test case that ran and, below it, for every phase of
+// the test case. As only the duration of the phases is measured, their spans are laid out one after the other from
+// the start of the test case, in the order the phases run
+type TraceExporter struct {
+	// Endpoint is the URL the spans are posted to, eg http://localhost:4318/v1/traces
+	Endpoint string
+	// Headers are added to the requests, eg to authenticate to the backend
+	Headers map[string]string
+	// ServiceName is the service.name of the spans. Defaults to terraspec
+	ServiceName string
+}
+
+// TraceExporterFromEnv returns the exporter configured by the standard OpenTelemetry environment variables :
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT to which /v1/traces is added, OTEL_EXPORTER_OTLP_HEADERS
+// and OTEL_SERVICE_NAME. It returns nil when no endpoint is set
+func TraceExporterFromEnv() *TraceExporter {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil
+	}
+	exporter := &TraceExporter{Endpoint: endpoint, Headers: make(map[string]string), ServiceName: os.Getenv("OTEL_SERVICE_NAME")}
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if parts := strings.SplitN(header, "=", 2); len(parts) == 2 {
+			exporter.Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return exporter
+}
+
+// otlpSpan is a span in the JSON encoding of OTLP
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOk         = 1
+	otlpStatusError      = 2
+)
+
+// Export posts the spans of the run to the endpoint
+func (e *TraceExporter) Export(ctx context.Context, results *Results) error {
+	service := e.ServiceName
+	if service == "" {
+		service = "terraspec"
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": []otlpAttribute{stringAttribute("service.name", service)}},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "terraspec"},
+				"spans": runSpans(results, newSpanID(16)),
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		answer, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("the endpoint answered %s %s", resp.Status, answer)
+	}
+	return nil
+}
+
+// runSpans returns the spans of the run, its test cases and their phases in the trace traceID
+func runSpans(results *Results, traceID string) []otlpSpan {
+	run := newSpan(traceID, "", "terraspec run", results.Started, results.Duration)
+	passed, failed := results.Count()
+	run.Attributes = []otlpAttribute{intAttribute("terraspec.passed", passed), intAttribute("terraspec.failed", failed), intAttribute("terraspec.skipped", results.SkippedCount())}
+	if results.Failed() {
+		run.Status = otlpStatus{Code: otlpStatusError, Message: fmt.Sprintf("%d test cases failed", failed)}
+	}
+	spans := []otlpSpan{run}
+
+	for _, c := range results.Cases {
+		if c.Started.IsZero() {
+			continue
+		}
+		span := newSpan(traceID, run.SpanID, "test case "+c.Name, c.Started, c.Duration)
+		span.Attributes = []otlpAttribute{stringAttribute("terraspec.test_case", c.Name), stringAttribute("terraspec.dir", c.Dir), intAttribute("terraspec.assertions", len(c.Assertions))}
+		if c.Failed() {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: "test case failed"}
+		}
+		spans = append(spans, span)
+		if c.Timings == nil {
+			continue
+		}
+		start := c.Started
+		for _, phase := range []struct {
+			name     string
+			duration time.Duration
+		}{
+			{"config load", c.Timings.ConfigLoad},
+			{"schema fetch", c.Timings.SchemaFetch},
+			{"refresh", c.Timings.Refresh},
+			{"plan", c.Timings.Plan},
+			{"validate", c.Timings.Validate},
+		} {
+			if phase.duration > 0 {
+				spans = append(spans, newSpan(traceID, span.SpanID, phase.name, start, phase.duration))
+				start = start.Add(phase.duration)
+			}
+		}
+	}
+	return spans
+}
+
+func newSpan(traceID, parentID, name string, start time.Time, duration time.Duration) otlpSpan {
+	return otlpSpan{
+		TraceID:           traceID,
+		SpanID:            newSpanID(8),
+		ParentSpanID:      parentID,
+		Name:              name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(start.Add(duration).UnixNano(), 10),
+		Status:            otlpStatus{Code: otlpStatusOk},
+	}
+}
+
+// newSpanID returns a random identifier of size bytes, hex encoded
+func newSpanID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"stringValue": value}}
+}
+
+func intAttribute(key string, value int) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"intValue": strconv.Itoa(value)}}
+}
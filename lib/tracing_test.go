@@ -0,0 +1,96 @@
+package terraspec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+func TestTraceExporterFromEnv(t *testing.T) {
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_HEADERS", "OTEL_SERVICE_NAME"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+	if exporter := TraceExporterFromEnv(); exporter != nil {
+		t.Errorf("No exporter should be configured without endpoint, got %+v", exporter)
+	}
+
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318/")
+	os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-api-key=secret, x-team = infra")
+	exporter := TraceExporterFromEnv()
+	if exporter == nil || exporter.Endpoint != "http://collector:4318/v1/traces" || exporter.Headers["x-api-key"] != "secret" || exporter.Headers["x-team"] != "infra" {
+		t.Errorf("The exporter should post to the traces path of the endpoint with the headers, got %+v", exporter)
+	}
+
+	os.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://traces:4318/custom")
+	if exporter := TraceExporterFromEnv(); exporter.Endpoint != "http://traces:4318/custom" {
+		t.Errorf("The traces endpoint should be used as is, got %s", exporter.Endpoint)
+	}
+}
+
+func TestTraceExporterExport(t *testing.T) {
+	var received struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan
+			}
+		}
+	}
+	var apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey = r.Header.Get("x-api-key")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	start := time.Unix(1700000000, 0)
+	results := &Results{Started: start, Duration: 5 * time.Second, Cases: []*CaseResult{
+		{Name: "web", Started: start.Add(time.Second), Duration: 3 * time.Second, Timings: &Timings{ConfigLoad: time.Second, Plan: 2 * time.Second}},
+		{Name: "broken", Started: start, Duration: time.Second, Diagnostics: tfdiags.Diagnostics{}.Append(errors.New("Could not compute the plan"))},
+		{Name: "parked", SkipReason: "waiting for a fix"},
+	}}
+	exporter := &TraceExporter{Endpoint: server.URL, Headers: map[string]string{"x-api-key": "secret"}}
+	if err := exporter.Export(context.Background(), results); err != nil {
+		t.Fatal(err)
+	}
+	if apiKey != "secret" {
+		t.Errorf("The headers should be sent, got %q", apiKey)
+	}
+
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	expected := []struct {
+		name, parent, start, end string
+		status                   int
+	}{
+		{"terraspec run", "", "1700000000000000000", "1700000005000000000", otlpStatusError},
+		{"test case web", "terraspec run", "1700000001000000000", "1700000004000000000", otlpStatusOk},
+		{"config load", "test case web", "1700000001000000000", "1700000002000000000", otlpStatusOk},
+		{"plan", "test case web", "1700000002000000000", "1700000004000000000", otlpStatusOk},
+		{"test case broken", "terraspec run", "1700000000000000000", "1700000001000000000", otlpStatusError},
+	}
+	if len(spans) != len(expected) {
+		t.Fatalf("Expected %d spans, got %+v", len(expected), spans)
+	}
+	names := make(map[string]string)
+	for _, span := range spans {
+		names[span.SpanID] = span.Name
+	}
+	for i, e := range expected {
+		span := spans[i]
+		if span.Name != e.name || names[span.ParentSpanID] != e.parent || span.StartTimeUnixNano != e.start || span.EndTimeUnixNano != e.end || span.Status.Code != e.status {
+			t.Errorf("Expected span %+v, got %+v", e, span)
+		}
+		if span.TraceID != spans[0].TraceID || len(span.TraceID) != 32 || len(span.SpanID) != 16 {
+			t.Errorf("All spans should be part of the same trace, got %+v", span)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package terraspec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// invalidVariableSummary is the summary of the diagnostics terraform returns when a variable validation rule fails
+const invalidVariableSummary = "Invalid value for variable"
+
+// FailedValidations extracts from diags the errors raised by the validation rules of the variables declared in cfg.
+// It returns the error messages of the failed rules by variable name, and the diagnostics left
+func FailedValidations(diags tfdiags.Diagnostics, cfg *configs.Config) (map[string][]string, tfdiags.Diagnostics) {
+	failures := make(map[string][]string)
+	var remaining tfdiags.Diagnostics
+	for _, diag := range diags {
+		if diag.Severity() != tfdiags.Error || diag.Description().Summary != invalidVariableSummary {
+			remaining = remaining.Append(diag)
+			continue
+		}
+		name, message := findValidationRule(cfg, diag.Description().Detail)
+		if name == "" {
+			remaining = remaining.Append(diag)
+			continue
+		}
+		failures[name] = append(failures[name], message)
+	}
+	return failures, remaining
+}
+
+// findValidationRule finds the variable and error message of the rule mentioned in the detail of an invalid variable diagnostic
+func findValidationRule(cfg *configs.Config, detail string) (string, string) {
+	var name, message string
+	if cfg == nil {
+		return name, message
+	}
+	cfg.DeepEach(func(c *configs.Config) {
+		for _, variable := range c.Module.Variables {
+			for _, rule := range variable.Validations {
+				if strings.Contains(detail, fmt.Sprintf("validation rule at %s.", rule.DeclRange)) {
+					name, message = variable.Name, rule.ErrorMessage
+				}
+			}
+		}
+	})
+	return name, message
+}
+
+// ValidateVariables checks the variable assertions of this Spec against the failed validation rules.
+// Failed validations of variables without assertion are reported as errors
+func (s *Spec) ValidateVariables(failures map[string][]string) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	asserted := make(map[string]bool)
+	for _, assert := range s.Asserts {
+		if assert.Type != "variable" {
+			continue
+		}
+		asserted[assert.Name] = true
+		first := len(diags)
+		path := cty.GetAttrPath("variable").GetAttr(assert.Name)
+		messages := failures[assert.Name]
+
+		expectValid := true
+		if valid := assert.Value.GetAttr("valid"); !valid.IsNull() {
+			expectValid = valid.True()
+		}
+		if isValid := len(messages) == 0; isValid != expectValid {
+			diags = diags.Append(AssertErrorDiags(path.GetAttr("valid"), expectValid, isValid).withMismatch(MismatchValue, cty.BoolVal(expectValid), cty.BoolVal(isValid)))
+		} else {
+			diags = diags.Append(SuccessDiags(path.GetAttr("valid"), isValid))
+		}
+
+		if expected := assert.Value.GetAttr("error_message"); !expected.IsNull() {
+			if contains(messages, expected.AsString()) {
+				diags = diags.Append(SuccessDiags(path.GetAttr("error_message"), expected.AsString()))
+			} else {
+				diags = diags.Append(AssertErrorDiags(path.GetAttr("error_message"), expected.AsString(), strings.Join(messages, ", ")).withMismatch(MismatchValue, expected, cty.StringVal(strings.Join(messages, ", "))))
+			}
+		}
+		explain(locate(diags[first:], assert.DeclRange), assert.Message)
+	}
+
+	names := make([]string, 0, len(failures))
+	for name := range failures {
+		if !asserted[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		diags = diags.Append(ErrorDiags(cty.GetAttrPath("variable").GetAttr(name), strings.Join(failures[name], ", ")))
+	}
+	return diags
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package terraspec
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func invalidVariableDiag(rule *configs.VariableValidation) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  invalidVariableSummary,
+		Detail:   fmt.Sprintf("%s\n\nThis was checked by the validation rule at %s.", rule.ErrorMessage, rule.DeclRange.String()),
+	}
+}
+
+func TestFailedValidations(t *testing.T) {
+	module, hclDiags := configs.NewParser(nil).LoadConfigDir("testdata/validations")
+	if hclDiags.HasErrors() {
+		t.Fatal(hclDiags.Error())
+	}
+	cfg := &configs.Config{Module: module}
+
+	var diags tfdiags.Diagnostics
+	diags = diags.Append(invalidVariableDiag(module.Variables["size"].Validations[0]))
+	diags = diags.Append(fmt.Errorf("another error"))
+
+	failures, remaining := FailedValidations(diags, cfg)
+	if len(remaining) != 1 || remaining[0].Description().Summary != "another error" {
+		t.Errorf("only unrelated errors should remain, got %v", remaining)
+	}
+	if got := failures["size"]; len(got) != 1 || got[0] != "Size must be positive." {
+		t.Errorf("size validation should have failed, got %v", failures)
+	}
+	if _, ok := failures["name"]; ok {
+		t.Errorf("name validation should not have failed")
+	}
+}
+
+func TestValidateVariables(t *testing.T) {
+	variableAssert := func(name string, valid cty.Value, message cty.Value) *Assert {
+		return NewAssert("variable", name, cty.ObjectVal(map[string]cty.Value{"valid": valid, "error_message": message}))
+	}
+	spec := &Spec{Asserts: []*Assert{
+		variableAssert("size", cty.False, cty.StringVal("Size must be positive.")),
+		variableAssert("name", cty.NullVal(cty.Bool), cty.NullVal(cty.String)),
+	}}
+
+	diags := spec.ValidateVariables(map[string][]string{"size": {"Size must be positive."}})
+	if diags.HasErrors() {
+		t.Errorf("variable assertions should succeed, got %v", diags.Err())
+	}
+
+	diags = spec.ValidateVariables(map[string][]string{"name": {"Name is too short."}, "other": {"Other is wrong."}})
+	if nb := len(diags); nb != 4 {
+		t.Fatalf("expected 4 diagnostics, got %d", nb)
+	}
+	testDiagnostic(t, diags[0], AssertErrorDiags(cty.GetAttrPath("variable").GetAttr("size").GetAttr("valid"), false, true))
+	testDiagnostic(t, diags[1], AssertErrorDiags(cty.GetAttrPath("variable").GetAttr("size").GetAttr("error_message"), "Size must be positive.", ""))
+	testDiagnostic(t, diags[2], AssertErrorDiags(cty.GetAttrPath("variable").GetAttr("name").GetAttr("valid"), true, false))
+	testDiagnostic(t, diags[3], ErrorDiags(cty.GetAttrPath("variable").GetAttr("other"), "Other is wrong."))
+}
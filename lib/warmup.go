@@ -0,0 +1,44 @@
+package terraspec
+
+import (
+	"sync"
+	"time"
+)
+
+// warmUp starts the plugins of the providers required by the config found in dir and loads their schemas,
+// so the test cases find them ready rather than the first ones waiting for them.
+// Plugins are started in the pool of tsCtx, and schemas kept in its SchemaCache, created in memory if needed.
+// Errors are left for the test cases to report. It returns the time spent
+func warmUp(dir string, tsCtx *Context) time.Duration {
+	start := time.Now()
+	if tsCtx.SchemaCache == nil {
+		tsCtx.SchemaCache = NewSchemaCache("")
+	}
+	absDir := absPath(dir)
+	cfg, diags := tsCtx.configs.load(absDir)
+	if diags.HasErrors() {
+		return time.Since(start)
+	}
+	resolver, err := BuildProviderResolver(absDir, tsCtx.PluginDirs...)
+	if err != nil {
+		return time.Since(start)
+	}
+	registered := registeredProviderFactories()
+
+	var wg sync.WaitGroup
+	for _, addr := range cfg.ProviderTypes() {
+		meta, ok := resolver.KnownPlugins[addr]
+		if _, isRegistered := registered[addr]; !ok || isRegistered {
+			continue
+		}
+		wg.Add(1)
+		go func(p *ProviderInterface) {
+			defer wg.Done()
+			if _, err := p.plugin(); err == nil {
+				p.GetSchema()
+			}
+		}(&ProviderInterface{provider: addr, pluginMeta: meta, logOutput: tsCtx.LogOutput, schemaCache: tsCtx.SchemaCache, pool: &tsCtx.plugins})
+	}
+	wg.Wait()
+	return time.Since(start)
+}
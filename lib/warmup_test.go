@@ -0,0 +1,42 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWarmUp(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-warm-up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"config/main.tf": `resource "acme_record" "a" {}`,
+	})
+	// the plugin exits at once, so it fails to start
+	plugin := filepath.Join(root, "plugins", "terraform-provider-acme_v1.0.0")
+	writeFiles(t, root, map[string]string{"plugins/terraform-provider-acme_v1.0.0": "#!/bin/sh\nexit 1\n"})
+	if err := os.Chmod(plugin, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tsCtx := &Context{PluginDirs: []string{filepath.Join(root, "plugins")}, LogOutput: ioutil.Discard}
+	defer tsCtx.plugins.close()
+	warmUp(filepath.Join(root, "config"), tsCtx)
+	if tsCtx.SchemaCache == nil || tsCtx.SchemaCache.Dir != "" {
+		t.Errorf("Warm-up should keep the schemas in memory, got %+v", tsCtx.SchemaCache)
+	}
+	if _, ok := tsCtx.plugins.plugins[plugin]; !ok {
+		t.Errorf("Warm-up should start the plugins required by the config, got %v", tsCtx.plugins.plugins)
+	}
+	if _, diags := tsCtx.configs.load(filepath.Join(root, "config")); diags.HasErrors() {
+		t.Errorf("Warm-up should load the config, got %v", diags.Err())
+	}
+
+	// an invalid config is left for the test cases to report
+	writeFiles(t, root, map[string]string{"invalid/main.tf": `resource {`})
+	warmUp(filepath.Join(root, "invalid"), &Context{})
+}
@@ -0,0 +1,139 @@
+package terraspec
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Workdir is a temporary copy of a config folder where a test case runs apart from the other test cases.
+// Folders are created again while files are symbolic links to the files of the config, so the copy is cheap
+// and the files written by a test case, eg by its hooks, stay in its own copy.
+// The folders of the .terraform folder, holding the installed modules and plugins, are linked as well
+// rather than installed again, while its files are copied
+type Workdir struct {
+	// Dir is the copy of the config folder
+	Dir string
+	// source is the absolute path of the config folder
+	source string
+}
+
+// NewWorkdir copies the config found in dir in a new temporary folder.
+// Hidden folders other than .terraform, eg .git, are left out
+func NewWorkdir(dir string) (*Workdir, error) {
+	tmp, err := ioutil.TempDir("", "terraspec-workdir")
+	if err != nil {
+		return nil, err
+	}
+	w, err := newWorkdirIn(dir, tmp)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	return w, nil
+}
+
+// newWorkdirIn copies the config found in dir in the existing empty folder tmp
+func newWorkdirIn(dir, tmp string) (*Workdir, error) {
+	source, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	w := &Workdir{Dir: tmp, source: source}
+
+	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		target := filepath.Join(tmp, rel)
+		switch {
+		case info.IsDir() && rel == ".terraform":
+			return filepath.SkipDir
+		case info.IsDir() && strings.HasPrefix(info.Name(), "."):
+			return filepath.SkipDir
+		case info.IsDir():
+			return os.Mkdir(target, 0755)
+		default:
+			return os.Symlink(path, target)
+		}
+	})
+	if err == nil {
+		err = w.overlayTerraformDir()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// overlayTerraformDir links the folders of the .terraform folder of the config and copies its files, eg the selected workspace
+func (w *Workdir) overlayTerraformDir() error {
+	entries, err := ioutil.ReadDir(filepath.Join(w.source, ".terraform"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(filepath.Join(w.Dir, ".terraform"), 0755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(w.source, ".terraform", entry.Name())
+		target := filepath.Join(w.Dir, ".terraform", entry.Name())
+		if entry.IsDir() {
+			err = os.Symlink(path, target)
+		} else {
+			err = copyFile(path, target, entry.Mode().Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Path returns the path of file in the copy, or file itself when it's not in the config folder
+func (w *Workdir) Path(file string) string {
+	if file == "" {
+		return file
+	}
+	rel, err := filepath.Rel(w.source, absPath(file))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return file
+	}
+	return filepath.Join(w.Dir, rel)
+}
+
+// TestCase returns tc with the paths of its folder and files in the copy
+func (w *Workdir) TestCase(tc *TestCase) *TestCase {
+	return &TestCase{Dir: w.Path(tc.Dir), VariableFile: w.Path(tc.VariableFile), SpecFile: w.Path(tc.SpecFile), Label: tc.Label}
+}
+
+// Close removes the copy. The files of the config are left untouched
+func (w *Workdir) Close() error {
+	return os.RemoveAll(w.Dir)
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
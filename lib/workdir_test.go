@@ -0,0 +1,118 @@
+package terraspec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewWorkdir(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-workdir-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"main.tf":                             `output "a" { value = 1 }`,
+		"spec/case/case.tfspec":               ``,
+		".terraform/environment":              "default",
+		".terraform/modules/modules.json":     `{"Modules":[]}`,
+		".git/HEAD":                           "ref: refs/heads/main",
+		"modules/network/main.tf":             ``,
+		"modules/network/templates/user.tmpl": ``,
+	})
+
+	w, err := NewWorkdir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]os.FileMode{
+		"main.tf":                             os.ModeSymlink,
+		"spec":                                os.ModeDir,
+		"spec/case/case.tfspec":               os.ModeSymlink,
+		"modules/network/templates/user.tmpl": os.ModeSymlink,
+		".terraform":                          os.ModeDir,
+		".terraform/environment":              0,
+		".terraform/modules":                  os.ModeSymlink,
+	} {
+		info, err := os.Lstat(filepath.Join(w.Dir, name))
+		if err != nil {
+			t.Errorf("%s should be in the workdir : %v", name, err)
+			continue
+		}
+		if mode := info.Mode() & (os.ModeDir | os.ModeSymlink); mode != expected {
+			t.Errorf("%s should have mode %v, got %v", name, expected, mode)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(w.Dir, ".git")); !os.IsNotExist(err) {
+		t.Errorf("Hidden folders should be left out of the workdir, got %v", err)
+	}
+
+	tc := w.TestCase(&TestCase{Dir: filepath.Join(root, "spec/case"), SpecFile: filepath.Join(root, "spec/case/case.tfspec"), VariableFile: "/elsewhere/case.tfvars"})
+	if tc.Dir != filepath.Join(w.Dir, "spec/case") || tc.SpecFile != filepath.Join(w.Dir, "spec/case/case.tfspec") {
+		t.Errorf("Test case should be moved to the workdir, got %+v", tc)
+	}
+	if tc.VariableFile != "/elsewhere/case.tfvars" {
+		t.Errorf("Files outside of the config should keep their path, got %s", tc.VariableFile)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(w.Dir); !os.IsNotExist(err) {
+		t.Errorf("Workdir should be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".terraform/modules/modules.json")); err != nil {
+		t.Errorf("Closing the workdir should leave the config untouched, got %v", err)
+	}
+}
+
+func TestRunSuiteIsolated(t *testing.T) {
+	root, err := ioutil.TempDir("", "terraspec-isolate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		"main.tf":  `output "size" { value = "size-${file("${path.module}/size.txt")}" }`,
+		"size.txt": "0",
+	}
+	for _, size := range []string{"1", "2", "3", "4"} {
+		files["spec/case"+size+"/case.tfspec"] = "before {\n  file \"../../size.txt\" {\n    content = \"" + size + "\"\n  }\n}\nreject \"output\" \"missing\" {}"
+	}
+	writeFiles(t, root, files)
+
+	results, err := RunSuite(context.Background(), Options{Dir: root, Isolate: true, Parallelism: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Cases) != 4 {
+		t.Fatalf("Expected 4 test cases, got %d", len(results.Cases))
+	}
+	for _, r := range results.Cases {
+		if r.Failed() {
+			t.Errorf("Test case %s should pass, got %v", r.Name, r.Diagnostics.Err())
+		}
+		if expected := `"size-` + strings.TrimPrefix(r.Name, "case") + `"`; !strings.Contains(string(r.PlanJSON), expected) {
+			t.Errorf("Test case %s should only see the file written by its own hook, got %s", r.Name, r.PlanJSON)
+		}
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(root, "size.txt")); err != nil || string(content) != "0" {
+		t.Errorf("Hooks should not change the files of the config, got %q, %v", content, err)
+	}
+}
@@ -0,0 +1,109 @@
+package terraspec
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// DefaultMemoryPerCase is the memory, in bytes, a test case is expected to use when the number of test cases run at the same time
+// is computed from the available memory
+const DefaultMemoryPerCase = 512 << 20
+
+// parallelism returns the number of test cases run at the same time : Parallelism when set,
+// otherwise the number of CPUs lowered so that the test cases fit in the available memory
+func (o *Options) parallelism() int {
+	if o.Parallelism > 0 {
+		return o.Parallelism
+	}
+	return autoParallelism(runtime.NumCPU(), availableMemory(), uint64(o.MemoryPerCase))
+}
+
+// autoParallelism returns the number of test cases using memoryPerCase bytes that can run on cpus CPUs with available bytes of memory.
+// The memory is ignored when it's unknown, ie 0
+func autoParallelism(cpus int, available, memoryPerCase uint64) int {
+	workers := cpus
+	if available > 0 && memoryPerCase > 0 {
+		if byMemory := int(available / memoryPerCase); byMemory < workers {
+			workers = byMemory
+		}
+	}
+	if workers < 1 {
+		return 1
+	}
+	return workers
+}
+
+// assertWorkers returns the number of goroutines checking the asserts of a spec, so that the parallelism test cases
+// run at the same time don't check their asserts from more goroutines than there are cpus
+func assertWorkers(cpus, parallelism int) int {
+	if parallelism < 1 || cpus <= parallelism {
+		return 1
+	}
+	return cpus / parallelism
+}
+
+// availableMemory returns the memory in bytes the process can still use, within the limit of its cgroup when it has one, eg in a container.
+// It returns 0 when it can't be found, eg on other systems than linux
+func availableMemory() uint64 {
+	available := meminfoAvailable("/proc/meminfo")
+	// cgroup v2, then v1
+	for _, files := range [][2]string{
+		{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory.current"},
+		{"/sys/fs/cgroup/memory/memory.limit_in_bytes", "/sys/fs/cgroup/memory/memory.usage_in_bytes"},
+	} {
+		limit, usage := readBytes(files[0]), readBytes(files[1])
+		if limit == 0 {
+			continue
+		}
+		if free := limit - usage; usage < limit && (available == 0 || free < available) {
+			available = free
+		}
+		break
+	}
+	return available
+}
+
+// meminfoAvailable reads the MemAvailable line of /proc/meminfo, given in kB
+func meminfoAvailable(file string) uint64 {
+	return readKBField(file, "MemAvailable:")
+}
+
+// readKBField reads the line of a /proc file starting with field, eg MemAvailable: in /proc/meminfo, holding a size in kB.
+// It returns the size in bytes, or 0 when the file or the field is missing
+func readKBField(file, field string) uint64 {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == field {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// readBytes reads a number of bytes written in a cgroup file. It returns 0 when the file is missing or holds no limit
+func readBytes(file string) uint64 {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		// memory.max holds "max" when there's no limit
+		return 0
+	}
+	return n
+}
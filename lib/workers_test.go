@@ -0,0 +1,76 @@
+package terraspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAutoParallelism(t *testing.T) {
+	for name, tc := range map[string]struct {
+		cpus      int
+		available uint64
+		expected  int
+	}{
+		"cpu bound":      {cpus: 8, available: 16 << 30, expected: 8},
+		"memory bound":   {cpus: 8, available: 3 << 30, expected: 3},
+		"unknown memory": {cpus: 4, available: 0, expected: 4},
+		"short memory":   {cpus: 4, available: 100 << 20, expected: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := autoParallelism(tc.cpus, tc.available, 1<<30); got != tc.expected {
+				t.Errorf("Expected %d workers, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestAssertWorkers(t *testing.T) {
+	for name, tc := range map[string]struct {
+		cpus        int
+		parallelism int
+		expected    int
+	}{
+		"single test case": {cpus: 8, parallelism: 1, expected: 8},
+		"shared cpus":      {cpus: 8, parallelism: 3, expected: 2},
+		"all cpus used":    {cpus: 4, parallelism: 4, expected: 1},
+		"more test cases":  {cpus: 4, parallelism: 10, expected: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := assertWorkers(tc.cpus, tc.parallelism); got != tc.expected {
+				t.Errorf("Expected %d workers, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestParallelismOption(t *testing.T) {
+	opts := &Options{Parallelism: 3}
+	if got := opts.parallelism(); got != 3 {
+		t.Errorf("Expected the given parallelism 3, got %d", got)
+	}
+	opts = &Options{MemoryPerCase: DefaultMemoryPerCase}
+	if got := opts.parallelism(); got < 1 {
+		t.Errorf("Expected at least 1 worker, got %d", got)
+	}
+}
+
+func TestMeminfoAvailable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraspec-workers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "meminfo")
+	content := "MemTotal:       16384000 kB\nMemFree:         1024000 kB\nMemAvailable:    2048000 kB\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := meminfoAvailable(file); got != 2048000*1024 {
+		t.Errorf("Expected %d bytes available, got %d", 2048000*1024, got)
+	}
+	if got := meminfoAvailable(filepath.Join(dir, "missing")); got != 0 {
+		t.Errorf("Expected 0 bytes when meminfo is missing, got %d", got)
+	}
+}
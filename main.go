@@ -1,26 +1,31 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strconv"
 	"strings"
-	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
+	goplugin "github.com/hashicorp/go-plugin"
 	goversion "github.com/hashicorp/go-version"
-	"github.com/hashicorp/terraform/backend/local"
-	"github.com/hashicorp/terraform/helper/logging"
-	"github.com/hashicorp/terraform/terraform"
 	"github.com/hashicorp/terraform/tfdiags"
 	tfversion "github.com/hashicorp/terraform/version"
-	"github.com/mitchellh/cli"
 	"github.com/mitchellh/colorstring"
 	terraspec "github.com/nhurel/terraspec/lib"
-	"github.com/zclconf/go-cty/cty"
+	"github.com/nhurel/terraspec/lib/format"
+	"github.com/nhurel/terraspec/lib/lsp"
+	"github.com/nhurel/terraspec/lib/server"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -29,9 +34,79 @@ var (
 	Version string
 	app     = kingpin.New("terraspec", "Unit test terraform config")
 	// dir = app.Flag("dir", "path to terraform config dir to test").Default(".").String()
-	specDir     = app.Flag("spec", "path to folder containing test cases").Default("spec").String()
-	displayPlan = app.Flag("display-plan", "Print the full plan before the results").Default("false").Bool()
-	tfVersion   = app.Flag("claim-version", "Simulate terraform version : This flag is a workaround to help upgrading terraspec and terraform independently. This flag won't change terraspec behavior but will make it pass version check").String()
+	specDir      = app.Flag("spec", "path to folder containing test cases").Default("spec").String()
+	specSource   = app.Flag("spec-source", "Address of a spec folder to fetch and run in place of --spec, like the source of a module, eg git::https://example.com/specs.git//aws?ref=v1.2").String()
+	displayPlan  = app.Flag("display-plan", "Print the full plan before the results, of every test case or only of the failing ones with --display-plan=on-failure").Default("false").Enum("false", "true", "on-failure")
+	tfVersion    = app.Flag("claim-version", "Simulate terraform version : This flag is a workaround to help upgrading terraspec and terraform independently. This flag won't change terraspec behavior but will make it pass version check").String()
+	moduleMode   = app.Flag("module", "Test the current directory as a module : specs run against a generated root config calling the module").Default("false").Bool()
+	autoInit     = app.Flag("auto-init", "Run terraform init when modules or providers required by the config are not installed").Default("false").Bool()
+	tfBin        = app.Flag("terraform-bin", "Path to the terraform binary used to run terraform init").Default("terraform").String()
+	pluginDirs   = app.Flag("plugin-dir", "Additional directory where provider plugins are searched. Can be repeated").Strings()
+	timeout      = app.Flag("timeout", "Abort the test cases still running after the given duration, eg 5m").Duration()
+	functionsDir = app.Flag("functions-dir", "Directory of go plugins (.so files) exporting additional functions for spec files. Needs a terraspec built from source with cgo on linux or darwin").ExistingDir()
+	historyFile  = app.Flag("history", "Record the outcome and duration of every test case in the given history file, see the history command").String()
+	manifest     = app.Flag("manifest", "HCL file listing the test cases to run, in place of the subfolders of the spec folder").ExistingFile()
+	schemaCache  = app.Flag("schema-cache", "Folder where the schemas of the provider plugins are cached between runs, by provider version").String()
+	parallelism  = app.Flag("parallelism", "Maximum number of test cases run at the same time. Defaults to the number of CPUs, lowered to fit in the available memory").Int()
+	memPerCase   = app.Flag("memory-per-case", "Memory a test case is expected to use when the default parallelism is computed, eg 1GB").Default("512MB").Bytes()
+	changedSince = app.Flag("changed-since", "Only run the test cases affected by the files changed since the given git ref, eg origin/main").String()
+	changedOnly  = app.Flag("changed-only", "Only run the test cases affected by the changes staged in git and only print the failing ones, eg from a pre-commit hook").Bool()
+	resultCache  = app.Flag("cache", "Folder where the results of the passing test cases are cached, so they're not run again while their inputs don't change").String()
+	timings      = app.Flag("timings", "Print the time every test case spent loading the config, fetching provider schemas, refreshing, planning and validating").Bool()
+	coverage     = app.Flag("coverage", "Print the planned resources no assert or reject block checks, for every test case and for the whole suite").Bool()
+	minCoverage  = app.Flag("min-coverage", "Fail the run when the test cases assert less than the given percentage of the planned resources or of their attributes, overall or in any module, eg 80").Float64()
+	memStats     = app.Flag("mem-stats", "Print the peak memory of the process and the Go heap when every test case completed, and the provider plugins it didn't close").Bool()
+	moduleCache  = app.Flag("module-cache", "Folder where the modules installed by --auto-init are cached, so they're restored rather than downloaded again").String()
+	keepArtifact = app.Flag("keep-artifacts", "Keep the temporary folders created for the test cases, eg by --module or --isolate, to debug them : never, on-failure or always").Default("never").Enum("never", "on-failure", "always")
+	artifactsDir = app.Flag("artifacts-dir", "Folder where the temporary folders of the test cases are created. Defaults to the temporary folder of the system").String()
+	warmUp       = app.Flag("warm-up", "Start the provider plugins and load their schemas before the test cases run, so the first test cases are not slower than the others").Bool()
+	isolate      = app.Flag("isolate", "Run every test case in its own temporary copy of the config, linking its files and installed modules, so the files written by a test case are not seen by the others").Bool()
+	showSecrets  = app.Flag("show-sensitive", "Print the values of the attributes and outputs marked sensitive in the assertion results, rather than redacting them").Bool()
+	strict       = app.Flag("strict", "Fail the test cases with warnings, from the terraform plan like deprecations or from terraspec like duplicate assertions").Bool()
+	skipCases    = app.Flag("skip", "Name of a test case not to run, reported as skipped. Can be repeated").Strings()
+	projectFile  = app.Flag("project-config", "Project config file, whose notify blocks post the summary of the run to webhooks").Default(terraspec.DefaultProjectFile).String()
+	metricsFile  = app.Flag("metrics-file", "Write metrics of the run in the Prometheus text format to the given file, eg in the folder of the textfile collector of the node exporter").String()
+	pushGateway  = app.Flag("pushgateway", "URL of a Prometheus Pushgateway the metrics of the run are pushed to, under the terraspec job").String()
+	badgeFile    = app.Flag("badge-file", "Write the outcome of the run to the given file as the JSON of a shields.io endpoint badge").String()
+	ciMode       = app.Flag("ci", "Write the reports read by the given CI system : gitlab writes a JUnit report and a Code Quality report").Enum("gitlab")
+	ciDir        = app.Flag("ci-dir", "Folder where the reports of --ci are written").Default(".").String()
+	terragrunt   = app.Flag("terragrunt", "Run the specs of every terragrunt stack found under the current directory, against the terraform config and inputs rendered by terragrunt").Bool()
+	tgBin        = app.Flag("terragrunt-bin", "Path to the terragrunt binary used to render the stacks with --terragrunt").Default("terragrunt").String()
+	atlantis     = app.Flag("atlantis", "Print a compact summary of the run without color, for the comment Atlantis posts when terraspec runs in a custom workflow").Bool()
+	tflintBin    = app.Flag("tflint-bin", "Path to the tflint binary run by the lint blocks of the specs").Default(terraspec.DefaultTflintBin).String()
+	checkovBin   = app.Flag("checkov-bin", "Path to the checkov binary run by the scan blocks of the specs").Default(terraspec.DefaultCheckovBin).String()
+	inDocker     = app.Flag("in-docker", "Image of the container every test case runs in, with the terraspec binary and the provider plugins it holds. The config folder is mounted in the container").PlaceHolder("IMAGE").String()
+	dockerBin    = app.Flag("docker-bin", "Path to the docker binary running the containers of --in-docker").Default(terraspec.DefaultDockerBin).String()
+	planFile     = app.Flag("plan-file", "Name of a plan file in the folder of every test case, saved by terraform plan -out or as JSON by terraform show -json. Assertions are checked against it rather than planning the config").String()
+	tfVersions   = app.Flag("tf-versions", "Comma separated list of terraform versions the config must support. The test suite runs with the terraform binary of each of them its version constraints accept, downloaded when missing, and the results are reported as a matrix").String()
+
+	runCmd      = app.Command("run", "Run the test cases of the spec folder").Default()
+	generateCmd = app.Command("generate", "Generate a spec asserting the resources and outputs of an existing plan or state")
+	fromPlan    = generateCmd.Flag("from-plan", "Path to the plan in JSON format, as printed by terraform show -json").ExistingFile()
+	fromState   = generateCmd.Flag("from-state", "Path to a state file, whose resources are asserted with their current attributes").ExistingFile()
+	genResource = generateCmd.Flag("resource", "Address of a resource or module of the state to assert, eg module.db. Can be repeated. Defaults to every resource").Strings()
+	serveCmd    = app.Command("serve", "Answer JSON-RPC requests to list, validate and run test cases on stdin and stdout")
+	lspCmd      = app.Command("lsp", "Run a language server for .tfspec files on stdin and stdout")
+	schemaCmd   = app.Command("schema", "Print as JSON the attributes that can be asserted on every resource type of the config")
+	historyCmd  = app.Command("history", "Show flaky test cases and duration trends recorded in a history file")
+	historyArg  = historyCmd.Arg("file", "History file written by runs with the --history flag").Required().ExistingFile()
+	migrateCmd  = app.Command("migrate", "Rewrite the spec files of the spec folder written in an older version of the spec language")
+	lintCmd     = app.Command("lint", "Report the anti-patterns of the spec files of the spec folder, like empty assert blocks or shadowed mocks")
+	lintFix     = lintCmd.Flag("fix", "Rewrite the spec files to fix the empty assert blocks and the deprecated syntax").Bool()
+	diffCmd     = app.Command("diff-plans", "Compare the resources planned by two plans in JSON format, as printed by terraform show -json")
+	diffPlanA   = diffCmd.Arg("a", "Path to the first plan").Required().ExistingFile()
+	diffPlanB   = diffCmd.Arg("b", "Path to the second plan").Required().ExistingFile()
+	checkCmd    = app.Command("check-plan", "Check spec files against a plan in JSON format, as printed by terraform show -json, without the config nor the provider plugins")
+	checkPlan   = checkCmd.Flag("plan", "Path to the plan in JSON format").Required().ExistingFile()
+	checkSpecs  = checkCmd.Arg("specs", "Spec files to check against the plan").Required().ExistingFiles()
+	testModCmd  = app.Command("test-module", "Download a module from a registry and run the specs of the spec folder against it, through a generated harness")
+	testModSrc  = testModCmd.Arg("source", "Registry source of the module, eg hashicorp/consul/aws or app.terraform.io/acme/network/aws//modules/vpc").Required().String()
+	testModVer  = testModCmd.Flag("module-version", "Version constraint of the module, eg ~> 3.2. Defaults to the latest version. --version is accepted as well after test-module").String()
+	benchCmd    = app.Command("bench", "Run the test suite several times and report the durations of every test case and phase")
+	benchRuns   = benchCmd.Flag("runs", "Number of runs of the test suite").Default("5").Int()
+	benchBase   = benchCmd.Flag("baseline", "Baseline file saved by a previous benchmark to compare with").ExistingFile()
+	benchSave   = benchCmd.Flag("save", "Save the durations in the given baseline file").String()
+	benchThresh = benchCmd.Flag("threshold", "Slowdown of a phase compared to the baseline reported as a regression, eg 0.2 for 20%").Default("0.2").Float64()
 )
 
 func init() {
@@ -42,286 +117,847 @@ Terraform Version : %s`
 
 func main() {
 
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	command := kingpin.MustParse(app.Parse(moduleVersionArgs(displayPlanArgs(os.Args[1:]))))
+	if *functionsDir != "" {
+		if err := terraspec.LoadFunctionPlugins(*functionsDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	switch command {
+	case generateCmd.FullCommand():
+		execGenerate(*fromPlan, *fromState, *genResource, *pluginDirs)
+		return
+	case serveCmd.FullCommand():
+		execServe()
+		return
+	case lspCmd.FullCommand():
+		execLsp(*pluginDirs)
+		return
+	case schemaCmd.FullCommand():
+		execSchema(*pluginDirs)
+		return
+	case historyCmd.FullCommand():
+		execHistory(*historyArg)
+		return
+	case migrateCmd.FullCommand():
+		execMigrate(*specDir)
+		return
+	case lintCmd.FullCommand():
+		execLint(*specDir, *lintFix, *pluginDirs)
+		return
+	case diffCmd.FullCommand():
+		execDiffPlans(*diffPlanA, *diffPlanB)
+		return
+	case checkCmd.FullCommand():
+		execCheckPlan(*checkPlan, *checkSpecs)
+		return
+	}
+
+	// the plugins of the host are not used by the containers
+	if *autoInit && !*terragrunt && *inDocker == "" && command != testModCmd.FullCommand() {
+		initIfNeeded(".", *tfBin, *pluginDirs)
+	}
+
+	ctx, cancel := runContext(*timeout)
+	defer cancel()
+
+	var exitCode int
+	if command == benchCmd.FullCommand() {
+		exitCode = execBench(ctx, *benchRuns, *benchBase, *benchSave, *benchThresh)
+	} else if command == testModCmd.FullCommand() {
+		exitCode = execTestModule(ctx, *testModSrc, *testModVer, *specDir, *displayPlan, *tfVersion, *pluginDirs)
+	} else if *terragrunt {
+		exitCode = execTerragrunt(ctx, *specDir, *displayPlan, *tfVersion, *moduleMode, *pluginDirs)
+	} else if *tfVersions != "" {
+		exitCode = execVersionMatrix(ctx, strings.Split(*tfVersions, ","), *specDir, *displayPlan, *moduleMode, *pluginDirs)
+	} else if results := execTerraspec(ctx, *specDir, *displayPlan, *tfVersion, *moduleMode, *pluginDirs); results.Failed() {
+		exitCode = 1
+	}
 
-	exitCode := execTerraspec(*specDir, *displayPlan, *tfVersion)
-	
+	// make sure no provider plugin process survives an interrupted run
+	goplugin.CleanupClients()
+	cancel()
 	os.Exit(exitCode)
 }
 
-type testCase struct {
-	dir          string
-	variableFile string
-	specFile     string
+// colors renders the color codes of the messages printed by the command line. Atlantis posts the output in the comments
+// of pull requests, which don't render colors, so they're left out in atlantis mode
+func colors() *colorstring.Colorize {
+	return &colorstring.Colorize{Colors: colorstring.DefaultColors, Disable: *atlantis, Reset: true}
 }
 
-func (tc *testCase) name() string {
-	return filepath.Base(tc.dir)
+// cliFormat returns the options of the reports printed by the command line, without colors in atlantis mode
+func cliFormat() format.Options {
+	opts := format.CLI
+	opts.Color = !*atlantis
+	return opts
 }
 
-type testReport struct {
-	name   string
-	plan   string
-	report tfdiags.Diagnostics
+// runContext returns a context cancelled on SIGINT or SIGTERM, or once timeout expired if it's not 0
+func runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			fmt.Fprint(os.Stderr, colors().Color("[bold][yellow]Interrupted, stopping test cases\n"))
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
 
-func execTerraspec(specDir string, displayPlan bool, tfVersion string) int {
-	var newSemVer *goversion.Version
-	var err error
-	if tfVersion != "" {
-		newSemVer, err = goversion.NewSemver(tfVersion)
+// initIfNeeded runs terraform init in dir when the modules or providers installed don't match the config,
+// restoring the cached modules first when --module-cache is set
+func initIfNeeded(dir, terraformBin string, pluginDirs []string) {
+	reason, err := terraspec.InitNeeded(dir, pluginDirs...)
+	if err != nil {
+		log.Fatalf("Could not check if terraform init is needed : %v", err)
+	}
+	if reason == "" {
+		return
+	}
+	var cache *terraspec.ModuleCache
+	if *moduleCache != "" {
+		cache = terraspec.NewModuleCache(*moduleCache)
+		restored, err := cache.Restore(dir)
 		if err != nil {
-			log.Fatalf("Invalid value for claim-version flag : %v", err)
+			fmt.Printf(colors().Color("[bold][yellow]Could not restore cached modules : %v\n"), err)
+		} else if restored {
+			if reason, err = terraspec.InitNeeded(dir, pluginDirs...); err != nil {
+				log.Fatalf("Could not check if terraform init is needed : %v", err)
+			}
+			if reason == "" {
+				fmt.Println(colors().Color("[bold][green]Modules restored from cache"))
+				return
+			}
 		}
 	}
+	fmt.Printf(colors().Color("[bold][yellow]Running terraform init : %s\n"), reason)
+	if _, err := terraspec.RunInit(dir, terraformBin); err != nil {
+		log.Fatal(err)
+	}
+	if cache != nil {
+		if err := cache.Save(dir); err != nil {
+			fmt.Printf(colors().Color("[bold][yellow]Could not cache modules : %v\n"), err)
+		}
+	}
+}
 
-	tsCtx := &terraspec.Context{TerraformVersion: tfversion.SemVer, UserVersion: newSemVer}
-
-	log.SetFlags(0)
+// execGenerate prints the spec generated from the JSON plan found in planFile
+func execGenerate(planFile, stateFile string, resources []string, pluginDirs []string) {
+	if (planFile == "") == (stateFile == "") {
+		log.Fatal("Either --from-plan or --from-state is required")
+	}
+	if stateFile != "" {
+		execGenerateFromState(stateFile, resources, pluginDirs)
+		return
+	}
+	planJSON, err := ioutil.ReadFile(planFile)
+	if err != nil {
+		log.Fatalf("Could not read plan file %s : %v", planFile, err)
+	}
+	spec, err := terraspec.GenerateSpec(planJSON)
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Stdout.Write(spec)
+}
 
-	testCases := findCases(specDir)
-	if len(testCases) == 0 {
-		log.Fatalf("No test case found in %s directory\n", specDir)
+// execGenerateFromState prints a spec asserting the current attributes of the given resources of the state file.
+// The schemas of the providers of the config in the current directory tell which attributes are computed, when they can be loaded
+func execGenerateFromState(stateFile string, resources []string, pluginDirs []string) {
+	stateJSON, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		log.Fatalf("Could not read state file %s : %v", stateFile, err)
+	}
+	schemas, diags := terraspec.LoadSchemas(context.Background(), ".", pluginDirs)
+	goplugin.CleanupClients()
+	if diags.HasErrors() {
+		// the spec is printed on stdout
+		fmt.Fprintf(os.Stderr, "Could not load the provider schemas, computed attributes other than id are asserted : %v\n", diags.Err())
+		schemas = nil
+	}
+	spec, err := terraspec.GenerateSpecFromState(stateJSON, resources, schemas)
+	if err != nil {
+		log.Fatal(err)
 	}
+	os.Stdout.Write(spec)
+}
 
-	reports := make(chan *testReport)
+// execServe answers JSON-RPC requests on stdio until stdin is closed or the process is interrupted
+func execServe() {
+	ctx, cancel := runContext(0)
+	defer cancel()
+	if err := server.ServeStdio(ctx); err != nil {
+		log.Fatal(err)
+	}
+	goplugin.CleanupClients()
+}
 
-	// Start measuring execution time of test suites
-	var startTime = time.Now()
-	var wg sync.WaitGroup
-	for _, tc := range testCases {
-		wg.Add(1)
-		go func(tc *testCase) {
-			runTestCase(tc, tsCtx, displayPlan, reports)
-			wg.Done()
-		}(tc)
+// execLsp runs the language server on stdio until the client exits
+func execLsp(pluginDirs []string) {
+	ctx, cancel := runContext(0)
+	defer cancel()
+	if err := lsp.NewServer(ctx, pluginDirs).Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
 	}
+	goplugin.CleanupClients()
+}
 
-	var duration time.Duration
-	go func() {
-		wg.Wait()
-		close(reports)
-		// End measuring execution time of test suites onces they all finished
-		duration = time.Since(startTime)
-	}()
+// execSchema prints the metadata of the resource types of the config found in the current directory
+func execSchema(pluginDirs []string) {
+	cfg, diags := terraspec.LoadConfig(".")
+	if diags.HasErrors() {
+		format.Diagnostics(os.Stdout, diags, cliFormat())
+		os.Exit(1)
+	}
+	schemas, diags := terraspec.LoadSchemas(context.Background(), ".", pluginDirs)
+	goplugin.CleanupClients()
+	if diags.HasErrors() {
+		format.Diagnostics(os.Stdout, diags, cliFormat())
+		os.Exit(1)
+	}
 
-	var success, errors = 0, 0
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(terraspec.SchemaMetadata(cfg, schemas)); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	exitCode := 0
-	for r := range reports {
-		fmt.Printf("🏷  %s\n", r.name)
-		if r.report.HasErrors() {
-			errors++
-			exitCode = 1
-		} else {
-			success++
+// execHistory prints the trend of every test case recorded in the history file
+func execHistory(file string) {
+	records, err := terraspec.ReadHistory(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("📈 %d runs recorded\n\n", len(records))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TEST CASE\tRUNS\tFAILURES\tFLAKY\tAVERAGE\tLAST\tTREND")
+	for _, trend := range terraspec.Trends(records) {
+		flaky := ""
+		if trend.Flaky() {
+			flaky = fmt.Sprintf("yes (%d flips)", trend.Flips)
 		}
-		if displayPlan {
-			fmt.Println(r.plan)
+		var change float64
+		if trend.AverageDuration > 0 {
+			change = float64(trend.LastDuration-trend.AverageDuration) / float64(trend.AverageDuration) * 100
 		}
-		printDiags(r.report)
-	}
-	fmt.Printf("\n🏁 %d suites run in %s \terror : %d \tsuccess : %d\n", len(testCases), duration.String(), errors, success)
-	if tfversion.SemVer != tsCtx.TerraformVersion {
-		colorstring.Printf("[bold][yellow]Terraform version %s substitued with provided one %s\n", tsCtx.TerraformVersion.String(), tsCtx.UserVersion.String())
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%+.0f%%\n", trend.Name, trend.Runs, trend.Failures, flaky,
+			trend.AverageDuration.Round(time.Millisecond), trend.LastDuration.Round(time.Millisecond), change)
 	}
-
-	return exitCode
+	w.Flush()
 }
 
-func runTestCase(tc *testCase, tsCtx *terraspec.Context, displayPlan bool, results chan<- *testReport) {
-	// Disable terraform verbose logging except if TF_LOG is set
-	logging.SetOutput()
-	var planOutput string
-
-	tfCtx, spec, ctxDiags := PrepareTestSuite(".", tc, tsCtx)
-	if fatalReport(tc.name(), ctxDiags, planOutput, results) {
-		return
+// execDiffPlans prints the resources planned differently by the JSON plans found in fileA and fileB, and exits with 1 when they differ
+func execDiffPlans(fileA, fileB string) {
+	planA, err := ioutil.ReadFile(fileA)
+	if err != nil {
+		log.Fatalf("Could not read plan file %s : %v", fileA, err)
 	}
-	//Refresh is required to have datasources read
-	_, ctxDiags = tfCtx.Refresh()
-	ctxDiags = ctxDiags.Append(spec.ValidateMocks())
-	if fatalReport(tc.name(), ctxDiags, planOutput, results) {
-		return
+	planB, err := ioutil.ReadFile(fileB)
+	if err != nil {
+		log.Fatalf("Could not read plan file %s : %v", fileB, err)
 	}
-
-	// Finally, compute the terraform plan
-	plan, planDiags := tfCtx.Plan()
-	ctxDiags = ctxDiags.Append(planDiags)
-	if fatalReport(tc.name(), ctxDiags, planOutput, results) {
+	diff, err := terraspec.DiffPlans(planA, planB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if diff.Empty() {
+		fmt.Println("Both plans plan the same changes")
 		return
 	}
+	format.PlanDiff(os.Stdout, diff, cliFormat())
+	os.Exit(1)
+}
 
-	log.SetOutput(os.Stderr)
-	var stdout = &strings.Builder{}
+// execCheckPlan checks every spec file against the JSON plan planFile, with the types implied by the planned values.
+// It exits with an error when any fails
+func execCheckPlan(planFile string, specFiles []string) {
+	planJSON, err := ioutil.ReadFile(planFile)
+	if err != nil {
+		log.Fatalf("Could not read plan file %s : %v", planFile, err)
+	}
+	ctx, cancel := runContext(*timeout)
+	defer cancel()
 
-	if displayPlan {
-		ui := &cli.BasicUi{
-			Reader:      os.Stdin,
-			Writer:      stdout,
-			ErrorWriter: stdout,
+	var failed int
+	for _, specFile := range specFiles {
+		r, err := terraspec.CheckPlanJSON(ctx, specFile, planJSON)
+		if err != nil {
+			log.Fatal(err)
+		}
+		format.CaseResult(os.Stdout, r, cliFormat())
+		if r.Failed() {
+			failed++
 		}
-		local.RenderPlan(plan, nil, nil, tfCtx.Schemas(), ui, &colorstring.Colorize{Colors: colorstring.DefaultColors})
-		planOutput = stdout.String()
 	}
-	logging.SetOutput()
+	if failed > 0 {
+		fmt.Printf(colors().Color("\n[red]%d of %d spec files failed\n"), failed, len(specFiles))
+		os.Exit(1)
+	}
+	fmt.Printf(colors().Color("\n[green]%d spec files passed\n"), len(specFiles))
+}
 
-	validateDiags, err := spec.Validate(plan)
-	ctxDiags = ctxDiags.Append(validateDiags)
+// execMigrate rewrites in place the .tfspec files found in specDir and its subfolders that are written in an older version of the spec language
+func execMigrate(specDir string) {
+	var failed bool
+	err := filepath.Walk(specDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".tfspec" {
+			return err
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		migrated, diags := terraspec.MigrateSpec(src, path)
+		if diags.HasErrors() {
+			format.Diagnostics(os.Stdout, tfdiags.Diagnostics(nil).Append(diags), cliFormat())
+			failed = true
+			return nil
+		}
+		if bytes.Equal(src, migrated) {
+			return nil
+		}
+		if err := ioutil.WriteFile(path, migrated, info.Mode()); err != nil {
+			return err
+		}
+		fmt.Printf("Migrated %s to version %d\n", path, terraspec.SpecVersion)
+		return nil
+	})
 	if err != nil {
-		ctxDiags = ctxDiags.Append(err)
+		log.Fatal(err)
+	}
+	if failed {
+		os.Exit(1)
 	}
-	results <- &testReport{name: tc.name(), report: ctxDiags, plan: planOutput}
 }
 
-// PrepareTestSuite builds the terraform.Context that can compute the plan in given dir
-// and parses the spec file containing all assertions. Returned diagnostics may contain errors
-func PrepareTestSuite(dir string, tc *testCase, tsCtx *terraspec.Context) (*terraform.Context, *terraspec.Spec, tfdiags.Diagnostics) {
-	var ctxDiags tfdiags.Diagnostics
+// execLint prints the anti-patterns of the spec files of specDir, after fixing the ones it can when fix is set.
+// It exits with an error when any remains
+func execLint(specDir string, fix bool, pluginDirs []string) {
+	schemas, diags := terraspec.LoadSchemas(context.Background(), ".", pluginDirs)
+	goplugin.CleanupClients()
+	if diags.HasErrors() {
+		format.Diagnostics(os.Stdout, diags, cliFormat())
+		os.Exit(1)
+	}
 
-	absDir, err := filepath.Abs(dir)
+	var found bool
+	err := filepath.Walk(specDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".tfspec" {
+			return err
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if fix {
+			fixed, diags := terraspec.FixSpec(src, path)
+			if !diags.HasErrors() && !bytes.Equal(src, fixed) {
+				if err := ioutil.WriteFile(path, fixed, info.Mode()); err != nil {
+					return err
+				}
+				fmt.Printf("Fixed %s\n", path)
+				src = fixed
+			}
+		}
+		if diags := terraspec.LintSpec(src, path, schemas); len(diags) > 0 {
+			format.Diagnostics(os.Stdout, tfdiags.Diagnostics(nil).Append(diags), cliFormat())
+			found = true
+		}
+		return nil
+	})
 	if err != nil {
-		ctxDiags = ctxDiags.Append(err)
-		return nil, nil, ctxDiags
+		log.Fatal(err)
+	}
+	if found {
+		os.Exit(1)
+	}
+}
 
+// displayPlanArgs gives a value to the --display-plan flags without one, so --display-plan still works as a boolean flag
+// now that it also takes the on-failure value
+func displayPlanArgs(args []string) []string {
+	normalized := make([]string, len(args))
+	for i, arg := range args {
+		switch arg {
+		case "--display-plan":
+			arg = "--display-plan=true"
+		case "--no-display-plan":
+			arg = "--display-plan=false"
+		}
+		normalized[i] = arg
 	}
-	providerResolver, err := terraspec.BuildProviderResolver(absDir)
-	if err != nil {
-		ctxDiags = ctxDiags.Append(err)
-		return nil, nil, ctxDiags
+	return normalized
+}
+
+// moduleVersionArgs turns the --version flags given after the test-module command into --module-version,
+// as --version prints the version of terraspec
+func moduleVersionArgs(args []string) []string {
+	normalized := make([]string, len(args))
+	var testModule bool
+	for i, arg := range args {
+		switch {
+		case arg == testModCmd.FullCommand():
+			testModule = true
+		case testModule && arg == "--version":
+			arg = "--module-version"
+		case testModule && strings.HasPrefix(arg, "--version="):
+			arg = "--module-version=" + strings.TrimPrefix(arg, "--version=")
+		}
+		normalized[i] = arg
 	}
+	return normalized
+}
 
-	// first we create a context to retrieve schemas for the providers, we need them to parse the spec file
-	tfCtxSchemas, diags := terraspec.NewContext(dir, tc.variableFile, providerResolver, tsCtx, "default") 
-	ctxDiags = ctxDiags.Append(diags)
-	if ctxDiags.HasErrors() {
-		return nil, nil, ctxDiags
+// suiteOptions returns the options of a test suite run set by the command line flags
+func suiteOptions(specDir string, displayPlan string, tfVersion string, moduleMode bool, pluginDirs []string) terraspec.Options {
+	opts := terraspec.Options{
+		SpecDir:              specDir,
+		DisplayPlan:          displayPlan == "true",
+		DisplayPlanOnFailure: displayPlan == "on-failure",
+		ClaimVersion:         tfVersion,
+		ModuleMode:           moduleMode,
+		PluginDirs:           pluginDirs,
+	}
+	opts.SchemaCacheDir = *schemaCache
+	opts.Isolate = *isolate
+	opts.WarmUp = *warmUp
+	opts.KeepArtifacts = *keepArtifact
+	opts.ArtifactsDir = *artifactsDir
+	opts.Parallelism = *parallelism
+	opts.MemoryPerCase = int64(*memPerCase)
+	opts.Skip = *skipCases
+	opts.ShowSensitive = *showSecrets
+	opts.Strict = *strict
+	opts.TflintBin = *tflintBin
+	opts.CheckovBin = *checkovBin
+	opts.PlanFile = *planFile
+	opts.SpecSource = *specSource
+	opts.DockerImage = *inDocker
+	opts.DockerBin = *dockerBin
+	if *manifest != "" {
+		opts.Discovery = terraspec.ManifestDiscovery{File: *manifest}
 	}
+	return opts
+}
 
-	// Parse specs may return mocked data source result
-	spec, diags := terraspec.ReadSpec(tc.specFile, tfCtxSchemas.Schemas())
-	ctxDiags = ctxDiags.Append(diags)
-	if ctxDiags.HasErrors() {
-		return nil, nil, ctxDiags
+// execBench runs the test suite the given number of times and prints the statistics of every test case and phase.
+// The statistics are compared to the baseline file when given, and exit code is 1 when a phase got slower than threshold.
+// They're stored in the save file when given
+func execBench(ctx context.Context, runs int, baseline, save string, threshold float64) int {
+	log.SetFlags(0)
+	if runs < 1 {
+		log.Fatal("At least one run is required")
 	}
+	opts := suiteOptions(*specDir, "false", *tfVersion, *moduleMode, *pluginDirs)
 
-	// this is the actual tf context we use for testing
-	tfCtx, diags := terraspec.NewContext(dir, tc.variableFile, providerResolver, tsCtx, spec.Terraspec.Workspace) // Setting a different folder works to parse configuration but not the modules :/
-	ctxDiags = ctxDiags.Append(diags)
-	if ctxDiags.HasErrors() {
-		return nil, nil, ctxDiags
+	var all []*terraspec.Results
+	failed := false
+	for i := 1; i <= runs; i++ {
+		fmt.Printf("⏱  Run %d/%d\n", i, runs)
+		results, err := terraspec.RunSuite(ctx, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		failed = failed || results.Failed()
+		all = append(all, results)
+	}
+	if failed {
+		fmt.Println(colors().Color("[bold][yellow]Some test cases failed, their durations may not be representative"))
 	}
 
+	bench := terraspec.NewBench(all)
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TEST CASE\tPHASE\tMEAN\tP50\tP90")
+	for _, c := range bench.Cases {
+		name := c.Name
+		for _, phase := range terraspec.BenchPhases {
+			stats := c.Phases[phase]
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, phase, stats.Mean.Round(time.Millisecond), stats.P50.Round(time.Millisecond), stats.P90.Round(time.Millisecond))
+			name = ""
+		}
+	}
+	w.Flush()
 
-	//If spec contains mocked data source results, they must be provided to the DataSourceReader
-	if len(spec.Mocks) > 0 {
-		providerResolver.DataSourceReader.SetMock(spec.Mocks)
+	if save != "" {
+		if err := terraspec.WriteBench(save, bench); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("\nBaseline saved in %s\n", save)
+	}
+	if baseline == "" {
+		return 0
+	}
+	previous, err := terraspec.ReadBench(baseline)
+	if err != nil {
+		log.Fatal(err)
 	}
-	spec.DataSourceReader = providerResolver.DataSourceReader
-	return tfCtx, spec, ctxDiags
+	regressions := bench.Compare(previous, threshold)
+	if len(regressions) == 0 {
+		fmt.Printf(colors().Color("\n[green]No regression compared to %s\n"), baseline)
+		return 0
+	}
+	fmt.Printf("\n%d regressions compared to %s :\n", len(regressions), baseline)
+	for _, r := range regressions {
+		fmt.Printf(colors().Color(" ❌  [bold]%s %s[reset] : %s -> %s [red](%+.0f%%)\n"), r.Case, r.Phase, r.Baseline.Round(time.Millisecond), r.Current.Round(time.Millisecond), r.Ratio()*100)
+	}
+	return 1
+}
+
+// execTerraspec runs the test suite, prints the result of every test case, reports the results and returns them
+func execTerraspec(ctx context.Context, specDir string, displayPlan string, tfVersion string, moduleMode bool, pluginDirs []string) *terraspec.Results {
+	results := runSuite(ctx, suiteOptions(specDir, displayPlan, tfVersion, moduleMode, pluginDirs))
+	reportResults(results)
+	return results
 }
 
-func findCases(rootDir string) []*testCase {
-	testCases := make([]*testCase, 0)
+// runSuite runs the test suite described by opts and prints the result of every test case as it completes
+func runSuite(ctx context.Context, opts terraspec.Options) *terraspec.Results {
+	log.SetFlags(0)
 
-	rootFis, err := ioutil.ReadDir(rootDir)
+	opts.OnCaseResult = func(r *terraspec.CaseResult) {
+		if *atlantis || *changedOnly && !r.Failed() {
+			return
+		}
+		// the report of a test case is written at once, so it's never interleaved with the logs of the test cases still running
+		var out bytes.Buffer
+		format.CaseResult(&out, r, cliFormat())
+		if *timings && r.Timings != nil {
+			format.Timings(&out, r.Timings, cliFormat())
+		}
+		if *coverage && r.Coverage != nil {
+			format.Coverage(&out, r.Coverage, cliFormat())
+		}
+		if r.MemStats != nil {
+			format.MemStats(&out, r.MemStats, cliFormat())
+		}
+		os.Stdout.Write(out.Bytes())
+	}
+	opts.ChangedSince = *changedSince
+	opts.ChangedOnly = *changedOnly
+	opts.CacheDir = *resultCache
+	opts.MemStats = *memStats
+	opts.MinCoverage = *minCoverage / 100
+	// plans are only printed as test cases complete
+	opts.ReleasePlans = true
+	results, err := terraspec.RunSuite(ctx, opts)
 	if err != nil {
-		return nil
+		log.Fatal(err)
 	}
+	return results
+}
 
-	for _, rootFi := range rootFis {
-		if !rootFi.IsDir() {
-			continue
+// reportResults prints the summary of the results, writes the reports asked by the flags, and sends the notifications and traces of the run
+func reportResults(results *terraspec.Results) {
+	metrics := func(w io.Writer, r *terraspec.Results) error { return format.Metrics(w, r, time.Now()) }
+	if *metricsFile != "" {
+		writeReport(*metricsFile, results, metrics)
+	}
+	if *pushGateway != "" {
+		if err := pushMetrics(*pushGateway, results, metrics); err != nil {
+			fmt.Printf(colors().Color("[yellow]Could not push the metrics : %v\n"), err)
+		}
+	}
+	if *badgeFile != "" {
+		writeReport(*badgeFile, results, format.Badge)
+	}
+	if *ciMode == "gitlab" {
+		writeReport(filepath.Join(*ciDir, "terraspec-junit.xml"), results, format.JUnit)
+		writeReport(filepath.Join(*ciDir, "gl-code-quality-report.json"), results, format.CodeQuality)
+	}
+	if *historyFile != "" {
+		if err := terraspec.AppendHistory(*historyFile, terraspec.NewRunRecord(results, time.Now())); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *atlantis {
+		format.Atlantis(os.Stdout, results)
+		notify(results)
+		exportTraces(results)
+		return
+	}
+	if *changedSince != "" && len(results.Cases) == 0 {
+		fmt.Printf("No test case affected by the changes since %s\n", *changedSince)
+		return
+	}
+	success, errors := results.Count()
+	if *changedOnly {
+		if len(results.Cases) == 0 {
+			fmt.Println("No test case affected by the staged changes")
+		} else {
+			fmt.Printf("🏁 %d test cases affected by the staged changes run in %s \terror : %d \tsuccess : %d\n", len(results.Cases), results.Duration.Round(time.Millisecond), errors, success)
+		}
+		return
+	}
+	fmt.Printf("\n🏁 %d suites run in %s \terror : %d \tsuccess : %d", len(results.Cases), results.Duration.String(), errors, success)
+	evaluated, skipped := results.AssertionCount()
+	fmt.Printf(" \tassertions : %d", evaluated)
+	if skipped > 0 {
+		fmt.Printf(" \tskipped blocks : %d", skipped)
+	}
+	if *resultCache != "" {
+		fmt.Printf(" \tcached : %d", results.CachedCount())
+	}
+	if skipped := results.SkippedCount(); skipped > 0 {
+		fmt.Printf(" \tskipped : %d", skipped)
+	}
+	fmt.Println()
+	if *timings {
+		format.Timings(os.Stdout, results.Timings(), cliFormat())
+		if results.WarmUp > 0 {
+			fmt.Printf(colors().Color("[dim]warm-up %s\n"), results.WarmUp.Round(time.Millisecond))
+		}
+	}
+	if *coverage {
+		if uncovered := results.UncoveredResources(); len(uncovered) > 0 {
+			fmt.Printf("%d planned resources are not asserted by any test case :\n", len(uncovered))
+			for _, addr := range uncovered {
+				fmt.Printf(colors().Color("[yellow]    %s\n"), addr)
+			}
+		} else {
+			fmt.Println(colors().Color("[green]Every planned resource is asserted by a test case"))
+		}
+	}
+	for _, s := range results.CoverageShortfalls {
+		scope := "all modules"
+		if s.Module != "" {
+			scope = "module " + s.Module
 		}
-		if testCase := findCase(filepath.Join(rootDir, rootFi.Name())); testCase != nil {
-			testCases = append(testCases, testCase)
+		fmt.Printf(colors().Color(" ❌  [bold]%s[reset] : [red]%.0f%% of resources and %.0f%% of attributes asserted, below the minimum of %.0f%%\n"), scope, s.ResourceRatio*100, s.AttributeRatio*100, *minCoverage)
+	}
+	if m := results.MemStats(); m != nil {
+		format.MemStats(os.Stdout, m, cliFormat())
+	}
+	if results.ClaimedVersion != nil {
+		fmt.Printf(colors().Color("[bold][yellow]Terraform version %s substitued with provided one %s\n"), tfversion.String(), results.ClaimedVersion.String())
+	}
+	notify(results)
+	exportTraces(results)
+}
+
+// exportTraces exports the run as traces to the OpenTelemetry endpoint set in the environment, if any
+func exportTraces(results *terraspec.Results) {
+	if exporter := terraspec.TraceExporterFromEnv(); exporter != nil {
+		if err := exporter.Export(context.Background(), results); err != nil {
+			fmt.Printf(colors().Color("[yellow]Could not export the traces : %v\n"), err)
 		}
 	}
-	if testCase := findCase(rootDir); testCase != nil {
-		testCases = append(testCases, testCase)
+}
+
+// notify posts the summary of the run to the webhooks of the project config, when it exists.
+// A notification that can't be sent is reported without failing the run. Runs stopped by --timeout are notified as well
+func notify(results *terraspec.Results) {
+	if _, err := os.Stat(*projectFile); os.IsNotExist(err) && *projectFile == terraspec.DefaultProjectFile {
+		return
+	}
+	project, diags := terraspec.ReadProjectConfig(*projectFile)
+	if diags.HasErrors() {
+		format.Diagnostics(os.Stdout, tfdiags.Diagnostics(nil).Append(diags), cliFormat())
+		return
+	}
+	for _, notifier := range project.Notifiers {
+		if err := notifier.Notify(context.Background(), results); err != nil {
+			fmt.Printf(colors().Color("[yellow]%v\n"), err)
+		}
 	}
-	return testCases
 }
 
-func findCase(rootDir string) *testCase {
-	fis, err := ioutil.ReadDir(rootDir)
+// writeReport writes the report of the results rendered by render to file. The file is replaced at once,
+// so the tools watching it, like the textfile collector, never read a partial report
+func writeReport(file string, results *terraspec.Results, render func(io.Writer, *terraspec.Results) error) {
+	var out bytes.Buffer
+	if err := render(&out, results); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file+".tmp", out.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Rename(file+".tmp", file); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// pushMetrics replaces the metrics of the terraspec job of the Pushgateway with the metrics of the results rendered by render
+func pushMetrics(gateway string, results *terraspec.Results, render func(io.Writer, *terraspec.Results) error) error {
+	var out bytes.Buffer
+	if err := render(&out, results); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(gateway, "/")+"/metrics/job/terraspec", &out)
 	if err != nil {
-		return nil
+		return err
 	}
-	var varFile, specFile string
-	for _, fi := range fis {
-		if fi.IsDir() {
-			continue
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("the Pushgateway answered %s", resp.Status)
+	}
+	return nil
+}
+
+// execTerragrunt renders every terragrunt stack with a spec folder under the current directory and runs its test suite
+// against the generated config, with the inputs of the stack as variables. Exit code is 1 when a stack fails
+func execTerragrunt(ctx context.Context, specDir string, displayPlan string, tfVersion string, moduleMode bool, pluginDirs []string) int {
+	dirs, err := terraspec.FindTerragruntStacks(".", specDir)
+	if err != nil {
+		log.Fatalf("Could not search terragrunt stacks : %v", err)
+	}
+	if len(dirs) == 0 {
+		log.Fatalf("No %s file with a %s folder found", terraspec.TerragruntFile, specDir)
+	}
+
+	exitCode := 0
+	var failed []string
+	// the results of all the stacks are reported at once, as a single run
+	all := &terraspec.Results{}
+	for _, dir := range dirs {
+		fmt.Printf(colors().Color("\n[bold]🏗  Terragrunt stack %s\n"), dir)
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			log.Fatal(err)
 		}
-		if filepath.Ext(fi.Name()) == ".tfvars" {
-			varFile = filepath.Join(rootDir, fi.Name())
+		stack, err := terraspec.RenderTerragruntStack(ctx, abs, *tgBin, *tfBin)
+		if err != nil {
+			fmt.Printf(colors().Color("[red]%v\n"), err)
+			exitCode = 1
+			failed = append(failed, dir)
+			continue
 		}
-		if filepath.Ext(fi.Name()) == ".tfspec" {
-			specFile = filepath.Join(rootDir, fi.Name())
+		opts := suiteOptions(specDir, displayPlan, tfVersion, moduleMode, pluginDirs)
+		opts.Dir = stack.WorkingDir
+		opts.SpecDir = filepath.Join(stack.Dir, specDir)
+		opts.BaseVariableFile = stack.InputsFile
+		results := runSuite(ctx, opts)
+		if results.Failed() {
+			exitCode = 1
+			failed = append(failed, dir)
 		}
+		all.Append(dir, results)
 	}
-	if specFile != "" {
-		return &testCase{dir: rootDir, variableFile: varFile, specFile: specFile}
+	reportResults(all)
+
+	fmt.Printf("\n🏗  %d terragrunt stacks, %d failed\n", len(dirs), len(failed))
+	for _, dir := range failed {
+		fmt.Printf(colors().Color(" ❌  [bold]%s\n"), dir)
 	}
-	return nil
+	return exitCode
 }
 
-func fatalReport(name string, err tfdiags.Diagnostics, plan string, reports chan<- *testReport) bool {
-	if err.HasErrors() {
-		reports <- &testReport{name: name, report: err, plan: plan}
-		return true
+// execTestModule downloads the module of a registry allowed by versionConstraint and runs the specs of specDir against it,
+// through a generated harness as with --module-mode. It returns the exit code of the run
+func execTestModule(ctx context.Context, source, versionConstraint, specDir string, displayPlan string, tfVersion string, pluginDirs []string) int {
+	tmp, err := ioutil.TempDir("", "terraspec-module")
+	if err != nil {
+		log.Fatal(err)
 	}
-	return false
-}
+	defer os.RemoveAll(tmp)
+	module, err := terraspec.FetchRegistryModule(ctx, nil, source, versionConstraint, filepath.Join(tmp, "module"))
+	if err != nil {
+		fmt.Printf(colors().Color("[red]%v\n"), err)
+		return 1
+	}
+	fmt.Printf(colors().Color("[bold]📦 Module %s %s\n"), source, module.Version)
+	// the providers and the modules the module calls are installed in its folder, where the harness finds them
+	initIfNeeded(module.Dir, *tfBin, pluginDirs)
 
-func printDiags(ctxDiags tfdiags.Diagnostics) {
-	for _, diag := range ctxDiags {
-		switch d := diag.(type) {
-		case *terraspec.TerraspecDiagnostic:
-			if diag.Severity() == terraspec.Info {
-				fmt.Print(" ✔  ")
-			} else {
-				fmt.Print(" ❌  ")
-			}
-			if path := tfdiags.GetAttribute(d.Diagnostic); path != nil {
-				colorstring.Printf("[bold]%s ", formatPath(path))
-			}
-			if diag.Severity() == terraspec.Info {
-				colorstring.Printf("= [green]%s\n", diag.Description().Detail)
-			} else {
-				colorstring.Printf(": [red]%s\n", diag.Description().Detail)
+	// the specs are in the current folder, not in the module
+	abs, err := filepath.Abs(specDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := suiteOptions(abs, displayPlan, tfVersion, true, pluginDirs)
+	opts.Dir = module.Dir
+	results := runSuite(ctx, opts)
+	reportResults(results)
+	if results.Failed() {
+		return 1
+	}
+	return 0
+}
 
-			}
+// execVersionMatrix runs the test suite with the terraform binary of every given version, see terraspec.FindTerraform,
+// so every version computes the plans of the test cases. The versions rejected by the version constraints of the config
+// are reported without running the suite. The runs of all the versions are reported at once
+func execVersionMatrix(ctx context.Context, versions []string, specDir string, displayPlan string, moduleMode bool, pluginDirs []string) int {
+	constraintDiags := make([]tfdiags.Diagnostics, len(versions))
+	binErrs := make([]error, len(versions))
+	suiteFailed := make([]bool, len(versions))
+	all := &terraspec.Results{}
+	for i, v := range versions {
+		versions[i] = strings.TrimSpace(v)
+		semVer, err := goversion.NewSemver(versions[i])
+		if err != nil {
+			log.Fatalf("Invalid value for tf-versions flag : %v", err)
+		}
+		constraintDiags[i] = rejectedVersion(terraspec.CheckVersionConstraints(".", semVer))
+		if constraintDiags[i].HasErrors() {
+			continue
+		}
+		fmt.Printf(colors().Color("\n[bold]🔢 Terraform %s\n"), versions[i])
+		bin, err := terraspec.FindTerraform(ctx, versions[i])
+		if err != nil {
+			binErrs[i] = err
+			continue
+		}
+		opts := suiteOptions(specDir, displayPlan, "", moduleMode, pluginDirs)
+		opts.TerraformBin = bin
+		results := runSuite(ctx, opts)
+		suiteFailed[i] = results.Failed()
+		all.Append(versions[i], results)
+	}
+	reportResults(all)
 
+	exitCode := 0
+	fmt.Printf("\n📊 Terraform version matrix\n")
+	for i, v := range versions {
+		switch {
+		case constraintDiags[i].HasErrors():
+			exitCode = 1
+			fmt.Printf(colors().Color(" ❌  [bold]%s : [red]version constraints not satisfied\n"), v)
+			format.Diagnostics(os.Stdout, constraintDiags[i], cliFormat())
+		case binErrs[i] != nil:
+			exitCode = 1
+			fmt.Printf(colors().Color(" ❌  [bold]%s : [red]%v\n"), v, binErrs[i])
+		case suiteFailed[i]:
+			exitCode = 1
+			fmt.Printf(colors().Color(" ❌  [bold]%s : [red]test suite failed\n"), v)
 		default:
-			if subj := diag.Source().Subject; subj != nil {
-				colorstring.Printf("[bold]%s#%d,%d : ", subj.Filename, subj.Start.Line, subj.Start.Column)
-			}
-
-			if diag.Description().Summary != "" {
-				colorstring.Printf("[red]%s : ", diag.Description().Summary)
-			}
-			colorstring.Printf("[red]%s\n", diag.Description().Detail)
-
+			fmt.Printf(colors().Color(" ✔  [bold]%s : [green]test suite passed\n"), v)
 		}
 	}
+	return exitCode
 }
 
-func formatPath(path cty.Path) string {
-	sb := strings.Builder{}
-	for i, pa := range path {
-		switch p := pa.(type) {
-		case cty.GetAttrStep:
-			if i > 0 {
-				sb.WriteRune('.')
-			}
-			sb.WriteString(p.Name)
-		case cty.IndexStep:
-			sb.WriteRune('[')
-			val, _ := p.Key.AsBigFloat().Int64()
-			sb.WriteString(strconv.Itoa(int(val)))
-			sb.WriteRune(']')
+// rejectedVersion keeps the errors of the version constraints rejecting the version. The config may use features the embedded terraform
+// can't parse, their errors are left to the terraform binary of the version
+func rejectedVersion(diags tfdiags.Diagnostics) tfdiags.Diagnostics {
+	var rejected tfdiags.Diagnostics
+	for _, diag := range diags {
+		if diag.Severity() == tfdiags.Error && diag.Description().Summary == "Unsupported Terraform Core version" {
+			rejected = rejected.Append(diag)
 		}
 	}
-	return sb.String()
-}
\ No newline at end of file
+	return rejected
+}